@@ -0,0 +1,165 @@
+package excelutil
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/360EntSecGroup-Skylar/excelize"
+)
+
+// Main runs the subcommand that is named by the first command line argument; all subcommands except 'process' are the
+// same in procexcel and procexcelratios, so the programs only pass the function that runs their 'process' subcommand
+func Main(process func(args []string)) {
+	// for backwards compatibility, flags without a subcommand are passed to 'process'
+	if len(os.Args) < 2 || strings.HasPrefix(os.Args[1], "-") {
+		process(os.Args[1:])
+		return
+	}
+	var err error
+	switch os.Args[1] {
+	case "process":
+		process(os.Args[2:])
+	case "inspect":
+		err = Inspect(os.Stdout, os.Args[2:])
+	case "merge":
+		err = Merge(os.Stdout, os.Args[2:])
+	case "compare":
+		var n int
+		n, err = Compare(os.Stdout, os.Args[2:])
+		if err == nil && n > 0 {
+			os.Exit(1)
+		}
+	case "list-sheets":
+		err = ListSheets(os.Stdout, os.Args[2:])
+	default:
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// usage prints the available subcommands
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: %s <subcommand> [flags]\n\n", os.Args[0])
+	fmt.Fprintln(os.Stderr, "subcommands:")
+	fmt.Fprintln(os.Stderr, "\tprocess\tprocess an Excel workbook (default if no subcommand is given)")
+	fmt.Fprintln(os.Stderr, "\tinspect\tprint the layout of every sheet of an Excel workbook")
+	fmt.Fprintln(os.Stderr, "\tmerge\tcopy the sheets of several Excel workbooks into a single one")
+	fmt.Fprintln(os.Stderr, "\tcompare\treport the cells that differ between two Excel workbooks")
+	fmt.Fprintln(os.Stderr, "\tlist-sheets\tlist the sheet names of an Excel workbook")
+	fmt.Fprintln(os.Stderr, "\nrun '<subcommand> --help' to see the flags of a subcommand")
+}
+
+// ListSheets runs the 'list-sheets' subcommand with args and writes the names of all sheets of a workbook to w
+func ListSheets(w io.Writer, args []string) error {
+	cmd := flag.NewFlagSet("list-sheets", flag.ExitOnError)
+	name := cmd.String("file_path", "", "specify the path to the Excel (.xlsx) file whose sheets you want to list")
+	cmd.Parse(args)
+	if *name == "" {
+		return errors.New("provide a correct file path (see list-sheets --help)")
+	}
+	wb := &ExcelWorkbook{}
+	wb.Open(*name)
+	wb.GetSheetNames()
+	for _, sheet := range wb.SheetNames {
+		fmt.Fprintln(w, sheet)
+	}
+	return nil
+}
+
+// Inspect runs the 'inspect' subcommand with args and writes the dimensions, the start row, and the detected background
+// columns of every sheet of a workbook to w
+func Inspect(w io.Writer, args []string) error {
+	cmd := flag.NewFlagSet("inspect", flag.ExitOnError)
+	name := cmd.String("file_path", "", "specify the path to the Excel (.xlsx) file that you want to inspect")
+	labels := cmd.String("start_labels", "Time (sec)", "specify a comma-separated list of labels in column 1 that mark the start of the data matrix (the first match is used)")
+	cmd.Parse(args)
+	if *name == "" {
+		return errors.New("provide a correct file path (see inspect --help)")
+	}
+	wb := &ExcelWorkbook{}
+	wb.Open(*name)
+	wb.GetSheetNames()
+	for _, sheet := range wb.SheetNames {
+		if len(wb.XLSX.GetRows(sheet)) == 0 {
+			fmt.Fprintf(w, "%s: empty sheet\n", sheet)
+			continue
+		}
+		dims := wb.Dimensions(sheet)
+		id, err := wb.StartRowAny(sheet, ParseLabels(*labels))
+		if err != nil {
+			fmt.Fprintf(w, "%s: [rows columns] - %v, %s\n", sheet, dims, err)
+			continue
+		}
+		header := wb.XLSX.GetRows(sheet)[id]
+		fmt.Fprintf(w, "%s: [rows columns] - %v, start row - %d, background columns - %d\n",
+			sheet, dims, id, DetectBackgroundColumns(header))
+	}
+	return nil
+}
+
+// Merge runs the 'merge' subcommand with args, i.e. it copies all sheets of the workbooks that are passed as arguments
+// into a single workbook and writes its progress to w
+func Merge(w io.Writer, args []string) error {
+	cmd := flag.NewFlagSet("merge", flag.ExitOnError)
+	output := cmd.String("output", "merged.xlsx", "specify the path of the merged Excel (.xlsx) file\nall sheets of the Excel files that are passed as arguments are copied to this file")
+	cmd.Parse(args)
+	if cmd.NArg() == 0 {
+		return errors.New("provide at least one Excel file to merge (see merge --help)")
+	}
+	// the default sheet of the new workbook is reused for the first merged sheet
+	xlsxMerged := excelize.NewFile()
+	first := true
+	for _, name := range cmd.Args() {
+		wb := &ExcelWorkbook{}
+		wb.Open(name)
+		wb.GetSheetNames()
+		for _, sheet := range wb.SheetNames {
+			var copied string
+			if first {
+				copied = ReuseDefaultSheet(xlsxMerged, wb.XLSX, sheet)
+				first = false
+			} else {
+				copied = CopySheet(xlsxMerged, wb.XLSX, sheet)
+			}
+			fmt.Fprintf(w, "copied sheet %s of %s to %s\n", sheet, name, copied)
+		}
+	}
+
+	if err := SaveXLSX(xlsxMerged, *output, DefaultSaveOptions()); err != nil {
+		return fmt.Errorf("error while saving merged file: %s", err)
+	}
+	fmt.Fprintf(w, "wrote merged workbook to file: %s\n", *output)
+	return nil
+}
+
+// Compare runs the 'compare' subcommand with args, i.e. it writes all cells that differ between two workbooks to w and
+// returns their number (the programs exit with status 1 if there are any)
+func Compare(w io.Writer, args []string) (int, error) {
+	cmd := flag.NewFlagSet("compare", flag.ExitOnError)
+	tolerance := cmd.Float64("tolerance", 1e-9, "specify the maximum absolute difference of two numeric cells that are considered equal")
+	cmd.Parse(args)
+	if cmd.NArg() != 2 {
+		return 0, errors.New("provide exactly two Excel files to compare (see compare --help)")
+	}
+	before, after := &ExcelWorkbook{}, &ExcelWorkbook{}
+	before.Open(cmd.Arg(0))
+	after.Open(cmd.Arg(1))
+	diffs := CompareWorkbooks(before.XLSX, after.XLSX, *tolerance)
+	for _, d := range diffs {
+		fmt.Fprintln(w, d)
+	}
+	if len(diffs) > 0 {
+		fmt.Fprintf(w, "found %d differing cell(s)\n", len(diffs))
+		return len(diffs), nil
+	}
+	fmt.Fprintln(w, "workbooks are identical")
+	return 0, nil
+}
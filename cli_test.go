@@ -0,0 +1,92 @@
+package excelutil
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/360EntSecGroup-Skylar/excelize"
+)
+
+// writeWorkbook saves a workbook with a 'Plate1' sheet whose first row is the start label row of a single well and
+// returns its path; edit can change the sheet before it is saved
+func writeWorkbook(t *testing.T, dir, name string, edit func(f *excelize.File)) string {
+	f := excelize.NewFile()
+	f.SetSheetName("Sheet1", "Plate1")
+	for c, v := range []string{"Time (sec)", "Well1 340", "Well1 380", "skip", "bg340", "bg380"} {
+		f.SetCellValue("Plate1", GetColumn(c+1)+"1", v)
+	}
+	for c := 1; c <= 6; c++ {
+		f.SetCellValue("Plate1", GetColumn(c)+"2", float64(c))
+	}
+	if edit != nil {
+		edit(f)
+	}
+	path := filepath.Join(dir, name)
+	if err := f.SaveAs(path); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSubcommands(t *testing.T) {
+	dir, err := ioutil.TempDir("", "excelutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	a := writeWorkbook(t, dir, "a.xlsx", nil)
+	b := writeWorkbook(t, dir, "b.xlsx", func(f *excelize.File) {
+		f.SetCellValue("Plate1", "B2", 7.0)
+	})
+
+	var out bytes.Buffer
+	if err := ListSheets(&out, []string{"--file_path=" + a}); err != nil || out.String() != "Plate1\n" {
+		t.Errorf("ListSheets = %q, %v; want the sheet Plate1", out.String(), err)
+	}
+
+	out.Reset()
+	if err := Inspect(&out, []string{"--file_path=" + a}); err != nil ||
+		!strings.Contains(out.String(), "Plate1: [rows columns] - [2 6], start row - 0, background columns - 2") {
+		t.Errorf("Inspect = %q, %v", out.String(), err)
+	}
+
+	merged := filepath.Join(dir, "merged.xlsx")
+	out.Reset()
+	if err := Merge(&out, []string{"--output=" + merged, a, b}); err != nil {
+		t.Fatal(err)
+	}
+	f, err := excelize.OpenFile(merged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.GetSheetIndex("Plate1") == 0 || f.GetSheetIndex("Plate1 (2)") == 0 || f.GetCellValue("Plate1 (2)", "B2") != "7" {
+		t.Errorf("merged workbook has sheets %v; want Plate1 of both files", f.GetSheetMap())
+	}
+
+	out.Reset()
+	if n, err := Compare(&out, []string{a, b}); err != nil || n != 1 || !strings.Contains(out.String(), "Plate1!B2: 2 -> 7") {
+		t.Errorf("Compare = %d, %v, %q; want the cell B2", n, err, out.String())
+	}
+	out.Reset()
+	if n, err := Compare(&out, []string{"--tolerance=5", a, b}); err != nil || n != 0 {
+		t.Errorf("Compare with --tolerance=5 = %d, %v; want no differences", n, err)
+	}
+
+	// missing arguments are reported as errors
+	if err := ListSheets(&out, nil); err == nil {
+		t.Error("ListSheets without --file_path = nil; want an error")
+	}
+	if err := Inspect(&out, nil); err == nil {
+		t.Error("Inspect without --file_path = nil; want an error")
+	}
+	if err := Merge(&out, nil); err == nil {
+		t.Error("Merge without files = nil; want an error")
+	}
+	if _, err := Compare(&out, []string{a}); err == nil {
+		t.Error("Compare of a single file = nil; want an error")
+	}
+}
@@ -0,0 +1,700 @@
+// Package excelutil is a command line program that converts an excel workbook with potentially multiple spread sheets
+// of a given format to another format while doing the appropriate maths. It can create graphs and sort the
+// columns of the primary output according to the maximum value per output.
+// author: Daniel Schuette (email: d.schuette@online.de)
+// license: MIT license (see github.com/DanielSchuette)
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/360EntSecGroup-Skylar/excelize"
+	"github.com/DanielSchuette/excelutil"
+)
+
+// define the flags of the process subcommand
+// the other subcommands are the same in both programs and are run by excelutil.Main
+var (
+	processCmd = flag.NewFlagSet("process", flag.ExitOnError)
+
+	// the flags that procexcel and procexcelratios share (see excelutil.Options)
+	opts = excelutil.NewOptions(processCmd)
+
+	// the flags that only procexcel has (or whose meaning differs from the other program)
+	responseThreshold = processCmd.Float64("threshold", 1.2, "optional argument specifying a response threshold (as a floating point number)\nevery column without a value larger than this number is dropped from the sorted data and the remaining columns are saved to a '_data_with_threshold.xlsx' file\nif you don't want this behavior, override it by putting in '0'")
+	sheetTimeout      = processCmd.Duration("sheet_timeout", 0, "specify how long processing a single sheet (from reading it to sorting its values) may take (e.g. '30s' or '2m')\nsheets that take longer are skipped with a warning and their output is discarded, which leaves their sheets in .xlsx outputs empty\nthe limit is not enforced while a stage runs but checked while reading a sheet and after the transform and sort stages, so a slow stage\nruns to its end before its sheet is skipped (defaults to 0, i.e. no limit)")
+	debugDump         = processCmd.String("debug_dump", "", "specify a directory to which the intermediate data of every sheet are written after each stage for troubleshooting,\ne.g. the transformed matrix the sorting was based on; files are named '<sheet>_<stage>.csv' with the stages transform and sort\n(they are not affected by --output_origin, --carry_metadata, or --gzip, defaults to '', i.e. no dump)")
+	columns           = processCmd.String("columns", "", "specify a selection of data columns (e.g. '1,3,5-8') to restrict processing to these columns\ndata columns are numbered starting at 1 with the first column after the time column (defaults to all columns)")
+	normValue         = processCmd.Int("norm_value", 9, "specify which measurement you want to use for column-wise normalization")
+)
+
+func main() {
+	excelutil.Main(process)
+}
+
+// process runs the actual analysis of a workbook
+func process(args []string) {
+	// defer done statement
+	defer excelutil.PrintDelim()
+	defer fmt.Println("done")
+
+	// parse flags and check for errors
+	excelutil.PrintDelim()
+	processCmd.Parse(args)
+	if err := opts.Validate(); err != nil {
+		log.Fatalf("%s\n", err)
+	}
+	if opts.ThresholdReport && *responseThreshold == 0 {
+		log.Fatalf("cannot use --threshold_report without --threshold\n")
+	}
+	originCol, originRow, err := excelutil.ParseCoordinate(opts.OutputOrigin)
+	if err != nil {
+		log.Fatalf("cannot use --output_origin: %s\n", err)
+	}
+	if (originCol != 1 || originRow != 1) && opts.OutputFormat != "xlsx" {
+		log.Fatal("--output_origin is only supported with --output_format=xlsx")
+	}
+	excelutil.Seed(opts.Seed)
+
+	// profile the whole run with --cpuprofile and --memprofile
+	stopProfiles, err := excelutil.StartProfiles(opts.CPUProfile, opts.MemProfile)
+	if err != nil {
+		log.Fatalf("cannot profile the run: %s\n", err)
+	}
+	defer func() {
+		if err := stopProfiles(); err != nil {
+			log.Fatalf("error while writing profiles: %s\n", err)
+		}
+	}()
+	save := opts.SaveOptions() // the settings of all output files (see --compression, --gzip, and --inf)
+	if save.Inf, err = excelutil.ParseInfPolicy(opts.Inf); err != nil {
+		log.Fatalf("cannot use --inf: %s\n", err)
+	}
+	var timeFrom, timeTo float64
+	if opts.TimeRange != "" {
+		var err error
+		if timeFrom, timeTo, err = excelutil.ParseTimeRange(opts.TimeRange); err != nil {
+			log.Fatalf("cannot use --time_range: %s\n", err)
+		}
+	}
+	startLabels := excelutil.ParseLabels(opts.StartLabels)
+	if len(startLabels) == 0 {
+		log.Fatal("provide at least one start label (see process --help)")
+	}
+
+	// start to process data
+	fmt.Printf("opened file: %s\n", opts.FilePath)
+	fmt.Println("starting to process data...")
+
+	// create a new ExcelWorkbook, open file, and get sheet names
+	wb := &excelutil.ExcelWorkbook{}
+	if opts.Wait > 0 && excelutil.ResolveFormat(opts.FilePath, opts.InputFormat) != "tsv" {
+		fmt.Printf("waiting up to %s for %s to be complete\n", opts.Wait, opts.FilePath)
+		if err := excelutil.WaitComplete(opts.FilePath, opts.Wait, time.Second); err != nil {
+			log.Fatalf("%s\n", err)
+		}
+	}
+	wb.Retries, wb.RetryDelay = opts.Retry, opts.RetryDelay
+	wb.OpenAs(opts.FilePath, opts.InputFormat)
+	wb.GetSheetNames()
+	wb.SearchRows = opts.LabelSearchLimit
+	if opts.LimitSheets > 0 && opts.LimitSheets < wb.NumSheets {
+		fmt.Printf("processing only the first %d of %d sheets\n", opts.LimitSheets, wb.NumSheets)
+		wb.SheetNames = wb.SheetNames[:opts.LimitSheets]
+		wb.NumSheets = opts.LimitSheets
+	}
+	outNames, err := excelutil.OutputSheetNames(opts.SheetNameTemplate, wb.SheetNames[:wb.NumSheets])
+	if err != nil {
+		log.Fatalf("cannot use --sheet_name_template: %s\n", err)
+	}
+	// print the files that a run with the current options writes
+	if opts.ListOutputs {
+		sheets := outNames
+		planned := func(name string) string {
+			return excelutil.OutputFilePattern(opts.OutputPrefix, opts.Timestamp, name)
+		}
+		paths := make([]string, 0)
+		for _, name := range []string{"transformed_data", "sorted_transformed_data"} {
+			paths = append(paths, excelutil.OutputPaths(opts.OutputFormat, planned(name), sheets, save.Gzip)...)
+		}
+		if *debugDump != "" {
+			for _, sheet := range sheets {
+				for _, stage := range []string{"transform", "sort"} {
+					paths = append(paths, excelutil.DebugDumpPath(*debugDump, sheet, stage))
+				}
+			}
+		}
+		if opts.ExportOrder {
+			paths = append(paths, excelutil.GzipPath(planned("order.csv"), save.Gzip))
+		}
+		if opts.QualityReport {
+			paths = append(paths, excelutil.GzipPath(planned("quality_report.csv"), save.Gzip))
+		}
+		if *responseThreshold != 0 {
+			paths = append(paths, planned("data_with_threshold.xlsx"))
+		}
+		if opts.ThresholdReport {
+			paths = append(paths, excelutil.GzipPath(planned("threshold_report.json"), save.Gzip))
+		}
+		for _, path := range []string{opts.CPUProfile, opts.MemProfile} {
+			if path != "" {
+				paths = append(paths, path)
+			}
+		}
+		fmt.Println("planned outputs:")
+		excelutil.ListOutputs(os.Stdout, paths)
+		return
+	}
+	if opts.Estimate {
+		// project the outputs from the number of used input cells (the main outputs hold a fixed share of the input columns)
+		wb.PrintEstimate(os.Stdout, opts.OutputFormat, []excelutil.EstimatedOutput{
+			{Name: "transformed_data", Fraction: 1},
+			{Name: "sorted_transformed_data", Fraction: 1},
+		}, save.Gzip)
+		return
+	}
+	if opts.ConsistentLayout {
+		if mismatches := wb.LayoutMismatches(startLabels); len(mismatches) > 0 {
+			log.Fatalf("sheets do not share the layout of sheet %s:\n\t%s\n", wb.SheetNames[0], strings.Join(mismatches, "\n\t"))
+		}
+	}
+
+	// with --template_sheet, the start row is searched once and reused for all sheets with the same layout
+	templateRow := -1
+	if opts.TemplateSheet != "" {
+		if wb.XLSX.GetSheetIndex(opts.TemplateSheet) == 0 {
+			log.Fatalf("cannot use --template_sheet=%s (no such sheet)\n", opts.TemplateSheet)
+		}
+		if templateRow, err = wb.StartRowAny(opts.TemplateSheet, startLabels); err != nil {
+			log.Fatalf("cannot use --template_sheet=%s: %s\n", opts.TemplateSheet, err)
+		}
+		fmt.Printf("using start row %d of template sheet %s\n", templateRow+1, opts.TemplateSheet)
+	}
+
+	// create new excel files to save results to
+	xlsxTransformed := excelize.NewFile()
+	if opts.PreserveFormatting {
+		if err := excelutil.CopyStyles(xlsxTransformed, wb.XLSX); err != nil {
+			log.Fatalf("error while preserving formatting: %s\n", err)
+		}
+	}
+	xlsxThreshold := excelize.NewFile()
+	xlsxSorted := excelize.NewFile()
+
+	// collect the number of columns that survive --threshold in every sheet for the summary
+	keptCounts := make([]excelutil.ThresholdCount, 0)
+
+	// collect the names of all output sheets
+	outSheets := make([]string, 0)
+
+	// get current time to create a unique file name (all outputs of a run share it, even with --incremental)
+	t := time.Now()
+	fileName := func(name string) string {
+		return excelutil.OutputFileName(opts.OutputPrefix, t, opts.Timestamp, name)
+	}
+
+	// collect the output sheets of sheets that exceeded --sheet_timeout
+	timedOut := make([]string, 0)
+
+	// the sorted order of the columns of every sheet (only collected with --export_order)
+	orderRows := [][]string{{"sheet", "rank", "column", "header"}}
+
+	// the counts of unusable cells of every column (only collected with --quality_report); the report is rewritten after
+	// every sheet, so that it exists even if the data of a later sheet cannot be parsed
+	qualityRows := [][]string{excelutil.QualityHeader}
+	qualityFileName := fileName("quality_report.csv")
+	saveQualityReport := func() {
+		if err := excelutil.WriteRecords(qualityFileName, qualityRows, save.Gzip); err != nil {
+			log.Fatalf("error while saving data-quality report: %s\n", err)
+		}
+	}
+
+	// the rows above the start label of every output sheet (only kept with --carry_metadata)
+	metadata := make(map[string][][]string)
+
+	// the raw values of every transformed column of every output sheet (only collected with --emit_raw_pairs)
+	rawPairs := make(map[string][][]float64)
+
+	// applyLayout applies --emit_raw_pairs, --carry_metadata, and --output_origin to the output sheets of the main outputs;
+	// it runs once all sheets were processed and on copies of the main outputs that are saved with --incremental
+	layoutChanged := opts.EmitRawPairs || opts.CarryMetadata || originCol > 1 || originRow > 1
+	applyLayout := func(transformed, sorted *excelize.File) {
+		// put the raw values in front of every transformed column
+		for _, name := range outSheets {
+			if raw, ok := rawPairs[name]; ok {
+				excelutil.InterleaveRaw(transformed, name, raw, save.Inf)
+			}
+		}
+
+		// copy the rows above the start label to the top of the transformed data
+		for _, name := range outSheets {
+			if rows := metadata[name]; len(rows) > 0 {
+				excelutil.PrependRows(transformed, name, rows)
+			}
+		}
+
+		// move the output to --output_origin
+		for _, name := range outSheets {
+			excelutil.ShiftSheet(transformed, name, originCol, originRow)
+			excelutil.ShiftSheet(sorted, name, originCol, originRow)
+		}
+	}
+
+	// finishSheet filters the sorted values of a sheet by --threshold and saves the main outputs with --incremental;
+	// it runs after every sheet, including the sheets without values to sort
+	finishSheet := func(sheet, outSheet string) {
+		// drop columns if not at least one value is > --threshold (this behavior is overriden by --threshold 0)
+		if *responseThreshold != 0 {
+			headers, values := excelutil.SheetData(xlsxSorted.GetRows(outSheet))
+			kept, keptValues := excelutil.FilterColumnsByThreshold(headers, values, *responseThreshold)
+			excelutil.WriteSheetData(xlsxThreshold, outSheet, kept, keptValues, save.Inf)
+			keptCounts = append(keptCounts, excelutil.ThresholdCount{Sheet: sheet, Kept: len(kept), Total: len(headers)})
+		}
+
+		// save the main outputs after every sheet so that they survive a crash of a long run
+		if opts.Incremental && !opts.DryRun {
+			fmt.Printf("saving results of %d sheet(s)\n", len(outSheets))
+			transformed, sorted := xlsxTransformed, xlsxSorted
+			if layoutChanged {
+				// the layout is applied to copies, because the next sheets are still written to the main outputs
+				var err error
+				for _, copied := range []**excelize.File{&transformed, &sorted} {
+					if *copied, err = excelutil.CopyWorkbook(*copied); err != nil {
+						log.Fatalf("error while saving results: %s\n", err)
+					}
+				}
+				applyLayout(transformed, sorted)
+			}
+			if err := excelutil.SaveWorkbook(transformed, outSheets, opts.OutputFormat, fileName("transformed_data"), save); err != nil {
+				log.Fatalf("error while saving transformed data: %s\n", err)
+			}
+			if err := excelutil.SaveWorkbook(sorted, outSheets, opts.OutputFormat, fileName("sorted_transformed_data"), save); err != nil {
+				log.Fatalf("error while saving sorted values: %s\n", err)
+			}
+		}
+	}
+
+	// iterate over spread sheets
+	// the deadline of every sheet is released when the next sheet is started and after the last one
+	cancel := context.CancelFunc(func() {})
+	for i := 0; i < wb.NumSheets; i++ {
+		cancel()
+
+		// the processing of a sheet runs under the deadline of --sheet_timeout, which is checked while reading the sheet and
+		// after every stage; a sheet that exceeds it is skipped and its results are discarded, so that the output files
+		// only hold complete sheets (excelize cannot delete sheets, so its sheets in .xlsx outputs are left empty)
+		ctx := context.Background()
+		if *sheetTimeout > 0 {
+			ctx, cancel = context.WithTimeout(ctx, *sheetTimeout)
+		}
+		timeout := func(err error) bool {
+			if err != context.DeadlineExceeded {
+				return false
+			}
+			fmt.Printf("skipping sheet %s (exceeded --sheet_timeout=%s)\n", wb.SheetNames[i], *sheetTimeout)
+			timedOut = append(timedOut, wb.SheetNames[i])
+			return true
+		}
+		nOut, nQuality := len(outSheets), len(qualityRows)
+		expired := func(outSheet string) bool {
+			if !timeout(ctx.Err()) {
+				return false
+			}
+			outSheets, qualityRows = outSheets[:nOut], qualityRows[:nQuality]
+			for _, f := range []*excelize.File{xlsxTransformed, xlsxThreshold, xlsxSorted} {
+				excelutil.ClearSheet(f, outSheet)
+			}
+			delete(metadata, outSheet)
+			delete(rawPairs, outSheet)
+			return true
+		}
+
+		// print name of current sheet and read its data matrix; sheets without usable data are skipped with a warning
+		fmt.Printf("opened sheet: %s (%d of %d)\n", wb.SheetNames[i], i+1, wb.NumSheets)
+		m, id, err := wb.ReadSheet(ctx, os.Stdout, wb.SheetNames[i], opts, startLabels, templateRow)
+		if timeout(err) || err == excelutil.ErrSkipSheet {
+			continue
+		}
+		if err != nil {
+			log.Fatalf("%s\n", err)
+		}
+
+		// the output sheets are named after the current sheet according to --sheet_name_template
+		outSheet := outNames[i]
+
+		// create a sheet in new workbook with same name to save transformed data
+		fmt.Println("creating new sheet to write data to...")
+		outSheets = append(outSheets, outSheet)
+		_ = xlsxTransformed.NewSheet(outSheet) /* background corrected values */
+		_ = xlsxSorted.NewSheet(outSheet)      /* background corrected, sorted values */
+		_ = xlsxThreshold.NewSheet(outSheet)
+
+		if opts.CarryMetadata {
+			metadata[outSheet] = m[:id]
+		}
+		if opts.QualityReport {
+			quality := excelutil.DataQuality(m[id:])
+			qualityRows = append(qualityRows, quality.Records(outSheet)...)
+			if quality.Total.Empty+quality.Total.NonNumeric+quality.Total.NonFinite > 0 {
+				fmt.Printf("sheet %s has %d empty, %d non-numeric, and %d non-finite cell(s) out of %d\n", wb.SheetNames[i],
+					quality.Total.Empty, quality.Total.NonNumeric, quality.Total.NonFinite, quality.Total.Cells)
+			}
+			saveQualityReport()
+		}
+
+		// parse the column selection and validate it against the number of data columns in the current sheet
+		var selected map[int]bool
+		if *columns != "" {
+			selected, err = excelutil.ParseColumnSelection(*columns, wb.Dims[1]-2)
+			if err != nil {
+				log.Fatalf("error while parsing --columns: %s\n", err)
+			}
+		}
+
+		// restrict processing to the rows within --time_range (the time is in the first column)
+		kFrom, kTo := id+1, wb.Dims[0]
+		if opts.TimeRange != "" {
+			times := make([]float64, 0)
+			for k := id + 1; k < wb.Dims[0]; k++ {
+				t, err := strconv.ParseFloat(m[k][0], 64)
+				if err != nil {
+					t = math.NaN()
+				}
+				times = append(times, t)
+			}
+			first, last, err := excelutil.TimeRows(times, timeFrom, timeTo)
+			if err != nil {
+				log.Fatalf("cannot use --time_range for sheet %s: %s\n", wb.SheetNames[i], err)
+			}
+			kFrom, kTo = id+1+first, id+2+last
+			fmt.Printf("processing rows %d to %d (--time_range=%s)\n", kFrom+1, kTo, opts.TimeRange)
+		}
+
+		// initialize a column counter and a ratio counter
+		colCounter := 1
+
+		// start analysis
+		for j := 1; j < (wb.Dims[1] - 1); j++ { // don't want the first and last background column
+			// set column counter and ratio counter to 1 whenever a new worksheet is processed
+			if j == 1 {
+				colCounter = 1
+			}
+			if selected != nil && !selected[j] {
+				if opts.Verbose {
+					fmt.Printf("skipping unselected column: %d\n", j)
+				}
+				continue
+			}
+
+			// create a column header with the same value as in the original sheet
+			currentCol := fmt.Sprintf("%s1", excelutil.GetColumn(colCounter))
+			xlsxTransformed.SetCellValue(outSheet, currentCol, m[id][j])
+			if opts.PreserveFormatting {
+				srcCell := fmt.Sprintf("%s%d", excelutil.GetColumn(j+1), id+1)
+				excelutil.CopyCellFormat(xlsxTransformed, outSheet, currentCol, wb.XLSX, wb.SheetNames[i], srcCell)
+			}
+
+			// verbose output option lets the user see whenever a new column header is written
+			if opts.Verbose {
+				fmt.Printf("wrote new column header: %v in %s\n", m[id][j], currentCol)
+			}
+			if opts.EmitRawPairs {
+				rawPairs[outSheet] = append(rawPairs[outSheet], make([]float64, 0, (kTo-kFrom)/(opts.Downsample)+1))
+			}
+
+			for k := kFrom; k < kTo; k += opts.Downsample {
+				// get background value and background for baseline value
+				baselineVal, err := strconv.ParseFloat(m[(*normValue + id - 1)][j], 64)
+				if err != nil {
+					log.Fatalf("fatal error converting indices: %s\n", err)
+				}
+				baselineBg, err := strconv.ParseFloat(m[(*normValue + id + 1)][(wb.Dims[1]-1)], 64)
+				if err != nil {
+					log.Fatalf("fatal error converting indices: %s\n", err)
+				}
+
+				// perform background correction of values
+				v1, err := strconv.ParseFloat(m[k][j], 64)
+				if err != nil {
+					log.Fatalf("fatal error converting indices: %s\n", err)
+				}
+				v2, err := strconv.ParseFloat(m[k][(wb.Dims[1]-1)], 64) /* always use last column as background */
+				if err != nil {
+					log.Fatalf("fatal error converting indices: %s\n", err)
+				}
+
+				// write corrected value to cell in new workbook (while always starting at row 2, because row 1 holds the labels)
+				currentCell := fmt.Sprintf("%s%d", excelutil.GetColumn(colCounter), (k-kFrom)/(opts.Downsample)+2)
+				xlsxTransformed.SetCellValue(outSheet, currentCell, save.Inf.CellValue((v1-v2)/(baselineVal-baselineBg)))
+				if opts.Annotate {
+					text := fmt.Sprintf("source=%s!%s%d, bg=%s!%s%d, baseline=%s!%s%d, op=subtract and divide by baseline", wb.SheetNames[i],
+						excelutil.GetColumn(j+1), k+1, wb.SheetNames[i], excelutil.GetColumn(wb.Dims[1]), k+1,
+						wb.SheetNames[i], excelutil.GetColumn(j+1), *normValue+id)
+					if err := excelutil.AnnotateCell(xlsxTransformed, outSheet, currentCell, text); err != nil {
+						log.Fatalf("error while annotating %s: %s\n", currentCell, err)
+					}
+				}
+
+				if opts.EmitRawPairs {
+					last := len(rawPairs[outSheet]) - 1
+					rawPairs[outSheet][last] = append(rawPairs[outSheet][last], v1)
+				}
+
+				// with verbose output, every original and new value will be printed to Stdout
+				if opts.Verbose {
+					fmt.Printf("default - old value: %v, bg: %v, corrected: %v\n", v1, v2, v1-v2)
+				}
+			}
+			// increment column counter and print current column (if verbose output is true)
+			if opts.Verbose {
+				fmt.Printf("current column: %d\n", colCounter)
+			}
+			colCounter++
+		}
+		if expired(outSheet) {
+			continue
+		}
+
+		// print the first rows of the transformed data
+		if opts.Preview > 0 {
+			fmt.Printf("preview of transformed data of %s:\n", wb.SheetNames[i])
+			excelutil.PrintPreview(os.Stdout, xlsxTransformed.GetRows(outSheet), opts.Preview)
+		}
+
+		// done with analysis of one sheet in workbook print summary statistics
+		fmt.Printf("summary:\n\tnumber of processed [rows columns]- %v\n\n", wb.Dims)
+
+		// write the intermediate data of every stage to --debug_dump
+		dump := func(stage string, rows [][]string) {
+			if *debugDump == "" || opts.DryRun {
+				return
+			}
+			headers, values := excelutil.SheetData(rows)
+			if err := excelutil.DebugDump(*debugDump, outSheet, stage, headers, values); err != nil {
+				log.Fatalf("%s\n", err)
+			}
+		}
+		dump("transform", xlsxTransformed.GetRows(outSheet))
+
+		// add two chart to every background corrected data sheet
+		// the only purpose of 'shnm' is to reduce the length of the following assignments; don't use it anywhere else
+		shnm := outSheet
+
+		// ChartSettings1 defines the settings required to add a line graphs for columns 1 - 6
+		ChartSettings1 := fmt.Sprintf("{\"type\":\"line\",\"dimension\":{\"width\":1040,\"height\":640},\"series\":[{\"name\":\"%v!$A$1\",\"values\":\"%v!$A$2:$A$470\"},{\"name\":\"%v!$B$1\",\"values\":\"%v!$B$2:$B$470\"},{\"name\":\"%v!$C$1\",\"values\":\"%v!$C$2:$C$470\"},{\"name\":\"%v!$D$1\",\"values\":\"%v!$D$2:$D$470\"},{\"name\":\"%v!$E$1\",\"values\":\"%v!$E$2:$E$470\"},{\"name\":\"%v!$F$1\",\"values\":\"%v!$F$2:$F$470\"}],\"title\":{\"name\":\"Response Profile\"}}", shnm, shnm, shnm, shnm, shnm, shnm, shnm, shnm, shnm, shnm, shnm, shnm)
+		// ChartSettings2 is similar to ChartSettings1 but specifies settings for columns 7 - 12
+		ChartSettings2 := fmt.Sprintf("{\"type\":\"line\",\"dimension\":{\"width\":1040,\"height\":640},\"series\":[{\"name\":\"%v!$G$1\",\"values\":\"%v!$G$2:$G$470\"},{\"name\":\"%v!$H$1\",\"values\":\"%v!$H$2:$H$470\"},{\"name\":\"%v!$I$1\",\"values\":\"%v!$I$2:$I$470\"},{\"name\":\"%v!$J$1\",\"values\":\"%v!$J$2:$J$470\"},{\"name\":\"%v!$K$1\",\"values\":\"%v!$K$2:$K$470\"},{\"name\":\"%v!$L$1\",\"values\":\"%v!$L$2:$L$470\"}],\"title\":{\"name\":\"Response Profile\"}}", shnm, shnm, shnm, shnm, shnm, shnm, shnm, shnm, shnm, shnm, shnm, shnm)
+		if opts.AddChart {
+			xlsxTransformed.AddChart(outSheet, "A470", ChartSettings1)
+			xlsxTransformed.AddChart(outSheet, "R470", ChartSettings2)
+			if opts.Verbose {
+				fmt.Printf("added chart to sheet %v with settings: %s\n", wb.SheetNames[i], ChartSettings1)
+				fmt.Printf("added chart to sheet %v with settings: %s\n", wb.SheetNames[i], ChartSettings2)
+			}
+		}
+		// look for peaks with the range of --start (sortStart) and --stop (sortEnd) and sort the ratio columns accordingly
+		// use a map to remember the columns that were already copied to the new workbook (xlsxSorted)
+		ratioStrings := xlsxTransformed.GetRows(outSheet)
+
+		// there is nothing to sort if the sheet did not produce a single row of values
+		if len(ratioStrings) < 2 || len(ratioStrings[0]) == 0 {
+			fmt.Printf("skipping sort of sheet %s (no values, e.g. because of --trimmed_output)\n", wb.SheetNames[i])
+			finishSheet(wb.SheetNames[i], outSheet)
+			continue
+		}
+		peaks := make(map[int]float64)
+		ratioToSort := make([][]float64, 0)
+
+		// parse ratioToSort values into an new slice after converting strings to float64s
+		for c := 0; c < len(ratioStrings[0]); c++ {
+			// create new slice and append it to a slice of slices
+			newArr := make([]float64, len(ratioStrings))
+
+			// initialize an independent value counter
+			vc := 0
+
+			// check validity of stop value for search
+			var stop int
+			if opts.Stop <= opts.Start {
+				log.Fatalf("cannot use start: %d, stop: %d for sorting\n", opts.Start, opts.Stop)
+			}
+			if opts.Stop <= len(ratioStrings) {
+				stop = opts.Stop
+			} else {
+				stop = len(ratioStrings)
+			}
+
+			// iterate over rows and add all values that are within the sorting range to the slice
+			for r := opts.Start; r < stop; r++ {
+				val, err := strconv.ParseFloat(ratioStrings[r][c], 64)
+				if err != nil {
+					log.Fatalf("error while converting indices: %s\n", err)
+				}
+				if opts.Verbose {
+					fmt.Printf("writing %v at [%d][%d]\n", val, r, c)
+				}
+				newArr[vc] = val
+				vc++
+			}
+			// append new values to slice
+			ratioToSort = append(ratioToSort, newArr)
+		}
+
+		// iterate over columns of ratioToSort and save to last value of the ordered slice to a map
+		for i := 0; i < len(ratioToSort); i++ {
+			if opts.Verbose {
+				fmt.Printf("sorting column %d\n", i)
+			}
+			sort.Float64s(ratioToSort[i])
+			peaks[i] = ratioToSort[i][len(ratioToSort[0])-1]
+		}
+		if opts.Verbose {
+			fmt.Printf("%+v\n", peaks)
+		}
+		if expired(outSheet) {
+			continue
+		}
+
+		// print ordered values to screen if flag is set to true; make sure to copy peaks, though!
+		tmpMap := make(map[int]float64)
+		for key, val := range peaks {
+			tmpMap[key] = val
+		}
+		if opts.PrintOrder {
+			fmt.Printf("ordered values for %s: ", wb.SheetNames[i])
+			for {
+				if len(tmpMap) == 0 {
+					break
+				}
+				key := excelutil.FindMaxElem(tmpMap)
+				if opts.PrintPrecision < 0 {
+					fmt.Printf("cell %d: %v ", key+1, tmpMap[key])
+				} else {
+					fmt.Printf("cell %d: %.*f ", key+1, opts.PrintPrecision, tmpMap[key])
+				}
+				delete(tmpMap, key)
+			}
+			fmt.Println()
+		}
+
+		// rank the keys by their max value (see SortedPermutation) ==> get every column from ratioToSort ==> write to output
+		// with --sort_order=asc, the keys are ranked by their min value instead
+		perm := excelutil.SortedPermutation(peaks, opts.SortOrder)
+		for ii, key := range perm {
+			// verbose output prints every max map key
+			if opts.Verbose {
+				fmt.Printf("dim1: %d, dim2: %d\n", len(ratioToSort), len(ratioToSort[0]))
+				fmt.Printf("key of next value in this map: %v\n", key)
+			}
+
+			for j := 0; j < len(ratioToSort[0]); j++ {
+				// get current cell and write value
+				cl := fmt.Sprintf("%s%d", excelutil.GetColumn(ii+1), (j + 1)) // need 0 for subsetting but A2 for Excel
+				// write header and continue for j == 0
+				if j == 0 {
+					xlsxSorted.SetCellValue(outSheet, cl, ratioStrings[j][key])
+					continue
+				}
+				if opts.Verbose {
+					fmt.Printf("writing sorted value %v at [%d][%d]\n", ratioStrings[j][key], key, j)
+				}
+				v, err := strconv.ParseFloat(ratioStrings[j][key], 64)
+				if err != nil {
+					log.Fatalf("error while converting string: %s\n", err)
+				}
+				xlsxSorted.SetCellValue(outSheet, cl, save.Inf.CellValue(v))
+			}
+		}
+		if opts.ExportOrder {
+			for rank, key := range perm {
+				orderRows = append(orderRows, []string{outSheet, strconv.Itoa(rank + 1), strconv.Itoa(key + 1), ratioStrings[0][key]})
+			}
+		}
+
+		dump("sort", xlsxSorted.GetRows(outSheet))
+
+		finishSheet(wb.SheetNames[i], outSheet)
+	}
+	cancel()
+	excelutil.PrintDelim()
+
+	// print some more statistics
+	fmt.Printf("summary:\n\tnumber of precessed sheets - %d\n", wb.NumSheets)
+	fmt.Printf("\tcreated charts - %v\n", opts.AddChart)
+	fmt.Printf("\tsorted values in range [lo][hi] - [%d][%d]\n", opts.Start, opts.Stop)
+	fmt.Printf("\tvalues trimmed after %d measurements\n", opts.TrimmedOutput)
+	if *responseThreshold != 0 {
+		fmt.Printf("\tused response threshold: %v\n", *responseThreshold)
+		for _, count := range keptCounts {
+			fmt.Printf("\t\t%s\n", count)
+		}
+	}
+
+	if len(timedOut) > 0 {
+		fmt.Printf("\tsheets skipped after --sheet_timeout - %s\n", strings.Join(timedOut, ", "))
+	}
+
+	// a dry run does not write any file
+	if opts.DryRun {
+		fmt.Println("dry run: no output files are written")
+		return
+	}
+
+	transformedFileName := fileName("transformed_data")
+	sortedTransformedFileName := fileName("sorted_transformed_data")
+
+	// change the layout of the main outputs
+	applyLayout(xlsxTransformed, xlsxSorted)
+
+	// save output file
+	fmt.Printf("writing transformed data to file: %s\n", excelutil.OutputPath(opts.OutputFormat, transformedFileName, save.Gzip))
+	if err := excelutil.SaveWorkbook(xlsxTransformed, outSheets, opts.OutputFormat, transformedFileName, save); err != nil {
+		log.Fatalf("error while saving transformed data: %s\n", err)
+	}
+	fmt.Printf("writing sorted values to file: %s\n", excelutil.OutputPath(opts.OutputFormat, sortedTransformedFileName, save.Gzip))
+	if err := excelutil.SaveWorkbook(xlsxSorted, outSheets, opts.OutputFormat, sortedTransformedFileName, save); err != nil {
+		log.Fatalf("error while saving sorted values: %s\n", err)
+	}
+
+	// save the sorted order of the columns
+	if opts.ExportOrder {
+		orderFileName := fileName("order.csv")
+		fmt.Printf("writing sorted order to file: %s\n", excelutil.GzipPath(orderFileName, save.Gzip))
+		if err := excelutil.WriteRecords(orderFileName, orderRows, save.Gzip); err != nil {
+			log.Fatalf("error while saving sorted order: %s\n", err)
+		}
+	}
+
+	// save the data-quality report
+	if opts.QualityReport {
+		fmt.Printf("writing data-quality report to file: %s\n", excelutil.GzipPath(qualityFileName, save.Gzip))
+		saveQualityReport()
+	}
+
+	// save threshold file
+	if *responseThreshold != 0 {
+		thresholdFileName := fileName("data_with_threshold.xlsx")
+		fmt.Printf("writing threshold data to file: %s\n", thresholdFileName)
+		if err := excelutil.SaveXLSX(xlsxThreshold, thresholdFileName, save); err != nil {
+			log.Fatalf("error while saving threshold data: %s\n", err)
+		}
+	}
+
+	// save the number of columns that survived --threshold
+	if opts.ThresholdReport {
+		reportFileName := fileName("threshold_report.json")
+		fmt.Printf("writing threshold report to file: %s\n", excelutil.GzipPath(reportFileName, save.Gzip))
+		if err := excelutil.WriteThresholdReport(reportFileName, *responseThreshold, keptCounts, save.Gzip); err != nil {
+			log.Fatalf("error while saving threshold report: %s\n", err)
+		}
+	}
+}
@@ -0,0 +1,1831 @@
+// Package excelutil is a command line program that converts an excel workbook with potentially multiple spread sheets
+// of a given format to another format while doing the appropriate maths. It can create graphs and sort the
+// columns of the primary output according to the maximum value per output.
+// author: Daniel Schuette (email: d.schuette@online.de)
+// license: MIT license (see github.com/DanielSchuette)
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/360EntSecGroup-Skylar/excelize"
+	"github.com/DanielSchuette/excelutil"
+)
+
+// define the flags of the process subcommand
+// the other subcommands are the same in both programs and are run by excelutil.Main
+var (
+	processCmd = flag.NewFlagSet("process", flag.ExitOnError)
+
+	// the flags that procexcel and procexcelratios share (see excelutil.Options)
+	opts = excelutil.NewOptions(processCmd)
+
+	// the flags that only procexcelratios has (or whose meaning differs from the other program)
+	responseThreshold = processCmd.Float64("threshold", 1.2, "optional argument specifying a response threshold (as a floating point number)\nevery column without a value larger than this number is dropped from the sorted data and the remaining columns are saved to a '_data_with_threshold.xlsx' file\nthe response rate of every sheet is the fraction of columns whose ranked value (see --sort_by and --sort_window, i.e. the peak ratio by default)\nis larger than this number; if you don't want this behavior, override it by putting in '0' (or leave out the sort stage, see --stages)")
+	sheetTimeout      = processCmd.Duration("sheet_timeout", 0, "specify how long processing a single sheet (from reading it to sorting its ratios) may take (e.g. '30s' or '2m')\nsheets that take longer are skipped with a warning and their output is discarded, which leaves their sheets in .xlsx outputs empty\nthe limit is not enforced while a stage runs but checked while reading a sheet and after the transform, ratio, and sort stages, so a slow stage\nruns to its end before its sheet is skipped (defaults to 0, i.e. no limit)")
+	zscore            = processCmd.Bool("zscore", false, "--zscore=true standardizes every ratio column to zero mean and unit standard deviation (ignoring empty cells) and writes the result to a '_zscore.xlsx' file\nconstant columns become all zeros (defaults to false)")
+	labelsFile        = processCmd.String("labels", "", "--labels=map.csv renames the ratio columns (and thereby the sorted output) with a two-column mapping file (key, label)\na key matches the position of a well (e.g. '3'), its default header (e.g. 'cell 3'), or the source header of either of its channels\nunmapped columns keep their original names (defaults to '', i.e. no mapping)")
+	clip              = processCmd.String("clip", "", "--clip=1:99 clamps the ratios of every column to the given low and high percentiles before they are ranked and written\nthis removes rare single-sample spikes (defaults to '', i.e. no clipping)")
+	qcMinSNR          = processCmd.Float64("qc_min_snr", -1, "specify the minimum signal-to-noise ratio (peak within --start/--stop over the noise within --baseline_window) of the top column\nthat a sheet needs to pass QC; the QC result of every sheet is printed and added to --summary_sheet (defaults to -1, i.e. not checked)")
+	qcMaxDrift        = processCmd.Float64("qc_max_drift", -1, "specify the maximum baseline drift (mean of the last measurements minus the mean of --baseline_window) of the top column\nthat a sheet may have to pass QC (defaults to -1, i.e. not checked)")
+	qcMaxEmpty        = processCmd.Int("qc_max_empty", -1, "specify the maximum number of empty ratios that a sheet may have to pass QC (defaults to -1, i.e. not checked)")
+	transposeOutput   = processCmd.Bool("transpose_output", false, "--transpose_output=true writes the ratios and the sorted ratios with one row per well (headers in the first column, measurements across columns)\nthe input is read in its normal orientation; cannot be combined with --add_chart (defaults to false)")
+	globalNumbering   = processCmd.Bool("global_numbering", false, "--global_numbering=true numbers the wells of all sheets continuously in the ratio and sorted headers (e.g. 'cell 5' is the first well\nof the second sheet if the first one has four wells) instead of restarting at 1 for every sheet (defaults to false)")
+	peaksLong         = processCmd.Bool("peaks_long", false, "--peaks_long=true writes the peak of every well of all sheets to a single '_peaks_long.csv' file with the columns sheet, well, peak, time_to_peak,\nand rank_in_sheet (the position of the well within its sheet according to --sort_order) for statistical modeling (defaults to false)")
+	formulas          = processCmd.Bool("formulas", false, "--formulas=true writes the background correction of the transformed data as formulas (e.g. ='raw Plate1'!B3-'raw Plate1'!N3)\nthat refer to a copy of the raw data in the same workbook, so that the math can be traced in Excel; only supported with --output_format=xlsx (defaults to false)")
+	overlayChart      = processCmd.Int("overlay_chart", 0, "--overlay_chart=N adds a 'Charts' sheet to the sorted ratios with one line chart per sheet that overlays up to N sorted columns\n(i.e. the N strongest responders in ranked order, colored from blue to red); keep N small (e.g. 50), since Excel struggles with\nhundreds of series; only embedded in .xlsx output and cannot be combined with --transpose_output (defaults to 0, i.e. no chart)")
+	order             = processCmd.String("order", "correct_then_ratio", "--order=correct_then_ratio subtracts the background from both channels before dividing them, i.e. (n-bg_n)/(d-bg_d)\n--order=ratio_then_correct divides the raw channels and subtracts the ratio of the backgrounds, i.e. n/d - bg_n/bg_d\nboth orders yield different quantities (e.g. n=200, d=300, bg_n=50, bg_d=60 yields 0.625 vs. -0.167), so ratios of\ndifferent orders must not be compared; the transformed data is background corrected in both cases (defaults to 'correct_then_ratio')")
+	groupBy           = processCmd.String("group_by", "", "--group_by=condition additionally writes the ratios of all sheets to a 'grouped_ratios' file with one sheet per condition\nthe condition of a well is its label in the mapping of --labels (which is required); wells without a label go to an 'Ungrouped' sheet\n(defaults to '', i.e. no grouping)")
+	stageList         = processCmd.String("stages", "transform,ratio,sort", "specify the stages of the pipeline that run, e.g. --stages=transform to only write the background-corrected data\nor --stages=transform,ratio to skip the peak search and sorting; a stage requires all stages before it, and skipped stages are neither\ncomputed nor written, so options that need their results (e.g. --correlation needs sort) are rejected (defaults to 'transform,ratio,sort')")
+	debugDump         = processCmd.String("debug_dump", "", "specify a directory to which the intermediate data of every sheet are written after each stage for troubleshooting,\ne.g. the transformed matrix the ratios were computed from; files are named '<sheet>_<stage>.csv' with the stages transform, ratio, and sort\n(see --stages); they are not affected by --output_origin, --transpose_output, --carry_metadata, or --gzip (defaults to '', i.e. no dump)")
+	denomSmooth       = processCmd.Int("denominator_smooth", 0, "specify a window of N measurements to divide by a centered rolling mean of the denominator channel instead of its raw values\nto reduce noise; the numerator is not smoothed and the window is truncated at both ends of a recording\ncannot be combined with --order=ratio_then_correct (defaults to 0, i.e. no smoothing)")
+	correlation       = processCmd.Bool("correlation", false, "--correlation=true writes the pairwise Pearson correlation matrix of all ratio columns of every sheet to a '_correlation.xlsx' file (defaults to false)")
+	numberFormat      = processCmd.String("number_format", "", "specify an Excel number format (e.g. '0.000') that is used to display the values in all output files\nthe values themselves are written with full precision (defaults to Excel's general format)")
+	columns           = processCmd.String("columns", "", "specify a selection of wells (e.g. '1,3,5-8') to restrict processing to these wells\nwells are numbered starting at 1 and every well consists of a 340, a 380, and an unused column (defaults to all wells)")
+	histogram         = processCmd.Int("histogram", 0, "specify a number of bins to write a histogram of the peak values of every sheet to a '_histogram.xlsx' file\nthe default of 0 does not create a histogram")
+	appendTo          = processCmd.String("append_to", "", "specify the path to an Excel (.xlsx) file to which the sorted ratios of every sheet are added as new sheets\nthe file is created if it does not exist; existing sheets are preserved and new sheet names are de-duplicated")
+	ewma              = processCmd.Float64("ewma", 0, "specify a smoothing factor alpha in (0, 1] to smooth the ratios with an exponentially weighted moving average before peaks are searched\nsmall values result in heavy smoothing; the written ratios are not smoothed (the default of 0 disables smoothing)\nthis is the old name of --rank_smooth, which takes precedence if both are given")
+	warnDuplicates    = processCmd.Bool("warn_duplicates", false, "--warn_duplicates=true warns about wells with identical ratios (e.g. because of copy-paste errors) and lists them in the summary (defaults to false)")
+	summarySheet      = processCmd.Bool("summary_sheet", false, "--summary_sheet=true adds a 'Summary' sheet to the sorted ratios that lists the top responder (column, peak value, peak row, and signal-to-noise ratio within --baseline_window) of every sheet (defaults to false)\nthe summary sheet is only written with --output_format=xlsx")
+	enumLabel         = processCmd.String("num_label", "", "specify a label for the enumerator wavelength (e.g. '340') that is added to the ratio headers like 'cell 3 (340/380)'")
+	denomLabel        = processCmd.String("denom_label", "", "specify a label for the denominator wavelength (e.g. '380') that is added to the ratio headers like 'cell 3 (340/380)'")
+	detrend           = processCmd.Bool("detrend", false, "--detrend=true removes a linear trend (e.g. caused by photobleaching) from the ratios before peaks are searched\nthe trend is removed before smoothing with --rank_smooth; the written ratios are not detrended (defaults to false)")
+	peaksOnly         = processCmd.Bool("peaks_only", false, "--peaks_only=true writes the peak value of every well (between --start and --stop) to a '_peaks.xlsx' file\nevery sheet of that file holds the well labels in the first and the peak values in the second row\nand the time of the peak (or its index within the search range if the time is missing) in the third row (defaults to false)")
+	sqlitePath        = processCmd.String("sqlite", "", "specify the path to a SQLite database to which the ratios ('measurements' table) and the peaks ('peaks' table) are written\nthe program has to be built with '-tags sqlite' to support this option")
+	explain           = processCmd.Bool("explain", false, "--explain=true prints which source column of every sheet was written to which transformed and ratio column\nand which background column was subtracted from it (defaults to false)")
+	sortBy            = processCmd.String("sort_by", "peak", "specify what columns are sorted by: 'peak' (the maximum within --start and --stop)\nor 'deltaf' (that maximum minus the mean ratio within --baseline_window) (defaults to 'peak')")
+	baselineWindow    = processCmd.String("baseline_window", "1:30", "specify the measurements from:to (to is excluded, like --stop) whose mean is used as baseline with --sort_by=deltaf\n(defaults to 1:30)")
+	emptyCells        = processCmd.String("empty", "error", "specify how empty cells in the data region are treated: 'error' aborts, 'zero' and 'nan' read them as 0 or NaN\n(NaN values are written as empty cells), and 'skip' leaves out every row (i.e. measurement) that contains an empty cell\n(--formulas and --annotate still refer to the source rows) (defaults to 'error')")
+	pngCharts         = processCmd.Bool("png_charts", false, "--png_charts=true additionally saves the response profiles of every sheet as a '_<sheet>_ratios.png' image\nthe images show the same columns and measurements as the charts of --add_chart (defaults to false)\nthe images are drawn without a plotting library; they have ticks with labels on both axes and a legend with the header of every column, but no title")
+	splitColumns      = processCmd.String("split_columns", "", "specify a directory to which every ratio column is additionally written as its own '<sheet>_<column>.xlsx' file\ntogether with the time column (e.g. to share single wells, defaults to no split files)")
+	channelBaseline   = processCmd.String("channel_baseline", "", "specify the measurements from:to (to is excluded, like --stop) whose mean is subtracted from every channel before ratios are computed\nthe order of operations is: background subtraction, per-channel baseline subtraction, division (numerator/denominator)\nthe transformed data is written before the baseline subtraction (defaults to no per-channel baseline)")
+	responderPeak     = processCmd.Float64("responder_peak", -1, "specify the value a peak has to exceed for a well to be counted as responder (a negative value ignores peaks)\nthe number of responders of every sheet is printed and added to --summary_sheet (defaults to -1)")
+	responderLatency  = processCmd.Float64("responder_latency", -1, "specify the time to peak a well has to fall below to be counted as responder (a negative value ignores the time to peak)\ncan be combined with --responder_peak (defaults to -1)")
+	verify            = processCmd.Bool("verify", false, "--verify=true reads every written ratio back and reports values that differ from the computed ones\n(e.g. because of a loss of precision while serializing them, defaults to false)")
+	windowList        = processCmd.String("windows", "", "specify additional windows of measurements from:to (to is excluded, like --stop) in which peaks are searched separately\n(e.g. '30:120,200:300' for two stimulations); their peaks are added to --peaks_only (from the fourth row on) and --summary_sheet")
+	sortWindow        = processCmd.Int("sort_window", 0, "specify the (1-based) index of a window of --windows whose peaks are used for sorting instead of the peaks between --start and --stop\n(defaults to 0, i.e. --start and --stop are used)")
+	rankSmooth        = processCmd.Float64("rank_smooth", 0, "specify a smoothing factor alpha in (0, 1] to smooth the ratios with an exponentially weighted moving average before peaks are searched\nsmall values result in heavy smoothing; this only affects the ranking of columns, not the written ratios (the default of 0 disables smoothing)")
+	outputSmooth      = processCmd.Float64("output_smooth", 0, "specify a smoothing factor alpha in (0, 1] to smooth the written ratios with an exponentially weighted moving average\npeaks are still searched in the unsmoothed ratios unless --rank_smooth is given, too (the default of 0 disables smoothing)")
+	backgroundLabels  = processCmd.String("background_labels", "", "specify the header labels of the background columns of the enumerator and the denominator (e.g. 'BG340,BG380') to find them\nat any position instead of at the end of every sheet; overrides --background_count (defaults to '', i.e. background columns are at the end)")
+	pairByHeader      = processCmd.String("pair_by_header", "", "specify the header suffixes of the enumerator and the denominator (e.g. '340,380') to pair the channels of every well by their headers\n(e.g. 'Well3_340' and 'Well3_380') instead of by their positions; other data columns are ignored (defaults to '', i.e. positional pairing)")
+	backgroundCount   = processCmd.String("background_count", "2", "specify how many trailing background columns every sheet has (defaults to 2)\n--background_count=auto detects them by their header labels (e.g. 'bg340' or 'background 380')\nand falls back to the default of 2 if detection is ambiguous\nsheets can have their own counts (e.g. '2,Plate2=1' or 'Plate1=auto'), all other sheets use the global count")
+)
+
+func main() {
+	excelutil.Main(process)
+}
+
+// process runs the actual analysis of a workbook
+func process(args []string) {
+	// defer done statement
+	defer excelutil.PrintDelim()
+	defer fmt.Println("done")
+
+	// parse flags and check for errors
+	excelutil.PrintDelim()
+	processCmd.Parse(args)
+	if err := opts.Validate(); err != nil {
+		log.Fatalf("%s\n", err)
+	}
+	originCol, originRow, err := excelutil.ParseCoordinate(opts.OutputOrigin)
+	if err != nil {
+		log.Fatalf("cannot use --output_origin: %s\n", err)
+	}
+	if (originCol != 1 || originRow != 1) && opts.OutputFormat != "xlsx" {
+		log.Fatal("--output_origin is only supported with --output_format=xlsx")
+	}
+	if *transposeOutput && opts.AddChart {
+		log.Fatal("--transpose_output cannot be combined with --add_chart")
+	}
+	if *transposeOutput && *overlayChart > 0 {
+		log.Fatal("--transpose_output cannot be combined with --overlay_chart")
+	}
+	if *formulas && opts.OutputFormat != "xlsx" {
+		log.Fatal("--formulas is only supported with --output_format=xlsx")
+	}
+	if *groupBy != "" && *groupBy != "condition" {
+		log.Fatalf("unknown grouping: %s (must be 'condition')\n", *groupBy)
+	}
+	if *groupBy != "" && *labelsFile == "" {
+		log.Fatal("--group_by=condition requires the conditions of the wells (see --labels)")
+	}
+	if *order != "correct_then_ratio" && *order != "ratio_then_correct" {
+		log.Fatalf("unknown order: %s (must be 'correct_then_ratio' or 'ratio_then_correct')\n", *order)
+	}
+	if *order == "ratio_then_correct" && *channelBaseline != "" {
+		log.Fatal("--order=ratio_then_correct cannot be combined with --channel_baseline")
+	}
+	if *denomSmooth < 0 {
+		log.Fatalf("cannot use --denominator_smooth=%d (must not be negative)\n", *denomSmooth)
+	}
+	if *order == "ratio_then_correct" && *denomSmooth > 1 {
+		log.Fatal("--order=ratio_then_correct cannot be combined with --denominator_smooth")
+	}
+	excelutil.Seed(opts.Seed)
+
+	// profile the whole run with --cpuprofile and --memprofile
+	stopProfiles, err := excelutil.StartProfiles(opts.CPUProfile, opts.MemProfile)
+	if err != nil {
+		log.Fatalf("cannot profile the run: %s\n", err)
+	}
+	defer func() {
+		if err := stopProfiles(); err != nil {
+			log.Fatalf("error while writing profiles: %s\n", err)
+		}
+	}()
+	save := opts.SaveOptions() // the settings of all output files (see --compression, --gzip, and --inf)
+	if save.Inf, err = excelutil.ParseInfPolicy(opts.Inf); err != nil {
+		log.Fatalf("cannot use --inf: %s\n", err)
+	}
+	var timeFrom, timeTo float64
+	if opts.TimeRange != "" {
+		var err error
+		if timeFrom, timeTo, err = excelutil.ParseTimeRange(opts.TimeRange); err != nil {
+			log.Fatalf("cannot use --time_range: %s\n", err)
+		}
+	}
+	var clipLow, clipHigh float64
+	if *clip != "" {
+		var err error
+		if clipLow, clipHigh, err = excelutil.ParsePercentiles(*clip); err != nil {
+			log.Fatalf("cannot use --clip: %s\n", err)
+		}
+	}
+	qc := excelutil.QCCriteria{MinSNR: *qcMinSNR, MaxDrift: *qcMaxDrift, MaxEmpty: *qcMaxEmpty}
+	startLabels := excelutil.ParseLabels(opts.StartLabels)
+	var labelMap map[string]string
+	if *labelsFile != "" {
+		var err error
+		labelMap, err = excelutil.LoadLabelMap(*labelsFile)
+		if err != nil {
+			log.Fatalf("%s\n", err)
+		}
+	}
+	if len(startLabels) == 0 {
+		log.Fatal("provide at least one start label (see process --help)")
+	}
+	if *ewma < 0 || *ewma > 1 {
+		log.Fatalf("cannot use --ewma=%v (alpha must be in (0, 1])\n", *ewma)
+	}
+	if *rankSmooth < 0 || *rankSmooth > 1 {
+		log.Fatalf("cannot use --rank_smooth=%v (alpha must be in (0, 1])\n", *rankSmooth)
+	}
+	if *outputSmooth < 0 || *outputSmooth > 1 {
+		log.Fatalf("cannot use --output_smooth=%v (alpha must be in (0, 1])\n", *outputSmooth)
+	}
+	rankAlpha := *rankSmooth
+	if rankAlpha == 0 {
+		rankAlpha = *ewma // --ewma is the old name of --rank_smooth
+	}
+	if *sortBy != "peak" && *sortBy != "deltaf" {
+		log.Fatalf("unknown sort criterion: %s (see process --help)\n", *sortBy)
+	}
+	baselineFrom, baselineTo, err := excelutil.ParseWindow(*baselineWindow)
+	if err != nil {
+		log.Fatalf("cannot use --baseline_window: %s\n", err)
+	}
+	if *sortBy == "deltaf" && (baselineFrom < 1 || baselineFrom == baselineTo) {
+		log.Fatalf("cannot use --baseline_window=%s (measurements start at 1 and the window must not be empty)\n", *baselineWindow)
+	}
+	if *sortBy == "deltaf" && opts.Start >= opts.Stop {
+		log.Fatalf("cannot use --sort_by=deltaf with --start=%d and --stop=%d (empty peak window)\n", opts.Start, opts.Stop)
+	}
+	var chanFrom, chanTo int
+	if *channelBaseline != "" {
+		if chanFrom, chanTo, err = excelutil.ParseWindow(*channelBaseline); err != nil {
+			log.Fatalf("cannot use --channel_baseline: %s\n", err)
+		}
+		if chanFrom < 1 || chanFrom == chanTo {
+			log.Fatalf("cannot use --channel_baseline=%s (measurements start at 1 and the window must not be empty)\n", *channelBaseline)
+		}
+	}
+	var windows [][2]int
+	if *windowList != "" {
+		if windows, err = excelutil.ParseWindows(*windowList); err != nil {
+			log.Fatalf("cannot use --windows: %s\n", err)
+		}
+		for _, w := range windows {
+			if w[0] < 1 || w[0] == w[1] {
+				log.Fatalf("cannot use --windows=%s (measurements start at 1 and windows must not be empty)\n", *windowList)
+			}
+		}
+	}
+	if *sortWindow < 0 || *sortWindow > len(windows) {
+		log.Fatalf("cannot use --sort_window=%d with %d windows\n", *sortWindow, len(windows))
+	}
+	if *sortWindow > 0 && *sortBy != "peak" {
+		log.Fatal("--sort_window cannot be combined with --sort_by=deltaf")
+	}
+	var pairSuffixes []string
+	if *pairByHeader != "" {
+		if pairSuffixes = excelutil.ParseLabels(*pairByHeader); len(pairSuffixes) != 2 {
+			log.Fatalf("cannot use --pair_by_header=%s (must be two suffixes, e.g. '340,380')\n", *pairByHeader)
+		}
+	}
+	var bgLabels []string
+	if *backgroundLabels != "" {
+		if bgLabels = excelutil.ParseLabels(*backgroundLabels); len(bgLabels) != 2 {
+			log.Fatalf("cannot use --background_labels=%s (must be two labels, e.g. 'BG340,BG380')\n", *backgroundLabels)
+		}
+	}
+	// every sheet uses its own background count or the global one (0 means that it is detected, i.e. 'auto')
+	bgCounts := map[string]int{"": 2}
+	bgSpecs, err := excelutil.ParseSheetValues(*backgroundCount)
+	if err != nil {
+		log.Fatalf("cannot use --background_count: %s\n", err)
+	}
+	for name, spec := range bgSpecs {
+		n, err := strconv.Atoi(spec)
+		if spec == "auto" {
+			n, err = 0, nil
+		} else if err != nil || n < 1 {
+			log.Fatalf("cannot use --background_count=%s (counts must be 'auto' or positive integers)\n", *backgroundCount)
+		}
+		bgCounts[name] = n
+	}
+
+	// start to process data
+	fmt.Printf("opened file: %s\n", opts.FilePath)
+	fmt.Println("starting to process data...")
+
+	// create a new ExcelWorkbook, open file, and get sheet names
+	wb := &excelutil.ExcelWorkbook{}
+	if opts.Wait > 0 && excelutil.ResolveFormat(opts.FilePath, opts.InputFormat) != "tsv" {
+		fmt.Printf("waiting up to %s for %s to be complete\n", opts.Wait, opts.FilePath)
+		if err := excelutil.WaitComplete(opts.FilePath, opts.Wait, time.Second); err != nil {
+			log.Fatalf("%s\n", err)
+		}
+	}
+	stages, err := excelutil.ParseStages(*stageList, []string{"transform", "ratio", "sort"})
+	if err != nil {
+		log.Fatalf("cannot use --stages: %s\n", err)
+	}
+	thresholdSet := false // only an explicit --threshold requires the sort stage
+	processCmd.Visit(func(f *flag.Flag) { thresholdSet = thresholdSet || f.Name == "threshold" })
+	for _, req := range []struct {
+		enabled bool
+		flag    string
+		stage   string
+	}{
+		{*verify, "verify", "ratio"},
+		{opts.AddChart, "add_chart", "ratio"},
+		{*transposeOutput, "transpose_output", "ratio"},
+		{*channelBaseline != "", "channel_baseline", "ratio"},
+		{*groupBy != "", "group_by", "ratio"},
+		{*denomSmooth > 1, "denominator_smooth", "ratio"},
+		{*correlation, "correlation", "sort"},
+		{*zscore, "zscore", "sort"},
+		{*peaksOnly, "peaks_only", "sort"},
+		{*peaksLong, "peaks_long", "sort"},
+		{*histogram > 0, "histogram", "sort"},
+		{opts.ExportOrder, "export_order", "sort"},
+		{*overlayChart > 0, "overlay_chart", "sort"},
+		{*pngCharts, "png_charts", "sort"},
+		{*splitColumns != "", "split_columns", "sort"},
+		{*sqlitePath != "", "sqlite", "sort"},
+		{*appendTo != "", "append_to", "sort"},
+		{*summarySheet, "summary_sheet", "sort"},
+		{*warnDuplicates, "warn_duplicates", "sort"},
+		{*windowList != "", "windows", "sort"},
+		{*responderPeak >= 0 || *responderLatency >= 0, "responder_peak/--responder_latency", "sort"},
+		{qc.Enabled(), "qc_min_snr/--qc_max_drift/--qc_max_empty", "sort"},
+		{thresholdSet && *responseThreshold != 0, "threshold", "sort"},
+	} {
+		if req.enabled && !stages[req.stage] {
+			log.Fatalf("--%s requires the %s stage (see --stages)\n", req.flag, req.stage)
+		}
+	}
+	if !stages["sort"] {
+		*responseThreshold = 0 // there are no sorted data to filter
+	}
+	if opts.ThresholdReport && *responseThreshold == 0 {
+		log.Fatalf("cannot use --threshold_report without --threshold\n")
+	}
+	wb.Retries, wb.RetryDelay = opts.Retry, opts.RetryDelay
+	wb.OpenAs(opts.FilePath, opts.InputFormat)
+	wb.GetSheetNames()
+	wb.SearchRows = opts.LabelSearchLimit
+	if opts.LimitSheets > 0 && opts.LimitSheets < wb.NumSheets {
+		fmt.Printf("processing only the first %d of %d sheets\n", opts.LimitSheets, wb.NumSheets)
+		wb.SheetNames = wb.SheetNames[:opts.LimitSheets]
+		wb.NumSheets = opts.LimitSheets
+	}
+	outNames, err := excelutil.OutputSheetNames(opts.SheetNameTemplate, wb.SheetNames[:wb.NumSheets])
+	if err != nil {
+		log.Fatalf("cannot use --sheet_name_template: %s\n", err)
+	}
+	// the main outputs with the stage that produces them and their rough size relative to the input (see --estimate)
+	mainOutputs := []struct {
+		stage    string
+		name     string
+		fraction float64
+	}{
+		{"transform", "transformed_data", 2.0 / 3},
+		{"ratio", "ratios", 1.0 / 3},
+		{"sort", "sorted_ratios", 1.0 / 3},
+	}
+	// print the files that a run with the current options writes
+	if opts.ListOutputs {
+		sheets := outNames
+		planned := func(name string) string {
+			return excelutil.OutputFilePattern(opts.OutputPrefix, opts.Timestamp, name)
+		}
+		paths := make([]string, 0)
+		for _, out := range mainOutputs {
+			if stages[out.stage] {
+				paths = append(paths, excelutil.OutputPaths(opts.OutputFormat, planned(out.name), sheets, save.Gzip)...)
+			}
+		}
+		if *pngCharts {
+			for _, sheet := range sheets {
+				paths = append(paths, planned(sheet+"_ratios.png"))
+			}
+		}
+		if *splitColumns != "" {
+			for _, sheet := range sheets {
+				paths = append(paths, excelutil.SplitColumnPattern(*splitColumns, sheet))
+			}
+		}
+		if *groupBy == "condition" {
+			paths = append(paths, excelutil.OutputPath(opts.OutputFormat, planned("grouped_ratios"), save.Gzip))
+		}
+		if *debugDump != "" {
+			for _, sheet := range sheets {
+				for _, out := range mainOutputs {
+					if stages[out.stage] {
+						paths = append(paths, excelutil.DebugDumpPath(*debugDump, sheet, out.stage))
+					}
+				}
+			}
+		}
+		for _, out := range []struct {
+			enabled bool
+			name    string
+		}{
+			{*correlation, "correlation.xlsx"},
+			{*peaksLong, "peaks_long.csv"},
+			{opts.ExportOrder, "order.csv"},
+			{opts.QualityReport, "quality_report.csv"},
+			{*zscore, "zscore.xlsx"},
+			{*peaksOnly, "peaks.xlsx"},
+			{*histogram > 0, "histogram.xlsx"},
+			{*responseThreshold != 0, "data_with_threshold.xlsx"},
+			{opts.ThresholdReport, "threshold_report.json"},
+		} {
+			if out.enabled {
+				paths = append(paths, excelutil.GzipPath(planned(out.name), save.Gzip))
+			}
+		}
+		if *appendTo != "" {
+			paths = append(paths, *appendTo)
+		}
+		if *sqlitePath != "" {
+			paths = append(paths, *sqlitePath)
+		}
+		for _, path := range []string{opts.CPUProfile, opts.MemProfile} {
+			if path != "" {
+				paths = append(paths, path)
+			}
+		}
+		fmt.Println("planned outputs:")
+		excelutil.ListOutputs(os.Stdout, paths)
+		return
+	}
+	if opts.Estimate {
+		// project the outputs from the number of used input cells (the main outputs hold a fixed share of the input columns)
+		outputs := make([]excelutil.EstimatedOutput, 0)
+		for _, out := range mainOutputs {
+			if stages[out.stage] {
+				outputs = append(outputs, excelutil.EstimatedOutput{Name: out.name, Fraction: out.fraction})
+			}
+		}
+		wb.PrintEstimate(os.Stdout, opts.OutputFormat, outputs, save.Gzip)
+		return
+	}
+	if wb.Empty, err = excelutil.ParseEmptyPolicy(*emptyCells); err != nil {
+		log.Fatalf("cannot use --empty: %s\n", err)
+	}
+	if opts.ConsistentLayout {
+		if mismatches := wb.LayoutMismatches(startLabels); len(mismatches) > 0 {
+			log.Fatalf("sheets do not share the layout of sheet %s:\n\t%s\n", wb.SheetNames[0], strings.Join(mismatches, "\n\t"))
+		}
+	}
+
+	// with --template_sheet, the start row is searched once and reused for all sheets with the same layout
+	templateRow := -1
+	if opts.TemplateSheet != "" {
+		if wb.XLSX.GetSheetIndex(opts.TemplateSheet) == 0 {
+			log.Fatalf("cannot use --template_sheet=%s (no such sheet)\n", opts.TemplateSheet)
+		}
+		if templateRow, err = wb.StartRowAny(opts.TemplateSheet, startLabels); err != nil {
+			log.Fatalf("cannot use --template_sheet=%s: %s\n", opts.TemplateSheet, err)
+		}
+		fmt.Printf("using start row %d of template sheet %s\n", templateRow+1, opts.TemplateSheet)
+	}
+
+	// create new excel files to save results to
+	xlsxTransformed := excelize.NewFile()
+	if opts.PreserveFormatting {
+		if err := excelutil.CopyStyles(xlsxTransformed, wb.XLSX); err != nil {
+			log.Fatalf("error while preserving formatting: %s\n", err)
+		}
+	}
+	xlsxRatio := excelize.NewFile()
+	xlsxThreshold := excelize.NewFile()
+	xlsxSorted := excelize.NewFile()
+	xlsxCorrelation := excelize.NewFile()
+	xlsxZScore := excelize.NewFile()
+	xlsxHistogram := excelize.NewFile()
+	xlsxPeaks := excelize.NewFile()
+
+	// open the SQLite database (unless this is a dry run); all sheets are written within a single transaction
+	var sqlWriter *excelutil.SQLWriter
+	if *sqlitePath != "" && !opts.DryRun {
+		db, err := sql.Open("sqlite3", *sqlitePath)
+		if err != nil {
+			log.Fatalf("error while opening database (build with '-tags sqlite' to enable SQLite support): %s\n", err)
+		}
+		defer db.Close()
+		if sqlWriter, err = excelutil.NewSQLWriter(db); err != nil {
+			log.Fatalf("error while preparing database: %s\n", err)
+		}
+	}
+
+	// collect the response rates of all sheets for the summary
+	responseRates := make([]string, 0)
+
+	// collect the number of responders of all sheets for the summary
+	responderCounts := make([]string, 0)
+
+	// collect the top responders of all sheets for the summary sheet
+	summaries := make([]excelutil.SheetSummary, 0)
+
+	// collect warnings about duplicate columns for the summary
+	duplicateWarnings := make([]string, 0)
+
+	// remember the number of sorted columns and measurements of every output sheet for --overlay_chart
+	overlaySizes := make(map[string][2]int)
+
+	// collect the ratios that are plotted for --png_charts and their headers (for the legend) by output sheet
+	chartData := make(map[string][][]float64)
+	chartLabels := make(map[string][]string)
+
+	// collect the number of columns that survive --threshold in every sheet for the summary
+	keptCounts := make([]excelutil.ThresholdCount, 0)
+
+	// collect the results of --verify for the summary
+	verifyCounts := make([]string, 0)
+
+	// collect the names of all output sheets
+	outSheets := make([]string, 0)
+
+	// get current time to create a unique file name (all outputs of a run share it, even with --incremental)
+	t := time.Now()
+	fileName := func(name string) string {
+		return excelutil.OutputFileName(opts.OutputPrefix, t, opts.Timestamp, name)
+	}
+
+	// collect the output sheets of sheets that exceeded --sheet_timeout
+	timedOut := make([]string, 0)
+
+	// rows of the long-format peaks table of all sheets (only collected with --peaks_long)
+	longPeaks := [][]string{{"sheet", "well", "peak", "time_to_peak", "rank_in_sheet"}}
+
+	// the sheets with the raw data of every output sheet (only created with --formulas)
+	rawSheets := make(map[string]string)
+
+	// number of wells of all previous sheets (only counted with --global_numbering)
+	wellBase := 0
+
+	// the ratio columns of every output sheet with their conditions (only collected with --group_by)
+	grouped := make(map[string][]excelutil.GroupedColumn)
+
+	// the sorted order of the columns of every sheet (only collected with --export_order)
+	orderRows := [][]string{{"sheet", "rank", "column", "header"}}
+
+	// the counts of unusable cells of every column (only collected with --quality_report); the report is rewritten after
+	// every sheet, so that it exists even if the data of a later sheet cannot be parsed
+	qualityRows := [][]string{excelutil.QualityHeader}
+	qualityFileName := fileName("quality_report.csv")
+	saveQualityReport := func() {
+		if err := excelutil.WriteRecords(qualityFileName, qualityRows, save.Gzip); err != nil {
+			log.Fatalf("error while saving data-quality report: %s\n", err)
+		}
+	}
+
+	// the rows above the start label of every output sheet (only kept with --carry_metadata)
+	metadata := make(map[string][][]string)
+
+	// the raw values of every transformed column of every output sheet (only collected with --emit_raw_pairs)
+	rawPairs := make(map[string][][]float64)
+
+	// applyLayout applies --transpose_output, --emit_raw_pairs, --carry_metadata, and --output_origin to the output sheets
+	// of the main outputs (and to the extra sheets of the sorted ratios, e.g. the summary sheet); it runs once all sheets
+	// were processed and on copies of the main outputs that are saved with --incremental
+	layoutChanged := *transposeOutput || opts.EmitRawPairs || opts.CarryMetadata || originCol > 1 || originRow > 1
+	applyLayout := func(transformed, ratio, sorted *excelize.File, sortedSheets []string) {
+		// write the ratios and the sorted ratios with one row per column
+		if *transposeOutput {
+			for _, name := range outSheets {
+				excelutil.TransposeSheet(ratio, name)
+				excelutil.TransposeSheet(sorted, name)
+			}
+		}
+
+		// put the raw values in front of every transformed column
+		for _, name := range outSheets {
+			if raw, ok := rawPairs[name]; ok {
+				excelutil.InterleaveRaw(transformed, name, raw, save.Inf)
+			}
+		}
+
+		// copy the rows above the start label to the top of the transformed data
+		for _, name := range outSheets {
+			if rows := metadata[name]; len(rows) > 0 {
+				excelutil.PrependRows(transformed, name, rows)
+			}
+		}
+
+		// move the output to --output_origin
+		for _, name := range outSheets {
+			excelutil.ShiftSheet(transformed, name, originCol, originRow)
+			excelutil.ShiftSheet(ratio, name, originCol, originRow)
+		}
+		for _, name := range sortedSheets {
+			excelutil.ShiftSheet(sorted, name, originCol, originRow)
+		}
+	}
+
+	// finishSheet formats the outputs of a sheet, filters its sorted ratios by --threshold, and saves the main outputs with
+	// --incremental; it runs after the last enabled stage (see --stages) of every sheet
+	finishSheet := func(sheet, outSheet string) {
+		// apply the number format to the data region of every output sheet
+		if *numberFormat != "" {
+			outputs := []*excelize.File{xlsxTransformed}
+			if stages["ratio"] {
+				outputs = append(outputs, xlsxRatio)
+			}
+			if stages["sort"] {
+				outputs = append(outputs, xlsxSorted)
+			}
+			if *correlation {
+				outputs = append(outputs, xlsxCorrelation)
+			}
+			if *zscore {
+				outputs = append(outputs, xlsxZScore)
+			}
+			for _, f := range outputs {
+				if err := excelutil.SetNumberFormat(f, outSheet, *numberFormat); err != nil {
+					log.Fatalf("error while applying number format: %s\n", err)
+				}
+			}
+		}
+
+		// drop columns if not at least one value is > --threshold (this behavior is overriden by --threshold 0)
+		if *responseThreshold != 0 {
+			headers, values := excelutil.SheetData(xlsxSorted.GetRows(outSheet))
+			kept, keptValues := excelutil.FilterColumnsByThreshold(headers, values, *responseThreshold)
+			excelutil.WriteSheetData(xlsxThreshold, outSheet, kept, keptValues, save.Inf)
+			keptCounts = append(keptCounts, excelutil.ThresholdCount{Sheet: sheet, Kept: len(kept), Total: len(headers)})
+		}
+
+		// save the main outputs after every sheet so that they survive a crash of a long run
+		if opts.Incremental && !opts.DryRun {
+			fmt.Printf("saving results of %d sheet(s)\n", len(outSheets))
+			transformed, ratio, sorted := xlsxTransformed, xlsxRatio, xlsxSorted
+			if layoutChanged {
+				// the layout is applied to copies, because the next sheets are still written to the main outputs
+				var err error
+				for _, copied := range []**excelize.File{&transformed, &ratio, &sorted} {
+					if *copied, err = excelutil.CopyWorkbook(*copied); err != nil {
+						log.Fatalf("error while saving results: %s\n", err)
+					}
+				}
+				applyLayout(transformed, ratio, sorted, outSheets)
+			}
+			if err := excelutil.SaveWorkbook(transformed, outSheets, opts.OutputFormat, fileName("transformed_data"), save); err != nil {
+				log.Fatalf("error while saving transformed data: %s\n", err)
+			}
+			if stages["ratio"] {
+				if err := excelutil.SaveWorkbook(ratio, outSheets, opts.OutputFormat, fileName("ratios"), save); err != nil {
+					log.Fatalf("error while saving ratios: %s\n", err)
+				}
+			}
+			if stages["sort"] {
+				if err := excelutil.SaveWorkbook(sorted, outSheets, opts.OutputFormat, fileName("sorted_ratios"), save); err != nil {
+					log.Fatalf("error while saving sorted ratios: %s\n", err)
+				}
+			}
+		}
+	}
+
+	// iterate over sheets in workbook
+	// the deadline of every sheet is released when the next sheet is started and after the last one
+	cancel := context.CancelFunc(func() {})
+	for i := 0; i < wb.NumSheets; i++ {
+		cancel()
+
+		// the processing of a sheet runs under the deadline of --sheet_timeout, which is checked while reading the sheet and
+		// after every stage; a sheet that exceeds it is skipped and its results are discarded, so that the output files
+		// only hold complete sheets (excelize cannot delete sheets, so its sheets in .xlsx outputs are left empty)
+		ctx := context.Background()
+		if *sheetTimeout > 0 {
+			ctx, cancel = context.WithTimeout(ctx, *sheetTimeout)
+		}
+		timeout := func(err error) bool {
+			if err != context.DeadlineExceeded {
+				return false
+			}
+			fmt.Printf("skipping sheet %s (exceeded --sheet_timeout=%s)\n", wb.SheetNames[i], *sheetTimeout)
+			timedOut = append(timedOut, wb.SheetNames[i])
+			return true
+		}
+		nOut, nQuality, nVerify, nDuplicates, base := len(outSheets), len(qualityRows), len(verifyCounts), len(duplicateWarnings), wellBase
+		expired := func(outSheet string) bool {
+			if !timeout(ctx.Err()) {
+				return false
+			}
+			outSheets, qualityRows, verifyCounts, duplicateWarnings, wellBase = outSheets[:nOut], qualityRows[:nQuality], verifyCounts[:nVerify],
+				duplicateWarnings[:nDuplicates], base
+			for _, f := range []*excelize.File{xlsxTransformed, xlsxRatio, xlsxThreshold, xlsxSorted, xlsxCorrelation, xlsxZScore} {
+				excelutil.ClearSheet(f, outSheet)
+			}
+			if rawSheet, ok := rawSheets[outSheet]; ok {
+				excelutil.ClearSheet(xlsxTransformed, rawSheet)
+			}
+			delete(metadata, outSheet)
+			delete(rawPairs, outSheet)
+			delete(rawSheets, outSheet)
+			delete(grouped, outSheet)
+			delete(chartData, outSheet)
+			return true
+		}
+
+		// print name of current sheet and read its data matrix; sheets without usable data are skipped with a warning
+		fmt.Printf("opened sheet: %s (%d of %d)\n", wb.SheetNames[i], i+1, wb.NumSheets)
+		m, id, err := wb.ReadSheet(ctx, os.Stdout, wb.SheetNames[i], opts, startLabels, templateRow)
+		if timeout(err) || err == excelutil.ErrSkipSheet {
+			continue
+		}
+		if err != nil {
+			log.Fatalf("%s\n", err)
+		}
+
+		// the output sheets are named after the current sheet according to --sheet_name_template
+		outSheet := outNames[i]
+
+		if opts.CarryMetadata {
+			metadata[outSheet] = m[:id]
+		}
+		if opts.QualityReport {
+			quality := excelutil.DataQuality(m[id:])
+			qualityRows = append(qualityRows, quality.Records(outSheet)...)
+			if quality.Total.Empty+quality.Total.NonNumeric+quality.Total.NonFinite > 0 {
+				fmt.Printf("sheet %s has %d empty, %d non-numeric, and %d non-finite cell(s) out of %d\n", wb.SheetNames[i],
+					quality.Total.Empty, quality.Total.NonNumeric, quality.Total.NonFinite, quality.Total.Cells)
+			}
+			saveQualityReport()
+		}
+
+		// create a sheet in new workbook with same name to save transformed data
+		fmt.Println("creating new sheet to write data to...")
+		_ = xlsxTransformed.NewSheet(outSheet)
+		_ = xlsxRatio.NewSheet(outSheet)
+		_ = xlsxThreshold.NewSheet(outSheet)
+		_ = xlsxSorted.NewSheet(outSheet)
+
+		// move the background columns of --background_labels to the end, where they are expected below
+		// srcCols maps the (reordered) columns that are processed to the columns of the input sheet
+		srcCols := excelutil.MoveToEnd(wb.Dims[1], nil)
+		srcHeader := m[id]
+		if len(bgLabels) > 0 {
+			bgCols, err := excelutil.FindColumns(m[id], bgLabels)
+			if err != nil {
+				log.Fatalf("cannot use --background_labels for sheet %s: %s\n", wb.SheetNames[i], err)
+			}
+			srcCols = excelutil.MoveToEnd(wb.Dims[1], bgCols)
+			m[id] = excelutil.Reorder(srcHeader, srcCols)
+		}
+
+		// determine the number of trailing background columns of the current sheet
+		nBg, ok := bgCounts[wb.SheetNames[i]]
+		if !ok {
+			nBg = bgCounts[""]
+		}
+		if len(bgLabels) > 0 {
+			nBg = len(bgLabels)
+		} else if nBg == 0 {
+			nBg = excelutil.DetectBackgroundColumns(m[id])
+			if nBg == 0 {
+				fmt.Println("could not detect background columns, using default of 2")
+				nBg = 2
+			} else {
+				fmt.Printf("detected %d background column(s)\n", nBg)
+			}
+		}
+
+		// if the header labels reveal fewer background columns than requested, data columns would be used as background
+		if detected := excelutil.DetectBackgroundColumns(m[id]); len(bgLabels) == 0 && detected > 0 && detected < nBg {
+			fmt.Printf("warning: sheet %s has only %d labeled background column(s) but %d were requested, using %d instead\n",
+				wb.SheetNames[i], detected, nBg, detected)
+			nBg = detected
+		}
+
+		// without labels, the layout reveals fewer background columns if the requested ones would leave an incomplete well
+		if detected := excelutil.DetectBackgroundColumns(m[id]); len(bgLabels) == 0 && len(pairSuffixes) == 0 && detected == 0 {
+			if fit := excelutil.FitBackgroundColumns(wb.Dims[1], nBg); fit > 0 && fit < nBg {
+				fmt.Printf("warning: sheet %s has %d columns, which only fit complete wells with %d background column(s) but %d were requested, using %d instead\n",
+					wb.SheetNames[i], wb.Dims[1], fit, nBg, fit)
+				nBg = fit
+			}
+		}
+		if nBg >= wb.Dims[1]-1 {
+			log.Fatalf("sheet %s has %d columns which is too few for %d background column(s)\n", wb.SheetNames[i], wb.Dims[1], nBg)
+		}
+
+		// with --pair_by_header, the channels of every well are paired by their headers and arranged like the default layout
+		// (numerator, denominator, and a skipped third column per well) in front of the background columns
+		if len(pairSuffixes) > 0 {
+			pairs, err := excelutil.PairColumns(m[id][1:wb.Dims[1]-nBg], pairSuffixes[0], pairSuffixes[1])
+			if err != nil {
+				log.Fatalf("cannot use --pair_by_header for sheet %s: %s\n", wb.SheetNames[i], err)
+			}
+			order := []int{srcCols[0]}
+			for _, pair := range pairs {
+				order = append(order, srcCols[pair[0]+1], srcCols[pair[1]+1], srcCols[0]) // the time column is never read as third column
+			}
+			srcCols = append(order, srcCols[wb.Dims[1]-nBg:]...)
+			m[id] = excelutil.Reorder(srcHeader, srcCols)
+			wb.Dims[1] = len(srcCols)
+			fmt.Printf("paired %d well(s) by their headers\n", len(pairs))
+		}
+
+		// parse the well selection and validate it against the number of wells in the current sheet
+		var selected map[int]bool
+		if *columns != "" {
+			numWells := (wb.Dims[1] - nBg + 1) / 3
+			selected, err = excelutil.ParseColumnSelection(*columns, numWells)
+			if err != nil {
+				log.Fatalf("error while parsing --columns: %s\n", err)
+			}
+		}
+
+		// only the time column and the channels and backgrounds of the selected wells are parsed, so that the unused third
+		// column of every well may hold text or be empty
+		usedCols := []int{srcCols[0]}
+		for j := 1; j < (wb.Dims[1] - nBg); j++ {
+			if j%excelutil.SKIP == 0 || (selected != nil && !selected[(j-1)/3+1]) {
+				continue
+			}
+			offset := nBg
+			if ((j + 1) % 3) == 0 {
+				offset = nBg - 1
+			}
+			if offset < 1 {
+				offset = 1
+			}
+			usedCols = append(usedCols, srcCols[j], srcCols[wb.Dims[1]-offset])
+		}
+
+		// parse the data matrix below the header row (srcRows holds the source row of every data row, since --empty=skip
+		// leaves out rows)
+		data, srcRows, err := wb.DataColumnsContext(ctx, wb.SheetNames[i], id+1, usedCols)
+		if err == context.DeadlineExceeded && expired(outSheet) {
+			continue
+		} else if err != nil {
+			log.Fatalf("fatal error while parsing data: %s\n", err)
+		}
+		outSheets = append(outSheets, outSheet)
+		if len(bgLabels) > 0 || len(pairSuffixes) > 0 {
+			for r, row := range data {
+				reordered := make([]float64, len(srcCols))
+				for c, src := range srcCols {
+					reordered[c] = math.NaN()
+					if src < len(row) {
+						reordered[c] = row[src]
+					}
+				}
+				data[r] = reordered
+			}
+		}
+
+		// restrict processing to the rows within --time_range (the time is in the first column)
+		kFrom, kTo := id+1, id+1+len(data)
+		if opts.TimeRange != "" {
+			times := make([]float64, len(data))
+			for r := range data {
+				times[r] = data[r][0]
+			}
+			first, last, err := excelutil.TimeRows(times, timeFrom, timeTo)
+			if err != nil {
+				log.Fatalf("cannot use --time_range for sheet %s: %s\n", wb.SheetNames[i], err)
+			}
+			kFrom, kTo = id+1+first, id+2+last
+			fmt.Printf("processing rows %d to %d (--time_range=%s)\n", srcRows[first]+1, srcRows[last]+1, opts.TimeRange)
+		}
+
+		// copy the raw data next to the transformed data that its formulas refer to
+		var rawSheet string
+		if *formulas {
+			rawSheet = excelutil.UniqueSheetName(xlsxTransformed, excelutil.SheetName("raw {name}", wb.SheetNames[i]))
+			_ = xlsxTransformed.NewSheet(rawSheet)
+			excelutil.CopyValues(xlsxTransformed, rawSheet, wb.XLSX, wb.SheetNames[i])
+			rawSheets[outSheet] = rawSheet
+		}
+
+		// collect the column mapping of this sheet for --explain
+		mapping := make([]string, 0)
+
+		// the raw values and the backgrounds of every transformed column (only collected with --order=ratio_then_correct)
+		uncorrected := make([][]float64, 0)
+		backgrounds := make([][]float64, 0)
+
+		// initialize a column counter and a ratio counter
+		colCounter := 1
+		ratioCounter := 1
+
+		// start analysis
+		for j := 1; j < (wb.Dims[1] - nBg); j++ { // don't want the trailing background columns
+			// set column counter and ratio counter to 1 whenever a new worksheet is processed
+			if j == 1 {
+				colCounter = 1
+				ratioCounter = 1
+			}
+
+			if mod := j % excelutil.SKIP; mod == 0 {
+				if opts.Verbose {
+					fmt.Printf("skipping unwanted column: %d\n", j)
+				}
+				continue
+			}
+			well := (j-1)/3 + 1
+			if selected != nil && !selected[well] {
+				if opts.Verbose {
+					fmt.Printf("skipping column %d of unselected well %d\n", j, well)
+				}
+				continue
+			}
+
+			// create a column header with the same value as in the original sheet
+			currentCol := fmt.Sprintf("%s1", excelutil.GetColumn(colCounter))
+			xlsxTransformed.SetCellValue(outSheet, currentCol, m[id][j])
+			if opts.PreserveFormatting {
+				srcCell := fmt.Sprintf("%s%d", excelutil.GetColumn(srcCols[j]+1), id+1)
+				excelutil.CopyCellFormat(xlsxTransformed, outSheet, currentCol, wb.XLSX, wb.SheetNames[i], srcCell)
+			}
+
+			// verbose output option lets the user see whenever a new column header is written
+			if opts.Verbose {
+				fmt.Printf("wrote new column header: %v in %s\n", m[id][j], currentCol)
+			}
+			if opts.EmitRawPairs {
+				rawPairs[outSheet] = append(rawPairs[outSheet], make([]float64, 0, (kTo-kFrom)/(opts.Downsample)+1))
+			}
+			if *order == "ratio_then_correct" {
+				uncorrected = append(uncorrected, make([]float64, 0))
+				backgrounds = append(backgrounds, make([]float64, 0))
+			}
+
+			// offset indicates which background column should be used
+			// the first background column belongs to the enumerator, the second one to the denominator
+			var offset int
+			switch {
+			case ((j + 1) % 3) == 0:
+				offset = nBg - 1
+			case ((j + 2) % 3) == 0:
+				offset = nBg // because go is 0 indexed
+			default:
+				log.Fatal("something went wrong while performing background corrections")
+			}
+			if offset < 1 {
+				offset = 1 // a single background column is used for both channels
+			}
+
+			// record which columns were combined (ratios divide the first channel of a well by the second one)
+			if *explain {
+				role := "numerator"
+				if ((j + 1) % 3) == 0 {
+					role = "denominator"
+				}
+				mapping = append(mapping, fmt.Sprintf("%s\t%s\t%s (%s)\t%s", excelutil.GetColumn(srcCols[j]+1), excelutil.GetColumn(colCounter),
+					excelutil.GetColumn(ratioCounter), role, excelutil.GetColumn(srcCols[wb.Dims[1]-offset]+1)))
+			}
+
+			for k := kFrom; k < kTo; k += opts.Downsample {
+				// perform background correction of values
+				v1 := data[k-id-1][j]
+				v2 := data[k-id-1][(wb.Dims[1] - offset)]
+				srcRow := srcRows[k-id-1] + 1
+
+				// write corrected value to cell in new workbook (while always starting at row 2, because row 1 holds the labels)
+				currentCell := fmt.Sprintf("%s%d", excelutil.GetColumn(colCounter), (k-kFrom)/(opts.Downsample)+2)
+				xlsxTransformed.SetCellValue(outSheet, currentCell, save.Inf.CellValue(v1-v2))
+				if *formulas {
+					// the value stays as cached result of the formula, which is what the ratios are computed from
+					formula := fmt.Sprintf("%s-%s", excelutil.CellRef(rawSheet, srcCols[j]+1, srcRow), excelutil.CellRef(rawSheet, srcCols[wb.Dims[1]-offset]+1, srcRow))
+					xlsxTransformed.SetCellFormula(outSheet, currentCell, formula)
+				}
+				if opts.Annotate {
+					text := fmt.Sprintf("source=%s!%s%d, bg=%s!%s%d, op=subtract", wb.SheetNames[i], excelutil.GetColumn(srcCols[j]+1), srcRow,
+						wb.SheetNames[i], excelutil.GetColumn(srcCols[wb.Dims[1]-offset]+1), srcRow)
+					if err := excelutil.AnnotateCell(xlsxTransformed, outSheet, currentCell, text); err != nil {
+						log.Fatalf("error while annotating %s: %s\n", currentCell, err)
+					}
+				}
+
+				if opts.EmitRawPairs {
+					last := len(rawPairs[outSheet]) - 1
+					rawPairs[outSheet][last] = append(rawPairs[outSheet][last], v1)
+				}
+				if *order == "ratio_then_correct" {
+					last := len(uncorrected) - 1
+					uncorrected[last] = append(uncorrected[last], v1)
+					backgrounds[last] = append(backgrounds[last], v2)
+				}
+
+				// with verbose output, every original and new value will be printed to Stdout
+				if opts.Verbose {
+					fmt.Printf("default - old value: %v, bg: %v, corrected: %v\n", v1, v2, v1-v2)
+				}
+			}
+
+			// create a column header for ratios after the denominator column of every well
+			if ((j + 1) % 3) == 0 {
+				// write column headers
+				currentCol := fmt.Sprintf("%s1", excelutil.GetColumn(ratioCounter))
+				name := fmt.Sprintf("cell %d", wellBase+well)
+				if labelMap != nil {
+					// match the position of the well, the default header, or a source header of either channel
+					name = excelutil.MapLabel(labelMap, name, strconv.Itoa(well), name, m[id][j-1], m[id][j])
+				}
+				currentCell := excelutil.RatioHeader(name, *enumLabel, *denomLabel)
+				xlsxRatio.SetCellValue(outSheet, currentCol, currentCell)
+				if *groupBy == "condition" {
+					// the condition of a well is its label, the column of its group sheet is named after its sheet and position
+					condition := excelutil.MapLabel(labelMap, "", strconv.Itoa(well), fmt.Sprintf("cell %d", wellBase+well), m[id][j-1], m[id][j])
+					grouped[outSheet] = append(grouped[outSheet], excelutil.GroupedColumn{Group: condition, Header: fmt.Sprintf("%s cell %d", outSheet, wellBase+well)})
+				}
+
+				// increment the ratio Counter
+				ratioCounter++
+			}
+
+			// increment column counter and print current column ONLY if no column is skipped (and verbose output is true)
+			if opts.Verbose {
+				fmt.Printf("current column: %d\n", colCounter)
+			}
+			colCounter++
+		}
+
+		// with --global_numbering, the wells of the next sheet are numbered after the wells of this one
+		if *globalNumbering {
+			wellBase += (wb.Dims[1] - nBg + 1) / 3
+		}
+
+		// print which source columns ended up in which output columns
+		if *explain {
+			fmt.Printf("column mapping of %s:\n", wb.SheetNames[i])
+			tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+			fmt.Fprintln(tw, "source\ttransformed\tratio\tbackground")
+			for _, line := range mapping {
+				fmt.Fprintln(tw, line)
+			}
+			tw.Flush()
+		}
+
+		// print the first rows of the transformed data
+		if opts.Preview > 0 {
+			fmt.Printf("preview of transformed data of %s:\n", wb.SheetNames[i])
+			excelutil.PrintPreview(os.Stdout, xlsxTransformed.GetRows(outSheet), opts.Preview)
+		}
+
+		if expired(outSheet) {
+			continue
+		}
+
+		// done with analysis of one sheet in workbook print summary statistics
+		fmt.Printf("summary:\n\tnumber of processed [rows columns]- %v\n\n", wb.Dims)
+
+		// write the intermediate data of every stage to --debug_dump
+		dump := func(stage string, rows [][]string) {
+			if *debugDump == "" || opts.DryRun {
+				return
+			}
+			headers, values := excelutil.SheetData(rows)
+			if err := excelutil.DebugDump(*debugDump, outSheet, stage, headers, values); err != nil {
+				log.Fatalf("%s\n", err)
+			}
+		}
+		dump("transform", xlsxTransformed.GetRows(outSheet))
+
+		// without the ratio stage (see --stages), the sheet is done once its data are transformed
+		if !stages["ratio"] {
+			finishSheet(wb.SheetNames[i], outSheet)
+			continue
+		}
+
+		// iterate over data in current sheet to create ratios that can be written to xlsxRatio
+		// get transformed data
+		tm := xlsxTransformed.GetRows(outSheet)
+
+		// continue if current sheet is empty
+		if tm == nil || len(tm) < 2 || len(tm[0]) < 2 {
+			finishSheet(wb.SheetNames[i], outSheet)
+			continue
+		}
+
+		// initialize another counter
+		rc := 1
+
+		// the per-channel baseline is computed from the parsed transformed data
+		var tmValues [][]float64
+		if *channelBaseline != "" {
+			if chanTo > len(tm) {
+				log.Fatalf("cannot use --channel_baseline=%s for sheet %s (only %d measurements)\n", *channelBaseline, wb.SheetNames[i], len(tm)-1)
+			}
+			_, tmValues = excelutil.SheetData(tm)
+		}
+
+		// keep the unsmoothed ratios of every column for the peak search
+		rawRatios := make([][]float64, 0)
+
+		// remember the intended ratios to verify them after writing
+		var written [][]float64
+		if *verify {
+			n := len(tm) - 1
+			if n > opts.TrimmedOutput {
+				n = opts.TrimmedOutput
+			}
+			written = make([][]float64, n)
+			for r := range written {
+				written[r] = make([]float64, (len(tm[0])+1)/2)
+			}
+		}
+
+		for c := 0; c < len(tm[0]); c += 2 { // iterate over every second column
+			// mean of both channels within --channel_baseline (both stay 0 without per-channel baseline)
+			var base1, base2 float64
+			if *channelBaseline != "" {
+				ch1, ch2 := make([]float64, len(tmValues)), make([]float64, len(tmValues))
+				for r := range tmValues {
+					ch1[r], ch2[r] = tmValues[r][c], tmValues[r][c+1]
+				}
+				base1 = excelutil.WindowMean(ch1, chanFrom-1, chanTo-1)
+				base2 = excelutil.WindowMean(ch2, chanFrom-1, chanTo-1)
+			}
+
+			// parse both channels (rows starting at row two, because row one is the header) up to --trimmed_output
+			// measurements; a channel ends at its last non-empty cell, so channels of different lengths only yield the
+			// ratios of the measurements of the shorter one
+			if opts.Verbose && len(tm)-1 > opts.TrimmedOutput {
+				fmt.Printf("trimmed after %d measurements\n", opts.TrimmedOutput)
+			}
+			channels := [2][]float64{}
+			for ch, base := range []float64{base1, base2} {
+				channels[ch] = make([]float64, 0)
+				for r := 1; r <= excelutil.ColumnLength(tm, c+ch) && r <= opts.TrimmedOutput; r++ {
+					// string to float conversion (empty cells within a column are the missing values of --empty=nan)
+					v := math.NaN()
+					if strings.TrimSpace(tm[r][c+ch]) != "" {
+						v, err = strconv.ParseFloat(tm[r][c+ch], 64)
+						if err != nil {
+							log.Fatalf("fatal error converting indices: %s\n", err)
+						}
+					}
+					channels[ch] = append(channels[ch], v-base)
+				}
+			}
+			// with --denominator_smooth, the ratios are computed with a rolling mean of the denominator (the numerator stays raw)
+			if *denomSmooth > 1 {
+				channels[1] = excelutil.RollingMean(channels[1], *denomSmooth)
+			}
+			ratios, equal := excelutil.ComputeRatios(channels[0], channels[1])
+			if !equal {
+				fmt.Printf("warning: %s has %d measurements but %s has %d in sheet %s, using the first %d\n", excelutil.ColumnHeader(tm, c), len(channels[0]),
+					excelutil.ColumnHeader(tm, c+1), len(channels[1]), wb.SheetNames[i], len(ratios))
+			}
+
+			// with --order=ratio_then_correct, the ratio of the raw values is corrected by the ratio of the backgrounds
+			if *order == "ratio_then_correct" {
+				for r := range ratios {
+					ratios[r] = excelutil.RatioThenCorrect(uncorrected[c][r], uncorrected[c+1][r], backgrounds[c][r], backgrounds[c+1][r])
+				}
+			}
+
+			// winsorize single-sample spikes (e.g. bubbles in the perfusion) before ranking and output
+			if *clip != "" {
+				ratios = excelutil.ClipOutliers(ratios, clipLow, clipHigh)
+			}
+
+			// smooth the ratios that are written with --output_smooth (peaks are still searched in the raw ratios)
+			rawRatios = append(rawRatios, ratios)
+			if *outputSmooth > 0 {
+				ratios = excelutil.EWMA(ratios, *outputSmooth)
+			}
+
+			column := make([][]float64, len(ratios))
+			for r, ratio := range ratios {
+				column[r] = []float64{ratio}
+				if written != nil {
+					written[r][rc-1] = ratio
+				}
+				if opts.Verbose {
+					fmt.Printf("wrote ratio: %v\n", ratio)
+				}
+			}
+			// the column starts below its header, i.e. at row 2
+			if err := excelutil.WriteMatrixNaNAware(xlsxRatio, outSheet, column, excelutil.GetColumn(rc)+"2", save.Inf); err != nil {
+				log.Fatalf("error while writing ratios: %s\n", err)
+			}
+			rc++
+		}
+
+		// read the ratios back and report every value that did not survive serialization
+		if *verify {
+			diffs := excelutil.VerifySheet(xlsxRatio, outSheet, written, 1e-12, save.Inf)
+			for _, d := range diffs {
+				fmt.Printf("verification failed: %s\n", d)
+			}
+			verifyCounts = append(verifyCounts, fmt.Sprintf("%s: %d drifting cells", wb.SheetNames[i], len(diffs)))
+		}
+
+		if expired(outSheet) {
+			continue
+		}
+
+		// add two chart to every ratio data sheet
+		// the only purpose of 'shnm' is to reduce the length of the following assignments; don't use it anywhere else
+		shnm := outSheet
+		// ChartSettings1 defines the settings required to add a line graphs for columns 1 - 6
+		ChartSettings1 := fmt.Sprintf("{\"type\":\"line\",\"dimension\":{\"width\":1040,\"height\":640},\"series\":[{\"name\":\"%v!$A$1\",\"values\":\"%v!$A$2:$A$470\"},{\"name\":\"%v!$B$1\",\"values\":\"%v!$B$2:$B$470\"},{\"name\":\"%v!$C$1\",\"values\":\"%v!$C$2:$C$470\"},{\"name\":\"%v!$D$1\",\"values\":\"%v!$D$2:$D$470\"},{\"name\":\"%v!$E$1\",\"values\":\"%v!$E$2:$E$470\"},{\"name\":\"%v!$F$1\",\"values\":\"%v!$F$2:$F$470\"}],\"title\":{\"name\":\"Response Profile\"}}", shnm, shnm, shnm, shnm, shnm, shnm, shnm, shnm, shnm, shnm, shnm, shnm)
+		// ChartSettings2 is similar to ChartSettings1 but specifies settings for columns 7 - 12
+		ChartSettings2 := fmt.Sprintf("{\"type\":\"line\",\"dimension\":{\"width\":1040,\"height\":640},\"series\":[{\"name\":\"%v!$G$1\",\"values\":\"%v!$G$2:$G$470\"},{\"name\":\"%v!$H$1\",\"values\":\"%v!$H$2:$H$470\"},{\"name\":\"%v!$I$1\",\"values\":\"%v!$I$2:$I$470\"},{\"name\":\"%v!$J$1\",\"values\":\"%v!$J$2:$J$470\"},{\"name\":\"%v!$K$1\",\"values\":\"%v!$K$2:$K$470\"},{\"name\":\"%v!$L$1\",\"values\":\"%v!$L$2:$L$470\"}],\"title\":{\"name\":\"Response Profile\"}}", shnm, shnm, shnm, shnm, shnm, shnm, shnm, shnm, shnm, shnm, shnm, shnm)
+		if opts.AddChart {
+			xlsxRatio.AddChart(outSheet, "A470", ChartSettings1)
+			xlsxRatio.AddChart(outSheet, "R470", ChartSettings2)
+			if opts.Verbose {
+				fmt.Printf("added chart to sheet %v with settings: %s\n", wb.SheetNames[i], ChartSettings1)
+				fmt.Printf("added chart to sheet %v with settings: %s\n", wb.SheetNames[i], ChartSettings2)
+			}
+		}
+
+		dump("ratio", xlsxRatio.GetRows(outSheet))
+
+		// without the sort stage (see --stages), neither peaks are searched nor ratios sorted
+		if !stages["sort"] {
+			finishSheet(wb.SheetNames[i], outSheet)
+			continue
+		}
+
+		// look for peaks with the range of --start (opts.Start) and --stop (opts.Stop) and sort the ratio columns accordingly
+		// use a map to remember the columns that were already copied to the new workbook (xlsxSorted)
+		ratioStrings := xlsxRatio.GetRows(outSheet)
+
+		// there is nothing to sort if the sheet did not produce a single row of values
+		if len(ratioStrings) < 2 || len(ratioStrings[0]) == 0 {
+			fmt.Printf("skipping sort of sheet %s (no values, e.g. because of --trimmed_output)\n", wb.SheetNames[i])
+			finishSheet(wb.SheetNames[i], outSheet)
+			continue
+		}
+		peaks := make(map[int]float64)
+		peakRows := make(map[int]int)
+
+		// parse all ratio columns; cells that cannot be parsed (e.g. the empty cells below a column that is shorter than the
+		// others, see ComputeRatios) are treated as missing values, so that every column has the length of the sheet
+		ratioCols := make([][]float64, len(ratioStrings[0]))
+		for c := range ratioCols {
+			ratioCols[c] = make([]float64, len(ratioStrings)-1)
+			for r := 1; r < len(ratioStrings); r++ {
+				val, err := strconv.ParseFloat(ratioStrings[r][c], 64)
+				if err != nil {
+					val = math.NaN()
+				}
+				ratioCols[c][r-1] = val
+			}
+		}
+
+		// with --output_smooth, the written ratios are smoothed but peaks are searched in the raw ratios (which are as long
+		// as their column, so the missing values below shorter columns are kept)
+		if *outputSmooth > 0 {
+			for c := range ratioCols {
+				copy(ratioCols[c], rawRatios[c])
+			}
+		}
+
+		// the time of every ratio row is taken from the first column of the data (downsampled like the rows)
+		times := make([]float64, kTo-kFrom)
+		for r := range times {
+			times[r] = data[kFrom-id-1+r][0]
+		}
+		ratioTimes := excelutil.Downsample(times, opts.Downsample)
+		if len(ratioTimes) > len(ratioStrings)-1 {
+			ratioTimes = ratioTimes[:len(ratioStrings)-1]
+		}
+
+		// find columns with identical ratios (e.g. because of copy-paste errors) and remember them for the summary
+		if *warnDuplicates {
+			for _, pair := range excelutil.FindDuplicateColumns(ratioCols, 1e-9) {
+				warning := fmt.Sprintf("%s: %s and %s are identical", wb.SheetNames[i], ratioStrings[0][pair[0]], ratioStrings[0][pair[1]])
+				fmt.Printf("warning: %s\n", warning)
+				duplicateWarnings = append(duplicateWarnings, warning)
+			}
+		}
+
+		// compute the correlation matrix of all ratio columns
+		if *correlation {
+			_ = xlsxCorrelation.NewSheet(outSheet)
+			corr := excelutil.CorrelationMatrix(ratioCols)
+
+			// write the ratio headers to the first row and column, followed by the coefficients (the matrix is symmetric)
+			for c := range corr {
+				xlsxCorrelation.SetCellValue(outSheet, fmt.Sprintf("%s1", excelutil.GetColumn(c+2)), ratioStrings[0][c])
+				xlsxCorrelation.SetCellValue(outSheet, fmt.Sprintf("A%d", c+2), ratioStrings[0][c])
+			}
+			if err := excelutil.WriteMatrixNaNAware(xlsxCorrelation, outSheet, corr, "B2", save.Inf); err != nil {
+				log.Fatalf("error while writing correlation matrix: %s\n", err)
+			}
+		}
+
+		// standardize every ratio column (e.g. for clustering)
+		if *zscore {
+			_ = xlsxZScore.NewSheet(outSheet)
+			standardized := make([][]float64, len(ratioTimes))
+			for r := range standardized {
+				standardized[r] = make([]float64, len(ratioCols))
+			}
+			for c, col := range ratioCols {
+				for r, v := range excelutil.ZScore(col) {
+					standardized[r][c] = v
+				}
+			}
+			for c, h := range ratioStrings[0] {
+				xlsxZScore.SetCellValue(outSheet, fmt.Sprintf("%s1", excelutil.GetColumn(c+1)), h)
+			}
+			if err := excelutil.WriteMatrixNaNAware(xlsxZScore, outSheet, standardized, "A2", save.Inf); err != nil {
+				log.Fatalf("error while writing z-scores: %s\n", err)
+			}
+		}
+
+		// remember when every column reaches its peak (in the unit of the time column)
+		timesToPeak := make([]float64, len(ratioStrings[0]))
+		for c := range timesToPeak {
+			timesToPeak[c] = math.NaN()
+		}
+
+		// peaks within every window of --windows by column
+		windowPeaks := make([][]float64, len(ratioStrings[0]))
+
+		// with --sort_by=deltaf, the baseline window must lie within the measurements of this sheet
+		var amplitudes []float64
+		if *sortBy == "deltaf" {
+			if baselineTo > len(ratioStrings) {
+				log.Fatalf("cannot use --baseline_window=%s for sheet %s (only %d measurements)\n", *baselineWindow, wb.SheetNames[i], len(ratioStrings)-1)
+			}
+			amplitudes = make([]float64, len(ratioStrings[0]))
+		}
+
+		// keep the columns and measurements of the embedded charts (A - L, rows 2 - 470) for --png_charts
+		if *pngCharts {
+			plotted := make([][]float64, 0)
+			for c := 0; c < len(ratioCols) && c < 12; c++ {
+				col := ratioCols[c]
+				if len(col) > 469 {
+					col = col[:469]
+				}
+				plotted = append(plotted, col)
+				chartLabels[outSheet] = append(chartLabels[outSheet], ratioStrings[0][c])
+			}
+			chartData[outSheet] = plotted
+		}
+
+		// search the peak of every column and the row it occurs in within --start and --stop
+		for c := 0; c < len(ratioStrings[0]); c++ {
+			// check validity of stop value for search
+			var stop int
+			if opts.Stop <= len(ratioStrings) {
+				stop = opts.Stop
+			} else {
+				stop = len(ratioStrings)
+			}
+
+			// remove a linear trend from and/or smooth the whole column (in this order) before the peak search
+			values := ratioCols[c]
+			if *detrend {
+				values = excelutil.Detrend(values)
+			}
+			if rankAlpha > 0 {
+				values = excelutil.EWMA(values, rankAlpha)
+			}
+
+			// the peak is the max of the parsed values within the search range (NaN if there are none, which ranks last)
+			peaks[c] = math.NaN()
+			for r := opts.Start; r < stop; r++ {
+				val := values[r-1]
+				if opts.Verbose {
+					fmt.Printf("searching %v at [%d][%d]\n", val, r, c)
+				}
+				if math.IsNaN(val) {
+					continue
+				}
+				if math.IsNaN(peaks[c]) || val > peaks[c] {
+					peaks[c] = val
+					peakRows[c] = r + 1 // rows start at 1 in Excel
+				}
+			}
+
+			// time of the peak within the search range
+			if opts.Start < stop {
+				timesToPeak[c] = excelutil.TimeToPeak(values[opts.Start-1:stop-1], ratioTimes[opts.Start-1:stop-1])
+			}
+
+			// peaks within --windows (which are counted in measurements like --start and --stop)
+			if len(windows) > 0 {
+				shifted := make([][2]int, len(windows))
+				for w := range windows {
+					shifted[w] = [2]int{windows[w][0] - 1, windows[w][1] - 1}
+				}
+				windowPeaks[c] = excelutil.WindowPeaks(values, shifted)
+			}
+
+			// peak minus mean baseline, both counted in measurements like --start and --stop
+			if amplitudes != nil {
+				amplitudes[c] = excelutil.DeltaF(values, baselineFrom-1, baselineTo-1, opts.Start-1, stop-1)
+			}
+		}
+
+		// rank by response amplitude or by the peak within one of --windows instead of the peak itself
+		for c := 0; c < len(ratioStrings[0]); c++ {
+			if amplitudes != nil {
+				peaks[c] = amplitudes[c]
+			}
+			if *sortWindow > 0 {
+				peaks[c] = windowPeaks[c][*sortWindow-1]
+			}
+		}
+		if opts.Verbose {
+			fmt.Printf("%+v\n", peaks)
+		}
+		if expired(outSheet) {
+			continue
+		}
+
+		// collect the ranked values in column order (the peak ratios, or the deltaF amplitudes of --sort_by=deltaf or the
+		// peaks within --sort_window) and compute the fraction of cells whose value exceeds the response threshold
+		peakValues := make([]float64, 0)
+		for c := 0; c < len(ratioStrings[0]); c++ {
+			peakValues = append(peakValues, peaks[c])
+		}
+		rate := math.NaN()
+		if *responseThreshold != 0 {
+			rankedValues := "peak ratios"
+			if *sortWindow > 0 {
+				rankedValues = fmt.Sprintf("peaks within window %d", *sortWindow)
+			} else if *sortBy == "deltaf" {
+				rankedValues = "deltaF amplitudes"
+			}
+			rate = excelutil.ResponseRate(peakValues, *responseThreshold)
+			responseRates = append(responseRates, fmt.Sprintf("%s: %.3f", wb.SheetNames[i], rate))
+			fmt.Printf("response rate of %s (%s above threshold %v): %.3f\n", wb.SheetNames[i], rankedValues, *responseThreshold, rate)
+		}
+		responders := excelutil.CountResponders(peakValues, timesToPeak, *responderPeak, *responderLatency)
+		if *responderPeak >= 0 || *responderLatency >= 0 {
+			responderCounts = append(responderCounts, fmt.Sprintf("%s: %d of %d", wb.SheetNames[i], responders, len(peakValues)))
+			fmt.Printf("responders of %s: %d of %d\n", wb.SheetNames[i], responders, len(peakValues))
+		}
+
+		// write the peak value of every well below its header
+		if *peaksOnly {
+			_ = xlsxPeaks.NewSheet(outSheet)
+			// the peak values are written to row 2, the times to peak to row 3, and the peaks within --windows below them
+			stats := [][]float64{peakValues, timesToPeak}
+			for c := range peakValues {
+				xlsxPeaks.SetCellValue(outSheet, fmt.Sprintf("%s1", excelutil.GetColumn(c+1)), ratioStrings[0][c])
+				for w, wp := range windowPeaks[c] {
+					for len(stats) < w+3 {
+						row := make([]float64, len(peakValues))
+						for k := range row {
+							row[k] = math.NaN()
+						}
+						stats = append(stats, row)
+					}
+					stats[w+2][c] = wp
+				}
+			}
+			if err := excelutil.WriteMatrixNaNAware(xlsxPeaks, outSheet, stats, "A2", save.Inf); err != nil {
+				log.Fatalf("error while writing peaks: %s\n", err)
+			}
+		}
+
+		// add one row per well to the long-format peaks table; ranks follow --sort_order within every sheet
+		if *peaksLong {
+			ranks := excelutil.Ranks(peakValues, opts.SortOrder == "desc")
+			for c, p := range peakValues {
+				longPeaks = append(longPeaks, []string{wb.SheetNames[i], ratioStrings[0][c], strconv.FormatFloat(p, 'f', -1, 64),
+					strconv.FormatFloat(timesToPeak[c], 'f', -1, 64), strconv.Itoa(ranks[c])})
+			}
+		}
+
+		// write ratios and peaks to the SQLite database (peak rows are counted like the measurements, starting at 1)
+		if sqlWriter != nil {
+			headers, values := excelutil.SheetData(ratioStrings)
+			rows := make([]int, len(peakValues))
+			for c := range rows {
+				rows[c] = peakRows[c] - 1
+			}
+			if err := sqlWriter.WriteSheet(wb.SheetNames[i], headers, values); err != nil {
+				sqlWriter.Rollback()
+				log.Fatalf("error while writing to database: %s\n", err)
+			}
+			if err := sqlWriter.WritePeaks(wb.SheetNames[i], headers, peakValues, rows); err != nil {
+				sqlWriter.Rollback()
+				log.Fatalf("error while writing to database: %s\n", err)
+			}
+		}
+
+		// write every ratio column with its times to a separate file
+		if *splitColumns != "" && !opts.DryRun {
+			headers, values := excelutil.SheetData(ratioStrings)
+			if err := excelutil.SplitByColumn(outSheet, headers, values, ratioTimes, *splitColumns, save); err != nil {
+				log.Fatalf("error while splitting columns: %s\n", err)
+			}
+		}
+
+		// write a histogram of the peak values with the bin centers in the first and the counts in the second column
+		if *histogram > 0 {
+			counts, edges := excelutil.Histogram(peakValues, *histogram)
+			_ = xlsxHistogram.NewSheet(outSheet)
+			xlsxHistogram.SetCellValue(outSheet, "A1", "bin center")
+			xlsxHistogram.SetCellValue(outSheet, "B1", "count")
+			for b := range counts {
+				xlsxHistogram.SetCellValue(outSheet, fmt.Sprintf("A%d", b+2), (edges[b]+edges[b+1])/2)
+				xlsxHistogram.SetCellValue(outSheet, fmt.Sprintf("B%d", b+2), counts[b])
+			}
+		}
+
+		// print ordered values to screen if flag is set to true; make sure to copy peaks, though!
+		tmpMap := make(map[int]float64)
+		for key, val := range peaks {
+			tmpMap[key] = val
+		}
+		if opts.PrintOrder {
+			fmt.Printf("ordered values for %s: ", wb.SheetNames[i])
+			for {
+				if len(tmpMap) == 0 {
+					break
+				}
+				key := excelutil.FindMaxElem(tmpMap)
+				if opts.PrintPrecision < 0 {
+					fmt.Printf("cell %d: %v ", key+1, tmpMap[key])
+				} else {
+					fmt.Printf("cell %d: %.*f ", key+1, opts.PrintPrecision, tmpMap[key])
+				}
+				delete(tmpMap, key)
+			}
+			fmt.Println()
+		}
+
+		// remember the top responder of the current sheet for the summary sheet
+		if (*summarySheet || qc.Enabled()) && len(peaks) > 0 {
+			key := excelutil.FindMaxElem(peaks)
+			// amplitude within --start/--stop relative to the noise within --baseline_window
+			stop := opts.Stop
+			if stop > len(ratioStrings) {
+				stop = len(ratioStrings)
+			}
+			snr := excelutil.SNR(ratioCols[key], baselineFrom-1, baselineTo-1, opts.Start-1, stop-1)
+			summary := excelutil.SheetSummary{
+				Sheet:        wb.SheetNames[i],
+				TopColumn:    ratioStrings[0][key],
+				Peak:         peaks[key],
+				PeakRow:      peakRows[key],
+				TimeToPeak:   timesToPeak[key],
+				WindowPeaks:  windowPeaks[key],
+				ResponseRate: rate,
+				Responders:   responders,
+				SNR:          snr,
+				Drift:        excelutil.Drift(ratioCols[key], baselineFrom-1, baselineTo-1),
+				Empty:        excelutil.CountNaN(ratioCols),
+			}
+			summary.QCPass, summary.QCReasons = excelutil.QCEvaluate(summary, qc)
+			if qc.Enabled() {
+				if summary.QCPass {
+					fmt.Printf("QC of sheet %s: pass\n", wb.SheetNames[i])
+				} else {
+					fmt.Printf("QC of sheet %s: fail (%s)\n", wb.SheetNames[i], strings.Join(summary.QCReasons, "; "))
+				}
+			}
+			if *summarySheet {
+				summaries = append(summaries, summary)
+			}
+		}
+
+		// rank the keys by their max value (see SortedPermutation) ==> get every column from ratioStrings ==> write to output
+		// with --sort_order=asc, the keys are ranked by their min value instead
+		perm := excelutil.SortedPermutation(peaks, opts.SortOrder)
+		for ii, key := range perm {
+			// verbose output prints every max map key
+			if opts.Verbose {
+				fmt.Printf("dim1: %d, dim2: %d\n", len(ratioStrings[0]), len(ratioStrings))
+				fmt.Printf("key of next value in this map: %v\n", key)
+			}
+
+			// write the header to row 1 and the values below it
+			xlsxSorted.SetCellValue(outSheet, fmt.Sprintf("%s1", excelutil.GetColumn(ii+1)), ratioStrings[0][key])
+			column := make([][]float64, len(ratioStrings)-1)
+			for j := 1; j < len(ratioStrings); j++ {
+				if opts.Verbose {
+					fmt.Printf("writing sorted value %v at [%d][%d]\n", ratioStrings[j][key], key, j)
+				}
+				v, err := strconv.ParseFloat(ratioStrings[j][key], 64)
+				if err != nil {
+					v = math.NaN() // the empty cells below a column that is shorter than the others stay empty
+				}
+				column[j-1] = []float64{v}
+			}
+			if err := excelutil.WriteMatrixNaNAware(xlsxSorted, outSheet, column, excelutil.GetColumn(ii+1)+"2", save.Inf); err != nil {
+				log.Fatalf("error while writing sorted ratios: %s\n", err)
+			}
+		}
+		if opts.ExportOrder {
+			for rank, key := range perm {
+				orderRows = append(orderRows, []string{outSheet, strconv.Itoa(rank + 1), strconv.Itoa(key + 1), ratioStrings[0][key]})
+			}
+		}
+		if *overlayChart > 0 {
+			overlaySizes[outSheet] = [2]int{len(ratioStrings[0]), len(ratioStrings) - 1}
+		}
+
+		dump("sort", xlsxSorted.GetRows(outSheet))
+		finishSheet(wb.SheetNames[i], outSheet)
+	}
+	cancel()
+	excelutil.PrintDelim()
+
+	// print some more statistics
+	fmt.Printf("summary:\n\tnumber of precessed sheets - %d\n", wb.NumSheets)
+	fmt.Printf("\tcreated charts - %v\n", opts.AddChart)
+	fmt.Printf("\tsorted ratios in range [lo][hi] - [%d][%d]\n", opts.Start, opts.Stop)
+	fmt.Printf("\tratios trimmed after %d measurements\n", opts.TrimmedOutput)
+	if *responseThreshold != 0 {
+		fmt.Printf("\tused response threshold: %v\n", *responseThreshold)
+		for _, count := range keptCounts {
+			fmt.Printf("\t\t%s\n", count)
+		}
+		fmt.Println("\tresponse rates:")
+		for _, rate := range responseRates {
+			fmt.Printf("\t\t%s\n", rate)
+		}
+	}
+	if len(responderCounts) > 0 {
+		fmt.Printf("\tresponders (peak > %v, time to peak < %v, negative values are ignored):\n", *responderPeak, *responderLatency)
+		for _, count := range responderCounts {
+			fmt.Printf("\t\t%s\n", count)
+		}
+	}
+	if *verify {
+		fmt.Println("\tverification of written ratios:")
+		for _, count := range verifyCounts {
+			fmt.Printf("\t\t%s\n", count)
+		}
+	}
+	if *warnDuplicates {
+		fmt.Printf("\tduplicate columns - %d\n", len(duplicateWarnings))
+		for _, warning := range duplicateWarnings {
+			fmt.Printf("\t\t%s\n", warning)
+		}
+	}
+
+	// commit everything that was written to the database
+	if sqlWriter != nil {
+		fmt.Printf("writing ratios and peaks to database: %s\n", *sqlitePath)
+		if err := sqlWriter.Close(); err != nil {
+			log.Fatalf("error while writing to database: %s\n", err)
+		}
+	}
+	if len(timedOut) > 0 {
+		fmt.Printf("\tsheets skipped after --sheet_timeout - %s\n", strings.Join(timedOut, ", "))
+	}
+
+	// a dry run does not write any file
+	if opts.DryRun {
+		fmt.Println("dry run: no output files are written")
+		return
+	}
+
+	transformedFileName := fileName("transformed_data")
+	ratioFileName := fileName("ratios")
+	sortedRatioFileName := fileName("sorted_ratios")
+
+	// add the summary sheet to the sorted ratios
+	// (the summary holds text columns and thus can only be written to .xlsx files)
+	sortedSheets := append([]string{}, outSheets...)
+	if *summarySheet && opts.OutputFormat == "xlsx" {
+		sortedSheets = append(sortedSheets, excelutil.WriteSummary(xlsxSorted, summaries, save.Inf))
+	}
+
+	// collect the ratio columns of all sheets by condition
+	xlsxGrouped := excelize.NewFile()
+	var groupSheets []string
+	if *groupBy == "condition" {
+		columns := make([]excelutil.GroupedColumn, 0)
+		for _, name := range outSheets {
+			_, values := excelutil.SheetData(xlsxRatio.GetRows(name))
+			for c, col := range grouped[name] {
+				col.Values = make([]float64, len(values))
+				for r := range values {
+					col.Values[r] = math.NaN()
+					if c < len(values[r]) {
+						col.Values[r] = values[r][c]
+					}
+				}
+				columns = append(columns, col)
+			}
+		}
+		groupSheets = excelutil.WriteGroups(xlsxGrouped, columns, save.Inf)
+	}
+
+	// change the layout of the main outputs
+	applyLayout(xlsxTransformed, xlsxRatio, xlsxSorted, sortedSheets)
+
+	// draw the sorted columns of every sheet into one chart on a separate sheet of the sorted ratios
+	if *overlayChart > 0 && len(overlaySizes) > 0 {
+		chartSheet := excelutil.UniqueSheetName(xlsxSorted, "Charts")
+		_ = xlsxSorted.NewSheet(chartSheet)
+		sortedSheets = append(sortedSheets, chartSheet)
+		k := 0
+		for _, name := range outSheets {
+			size, ok := overlaySizes[name]
+			if !ok {
+				continue
+			}
+			settings := excelutil.OverlayChart(name, originCol, originRow, size[0], size[1], *overlayChart)
+			if err := excelutil.AddOverlayChart(xlsxSorted, chartSheet, fmt.Sprintf("A%d", 1+k*35), settings); err != nil {
+				log.Fatalf("error while adding overlay chart of sheet %s: %s\n", name, err)
+			}
+			if opts.Verbose {
+				fmt.Printf("added overlay chart of sheet %v with settings: %s\n", name, settings)
+			}
+			k++
+		}
+	}
+
+	// save output file
+	fmt.Printf("writing transformed data to file: %s\n", excelutil.OutputPath(opts.OutputFormat, transformedFileName, save.Gzip))
+	if err := excelutil.SaveWorkbook(xlsxTransformed, outSheets, opts.OutputFormat, transformedFileName, save); err != nil {
+		log.Fatalf("error while saving transformed data: %s\n", err)
+	}
+	if stages["ratio"] {
+		fmt.Printf("writing ratios to file: %s\n", excelutil.OutputPath(opts.OutputFormat, ratioFileName, save.Gzip))
+		if err := excelutil.SaveWorkbook(xlsxRatio, outSheets, opts.OutputFormat, ratioFileName, save); err != nil {
+			log.Fatalf("error while saving ratios: %s\n", err)
+		}
+	}
+	if stages["sort"] {
+		fmt.Printf("writing sorted ratios to file: %s\n", excelutil.OutputPath(opts.OutputFormat, sortedRatioFileName, save.Gzip))
+		if err := excelutil.SaveWorkbook(xlsxSorted, sortedSheets, opts.OutputFormat, sortedRatioFileName, save); err != nil {
+			log.Fatalf("error while saving sorted ratios: %s\n", err)
+		}
+	}
+
+	// save a chart of every sheet as png image
+	if *pngCharts {
+		for _, name := range outSheets {
+			if _, ok := chartData[name]; !ok {
+				continue // skipped sheet
+			}
+			pngFileName := fileName(name + "_ratios.png")
+			fmt.Printf("writing chart to file: %s\n", pngFileName)
+			out, err := os.Create(pngFileName)
+			if err != nil {
+				log.Fatalf("error while creating chart: %s\n", err)
+			}
+			err = excelutil.WriteLineChartPNG(out, chartData[name], chartLabels[name], 1040, 640)
+			out.Close()
+			if err != nil {
+				log.Fatalf("error while writing chart: %s\n", err)
+			}
+		}
+	}
+
+	// save the ratios grouped by condition
+	if *groupBy == "condition" {
+		groupedFileName := fileName("grouped_ratios")
+		fmt.Printf("writing ratios grouped by condition to file: %s\n", excelutil.OutputPath(opts.OutputFormat, groupedFileName, save.Gzip))
+		if err := excelutil.SaveWorkbook(xlsxGrouped, groupSheets, opts.OutputFormat, groupedFileName, save); err != nil {
+			log.Fatalf("error while saving grouped ratios: %s\n", err)
+		}
+	}
+
+	// save correlation file
+	if *correlation {
+		correlationFileName := fileName("correlation.xlsx")
+		fmt.Printf("writing correlation matrices to file: %s\n", correlationFileName)
+		if err := excelutil.SaveXLSX(xlsxCorrelation, correlationFileName, save); err != nil {
+			log.Fatalf("error while saving correlation matrices: %s\n", err)
+		}
+	}
+
+	// save the sorted order of the columns
+	if opts.ExportOrder {
+		orderFileName := fileName("order.csv")
+		fmt.Printf("writing sorted order to file: %s\n", excelutil.GzipPath(orderFileName, save.Gzip))
+		if err := excelutil.WriteRecords(orderFileName, orderRows, save.Gzip); err != nil {
+			log.Fatalf("error while saving sorted order: %s\n", err)
+		}
+	}
+
+	// save the data-quality report
+	if opts.QualityReport {
+		fmt.Printf("writing data-quality report to file: %s\n", excelutil.GzipPath(qualityFileName, save.Gzip))
+		saveQualityReport()
+	}
+
+	// save long-format peaks table
+	if *peaksLong {
+		peaksLongFileName := fileName("peaks_long.csv")
+		fmt.Printf("writing long-format peaks table to file: %s\n", excelutil.GzipPath(peaksLongFileName, save.Gzip))
+		if err := excelutil.WriteRecords(peaksLongFileName, longPeaks, save.Gzip); err != nil {
+			log.Fatalf("error while saving long-format peaks table: %s\n", err)
+		}
+	}
+
+	// save z-score file
+	if *zscore {
+		zscoreFileName := fileName("zscore.xlsx")
+		fmt.Printf("writing z-scores to file: %s\n", zscoreFileName)
+		if err := excelutil.SaveXLSX(xlsxZScore, zscoreFileName, save); err != nil {
+			log.Fatalf("error while saving z-scores: %s\n", err)
+		}
+	}
+
+	// save peaks file
+	if *peaksOnly {
+		peaksFileName := fileName("peaks.xlsx")
+		fmt.Printf("writing peak values to file: %s\n", peaksFileName)
+		if err := excelutil.SaveXLSX(xlsxPeaks, peaksFileName, save); err != nil {
+			log.Fatalf("error while saving peak values: %s\n", err)
+		}
+	}
+
+	// save histogram file
+	if *histogram > 0 {
+		histogramFileName := fileName("histogram.xlsx")
+		fmt.Printf("writing histograms to file: %s\n", histogramFileName)
+		if err := excelutil.SaveXLSX(xlsxHistogram, histogramFileName, save); err != nil {
+			log.Fatalf("error while saving histograms: %s\n", err)
+		}
+	}
+
+	// append sorted ratios to an existing workbook
+	if *appendTo != "" {
+		_, statErr := os.Stat(*appendTo)
+		xlsxAppend, err := excelutil.OpenOrCreate(*appendTo)
+		if err != nil {
+			log.Fatalf("error while opening file to append to: %s\n", err)
+		}
+		for idx, name := range outSheets {
+			var appended string
+			if idx == 0 && os.IsNotExist(statErr) {
+				// the default sheet of a newly created workbook is reused for the first sheet
+				appended = excelutil.ReuseDefaultSheet(xlsxAppend, xlsxSorted, name)
+			} else {
+				appended = excelutil.CopySheet(xlsxAppend, xlsxSorted, name)
+			}
+			if opts.Verbose {
+				fmt.Printf("appended sorted ratios of %s as sheet %s\n", name, appended)
+			}
+		}
+		fmt.Printf("appending sorted ratios to file: %s\n", *appendTo)
+		if err := excelutil.SaveXLSX(xlsxAppend, *appendTo, save); err != nil {
+			log.Fatalf("error while saving file: %s\n", err)
+		}
+	}
+
+	// save threshold file
+	if *responseThreshold != 0 {
+		thresholdFileName := fileName("data_with_threshold.xlsx")
+		fmt.Printf("writing threshold data to file: %s\n", thresholdFileName)
+		if err := excelutil.SaveXLSX(xlsxThreshold, thresholdFileName, save); err != nil {
+			log.Fatalf("error while saving threshold data: %s\n", err)
+		}
+	}
+
+	// save the number of columns that survived --threshold
+	if opts.ThresholdReport {
+		reportFileName := fileName("threshold_report.json")
+		fmt.Printf("writing threshold report to file: %s\n", excelutil.GzipPath(reportFileName, save.Gzip))
+		if err := excelutil.WriteThresholdReport(reportFileName, *responseThreshold, keptCounts, save.Gzip); err != nil {
+			log.Fatalf("error while saving threshold report: %s\n", err)
+		}
+	}
+}
@@ -0,0 +1,1992 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"image/png"
+	"io/ioutil"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/360EntSecGroup-Skylar/excelize"
+	"github.com/DanielSchuette/excelutil"
+)
+
+// the tests run the tool in a child process (the test binary itself with runMainEnv set), because main calls
+// log.Fatal and reads the global flags
+const runMainEnv = "PROCEXCELRATIOS_RUN_MAIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(runMainEnv) == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runTool runs the tool with args in dir and returns its combined output
+func runTool(t *testing.T, dir string, args ...string) (string, error) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), runMainEnv+"=1")
+	out, err := cmd.CombinedOutput()
+	return string(out), err
+}
+
+// tempDir creates a directory for the in- and output of a test and returns a function that removes it
+func tempDir(t *testing.T) (string, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "procexcelratios")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+// writePlates writes a workbook in the layout of the instrument exports (a title row, a header row that starts with
+// "Time (sec)", three columns per well of which the third one is skipped, and the two background columns) with
+// rows measurements on every sheet; edit is called for every sheet before the workbook is saved (e.g. to clear cells)
+func writePlates(t *testing.T, path string, sheets []string, wells, rows int, edit func(f *excelize.File, sheet string)) {
+	t.Helper()
+	f := excelize.NewFile()
+	for _, name := range sheets {
+		f.NewSheet(name)
+		f.SetCellValue(name, "A1", "Instrument X")
+		header := []string{"Time (sec)"}
+		for w := 1; w <= wells; w++ {
+			header = append(header, fmt.Sprintf("Well%d 340", w), fmt.Sprintf("Well%d 380", w), fmt.Sprintf("Well%d skip", w))
+		}
+		header = append(header, "bg340", "bg380")
+		for c, h := range header {
+			f.SetCellValue(name, fmt.Sprintf("%s2", excelize.ToAlphaString(c)), h)
+		}
+		for r := 0; r < rows; r++ {
+			row := r + 3
+			f.SetCellValue(name, fmt.Sprintf("A%d", row), float64(r)*2)
+			for w := 1; w <= wells; w++ {
+				f.SetCellValue(name, fmt.Sprintf("%s%d", excelize.ToAlphaString((w-1)*3+1), row), 200+float64(r+w))
+				f.SetCellValue(name, fmt.Sprintf("%s%d", excelize.ToAlphaString((w-1)*3+2), row), 300+float64(r))
+				f.SetCellValue(name, fmt.Sprintf("%s%d", excelize.ToAlphaString((w-1)*3+3), row), 1)
+			}
+			f.SetCellValue(name, fmt.Sprintf("%s%d", excelize.ToAlphaString(wells*3+1), row), 50)
+			f.SetCellValue(name, fmt.Sprintf("%s%d", excelize.ToAlphaString(wells*3+2), row), 60)
+		}
+		if edit != nil {
+			edit(f, name)
+		}
+	}
+	f.DeleteSheet("Sheet1")
+	if err := f.SaveAs(path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// openOutput opens an output workbook of a test run
+func openOutput(t *testing.T, path string) *excelize.File {
+	t.Helper()
+	f, err := excelize.OpenFile(path)
+	if err != nil {
+		t.Fatalf("cannot open output: %s", err)
+	}
+	return f
+}
+
+// defaultArgs are the flags of every test run (the outputs are named t_*.xlsx and have no timestamp)
+func defaultArgs(input string, args ...string) []string {
+	return append([]string{"--file_path=" + input, "--output_prefix=t", "--timestamp=false", "--print_order=false"}, args...)
+}
+
+func TestEmptySkipFormulasReferToSourceRows(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	input := filepath.Join(dir, "in.xlsx")
+	writePlates(t, input, []string{"Plate1"}, 2, 20, func(f *excelize.File, sheet string) {
+		f.SetCellValue(sheet, "E10", nil) // the 340 nm channel of well 2 in the 8th measurement
+	})
+	if out, err := runTool(t, dir, defaultArgs(input, "--empty=skip", "--formulas")...); err != nil {
+		t.Fatalf("run failed: %s\n%s", err, out)
+	}
+
+	f := openOutput(t, filepath.Join(dir, "t_transformed_data.xlsx"))
+	if got := len(f.GetRows("Plate1")); got != 20 {
+		t.Fatalf("transformed sheet has %d rows; want a header and 19 measurements", got)
+	}
+	tests := []struct{ cell, formula string }{
+		{"A8", "'raw Plate1'!B9-'raw Plate1'!H9"},
+		{"A9", "'raw Plate1'!B11-'raw Plate1'!H11"}, // row 10 of the source was skipped
+		{"C20", "'raw Plate1'!E22-'raw Plate1'!H22"},
+	}
+	for _, tt := range tests {
+		if got := f.GetCellFormula("Plate1", tt.cell); got != tt.formula {
+			t.Errorf("formula of %s = %q; want %q", tt.cell, got, tt.formula)
+		}
+	}
+}
+
+func TestAppendTo(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	input := filepath.Join(dir, "in.xlsx")
+	writePlates(t, input, []string{"Plate1"}, 2, 20, nil)
+
+	// the first run creates the workbook and the second one adds its sheet next to the existing one
+	for run := 0; run < 2; run++ {
+		if out, err := runTool(t, dir, defaultArgs(input, "--append_to=results.xlsx")...); err != nil {
+			t.Fatalf("run failed: %s\n%s", err, out)
+		}
+	}
+	f := openOutput(t, filepath.Join(dir, "results.xlsx"))
+	sorted := openOutput(t, filepath.Join(dir, "t_sorted_ratios.xlsx"))
+	for _, sheet := range []string{"Plate1", "Plate1 (2)"} {
+		if f.GetSheetIndex(sheet) == 0 {
+			t.Fatalf("appended workbook has sheets %v; want Plate1 of both runs", f.GetSheetMap())
+		}
+		if got, want := f.GetCellValue(sheet, "A2"), sorted.GetCellValue("Plate1", "A2"); got != want || got == "" {
+			t.Errorf("A2 of sheet %s = %q; want the sorted ratio %q", sheet, got, want)
+		}
+	}
+}
+
+func TestFallbackStartRow(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	input := filepath.Join(dir, "in.xlsx")
+	writePlates(t, input, []string{"Plate1", "Plate2"}, 2, 20, func(f *excelize.File, sheet string) {
+		if sheet == "Plate2" {
+			f.SetCellValue(sheet, "A2", "Seconds") // no start label, the header is still in row 2
+		}
+	})
+
+	// by default, the sheet without start label is skipped
+	out, err := runTool(t, dir, defaultArgs(input)...)
+	if err != nil {
+		t.Fatalf("run failed: %s\n%s", err, out)
+	}
+	if want := "skipping sheet Plate2 (use --fallback_start_row"; !strings.Contains(out, want) {
+		t.Errorf("output does not contain %q:\n%s", want, out)
+	}
+	if openOutput(t, filepath.Join(dir, "t_ratios.xlsx")).GetSheetIndex("Plate2") != 0 {
+		t.Errorf("the skipped sheet Plate2 was written")
+	}
+
+	// with --fallback_start_row, the metadata in row 1 is not mistaken for the header
+	if out, err := runTool(t, dir, defaultArgs(input, "--fallback_start_row=2")...); err != nil {
+		t.Fatalf("run failed: %s\n%s", err, out)
+	}
+	f := openOutput(t, filepath.Join(dir, "t_ratios.xlsx"))
+	for _, cell := range []string{"A1", "A2", "B21"} {
+		if got, want := f.GetCellValue("Plate2", cell), f.GetCellValue("Plate1", cell); got != want || got == "" {
+			t.Errorf("%s of Plate2 = %q; want %q like Plate1", cell, got, want)
+		}
+	}
+}
+
+func TestSheetTimeoutSkipsSheetsBeforeWriting(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	input := filepath.Join(dir, "in.xlsx")
+	writePlates(t, input, []string{"Plate1", "Plate2"}, 2, 20, nil)
+
+	// every sheet exceeds a timeout of 1ns
+	out, err := runTool(t, dir, defaultArgs(input, "--sheet_timeout=1ns")...)
+	if err != nil {
+		t.Fatalf("run failed: %s\n%s", err, out)
+	}
+	for _, want := range []string{"skipping sheet Plate1 (exceeded --sheet_timeout=1ns)", "sheets skipped after --sheet_timeout - Plate1, Plate2"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+	f := openOutput(t, filepath.Join(dir, "t_transformed_data.xlsx"))
+	for _, sheet := range []string{"Plate1", "Plate2"} {
+		if rows := f.GetRows(sheet); len(rows) != 0 {
+			t.Errorf("transformed data hold %d rows of the skipped sheet %s", len(rows), sheet)
+		}
+	}
+}
+
+func TestSheetWithoutRatioRows(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	input := filepath.Join(dir, "in.xlsx")
+	writePlates(t, input, []string{"Plate1", "Plate2"}, 2, 20, nil)
+
+	// --trimmed_output=0 leaves the ratio sheets without a single row of values, which made the sort stage panic
+	out, err := runTool(t, dir, defaultArgs(input, "--trimmed_output=0", "--threshold=1.2")...)
+	if err != nil {
+		t.Fatalf("run failed: %s\n%s", err, out)
+	}
+	for _, want := range []string{"skipping sort of sheet Plate2", "Plate1: kept 0 of 0 columns", "Plate2: kept 0 of 0 columns"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+	f := openOutput(t, filepath.Join(dir, "t_sorted_ratios.xlsx"))
+	for _, sheet := range []string{"Plate1", "Plate2"} {
+		if f.GetSheetIndex(sheet) == 0 {
+			t.Errorf("sorted ratios have no sheet %s", sheet)
+		}
+	}
+}
+
+func TestSingleUnlabeledBackgroundColumn(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	input := filepath.Join(dir, "in.xlsx")
+
+	// the single background column H is labeled like a data column and the second background column I is missing
+	writePlates(t, input, []string{"Plate1"}, 2, 20, func(f *excelize.File, sheet string) {
+		f.SetCellValue(sheet, "H2", "Reference")
+		f.RemoveCol(sheet, "I")
+	})
+	out, err := runTool(t, dir, defaultArgs(input)...)
+	if err != nil {
+		t.Fatalf("run failed: %s\n%s", err, out)
+	}
+	if want := "only fit complete wells with 1 background column(s) but 2 were requested"; !strings.Contains(out, want) {
+		t.Errorf("output does not contain %q:\n%s", want, out)
+	}
+
+	// both channels are corrected by the single background column (50) instead of the skipped column of the last well
+	f := openOutput(t, filepath.Join(dir, "t_transformed_data.xlsx"))
+	for cell, want := range map[string]string{"A2": "151", "B2": "250", "C2": "152", "D2": "250"} {
+		if got := f.GetCellValue("Plate1", cell); got != want {
+			t.Errorf("transformed value of %s = %q; want %s", cell, got, want)
+		}
+	}
+}
+
+func TestPeaksOnly(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	input := filepath.Join(dir, "in.xlsx")
+	writePlates(t, input, []string{"Plate1"}, 2, 20, nil)
+	if out, err := runTool(t, dir, defaultArgs(input, "--peaks_only", "--start=1")...); err != nil {
+		t.Fatalf("run failed: %s\n%s", err, out)
+	}
+
+	// the ratios (150+r+w)/(240+r) of well w increase with the (0-based) measurement r, so they peak in the last one (38 sec)
+	f := openOutput(t, filepath.Join(dir, "t_peaks.xlsx"))
+	ratios := openOutput(t, filepath.Join(dir, "t_ratios.xlsx"))
+	rows := f.GetRows("Plate1")
+	if len(rows) != 3 || len(rows[0]) != 2 {
+		t.Fatalf("peaks = %q; want labels, peaks, and times of 2 wells", rows)
+	}
+	for w := 0; w < 2; w++ {
+		want := float64(170+w) / 259
+		if got, _ := strconv.ParseFloat(rows[1][w], 64); !excelutil.AlmostEqual(got, want, 1e-12) || rows[2][w] != "38" {
+			t.Errorf("peak of well %d = %s at %s; want %v at 38", w+1, rows[1][w], rows[2][w], want)
+		}
+		if header := ratios.GetRows("Plate1")[0][w]; rows[0][w] != header {
+			t.Errorf("label of well %d = %q; want the ratio header %q", w+1, rows[0][w], header)
+		}
+	}
+}
+
+func TestSQLite(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	input := filepath.Join(dir, "in.xlsx")
+	writePlates(t, input, []string{"Plate1"}, 2, 20, nil)
+	dbPath := filepath.Join(dir, "out.db")
+	out, err := runTool(t, dir, defaultArgs(input, "--start=1", "--sqlite="+dbPath)...)
+
+	// the driver is only linked with '-tags sqlite', the flag fails with a hint without it
+	registered := false
+	for _, name := range sql.Drivers() {
+		registered = registered || name == "sqlite3"
+	}
+	if !registered {
+		if err == nil || !strings.Contains(out, "-tags sqlite") {
+			t.Errorf("run with --sqlite without a driver = %v; want an error with a hint:\n%s", err, out)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("run with --sqlite failed: %s\n%s", err, out)
+	}
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var measurements int
+	if err := db.QueryRow("SELECT COUNT(*) FROM measurements WHERE sheet = 'Plate1'").Scan(&measurements); err != nil || measurements != 40 {
+		t.Errorf("measurements of Plate1 = %d (%v); want 40", measurements, err)
+	}
+
+	// the ratios peak in the last measurement (see TestPeaksOnly)
+	var peak float64
+	var row int
+	if err := db.QueryRow("SELECT peak_value, peak_row FROM peaks WHERE column_label = 'cell 2'").Scan(&peak, &row); err != nil {
+		t.Fatal(err)
+	}
+	if !excelutil.AlmostEqual(peak, 171.0/259, 1e-12) || row != 20 {
+		t.Errorf("peak of cell 2 = %v in row %d; want %v in row 20", peak, row, 171.0/259)
+	}
+}
+
+func TestExplain(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	input := filepath.Join(dir, "in.xlsx")
+	writePlates(t, input, []string{"Plate1"}, 2, 20, nil)
+	out, err := runTool(t, dir, defaultArgs(input, "--explain")...)
+	if err != nil {
+		t.Fatalf("run failed: %s\n%s", err, out)
+	}
+
+	// the 340 nm columns are corrected by bg340 (H) and the 380 nm columns by bg380 (I); the third column of every well is skipped
+	want := []string{
+		"column mapping of Plate1:",
+		"source transformed ratio background",
+		"B A A (numerator) H",
+		"C B A (denominator) I",
+		"E C B (numerator) H",
+		"F D B (denominator) I",
+	}
+	lines := make([]string, 0)
+	for _, line := range strings.Split(out, "\n") {
+		lines = append(lines, strings.Join(strings.Fields(line), " "))
+	}
+	if got := strings.Join(lines, "\n"); !strings.Contains(got, strings.Join(want, "\n")) {
+		t.Errorf("output does not contain the mapping\n%s\n%s", strings.Join(want, "\n"), out)
+	}
+}
+
+func TestEmptyNaNWritesEmptyCells(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	input := filepath.Join(dir, "in.xlsx")
+	writePlates(t, input, []string{"Plate1"}, 2, 20, func(f *excelize.File, sheet string) {
+		f.SetCellValue(sheet, "E10", nil)
+	})
+	if out, err := runTool(t, dir, defaultArgs(input, "--empty=nan")...); err != nil {
+		t.Fatalf("run failed: %s\n%s", err, out)
+	}
+
+	transformed := openOutput(t, filepath.Join(dir, "t_transformed_data.xlsx"))
+	if got := transformed.GetCellValue("Plate1", "C9"); got != "" {
+		t.Errorf("transformed value of the empty cell = %q; want an empty cell", got)
+	}
+	if got := transformed.GetCellValue("Plate1", "C10"); got != "160" {
+		t.Errorf("transformed value after the empty cell = %q; want 160", got)
+	}
+	ratios := openOutput(t, filepath.Join(dir, "t_ratios.xlsx"))
+	if got := ratios.GetCellValue("Plate1", "B9"); got != "" {
+		t.Errorf("ratio of the empty cell = %q; want an empty cell", got)
+	}
+	if got := ratios.GetCellValue("Plate1", "A9"); got == "" {
+		t.Errorf("ratio of the other well is empty")
+	}
+}
+
+func TestPNGCharts(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	input := filepath.Join(dir, "in.xlsx")
+	writePlates(t, input, []string{"Plate1"}, 2, 20, nil)
+	if out, err := runTool(t, dir, defaultArgs(input, "--png_charts")...); err != nil {
+		t.Fatalf("run failed: %s\n%s", err, out)
+	}
+	f, err := os.Open(filepath.Join(dir, "t_Plate1_ratios.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatalf("chart is not a PNG image: %s", err)
+	}
+	if img.Bounds().Empty() {
+		t.Errorf("chart is empty")
+	}
+}
+
+func TestOutputOrigin(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	input := filepath.Join(dir, "in.xlsx")
+	writePlates(t, input, []string{"Plate1"}, 2, 20, nil)
+	if out, err := runTool(t, dir, defaultArgs(input)...); err != nil {
+		t.Fatalf("run failed: %s\n%s", err, out)
+	}
+	plain := openOutput(t, filepath.Join(dir, "t_transformed_data.xlsx"))
+	plainRatios := openOutput(t, filepath.Join(dir, "t_ratios.xlsx"))
+
+	if out, err := runTool(t, dir, defaultArgs(input, "--output_origin=B3")...); err != nil {
+		t.Fatalf("run failed: %s\n%s", err, out)
+	}
+	transformed := openOutput(t, filepath.Join(dir, "t_transformed_data.xlsx"))
+	ratios := openOutput(t, filepath.Join(dir, "t_ratios.xlsx"))
+	tests := []struct {
+		f, plain  *excelize.File
+		cell, was string
+	}{
+		{transformed, plain, "B3", "A1"},
+		{transformed, plain, "B4", "A2"},
+		{transformed, plain, "E21", "D19"},
+		{ratios, plainRatios, "B3", "A1"},
+		{ratios, plainRatios, "C21", "B19"},
+	}
+	for _, tt := range tests {
+		if got, want := tt.f.GetCellValue("Plate1", tt.cell), tt.plain.GetCellValue("Plate1", tt.was); got != want || got == "" {
+			t.Errorf("%s = %q; want %q (%s without --output_origin)", tt.cell, got, want, tt.was)
+		}
+	}
+	// nothing is written above or to the left of the origin
+	for _, cell := range []string{"A1", "A3", "B1", "B2", "C2"} {
+		if got := transformed.GetCellValue("Plate1", cell); got != "" {
+			t.Errorf("%s = %q; want an empty cell", cell, got)
+		}
+	}
+
+	if out, err := runTool(t, dir, defaultArgs(input, "--output_origin=3B")...); err == nil {
+		t.Errorf("run with an invalid --output_origin succeeded\n%s", out)
+	}
+}
+
+func TestChannelBaseline(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	input := filepath.Join(dir, "in.xlsx")
+	writePlates(t, input, []string{"Plate1"}, 2, 20, nil)
+
+	// without per-channel baseline, the ratio of measurement r of well w is (150+r+w)/(240+r)
+	if out, err := runTool(t, dir, defaultArgs(input)...); err != nil {
+		t.Fatalf("run failed: %s\n%s", err, out)
+	}
+	f := openOutput(t, filepath.Join(dir, "t_ratios.xlsx"))
+	if got, want := f.GetCellValue("Plate1", "A2"), strconv.FormatFloat(151.0/240, 'f', -1, 64); got != want {
+		t.Errorf("ratio without --channel_baseline = %s; want %s", got, want)
+	}
+
+	// the means of the first two measurements (150.5+w and 240.5) are subtracted from both channels before dividing,
+	// which leaves (r-0.5)/(r-0.5) in every row
+	if out, err := runTool(t, dir, defaultArgs(input, "--channel_baseline=1:3")...); err != nil {
+		t.Fatalf("run failed: %s\n%s", err, out)
+	}
+	f = openOutput(t, filepath.Join(dir, "t_ratios.xlsx"))
+	for _, cell := range []string{"A2", "A3", "A20", "B2", "B20"} {
+		if got := f.GetCellValue("Plate1", cell); got != "1" {
+			t.Errorf("ratio %s with --channel_baseline = %s; want 1", cell, got)
+		}
+	}
+	// the transformed data is written before the baseline subtraction
+	if got := openOutput(t, filepath.Join(dir, "t_transformed_data.xlsx")).GetCellValue("Plate1", "A2"); got != "151" {
+		t.Errorf("transformed value with --channel_baseline = %s; want 151", got)
+	}
+
+	if out, err := runTool(t, dir, defaultArgs(input, "--channel_baseline=1:30")...); err == nil {
+		t.Errorf("run with a window beyond the measurements succeeded\n%s", out)
+	}
+}
+
+func TestThresholdReportMatchesFilter(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	input := filepath.Join(dir, "in.xlsx")
+	writePlates(t, input, []string{"Plate1", "Plate2"}, 3, 20, nil)
+
+	// --threshold=0 turns the filter off
+	if out, err := runTool(t, dir, defaultArgs(input, "--start=1", "--threshold=0")...); err != nil {
+		t.Fatalf("run failed: %s\n%s", err, out)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "t_data_with_threshold.xlsx")); !os.IsNotExist(err) {
+		t.Errorf("a run with --threshold=0 wrote filtered data (%v)", err)
+	}
+
+	// the ratios of the three wells peak at about 0.656, 0.660, and 0.664
+	out, err := runTool(t, dir, defaultArgs(input, "--start=1", "--threshold=0.659", "--threshold_report")...)
+	if err != nil {
+		t.Fatalf("run failed: %s\n%s", err, out)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "t_threshold_report.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report struct {
+		Threshold float64
+		Sheets    []excelutil.ThresholdCount
+	}
+	if err := json.Unmarshal(b, &report); err != nil {
+		t.Fatalf("cannot parse report: %s\n%s", err, b)
+	}
+	if report.Threshold != 0.659 || len(report.Sheets) != 2 {
+		t.Fatalf("report = %+v; want threshold 0.659 and two sheets", report)
+	}
+
+	// the counts match the filter applied to the sorted ratios and are printed in the summary
+	sorted := openOutput(t, filepath.Join(dir, "t_sorted_ratios.xlsx"))
+	for _, count := range report.Sheets {
+		headers, values := excelutil.SheetData(sorted.GetRows(count.Sheet))
+		kept, _ := excelutil.FilterColumnsByThreshold(headers, values, 0.659)
+		if count.Kept != len(kept) || count.Total != len(headers) || count.Kept != 2 || count.Total != 3 {
+			t.Errorf("reported %s; the filter keeps %d of %d columns (want 2 of 3)", count, len(kept), len(headers))
+		}
+		if !strings.Contains(out, count.String()) {
+			t.Errorf("summary does not contain %q:\n%s", count.String(), out)
+		}
+	}
+}
+
+func TestLimitSheets(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	input := filepath.Join(dir, "in.xlsx")
+	writePlates(t, input, []string{"Plate1", "Plate2", "Plate3"}, 2, 20, nil)
+	if out, err := runTool(t, dir, defaultArgs(input, "--limit_sheets=2")...); err != nil {
+		t.Fatalf("run failed: %s\n%s", err, out)
+	}
+
+	for _, name := range []string{"t_ratios.xlsx", "t_transformed_data.xlsx"} {
+		f := openOutput(t, filepath.Join(dir, name))
+		if f.GetSheetIndex("Plate1") == 0 || f.GetSheetIndex("Plate2") == 0 || f.GetSheetIndex("Plate3") != 0 {
+			t.Errorf("%s has sheets %v; want only the first two plates", name, f.GetSheetMap())
+		}
+	}
+}
+
+func TestSortOrder(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	input := filepath.Join(dir, "in.xlsx")
+	writePlates(t, input, []string{"Plate1"}, 3, 20, nil)
+
+	// the peaks increase with the well, so the order of the sorted columns flips between both modes
+	for order, want := range map[string][]string{
+		"desc": {"cell 3", "cell 2", "cell 1"},
+		"asc":  {"cell 1", "cell 2", "cell 3"},
+	} {
+		if out, err := runTool(t, dir, defaultArgs(input, "--start=1", "--sort_order="+order)...); err != nil {
+			t.Fatalf("run failed: %s\n%s", err, out)
+		}
+		headers, _ := excelutil.SheetData(openOutput(t, filepath.Join(dir, "t_sorted_ratios.xlsx")).GetRows("Plate1"))
+		if !reflect.DeepEqual(headers, want) {
+			t.Errorf("sorted columns with --sort_order=%s = %q; want %q", order, headers, want)
+		}
+	}
+}
+
+func TestRankAndOutputSmoothing(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	input := filepath.Join(dir, "in.xlsx")
+	// well 1 has a single spike (ratio 950/250 = 3.8 in measurement 11), well 2 a sustained response of about 1.8
+	writePlates(t, input, []string{"Plate1"}, 2, 20, func(f *excelize.File, sheet string) {
+		f.SetCellValue(sheet, "B13", 1000.0)
+		for r := 8; r <= 22; r++ {
+			f.SetCellValue(sheet, fmt.Sprintf("E%d", r), 500.0)
+		}
+	})
+
+	tests := []struct {
+		args   []string
+		sorted []string
+		spike  string // the written ratio of the spike
+	}{
+		{nil, []string{"cell 1", "cell 2"}, "3.8"},
+		{[]string{"--rank_smooth=0.1"}, []string{"cell 2", "cell 1"}, "3.8"},
+		{[]string{"--output_smooth=0.1"}, []string{"cell 1", "cell 2"}, ""},
+	}
+	for _, tt := range tests {
+		if out, err := runTool(t, dir, defaultArgs(input, append([]string{"--start=1"}, tt.args...)...)...); err != nil {
+			t.Fatalf("run failed: %s\n%s", err, out)
+		}
+		headers, _ := excelutil.SheetData(openOutput(t, filepath.Join(dir, "t_sorted_ratios.xlsx")).GetRows("Plate1"))
+		if !reflect.DeepEqual(headers, tt.sorted) {
+			t.Errorf("%v: sorted columns = %q; want %q", tt.args, headers, tt.sorted)
+		}
+		spike := openOutput(t, filepath.Join(dir, "t_ratios.xlsx")).GetCellValue("Plate1", "A12")
+		if tt.spike != "" && spike != tt.spike {
+			t.Errorf("%v: written ratio of the spike = %s; want the raw ratio %s", tt.args, spike, tt.spike)
+		} else if v, err := strconv.ParseFloat(spike, 64); tt.spike == "" && (err != nil || v >= 1) {
+			t.Errorf("%v: written ratio of the spike = %s; want a smoothed ratio below 1", tt.args, spike)
+		}
+	}
+}
+
+func TestIncremental(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	input := filepath.Join(dir, "in.xlsx")
+	// the empty cell of the last sheet aborts the run (see --empty) like a crash would
+	writePlates(t, input, []string{"Plate1", "Plate2", "Plate3"}, 2, 20, func(f *excelize.File, sheet string) {
+		if sheet == "Plate3" {
+			f.SetCellValue(sheet, "E10", nil)
+		}
+	})
+
+	if out, err := runTool(t, dir, defaultArgs(input)...); err == nil {
+		t.Fatalf("run with an empty cell succeeded\n%s", out)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "t_ratios.xlsx")); !os.IsNotExist(err) {
+		t.Errorf("an aborted run without --incremental wrote ratios (%v)", err)
+	}
+
+	if out, err := runTool(t, dir, defaultArgs(input, "--incremental")...); err == nil {
+		t.Fatalf("run with an empty cell succeeded\n%s", out)
+	}
+	for _, name := range []string{"t_transformed_data.xlsx", "t_ratios.xlsx", "t_sorted_ratios.xlsx"} {
+		f := openOutput(t, filepath.Join(dir, name))
+		if f.GetSheetIndex("Plate1") == 0 || f.GetSheetIndex("Plate2") == 0 || f.GetSheetIndex("Plate3") != 0 {
+			t.Errorf("%s of the aborted run has sheets %v; want the sheets that were finished", name, f.GetSheetMap())
+		}
+	}
+
+	// the finished sheets have the layout of a complete run
+	checkIncrementalLayout(t, "--output_origin=B3")
+}
+
+// checkIncrementalLayout checks that the sheets that a run with --incremental and the layout flags finished before it
+// aborted are saved exactly like the sheets of a complete run with the same flags
+func checkIncrementalLayout(t *testing.T, layout ...string) {
+	t.Helper()
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	input, complete := filepath.Join(dir, "in.xlsx"), filepath.Join(dir, "complete.xlsx")
+	writePlates(t, input, []string{"Plate1", "Plate2", "Plate3"}, 2, 20, func(f *excelize.File, sheet string) {
+		if sheet == "Plate3" {
+			f.SetCellValue(sheet, "E10", nil)
+		}
+	})
+	writePlates(t, complete, []string{"Plate1", "Plate2"}, 2, 20, nil)
+
+	if out, err := runTool(t, dir, defaultArgs(input, append(layout, "--incremental")...)...); err == nil {
+		t.Fatalf("run with an empty cell succeeded\n%s", out)
+	}
+	if out, err := runTool(t, dir, defaultArgs(complete, append(layout, "--output_prefix=c")...)...); err != nil {
+		t.Fatalf("run failed: %s\n%s", err, out)
+	}
+	for _, name := range []string{"transformed_data.xlsx", "ratios.xlsx", "sorted_ratios.xlsx"} {
+		partial, want := openOutput(t, filepath.Join(dir, "t_"+name)), openOutput(t, filepath.Join(dir, "c_"+name))
+		for _, sheet := range []string{"Plate1", "Plate2"} {
+			if got := partial.GetRows(sheet); !reflect.DeepEqual(got, want.GetRows(sheet)) {
+				t.Errorf("%v: sheet %s of %s of the aborted run = %q; want %q", layout, sheet, name, got, want.GetRows(sheet))
+			}
+		}
+	}
+}
+
+func TestIncrementalSkippedSheets(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	input := filepath.Join(dir, "in.xlsx")
+	writePlates(t, input, []string{"Plate1", "Plate2"}, 2, 20, nil)
+
+	// sheets that exceed --sheet_timeout are not saved at all instead of being left empty
+	if out, err := runTool(t, dir, defaultArgs(input, "--sheet_timeout=1ns", "--incremental")...); err != nil {
+		t.Fatalf("run failed: %s\n%s", err, out)
+	}
+	f := openOutput(t, filepath.Join(dir, "t_transformed_data.xlsx"))
+	for _, sheet := range []string{"Plate1", "Plate2"} {
+		if f.GetSheetIndex(sheet) != 0 {
+			t.Errorf("transformed data hold the skipped sheet %s", sheet)
+		}
+	}
+
+	// sheets whose sort stage is skipped are saved after every sheet like all other sheets
+	if out, err := runTool(t, dir, defaultArgs(input, "--trimmed_output=0", "--incremental")...); err != nil {
+		t.Fatalf("run failed: %s\n%s", err, out)
+	}
+	f = openOutput(t, filepath.Join(dir, "t_sorted_ratios.xlsx"))
+	for _, sheet := range []string{"Plate1", "Plate2"} {
+		if f.GetSheetIndex(sheet) == 0 {
+			t.Errorf("sorted ratios have no sheet %s", sheet)
+		}
+	}
+}
+
+func TestWaitForTSVInput(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	// a .tsv file is not a zip archive, so --wait must not wait for it to become one
+	input := filepath.Join(dir, "plate.tsv")
+	lines := []string{"Instrument X", "Time (sec)\tWell1 340\tWell1 380\tWell1 skip\tbg340\tbg380"}
+	for r := 0; r < 5; r++ {
+		lines = append(lines, fmt.Sprintf("%d\t%d\t%d\t1\t50\t60", r*2, 200+r, 300+r))
+	}
+	if err := ioutil.WriteFile(input, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := runTool(t, dir, defaultArgs(input, "--start=1", "--wait=1m")...); err != nil || strings.Contains(out, "waiting") {
+		t.Errorf("run with --wait for a .tsv file failed or waited: %v\n%s", err, out)
+	}
+}
+
+func TestEstimate(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	input := filepath.Join(dir, "in.xlsx")
+	writePlates(t, input, []string{"Plate1", "Plate2"}, 2, 20, nil)
+	out, err := runTool(t, dir, defaultArgs(input, "--estimate")...)
+	if err != nil {
+		t.Fatalf("run failed: %s\n%s", err, out)
+	}
+
+	// 22 rows of 9 columns per sheet
+	for _, want := range []string{"estimated input cells: 396 in 2 sheet(s)", "estimated processing time:", "estimated size of ratios.xlsx:"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "t_ratios.xlsx")); !os.IsNotExist(err) {
+		t.Errorf("a run with --estimate wrote ratios (%v)", err)
+	}
+
+	// the sizes are projected for the files of --output_format
+	out, err = runTool(t, dir, defaultArgs(input, "--estimate", "--output_format=csv")...)
+	if want := "estimated size of ratios_<sheet>.csv:"; err != nil || !strings.Contains(out, want) {
+		t.Errorf("output does not contain %q (%v):\n%s", want, err, out)
+	}
+}
+
+func TestCarryMetadata(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	input := filepath.Join(dir, "in.xlsx")
+	writePlates(t, input, []string{"Plate1"}, 2, 20, nil)
+	if out, err := runTool(t, dir, defaultArgs(input, "--carry_metadata")...); err != nil {
+		t.Fatalf("run failed: %s\n%s", err, out)
+	}
+
+	// the row above the start label is copied to the top and the data starts one row further down
+	f := openOutput(t, filepath.Join(dir, "t_transformed_data.xlsx"))
+	for cell, want := range map[string]string{"A1": "Instrument X", "A3": "151", "C22": "171"} {
+		if got := f.GetCellValue("Plate1", cell); got != want {
+			t.Errorf("transformed %s = %q; want %q", cell, got, want)
+		}
+	}
+	if got := len(f.GetRows("Plate1")); got != 22 {
+		t.Errorf("transformed sheet has %d rows; want the metadata, a header, and 20 measurements", got)
+	}
+
+	if out, err := runTool(t, dir, defaultArgs(input, "--carry_metadata", "--output_format=csv")...); err == nil {
+		t.Errorf("run with --carry_metadata and --output_format=csv succeeded\n%s", out)
+	}
+
+	// the sheets that --incremental saves before the end of the run carry the metadata as well
+	checkIncrementalLayout(t, "--carry_metadata")
+}
+
+func TestPrintPrecision(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	input := filepath.Join(dir, "in.xlsx")
+	writePlates(t, input, []string{"Plate1"}, 2, 20, nil)
+
+	// the peaks are 170/259 and 171/259, only the printed values are rounded
+	tests := []struct {
+		precision string
+		want      string
+	}{
+		{"", "ordered values for Plate1: cell 2: 0.660 cell 1: 0.656 "},
+		{"--print_precision=1", "ordered values for Plate1: cell 2: 0.7 cell 1: 0.7 "},
+		{"--print_precision=-1", fmt.Sprintf("ordered values for Plate1: cell 2: %v cell 1: %v ", 171.0/259, 170.0/259)},
+	}
+	for _, tt := range tests {
+		args := []string{"--start=1", "--print_order=true"}
+		if tt.precision != "" {
+			args = append(args, tt.precision)
+		}
+		out, err := runTool(t, dir, defaultArgs(input, args...)...)
+		if err != nil {
+			t.Fatalf("run failed: %s\n%s", err, out)
+		}
+		if !strings.Contains(out, tt.want+"\n") {
+			t.Errorf("%s: output does not contain %q:\n%s", tt.precision, tt.want, out)
+		}
+		if got := openOutput(t, filepath.Join(dir, "t_sorted_ratios.xlsx")).GetCellValue("Plate1", "A21"); got != strconv.FormatFloat(171.0/259, 'f', -1, 64) {
+			t.Errorf("%s: sorted peak = %s; want full precision", tt.precision, got)
+		}
+	}
+}
+
+func TestBackgroundLabels(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	plain, moved := filepath.Join(dir, "plain.xlsx"), filepath.Join(dir, "moved.xlsx")
+	writePlates(t, plain, []string{"Plate1"}, 2, 20, nil)
+	// the background columns are moved from the end to the columns right after the time
+	writePlates(t, moved, []string{"Plate1"}, 2, 20, func(f *excelize.File, sheet string) {
+		for r, row := range f.GetRows(sheet) {
+			if r == 0 {
+				continue
+			}
+			values := append([]interface{}{}, row[0], row[7], row[8])
+			for _, v := range row[1:7] {
+				values = append(values, v)
+			}
+			for c, v := range values {
+				if n, err := strconv.ParseFloat(v.(string), 64); err == nil {
+					v = n
+				}
+				f.SetCellValue(sheet, fmt.Sprintf("%s%d", excelize.ToAlphaString(c), r+1), v)
+			}
+		}
+	})
+
+	if out, err := runTool(t, dir, defaultArgs(plain, "--output_prefix=plain")...); err != nil {
+		t.Fatalf("run failed: %s\n%s", err, out)
+	}
+	if out, err := runTool(t, dir, defaultArgs(moved, "--background_labels=BG340,BG380")...); err != nil {
+		t.Fatalf("run failed: %s\n%s", err, out)
+	}
+	for _, name := range []string{"transformed_data.xlsx", "ratios.xlsx"} {
+		want := openOutput(t, filepath.Join(dir, "plain_"+name)).GetRows("Plate1")
+		if got := openOutput(t, filepath.Join(dir, "t_"+name)).GetRows("Plate1"); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s with --background_labels differs from the sheet with background columns at the end:\n%q\n%q", name, got, want)
+		}
+	}
+
+	if out, err := runTool(t, dir, defaultArgs(moved, "--background_labels=BG340,BG405")...); err == nil {
+		t.Errorf("run with a missing background label succeeded\n%s", out)
+	}
+}
+
+func TestTransposeOutput(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	input := filepath.Join(dir, "in.xlsx")
+	writePlates(t, input, []string{"Plate1"}, 2, 20, nil)
+	if out, err := runTool(t, dir, defaultArgs(input, "--output_prefix=plain")...); err != nil {
+		t.Fatalf("run failed: %s\n%s", err, out)
+	}
+	if out, err := runTool(t, dir, defaultArgs(input, "--transpose_output")...); err != nil {
+		t.Fatalf("run failed: %s\n%s", err, out)
+	}
+
+	// every well is a row with its header in the first column, the transformed data is not transposed
+	for _, name := range []string{"ratios.xlsx", "sorted_ratios.xlsx"} {
+		plain := openOutput(t, filepath.Join(dir, "plain_"+name)).GetRows("Plate1")
+		got := openOutput(t, filepath.Join(dir, "t_"+name)).GetRows("Plate1")
+		if len(got) != len(plain[0]) || len(got[0]) != len(plain) {
+			t.Fatalf("%s has %d rows; want %d rows of %d cells", name, len(got), len(plain[0]), len(plain))
+		}
+		for r := range plain {
+			for c := range plain[r] {
+				if got[c][r] != plain[r][c] {
+					t.Errorf("%s: cell %d,%d = %q; want %q", name, c, r, got[c][r], plain[r][c])
+				}
+			}
+		}
+	}
+	plain := openOutput(t, filepath.Join(dir, "plain_transformed_data.xlsx")).GetRows("Plate1")
+	if got := openOutput(t, filepath.Join(dir, "t_transformed_data.xlsx")).GetRows("Plate1"); !reflect.DeepEqual(got, plain) {
+		t.Error("--transpose_output changed the transformed data")
+	}
+
+	if out, err := runTool(t, dir, defaultArgs(input, "--transpose_output", "--add_chart")...); err == nil {
+		t.Errorf("run with --transpose_output and --add_chart succeeded\n%s", out)
+	}
+
+	// the sheets that --incremental saves before the end of the run are transposed as well
+	checkIncrementalLayout(t, "--transpose_output")
+}
+
+func TestGlobalNumbering(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	input := filepath.Join(dir, "in.xlsx")
+	writePlates(t, input, []string{"Plate1", "Plate2", "Plate3"}, 2, 20, nil)
+
+	tests := []struct {
+		args           []string
+		ratios, sorted []string // headers of Plate3
+	}{
+		{nil, []string{"cell 1", "cell 2"}, []string{"cell 2", "cell 1"}},
+		{[]string{"--global_numbering"}, []string{"cell 5", "cell 6"}, []string{"cell 6", "cell 5"}},
+	}
+	for _, tt := range tests {
+		if out, err := runTool(t, dir, defaultArgs(input, append([]string{"--start=1"}, tt.args...)...)...); err != nil {
+			t.Fatalf("run failed: %s\n%s", err, out)
+		}
+		ratios, _ := excelutil.SheetData(openOutput(t, filepath.Join(dir, "t_ratios.xlsx")).GetRows("Plate3"))
+		sorted, _ := excelutil.SheetData(openOutput(t, filepath.Join(dir, "t_sorted_ratios.xlsx")).GetRows("Plate3"))
+		if !reflect.DeepEqual(ratios, tt.ratios) || !reflect.DeepEqual(sorted, tt.sorted) {
+			t.Errorf("%v: headers of Plate3 = %q and %q (sorted); want %q and %q", tt.args, ratios, sorted, tt.ratios, tt.sorted)
+		}
+	}
+}
+
+func TestPeaksLong(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	input := filepath.Join(dir, "in.xlsx")
+	writePlates(t, input, []string{"Plate1", "Plate2"}, 2, 20, nil)
+	if out, err := runTool(t, dir, defaultArgs(input, "--start=1", "--peaks_long")...); err != nil {
+		t.Fatalf("run failed: %s\n%s", err, out)
+	}
+
+	f, err := os.Open(filepath.Join(dir, "t_peaks_long.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	records, err := excelutil.ReadDelimited(f, ',')
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the peak (169+w)/259 of well w is reached in the last measurement at 38 s; the second well ranks first
+	p1, p2 := strconv.FormatFloat(170.0/259, 'f', -1, 64), strconv.FormatFloat(171.0/259, 'f', -1, 64)
+	want := [][]string{
+		{"sheet", "well", "peak", "time_to_peak", "rank_in_sheet"},
+		{"Plate1", "cell 1", p1, "38", "2"},
+		{"Plate1", "cell 2", p2, "38", "1"},
+		{"Plate2", "cell 1", p1, "38", "2"},
+		{"Plate2", "cell 2", p2, "38", "1"},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("t_peaks_long.csv = %q; want %q", records, want)
+	}
+}
+
+func TestBackgroundCountPerSheet(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	input := filepath.Join(dir, "in.xlsx")
+	// Plate2 has a single background column
+	writePlates(t, input, []string{"Plate1", "Plate2"}, 2, 20, func(f *excelize.File, sheet string) {
+		if sheet == "Plate2" {
+			for r := 2; r <= 22; r++ {
+				f.SetCellValue(sheet, fmt.Sprintf("I%d", r), nil)
+			}
+		}
+	})
+	out, err := runTool(t, dir, defaultArgs(input, "--background_count=2,Plate2=1")...)
+	if err != nil {
+		t.Fatalf("run failed: %s\n%s", err, out)
+	}
+	if strings.Contains(out, "only fit complete wells") {
+		t.Errorf("the background count of Plate2 was not used:\n%s", out)
+	}
+
+	// the 380 nm channel is corrected by bg380 (60) on Plate1 and by the single background column (50) on Plate2
+	f := openOutput(t, filepath.Join(dir, "t_transformed_data.xlsx"))
+	for _, tt := range []struct{ sheet, cell, want string }{
+		{"Plate1", "A2", "151"}, {"Plate1", "B2", "240"}, {"Plate2", "A2", "151"}, {"Plate2", "B2", "250"},
+	} {
+		if got := f.GetCellValue(tt.sheet, tt.cell); got != tt.want {
+			t.Errorf("transformed value of %s!%s = %q; want %s", tt.sheet, tt.cell, got, tt.want)
+		}
+	}
+
+	if out, err := runTool(t, dir, defaultArgs(input, "--background_count=Plate2=0")...); err == nil {
+		t.Errorf("run with a background count of 0 succeeded\n%s", out)
+	}
+}
+
+func TestDownsample(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	input := filepath.Join(dir, "in.xlsx")
+	writePlates(t, input, []string{"Plate1"}, 2, 20, nil)
+	if out, err := runTool(t, dir, defaultArgs(input, "--downsample=3")...); err != nil {
+		t.Fatalf("run failed: %s\n%s", err, out)
+	}
+
+	// the measurements 0, 3, ..., 18 are kept, i.e. ceil(20/3) = 7 rows below the header
+	for _, name := range []string{"t_transformed_data.xlsx", "t_ratios.xlsx"} {
+		if got := len(openOutput(t, filepath.Join(dir, name)).GetRows("Plate1")); got != 8 {
+			t.Errorf("%s has %d rows; want a header and 7 measurements", name, got)
+		}
+	}
+	f := openOutput(t, filepath.Join(dir, "t_transformed_data.xlsx"))
+	for cell, want := range map[string]string{"A2": "151", "A3": "154", "A8": "169"} {
+		if got := f.GetCellValue("Plate1", cell); got != want {
+			t.Errorf("transformed %s = %q; want %s", cell, got, want)
+		}
+	}
+}
+
+func TestPairByHeader(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	plain, swapped := filepath.Join(dir, "plain.xlsx"), filepath.Join(dir, "swapped.xlsx")
+	writePlates(t, plain, []string{"Plate1"}, 2, 20, nil)
+	// the 380 nm channel of the second well comes before its 340 nm channel
+	writePlates(t, swapped, []string{"Plate1"}, 2, 20, func(f *excelize.File, sheet string) {
+		for r := 2; r <= 22; r++ {
+			e, f2 := f.GetCellValue(sheet, fmt.Sprintf("E%d", r)), f.GetCellValue(sheet, fmt.Sprintf("F%d", r))
+			for cell, v := range map[string]string{fmt.Sprintf("E%d", r): f2, fmt.Sprintf("F%d", r): e} {
+				if n, err := strconv.ParseFloat(v, 64); err == nil {
+					f.SetCellValue(sheet, cell, n)
+				} else {
+					f.SetCellValue(sheet, cell, v)
+				}
+			}
+		}
+	})
+
+	if out, err := runTool(t, dir, defaultArgs(plain, "--output_prefix=plain")...); err != nil {
+		t.Fatalf("run failed: %s\n%s", err, out)
+	}
+	if out, err := runTool(t, dir, defaultArgs(swapped, "--pair_by_header=340,380")...); err != nil {
+		t.Fatalf("run failed: %s\n%s", err, out)
+	}
+	want := openOutput(t, filepath.Join(dir, "plain_ratios.xlsx")).GetRows("Plate1")
+	if got := openOutput(t, filepath.Join(dir, "t_ratios.xlsx")).GetRows("Plate1"); !reflect.DeepEqual(got, want) {
+		t.Errorf("ratios of the swapped columns paired by header differ from the default layout:\n%q\n%q", got, want)
+	}
+
+	if out, err := runTool(t, dir, defaultArgs(swapped, "--pair_by_header=340")...); err == nil {
+		t.Errorf("run with a single suffix succeeded\n%s", out)
+	}
+}
+
+func TestOverlayChart(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	input := filepath.Join(dir, "in.xlsx")
+	writePlates(t, input, []string{"Plate1", "Plate2"}, 3, 20, nil)
+	if out, err := runTool(t, dir, defaultArgs(input, "--overlay_chart=2")...); err != nil {
+		t.Fatalf("run failed: %s\n%s", err, out)
+	}
+
+	// one chart per sheet on a separate sheet of the sorted ratios
+	f := openOutput(t, filepath.Join(dir, "t_sorted_ratios.xlsx"))
+	if f.GetSheetIndex("Charts") == 0 {
+		t.Fatalf("sorted ratios have sheets %v; want a Charts sheet", f.GetSheetMap())
+	}
+	charts := 0
+	for name := range f.XLSX {
+		if strings.HasPrefix(name, "xl/charts/chart") {
+			charts++
+		}
+	}
+	if charts != 2 {
+		t.Errorf("sorted ratios hold %d charts; want one per sheet", charts)
+	}
+
+	if out, err := runTool(t, dir, defaultArgs(input, "--overlay_chart=2", "--transpose_output")...); err == nil {
+		t.Errorf("run with --overlay_chart and --transpose_output succeeded\n%s", out)
+	}
+}
+
+func TestSheetWithoutRows(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	input := filepath.Join(dir, "in.xlsx")
+	const marker = "<v>123456789</v>"
+	writePlates(t, input, []string{"Plate1", "Plate2", "Plate3"}, 2, 20, func(f *excelize.File, sheet string) {
+		if sheet == "Plate2" {
+			f.SetCellValue(sheet, "Z1", 123456789)
+		}
+	})
+
+	// replace the part of Plate2 (found by its marker) with a truncated one, like a crashed instrument leaves it
+	zr, err := zip.OpenReader(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupt := filepath.Join(dir, "corrupt.xlsx")
+	out, err := os.Create(corrupt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(out)
+	replaced := false
+	for _, part := range zr.File {
+		rc, err := part.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.HasPrefix(part.Name, "xl/worksheets/") && bytes.Contains(b, []byte(marker)) {
+			b, replaced = []byte("<worksheet><sheetData><row"), true
+		}
+		w, err := zw.Create(part.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(b)
+	}
+	zr.Close()
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	out.Close()
+	if !replaced {
+		t.Fatal("did not find the part of Plate2")
+	}
+
+	log, err := runTool(t, dir, defaultArgs(corrupt)...)
+	if err != nil {
+		t.Fatalf("run with a sheet without rows failed: %s\n%s", err, log)
+	}
+	if want := "warning: skipping sheet Plate2 (no rows, the sheet might be empty or corrupt)"; !strings.Contains(log, want) {
+		t.Errorf("output does not contain %q:\n%s", want, log)
+	}
+	f := openOutput(t, filepath.Join(dir, "t_ratios.xlsx"))
+	if f.GetSheetIndex("Plate1") == 0 || f.GetSheetIndex("Plate2") != 0 || f.GetSheetIndex("Plate3") == 0 {
+		t.Errorf("ratios have sheets %v; want Plate1 and Plate3", f.GetSheetMap())
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	input := filepath.Join(dir, "in.xlsx")
+	writePlates(t, input, []string{"Plate1"}, 2, 20, nil)
+
+	cpuPath, memPath := filepath.Join(dir, "cpu.prof"), filepath.Join(dir, "mem.prof")
+	if log, err := runTool(t, dir, defaultArgs(input, "--cpuprofile="+cpuPath, "--memprofile="+memPath)...); err != nil {
+		t.Fatalf("run with profiles failed: %s\n%s", err, log)
+	}
+	for _, path := range []string{cpuPath, memPath} {
+		if info, err := os.Stat(path); err != nil || info.Size() == 0 {
+			t.Errorf("profile %s was not written (%v)", filepath.Base(path), err)
+		}
+	}
+}
+
+func TestTemplateSheet(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	input := filepath.Join(dir, "in.xlsx")
+	writePlates(t, input, []string{"Plate1", "Plate2", "Plate3"}, 2, 20, func(f *excelize.File, sheet string) {
+		if sheet == "Plate3" {
+			f.InsertRow(sheet, 0) // the start label is one row further down
+		}
+	})
+
+	log, err := runTool(t, dir, defaultArgs(input, "--template_sheet=Plate1")...)
+	if err != nil {
+		t.Fatalf("run with --template_sheet failed: %s\n%s", err, log)
+	}
+	for _, want := range []string{
+		"using start row 2 of template sheet Plate1",
+		"sheet Plate3 does not share the layout of --template_sheet=Plate1, searching its start row",
+	} {
+		if !strings.Contains(log, want) {
+			t.Errorf("output does not contain %q:\n%s", want, log)
+		}
+	}
+	if strings.Contains(log, "sheet Plate2 does not share") {
+		t.Errorf("Plate2 was searched although it shares the layout of the template:\n%s", log)
+	}
+	f := openOutput(t, filepath.Join(dir, "t_ratios.xlsx"))
+	for _, sheet := range []string{"Plate2", "Plate3"} { // all sheets hold the same values
+		for _, axis := range []string{"A1", "A2", "B2", "B10"} {
+			if got, want := f.GetCellValue(sheet, axis), f.GetCellValue("Plate1", axis); got != want || want == "" {
+				t.Errorf("ratios of %s hold %q in %s; want %q", sheet, got, axis, want)
+			}
+		}
+	}
+
+	if out, err := runTool(t, dir, defaultArgs(input, "--template_sheet=Plate9")...); err == nil {
+		t.Errorf("run with a missing template sheet succeeded:\n%s", out)
+	}
+}
+
+func TestCorrelationAndZScore(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	input := filepath.Join(dir, "in.xlsx")
+	writePlates(t, input, []string{"Plate1"}, 3, 20, nil)
+	if log, err := runTool(t, dir, defaultArgs(input, "--start=1", "--correlation", "--zscore")...); err != nil {
+		t.Fatalf("run with --correlation and --zscore failed: %s\n%s", err, log)
+	}
+
+	// the ratios of all wells rise together, so every pair is perfectly correlated
+	f := openOutput(t, filepath.Join(dir, "t_correlation.xlsx"))
+	rows := f.GetRows("Plate1")
+	if len(rows) != 4 || len(rows[0]) != 4 || rows[0][1] != "cell 1" || rows[3][0] != "cell 3" {
+		t.Fatalf("correlation sheet = %q; want a 3x3 matrix with headers", rows)
+	}
+	for r := 1; r < 4; r++ {
+		for c := 1; c < 4; c++ {
+			if v, err := strconv.ParseFloat(rows[r][c], 64); err != nil || math.Abs(v-1) > 1e-6 {
+				t.Errorf("correlation of %s and %s = %q; want 1", rows[0][c], rows[r][0], rows[r][c])
+			}
+		}
+	}
+
+	// every z-score column has zero mean
+	f = openOutput(t, filepath.Join(dir, "t_zscore.xlsx"))
+	rows = f.GetRows("Plate1")
+	if len(rows) < 2 || rows[0][0] != "cell 1" {
+		t.Fatalf("z-score sheet = %q; want the ratio headers followed by z-scores", rows)
+	}
+	for c := range rows[0] {
+		sum := 0.0
+		for _, row := range rows[1:] {
+			v, err := strconv.ParseFloat(row[c], 64)
+			if err != nil {
+				t.Fatalf("z-score of %s = %q; want a number", rows[0][c], row[c])
+			}
+			sum += v
+		}
+		if math.Abs(sum) > 1e-6 {
+			t.Errorf("z-scores of %s sum up to %g; want 0", rows[0][c], sum)
+		}
+	}
+}
+
+func TestEmitRawPairs(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	input := filepath.Join(dir, "in.xlsx")
+	writePlates(t, input, []string{"Plate1"}, 2, 20, nil)
+	if log, err := runTool(t, dir, defaultArgs(input, "--emit_raw_pairs")...); err != nil {
+		t.Fatalf("run with --emit_raw_pairs failed: %s\n%s", err, log)
+	}
+
+	f := openOutput(t, filepath.Join(dir, "t_transformed_data.xlsx"))
+	rows := f.GetRows("Plate1")
+	want := [][]string{
+		{"Well1 340 (raw)", "Well1 340 (corrected)", "Well1 380 (raw)", "Well1 380 (corrected)",
+			"Well2 340 (raw)", "Well2 340 (corrected)", "Well2 380 (raw)", "Well2 380 (corrected)"},
+		{"201", "151", "300", "240", "202", "152", "300", "240"},
+	}
+	if len(rows) != 21 || !reflect.DeepEqual(rows[:2], want) {
+		t.Errorf("transformed data starts with %q (%d rows); want %q (21 rows)", rows[:2], len(rows), want)
+	}
+
+	// the ratios are computed from the corrected values only
+	if got := openOutput(t, filepath.Join(dir, "t_ratios.xlsx")).GetCellValue("Plate1", "A2"); got != strconv.FormatFloat(151.0/240, 'f', -1, 64) {
+		t.Errorf("first ratio = %q; want %v", got, 151.0/240)
+	}
+
+	if out, err := runTool(t, dir, defaultArgs(input, "--emit_raw_pairs", "--annotate")...); err == nil {
+		t.Errorf("run with --emit_raw_pairs and --annotate succeeded:\n%s", out)
+	}
+
+	// the sheets that --incremental saves before the end of the run hold the raw values as well
+	checkIncrementalLayout(t, "--emit_raw_pairs")
+}
+
+func TestRatioThenCorrectNegativePeaks(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	input := filepath.Join(dir, "in.xlsx")
+	writePlates(t, input, []string{"Plate1"}, 2, 20, nil)
+
+	// every ratio is below the ratio of the backgrounds (50/60), so all corrected traces are negative; they increase with
+	// the measurement, so the peaks are the last values and not 0
+	out, err := runTool(t, dir, defaultArgs(input, "--order=ratio_then_correct", "--start=1", "--print_order=true", "--summary_sheet")...)
+	if err != nil {
+		t.Fatalf("run with --order=ratio_then_correct failed: %s\n%s", err, out)
+	}
+	if want := "ordered values for Plate1: cell 2: -0.141 cell 1: -0.144 \n"; !strings.Contains(out, want) {
+		t.Errorf("output does not contain %q:\n%s", want, out)
+	}
+	summary := openOutput(t, filepath.Join(dir, "t_sorted_ratios.xlsx"))
+	peak, err := strconv.ParseFloat(summary.GetCellValue("Summary", "C2"), 64)
+	if want := 221.0/319 - 50.0/60; err != nil || math.Abs(peak-want) > 1e-9 {
+		t.Errorf("peak of the top column = %v (%v); want %v", peak, err, want)
+	}
+	if got := summary.GetCellValue("Summary", "D2"); got != "21" {
+		t.Errorf("peak row of the top column = %s; want 21", got)
+	}
+}
+
+func TestRatioThenCorrect(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	input := filepath.Join(dir, "in.xlsx")
+	writePlates(t, input, []string{"Plate1"}, 2, 20, nil)
+
+	// both orders on the same input: correcting first divides the corrected channels
+	if log, err := runTool(t, dir, defaultArgs(input, "--order=correct_then_ratio")...); err != nil {
+		t.Fatalf("run with --order=correct_then_ratio failed: %s\n%s", err, log)
+	}
+	corrected := openOutput(t, filepath.Join(dir, "t_ratios.xlsx")).GetCellValue("Plate1", "A2")
+	if got, err := strconv.ParseFloat(corrected, 64); err != nil || math.Abs(got-151.0/240) > 1e-9 {
+		t.Errorf("ratio in A2 with --order=correct_then_ratio = %q; want %v", corrected, 151.0/240)
+	}
+	if log, err := runTool(t, dir, defaultArgs(input, "--order=ratio_then_correct")...); err != nil {
+		t.Fatalf("run with --order=ratio_then_correct failed: %s\n%s", err, log)
+	}
+
+	// the ratios divide the raw channels, while the transformed data is still background corrected
+	ratios := openOutput(t, filepath.Join(dir, "t_ratios.xlsx"))
+	if got := ratios.GetCellValue("Plate1", "A2"); got == corrected {
+		t.Errorf("both orders yield the ratio %s in A2", got)
+	}
+	for _, tt := range []struct {
+		cell string
+		want float64
+	}{
+		{"A2", 201.0/300 - 50.0/60},
+		{"B2", 202.0/300 - 50.0/60},
+		{"A3", 202.0/301 - 50.0/60},
+	} {
+		got, err := strconv.ParseFloat(ratios.GetCellValue("Plate1", tt.cell), 64)
+		if err != nil || math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("ratio in %s = %v (%v); want %v", tt.cell, got, err, tt.want)
+		}
+	}
+	if got := openOutput(t, filepath.Join(dir, "t_transformed_data.xlsx")).GetCellValue("Plate1", "A2"); got != "151" {
+		t.Errorf("first transformed value = %q; want 151", got)
+	}
+
+	for _, args := range [][]string{
+		{"--order=correct"},
+		{"--order=ratio_then_correct", "--channel_baseline=1:5"},
+	} {
+		if out, err := runTool(t, dir, defaultArgs(input, args...)...); err == nil {
+			t.Errorf("run with %q succeeded:\n%s", args, out)
+		}
+	}
+}
+
+func TestListOutputs(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	input := filepath.Join(dir, "in.xlsx")
+	writePlates(t, input, []string{"Plate1", "Plate2"}, 2, 20, nil)
+	args := []string{"--output_format=csv", "--correlation", "--export_order", "--split_columns=split"}
+
+	log, err := runTool(t, dir, defaultArgs(input, append(args, "--list_outputs")...)...)
+	if err != nil {
+		t.Fatalf("run with --list_outputs failed: %s\n%s", err, log)
+	}
+	i := strings.Index(log, "planned outputs:\n")
+	if i < 0 {
+		t.Fatalf("output does not list the planned outputs:\n%s", log)
+	}
+	listed, patterns := make([]string, 0), make([]string, 0)
+	for _, line := range strings.Split(log[i:], "\n") {
+		if strings.HasPrefix(line, "t_") {
+			listed = append(listed, line)
+		}
+		if strings.HasPrefix(line, "split") {
+			patterns = append(patterns, strings.Replace(line, "<column>", "*", 1))
+		}
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "t_*"))
+	if len(files) != 0 {
+		t.Errorf("--list_outputs wrote %q; want no files", files)
+	}
+
+	// a run writes exactly the listed files
+	if log, err := runTool(t, dir, defaultArgs(input, args...)...); err != nil {
+		t.Fatalf("run failed: %s\n%s", err, log)
+	}
+	files, _ = filepath.Glob(filepath.Join(dir, "t_*"))
+	for i := range files {
+		files[i] = filepath.Base(files[i])
+	}
+	sorted := append([]string(nil), listed...)
+	sort.Strings(sorted)
+	if !reflect.DeepEqual(sorted, files) {
+		t.Errorf("--list_outputs listed %q; the run wrote %q", sorted, files)
+	}
+
+	// the files of --split_columns are listed by sheet, since their names depend on the headers of the columns
+	if len(patterns) != 2 {
+		t.Errorf("--list_outputs listed %q for --split_columns; want one pattern per sheet", patterns)
+	}
+	for _, pattern := range patterns {
+		if split, _ := filepath.Glob(filepath.Join(dir, pattern)); len(split) != 2 {
+			t.Errorf("the run wrote %q for %s; want the files of both wells", split, pattern)
+		}
+	}
+
+	// a second listing marks the files of the run
+	log, err = runTool(t, dir, defaultArgs(input, append(args, "--list_outputs")...)...)
+	if want := "t_ratios_Plate1.csv (exists, will be overwritten)"; err != nil || !strings.Contains(log, want) {
+		t.Errorf("second listing does not contain %q (%v):\n%s", want, err, log)
+	}
+}
+
+func TestDataRange(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	input, shifted := filepath.Join(dir, "in.xlsx"), filepath.Join(dir, "shifted.xlsx")
+	writePlates(t, input, []string{"Plate1"}, 2, 20, nil)
+	writePlates(t, shifted, []string{"Plate1"}, 2, 20, func(f *excelize.File, sheet string) {
+		// move the header from A2 to B4 and put notes around the data, which --data_range ignores
+		f.InsertRow(sheet, 0)
+		f.InsertRow(sheet, 0)
+		f.InsertCol(sheet, "A")
+		f.SetCellValue(sheet, "A1", "notes")
+		f.SetCellValue(sheet, "K30", 12345)
+	})
+
+	if log, err := runTool(t, dir, defaultArgs(input)...); err != nil {
+		t.Fatalf("run failed: %s\n%s", err, log)
+	}
+	want := openOutput(t, filepath.Join(dir, "t_ratios.xlsx")).GetRows("Plate1")
+	if log, err := runTool(t, dir, defaultArgs(shifted, "--data_range=B4:J24", "--output_prefix=shifted")...); err != nil {
+		t.Fatalf("run with --data_range failed: %s\n%s", err, log)
+	}
+	if got := openOutput(t, filepath.Join(dir, "shifted_ratios.xlsx")).GetRows("Plate1"); !reflect.DeepEqual(got, want) {
+		t.Errorf("ratios of --data_range = %q; want the ratios of the unshifted data %q", got, want)
+	}
+
+	if out, err := runTool(t, dir, defaultArgs(shifted, "--data_range=J24:B4", "--output_prefix=shifted")...); err == nil {
+		t.Errorf("run with a reversed --data_range succeeded:\n%s", out)
+	}
+}
+
+func TestGroupByCondition(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	input := filepath.Join(dir, "in.xlsx")
+	writePlates(t, input, []string{"Plate1", "Plate2"}, 3, 20, nil)
+	labels := filepath.Join(dir, "map.csv")
+	if err := ioutil.WriteFile(labels, []byte("cell 1,control\ncell 2,Drug X\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if log, err := runTool(t, dir, defaultArgs(input, "--group_by=condition", "--labels="+labels)...); err != nil {
+		t.Fatalf("run with --group_by=condition failed: %s\n%s", err, log)
+	}
+
+	f := openOutput(t, filepath.Join(dir, "t_grouped_ratios.xlsx"))
+	ratios := openOutput(t, filepath.Join(dir, "t_ratios.xlsx"))
+	for _, tt := range []struct {
+		sheet   string
+		headers []string
+		column  string // the column of the wells in the ratios
+	}{
+		{"control", []string{"Plate1 cell 1", "Plate2 cell 1"}, "A"},
+		{"Drug X", []string{"Plate1 cell 2", "Plate2 cell 2"}, "B"},
+		{excelutil.Ungrouped, []string{"Plate1 cell 3", "Plate2 cell 3"}, "C"},
+	} {
+		rows := f.GetRows(tt.sheet)
+		if len(rows) != 21 {
+			t.Errorf("group %s has %d rows; want a header and 20 measurements", tt.sheet, len(rows))
+			continue
+		}
+		if !reflect.DeepEqual(rows[0], tt.headers) {
+			t.Errorf("group %s has headers %q; want %q", tt.sheet, rows[0], tt.headers)
+		}
+		if got, want := rows[5][1], ratios.GetCellValue("Plate2", tt.column+"6"); got != want {
+			t.Errorf("group %s holds %s in B6; want the ratio %s", tt.sheet, got, want)
+		}
+	}
+
+	for _, args := range [][]string{{"--group_by=condition"}, {"--group_by=plate", "--labels=" + labels}} {
+		if out, err := runTool(t, dir, defaultArgs(input, args...)...); err == nil {
+			t.Errorf("run with %q succeeded:\n%s", args, out)
+		}
+	}
+}
+
+func TestReproducible(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	input := filepath.Join(dir, "in.xlsx")
+	writePlates(t, input, []string{"Plate1", "Plate2"}, 4, 20, func(f *excelize.File, sheet string) {
+		// the same spike in wells 2 and 3 ties their peaks
+		f.SetCellValue(sheet, "E12", 305)
+		f.SetCellValue(sheet, "H12", 305)
+	})
+
+	// two runs of the same input write the same stdout and the same bytes to every output
+	args := []string{"--start=1", "--correlation", "--zscore", "--peaks_long", "--export_order"}
+	logs := make([]string, 2)
+	for i, run := range []string{"run1", "run2"} {
+		if err := os.Mkdir(filepath.Join(dir, run), 0755); err != nil {
+			t.Fatal(err)
+		}
+		log, err := runTool(t, dir, defaultArgs(input, append(args, "--output_prefix="+run+"/t")...)...)
+		if err != nil {
+			t.Fatalf("run %s failed: %s\n%s", run, err, log)
+		}
+		logs[i] = strings.Replace(log, run+"/", "", -1)
+	}
+	if logs[0] != logs[1] {
+		t.Errorf("stdout of the runs differs:\n%s\n%s", logs[0], logs[1])
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "run1", "*"))
+	if len(files) < 7 {
+		t.Fatalf("first run wrote %q; want all outputs", files)
+	}
+	for _, first := range files {
+		a, err := ioutil.ReadFile(first)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadFile(filepath.Join(dir, "run2", filepath.Base(first)))
+		if err != nil {
+			t.Errorf("second run did not write %s: %s", filepath.Base(first), err)
+			continue
+		}
+		if !bytes.Equal(a, b) {
+			t.Errorf("%s differs between the runs", filepath.Base(first))
+		}
+	}
+}
+
+func TestHeaderOffset(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	input := filepath.Join(dir, "in.xlsx")
+	writePlates(t, input, []string{"Plate1"}, 2, 20, func(f *excelize.File, sheet string) {
+		// the well names follow in a separate row below the start label
+		f.InsertRow(sheet, 2)
+		f.SetSheetRow(sheet, "A3", &[]interface{}{"sec", "A01 340", "A01 380", "A01 skip", "A02 340", "A02 380", "A02 skip", "bg", "bg"})
+	})
+	log, err := runTool(t, dir, defaultArgs(input, "--header_offset=1")...)
+	if err != nil {
+		t.Fatalf("run with --header_offset=1 failed: %s\n%s", err, log)
+	}
+	if want := "using row 3 as header (--header_offset=1)"; !strings.Contains(log, want) {
+		t.Errorf("output does not contain %q:\n%s", want, log)
+	}
+
+	f := openOutput(t, filepath.Join(dir, "t_transformed_data.xlsx"))
+	rows := f.GetRows("Plate1")
+	want := []string{"A01 340", "A01 380", "A02 340", "A02 380"}
+	if len(rows) != 21 || !reflect.DeepEqual(rows[0], want) {
+		t.Errorf("transformed data has %d rows and headers %q; want 21 rows and %q", len(rows), rows[0], want)
+	}
+	if rows[1][0] != "151" {
+		t.Errorf("first transformed value = %q; want 151", rows[1][0])
+	}
+}
+
+func TestExportOrder(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	input := filepath.Join(dir, "in.xlsx")
+	writePlates(t, input, []string{"Plate1", "Plate2"}, 3, 20, func(f *excelize.File, sheet string) {
+		if sheet == "Plate2" {
+			f.SetCellValue(sheet, "B12", 400) // well 1 of Plate2 has the strongest response
+		}
+	})
+	if log, err := runTool(t, dir, defaultArgs(input, "--start=1", "--export_order")...); err != nil {
+		t.Fatalf("run with --export_order failed: %s\n%s", err, log)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "t_order.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "sheet,rank,column,header\n" +
+		"Plate1,1,3,cell 3\nPlate1,2,2,cell 2\nPlate1,3,1,cell 1\n" +
+		"Plate2,1,1,cell 1\nPlate2,2,3,cell 3\nPlate2,3,2,cell 2\n"
+	if string(b) != want {
+		t.Errorf("order.csv = %q; want %q", b, want)
+	}
+
+	// the order is the one of the sorted ratios
+	sorted := openOutput(t, filepath.Join(dir, "t_sorted_ratios.xlsx"))
+	for sheet, headers := range map[string][]string{"Plate1": {"cell 3", "cell 2", "cell 1"}, "Plate2": {"cell 1", "cell 3", "cell 2"}} {
+		if got := sorted.GetRows(sheet)[0]; !reflect.DeepEqual(got, headers) {
+			t.Errorf("sorted ratios of %s have headers %q; want %q", sheet, got, headers)
+		}
+	}
+}
+
+func TestGzip(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	input := filepath.Join(dir, "in.xlsx")
+	writePlates(t, input, []string{"Plate1"}, 2, 20, nil)
+	args := []string{"--start=1", "--output_format=csv", "--export_order", "--threshold=0"} // no .xlsx threshold data
+	if log, err := runTool(t, dir, defaultArgs(input, args...)...); err != nil {
+		t.Fatalf("run failed: %s\n%s", err, log)
+	}
+	if log, err := runTool(t, dir, defaultArgs(input, append(args, "--gzip", "--output_prefix=gz")...)...); err != nil {
+		t.Fatalf("run with --gzip failed: %s\n%s", err, log)
+	}
+
+	// every file of the plain run was written compressed by the other run
+	plain, _ := filepath.Glob(filepath.Join(dir, "t_*"))
+	if len(plain) != 4 {
+		t.Fatalf("plain run wrote %q; want 4 files", plain)
+	}
+	for _, path := range plain {
+		name := "gz" + strings.TrimPrefix(filepath.Base(path), "t") + ".gz"
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			t.Errorf("run with --gzip did not write %s: %s", name, err)
+			continue
+		}
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			t.Errorf("%s is no gzip file: %s", name, err)
+			continue
+		}
+		got, err := ioutil.ReadAll(zr)
+		f.Close()
+		want, _ := ioutil.ReadFile(path)
+		if err != nil || !bytes.Equal(got, want) {
+			t.Errorf("decompressed %s differs from %s (%v)", name, filepath.Base(path), err)
+		}
+	}
+
+	// --list_outputs and --estimate name the compressed files
+	log, err := runTool(t, dir, defaultArgs(input, append(args, "--gzip", "--output_prefix=gz", "--list_outputs")...)...)
+	if want := "gz_ratios_Plate1.csv.gz (exists, will be overwritten)"; err != nil || !strings.Contains(log, want) {
+		t.Errorf("listing does not contain %q (%v):\n%s", want, err, log)
+	}
+	log, err = runTool(t, dir, defaultArgs(input, append(args, "--gzip", "--estimate")...)...)
+	if want := "estimated size of ratios_<sheet>.csv.gz:"; err != nil || !strings.Contains(log, want) {
+		t.Errorf("estimate does not contain %q (%v):\n%s", want, err, log)
+	}
+}
+
+func TestQualityReport(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	input := filepath.Join(dir, "in.xlsx")
+	writePlates(t, input, []string{"Plate1", "Plate2"}, 1, 20, func(f *excelize.File, sheet string) {
+		if sheet == "Plate2" {
+			f.SetCellValue(sheet, "B10", nil)
+			f.SetCellValue(sheet, "C11", "Inf")
+		}
+	})
+	log, err := runTool(t, dir, defaultArgs(input, "--empty=nan", "--quality_report")...)
+	if err != nil {
+		t.Fatalf("run with --quality_report failed: %s\n%s", err, log)
+	}
+	if want := "sheet Plate2 has 1 empty, 0 non-numeric, and 1 non-finite cell(s) out of 120"; !strings.Contains(log, want) {
+		t.Errorf("output does not contain %q:\n%s", want, log)
+	}
+	if strings.Contains(log, "sheet Plate1 has") {
+		t.Errorf("output reports unusable cells of Plate1:\n%s", log)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "t_quality_report.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(records) != 1+2*7 || records[0] != strings.Join(excelutil.QualityHeader, ",") {
+		t.Fatalf("quality_report.csv = %q; want a header and 7 records per sheet", records)
+	}
+	for _, want := range []string{
+		"Plate1,all,,120,0,0,0",
+		"Plate2,2,Well1 340,20,1,0,0",
+		"Plate2,3,Well1 380,20,0,0,1",
+		"Plate2,all,,120,1,0,1",
+	} {
+		if !strings.Contains(string(b), want+"\n") {
+			t.Errorf("quality_report.csv does not contain %q:\n%s", want, b)
+		}
+	}
+
+	// the report is written before a non-numeric cell stops the run
+	writePlates(t, input, []string{"Plate1", "Plate2"}, 1, 20, func(f *excelize.File, sheet string) {
+		if sheet == "Plate2" {
+			f.SetCellValue(sheet, "B12", "n/a")
+		}
+	})
+	log, err = runTool(t, dir, defaultArgs(input, "--quality_report", "--output_prefix=text")...)
+	if err == nil {
+		t.Fatalf("run with a non-numeric cell succeeded:\n%s", log)
+	}
+	b, err = ioutil.ReadFile(filepath.Join(dir, "text_quality_report.csv"))
+	if err != nil {
+		t.Fatalf("failed run did not write the quality report: %s\n%s", err, log)
+	}
+	for _, want := range []string{"Plate2,2,Well1 340,20,0,1,0", "Plate2,all,,120,0,1,0"} {
+		if !strings.Contains(string(b), want+"\n") {
+			t.Errorf("quality_report.csv of the failed run does not contain %q:\n%s", want, b)
+		}
+	}
+}
+
+func TestStages(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	input := filepath.Join(dir, "in.xlsx")
+	writePlates(t, input, []string{"Plate1"}, 2, 20, nil)
+
+	tests := []struct {
+		stages string
+		want   []string
+	}{
+		{"transform", []string{"t_transformed_data.xlsx"}},
+		{"transform,ratio", []string{"t_ratios.xlsx", "t_transformed_data.xlsx"}},
+	}
+	for _, tt := range tests {
+		prefix := strings.Replace(tt.stages, ",", "_", -1)
+		if err := os.Mkdir(filepath.Join(dir, prefix), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if log, err := runTool(t, dir, defaultArgs(input, "--stages="+tt.stages, "--output_prefix="+prefix+"/t")...); err != nil {
+			t.Fatalf("run with --stages=%s failed: %s\n%s", tt.stages, err, log)
+		}
+		files, _ := filepath.Glob(filepath.Join(dir, prefix, "*"))
+		for i := range files {
+			files[i] = filepath.Base(files[i])
+		}
+		if !reflect.DeepEqual(files, tt.want) {
+			t.Errorf("run with --stages=%s wrote %q; want %q", tt.stages, files, tt.want)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"--stages=ratio"},
+		{"--stages=transform", "--correlation"},
+		{"--stages=transform,ratio", "--export_order"},
+		{"--stages=transform", "--denominator_smooth=5"},
+	} {
+		if out, err := runTool(t, dir, defaultArgs(input, args...)...); err == nil {
+			t.Errorf("run with %q succeeded:\n%s", args, out)
+		}
+	}
+}
+
+func TestDebugDump(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	input := filepath.Join(dir, "in.xlsx")
+	writePlates(t, input, []string{"Plate1"}, 2, 20, nil)
+	dump := filepath.Join(dir, "dump")
+	if log, err := runTool(t, dir, defaultArgs(input, "--start=1", "--output_format=csv", "--debug_dump="+dump)...); err != nil {
+		t.Fatalf("run with --debug_dump failed: %s\n%s", err, log)
+	}
+
+	// the dump of every stage holds the data of its output
+	for stage, output := range map[string]string{
+		"transform": "t_transformed_data_Plate1.csv",
+		"ratio":     "t_ratios_Plate1.csv",
+		"sort":      "t_sorted_ratios_Plate1.csv",
+	} {
+		got, err := ioutil.ReadFile(filepath.Join(dump, "Plate1_"+stage+".csv"))
+		if err != nil {
+			t.Errorf("stage %s was not dumped: %s", stage, err)
+			continue
+		}
+		want, err := ioutil.ReadFile(filepath.Join(dir, output))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("dump of stage %s differs from %s:\n%s\n%s", stage, output, got, want)
+		}
+	}
+
+	// --list_outputs lists exactly the dumps of the run
+	files, _ := filepath.Glob(filepath.Join(dump, "*"))
+	log, err := runTool(t, dir, defaultArgs(input, "--start=1", "--output_format=csv", "--debug_dump="+dump, "--list_outputs")...)
+	if err != nil || strings.Count(log, dump) != len(files) {
+		t.Errorf("--list_outputs did not list the %d dump(s) of the run (%v):\n%s", len(files), err, log)
+	}
+	for _, file := range files {
+		if want := file + " (exists, will be overwritten)"; !strings.Contains(log, want) {
+			t.Errorf("--list_outputs does not contain %q:\n%s", want, log)
+		}
+	}
+}
+
+func TestDenominatorSmooth(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	input := filepath.Join(dir, "in.xlsx")
+	writePlates(t, input, []string{"Plate1"}, 1, 20, func(f *excelize.File, sheet string) {
+		f.SetCellValue(sheet, "C12", 330) // a spike of the denominator in the 10th measurement
+	})
+	if log, err := runTool(t, dir, defaultArgs(input, "--denominator_smooth=3")...); err != nil {
+		t.Fatalf("run with --denominator_smooth=3 failed: %s\n%s", err, log)
+	}
+
+	// the denominator is averaged over three measurements (two at the ends), the numerator is not
+	ratios := openOutput(t, filepath.Join(dir, "t_ratios.xlsx"))
+	for _, tt := range []struct {
+		cell string
+		want float64
+	}{
+		{"A2", 151 / 240.5},
+		{"A11", 160.0 / ((248 + 270 + 250) / 3.0)},
+		{"A12", 161.0 / ((270 + 250 + 251) / 3.0)},
+		{"A21", 170 / 258.5},
+	} {
+		got, err := strconv.ParseFloat(ratios.GetCellValue("Plate1", tt.cell), 64)
+		if err != nil || math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("ratio in %s = %v (%v); want %v", tt.cell, got, err, tt.want)
+		}
+	}
+	// the transformed data keeps the spike
+	if got := openOutput(t, filepath.Join(dir, "t_transformed_data.xlsx")).GetCellValue("Plate1", "B11"); got != "270" {
+		t.Errorf("transformed denominator of the spike = %q; want 270", got)
+	}
+
+	// without smoothing, the ratios of the same input only differ around the spike and at both ends, where the window of
+	// the (otherwise linear) denominator is truncated
+	if log, err := runTool(t, dir, defaultArgs(input, "--output_prefix=raw")...); err != nil {
+		t.Fatalf("run without --denominator_smooth failed: %s\n%s", err, log)
+	}
+	raw := openOutput(t, filepath.Join(dir, "raw_ratios.xlsx"))
+	if got, err := strconv.ParseFloat(raw.GetCellValue("Plate1", "A11"), 64); err != nil || math.Abs(got-160.0/270) > 1e-9 {
+		t.Errorf("unsmoothed ratio of the spike = %v (%v); want %v", got, err, 160.0/270)
+	}
+	for row := 2; row <= 21; row++ {
+		cell := fmt.Sprintf("A%d", row)
+		smoothed, err1 := strconv.ParseFloat(ratios.GetCellValue("Plate1", cell), 64)
+		unsmoothed, err2 := strconv.ParseFloat(raw.GetCellValue("Plate1", cell), 64)
+		if err1 != nil || err2 != nil {
+			t.Fatalf("cannot parse the ratios in %s: %v, %v", cell, err1, err2)
+		}
+		changed := row == 2 || (row >= 10 && row <= 12) || row == 21
+		if got := math.Abs(smoothed-unsmoothed) > 1e-9; got != changed {
+			t.Errorf("ratio in %s = %v with and %v without smoothing; want a difference %v", cell, smoothed, unsmoothed, changed)
+		}
+	}
+
+	if out, err := runTool(t, dir, defaultArgs(input, "--denominator_smooth=-1")...); err == nil {
+		t.Errorf("run with a negative --denominator_smooth succeeded:\n%s", out)
+	}
+}
+
+func TestUnusedColumnsMayHoldText(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	input := filepath.Join(dir, "in.xlsx")
+	writePlates(t, input, []string{"Plate1"}, 2, 20, func(f *excelize.File, sheet string) {
+		for row := 3; row < 23; row++ {
+			f.SetCellValue(sheet, fmt.Sprintf("D%d", row), "ok") // the third column of the first well holds text
+			f.SetCellValue(sheet, fmt.Sprintf("G%d", row), nil)  // and the one of the second well is empty
+		}
+	})
+	if out, err := runTool(t, dir, defaultArgs(input)...); err != nil {
+		t.Fatalf("run with text in the unused columns failed: %s\n%s", err, out)
+	}
+	ratios := openOutput(t, filepath.Join(dir, "t_ratios.xlsx"))
+	for _, tt := range []struct {
+		cell string
+		want float64
+	}{
+		{"A2", 151.0 / 240},
+		{"B2", 152.0 / 240},
+	} {
+		got, err := strconv.ParseFloat(ratios.GetCellValue("Plate1", tt.cell), 64)
+		if err != nil || math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("ratio in %s = %v (%v); want %v", tt.cell, got, err, tt.want)
+		}
+	}
+
+	// a used column that holds text is still an error
+	writePlates(t, input, []string{"Plate1"}, 2, 20, func(f *excelize.File, sheet string) {
+		f.SetCellValue(sheet, "B5", "ok")
+	})
+	if out, err := runTool(t, dir, defaultArgs(input)...); err == nil || !strings.Contains(out, `cannot parse Plate1!B5: "ok" is not a number`) {
+		t.Errorf("run with text in a used column = %v; want a parse error:\n%s", err, out)
+	}
+}
+
+func TestSheetNameTemplate(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	input := filepath.Join(dir, "in.xlsx")
+	writePlates(t, input, []string{"Plate1", "Plate2"}, 2, 20, nil)
+	if out, err := runTool(t, dir, defaultArgs(input, "--sheet_name_template=ratios {name}")...); err != nil {
+		t.Fatalf("run with --sheet_name_template failed: %s\n%s", err, out)
+	}
+	f := openOutput(t, filepath.Join(dir, "t_ratios.xlsx"))
+	for _, sheet := range []string{"ratios Plate1", "ratios Plate2"} {
+		if f.GetSheetIndex(sheet) == 0 {
+			t.Errorf("ratios have the sheets %v; want %s", f.GetSheetMap(), sheet)
+		}
+	}
+
+	// both sheets would be written to the same output sheet
+	out, err := runTool(t, dir, defaultArgs(input, "--sheet_name_template=ratios")...)
+	if want := "sheets Plate1 and Plate2 both map to the output sheet ratios"; err == nil || !strings.Contains(out, want) {
+		t.Errorf("run with colliding sheet names = %v; want an error containing %q:\n%s", err, want, out)
+	}
+}
+
+func TestEmptyPolicies(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	input := filepath.Join(dir, "in.xlsx")
+	writePlates(t, input, []string{"Plate1"}, 2, 20, func(f *excelize.File, sheet string) {
+		f.SetCellValue(sheet, "E10", nil)
+		for row := 3; row < 23; row++ {
+			f.SetCellValue(sheet, fmt.Sprintf("G%d", row), nil) // the unused third column of the second well is empty
+		}
+	})
+
+	// by default, an empty cell in a used column is an error
+	out, err := runTool(t, dir, defaultArgs(input)...)
+	if want := "cannot parse Plate1!E10: cell is empty"; err == nil || !strings.Contains(out, want) {
+		t.Errorf("run with an empty cell = %v; want an error containing %q:\n%s", err, want, out)
+	}
+
+	// --empty=zero reads the empty cell as 0 and --empty=skip leaves out its row (but none of the other rows)
+	for _, tt := range []struct {
+		policy   string
+		c9, c10  string
+		wantRows int
+	}{
+		{"zero", "-50", "160", 21},
+		{"skip", "160", "161", 20},
+	} {
+		if out, err := runTool(t, dir, defaultArgs(input, "--empty="+tt.policy)...); err != nil {
+			t.Fatalf("run with --empty=%s failed: %s\n%s", tt.policy, err, out)
+		}
+		transformed := openOutput(t, filepath.Join(dir, "t_transformed_data.xlsx"))
+		if got := transformed.GetCellValue("Plate1", "C9"); got != tt.c9 {
+			t.Errorf("transformed value of the empty cell with --empty=%s = %q; want %s", tt.policy, got, tt.c9)
+		}
+		if got := transformed.GetCellValue("Plate1", "C10"); got != tt.c10 {
+			t.Errorf("transformed value after the empty cell with --empty=%s = %q; want %s", tt.policy, got, tt.c10)
+		}
+		if got := len(transformed.GetRows("Plate1")); got != tt.wantRows {
+			t.Errorf("transformed data with --empty=%s have %d rows; want %d", tt.policy, got, tt.wantRows)
+		}
+	}
+}
+
+func TestVerifyInfiniteRatios(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	input := filepath.Join(dir, "in.xlsx")
+	writePlates(t, input, []string{"Plate1"}, 1, 20, func(f *excelize.File, sheet string) {
+		f.SetCellValue(sheet, "C10", 60) // the corrected 380 nm value is 0, so the ratio is infinite
+	})
+
+	// the infinite ratio is stored as written by --inf and is no drifting cell
+	for _, policy := range []string{"text", "blank", "1e9"} {
+		out, err := runTool(t, dir, defaultArgs(input, "--verify", "--inf="+policy)...)
+		if err != nil {
+			t.Fatalf("run with --inf=%s failed: %s\n%s", policy, err, out)
+		}
+		if !strings.Contains(out, "Plate1: 0 drifting cells") || strings.Contains(out, "verification failed") {
+			t.Errorf("run with --inf=%s reported drifting cells:\n%s", policy, out)
+		}
+	}
+}
+
+func TestLabelsFile(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	input := filepath.Join(dir, "in.xlsx")
+	writePlates(t, input, []string{"Plate1"}, 4, 20, nil)
+
+	// the wells are matched by position, default header, and source header; the fourth well is not mapped
+	labels := filepath.Join(dir, "map.csv")
+	mapping := "1,Drug X 10uM\ncell 2,Vehicle\nWell3 380,Control\n"
+	if err := ioutil.WriteFile(labels, []byte(mapping), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := runTool(t, dir, defaultArgs(input, "--start=1", "--labels="+labels)...); err != nil {
+		t.Fatalf("run with --labels failed: %s\n%s", err, out)
+	}
+
+	want := []string{"Drug X 10uM", "Vehicle", "Control", "cell 4"}
+	if got := openOutput(t, filepath.Join(dir, "t_ratios.xlsx")).GetRows("Plate1")[0]; !reflect.DeepEqual(got, want) {
+		t.Errorf("ratio headers = %q; want %q", got, want)
+	}
+	// the peaks rise with the number of the well, so the sorted ratios have the labels in reverse order
+	want = []string{"cell 4", "Control", "Vehicle", "Drug X 10uM"}
+	if got := openOutput(t, filepath.Join(dir, "t_sorted_ratios.xlsx")).GetRows("Plate1")[0]; !reflect.DeepEqual(got, want) {
+		t.Errorf("sorted headers = %q; want %q", got, want)
+	}
+}
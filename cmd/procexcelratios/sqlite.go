@@ -0,0 +1,7 @@
+//go:build sqlite
+// +build sqlite
+
+package main
+
+// the SQLite driver is only linked if the program is built with '-tags sqlite'
+import _ "github.com/mattn/go-sqlite3"
@@ -0,0 +1,131 @@
+package excelutil
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/360EntSecGroup-Skylar/excelize"
+)
+
+// CellDiff describes a cell that differs between two workbooks
+type CellDiff struct {
+	Sheet string
+	Cell  string // empty if the whole sheet is missing in one of the workbooks
+	Old   string
+	New   string
+}
+
+// String formats a CellDiff as 'sheet!cell: old -> new'
+func (d CellDiff) String() string {
+	if d.Cell == "" {
+		return fmt.Sprintf("%s: %s -> %s", d.Sheet, d.Old, d.New)
+	}
+	return fmt.Sprintf("%s!%s: %s -> %s", d.Sheet, d.Cell, d.Old, d.New)
+}
+
+// CompareWorkbooks compares all sheets of two workbooks cell by cell and returns the cells that differ
+// numeric cells are considered equal if they differ by no more than tol, all other cells have to be identical
+func CompareWorkbooks(before, after *excelize.File, tol float64) []CellDiff {
+	diffs := make([]CellDiff, 0)
+	oldSheets, newSheets := sheetSet(before), sheetSet(after)
+	names := make([]string, 0)
+	for name := range oldSheets {
+		names = append(names, name)
+	}
+	for name := range newSheets {
+		if !oldSheets[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		switch {
+		case !newSheets[name]:
+			diffs = append(diffs, CellDiff{Sheet: name, Old: "sheet", New: "missing"})
+			continue
+		case !oldSheets[name]:
+			diffs = append(diffs, CellDiff{Sheet: name, Old: "missing", New: "sheet"})
+			continue
+		}
+		oldRows, newRows := before.GetRows(name), after.GetRows(name)
+		for r := 0; r < len(oldRows) || r < len(newRows); r++ {
+			var oldRow, newRow []string
+			if r < len(oldRows) {
+				oldRow = oldRows[r]
+			}
+			if r < len(newRows) {
+				newRow = newRows[r]
+			}
+			for c := 0; c < len(oldRow) || c < len(newRow); c++ {
+				var o, n string
+				if c < len(oldRow) {
+					o = oldRow[c]
+				}
+				if c < len(newRow) {
+					n = newRow[c]
+				}
+				if !equalCells(o, n, tol) {
+					diffs = append(diffs, CellDiff{Sheet: name, Cell: fmt.Sprintf("%s%d", GetColumn(c+1), r+1), Old: o, New: n})
+				}
+			}
+		}
+	}
+	return diffs
+}
+
+// sheetSet returns the set of sheet names of a workbook
+func sheetSet(f *excelize.File) map[string]bool {
+	set := make(map[string]bool)
+	for _, name := range f.GetSheetMap() {
+		set[name] = true
+	}
+	return set
+}
+
+// equalCells compares two cell values numerically (within tol) if both are numbers and literally otherwise
+func equalCells(a, b string, tol float64) bool {
+	if a == b {
+		return true
+	}
+	x, errA := strconv.ParseFloat(a, 64)
+	y, errB := strconv.ParseFloat(b, 64)
+	if errA != nil || errB != nil {
+		return false
+	}
+	return AlmostEqual(x, y, tol)
+}
+
+// VerifySheet re-reads the data region of a sheet (everything below the header row) and returns every cell whose
+// parsed value differs from the intended value data[r][c] (which belongs to row r+2 and column c+1) by more than tol
+// the intended values are compared as they are written (see InfPolicy.CellValue), i.e. NaN must be stored as an empty
+// cell and infinite values as their replacement according to inf; Old holds the intended and New the stored value of a
+// returned CellDiff
+func VerifySheet(f *excelize.File, sheet string, data [][]float64, tol float64, inf InfPolicy) []CellDiff {
+	diffs := make([]CellDiff, 0)
+	rows := f.GetRows(sheet)
+	for r := range data {
+		for c, want := range data[r] {
+			got := ""
+			if r+1 < len(rows) && c < len(rows[r+1]) {
+				got = rows[r+1][c]
+			}
+			same := false
+			switch w := inf.CellValue(want).(type) {
+			case nil:
+				same = got == ""
+			case string:
+				same = got == w
+			case float64:
+				v, err := strconv.ParseFloat(got, 64)
+				same = err == nil && AlmostEqual(v, w, tol)
+			}
+			if !same {
+				diffs = append(diffs, CellDiff{Sheet: sheet, Cell: fmt.Sprintf("%s%d", GetColumn(c+1), r+2),
+					Old: strconv.FormatFloat(want, 'g', -1, 64), New: got})
+			}
+		}
+	}
+	return diffs
+}
@@ -0,0 +1,100 @@
+package excelutil
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/360EntSecGroup-Skylar/excelize"
+)
+
+func TestCompareWorkbooks(t *testing.T) {
+	before, after := excelize.NewFile(), excelize.NewFile()
+	before.NewSheet("Old")
+	after.NewSheet("New")
+	before.SetSheetRow("Sheet1", "A1", &[]interface{}{"cell 1", 0.5, 1.0})
+	after.SetSheetRow("Sheet1", "A1", &[]interface{}{"cell 1", 0.5000001, 2.0, "extra"})
+	before.SetCellValue("Sheet1", "A2", "text")
+	after.SetCellValue("Sheet1", "A2", "Text")
+
+	want := []CellDiff{
+		{Sheet: "New", Old: "missing", New: "sheet"},
+		{Sheet: "Old", Old: "sheet", New: "missing"},
+		{Sheet: "Sheet1", Cell: "C1", Old: "1", New: "2"},
+		{Sheet: "Sheet1", Cell: "D1", Old: "", New: "extra"},
+		{Sheet: "Sheet1", Cell: "A2", Old: "text", New: "Text"},
+	}
+	if got := CompareWorkbooks(before, after, 1e-6); !reflect.DeepEqual(got, want) {
+		t.Errorf("CompareWorkbooks =\n%v\nwant\n%v", got, want)
+	}
+
+	// without tolerance, the numbers of B1 differ, too
+	if got := CompareWorkbooks(before, after, 0); len(got) != len(want)+1 || got[2].Cell != "B1" {
+		t.Errorf("CompareWorkbooks without tolerance = %v; want B1 to differ", got)
+	}
+	if got := CompareWorkbooks(before, before, 0); len(got) != 0 {
+		t.Errorf("CompareWorkbooks of the same workbook = %v; want no differences", got)
+	}
+	if got := want[2].String(); got != "Sheet1!C1: 1 -> 2" {
+		t.Errorf("String() = %q", got)
+	}
+}
+
+func TestVerifySheet(t *testing.T) {
+	// values whose decimal representation is long or that are close to the limits of float64
+	data := [][]float64{
+		{0.1 + 0.2, 1.0 / 3, 2.0 / 3},
+		{1e-310, 123456789.123456789, math.MaxFloat64},
+		{-0.0001234, 1e21, math.SmallestNonzeroFloat64},
+	}
+	f := excelize.NewFile()
+	f.SetSheetRow("Sheet1", "A1", &[]interface{}{"a", "b", "c"})
+	for r, row := range data {
+		for c, v := range row {
+			f.SetCellValue("Sheet1", fmt.Sprintf("%s%d", GetColumn(c+1), r+2), v)
+		}
+	}
+	if diffs := VerifySheet(f, "Sheet1", data, 0, "text"); len(diffs) != 0 {
+		t.Errorf("VerifySheet of exactly written values = %v; want no differences", diffs)
+	}
+
+	f.SetCellValue("Sheet1", "B2", 0.333)
+	f.SetCellValue("Sheet1", "C4", "")
+	want := []CellDiff{
+		{Sheet: "Sheet1", Cell: "B2", Old: "0.3333333333333333", New: "0.333"},
+		{Sheet: "Sheet1", Cell: "C4", Old: "5e-324", New: ""},
+	}
+	if got := VerifySheet(f, "Sheet1", data, 1e-6, "text"); !reflect.DeepEqual(got, want) {
+		t.Errorf("VerifySheet =\n%v\nwant\n%v", got, want)
+	}
+	if got := VerifySheet(f, "Sheet1", data, 1e-3, "text"); len(got) != 1 {
+		t.Errorf("VerifySheet within 1e-3 = %v; want only the empty cell", got)
+	}
+}
+
+func TestVerifySheetNaNAndInf(t *testing.T) {
+	data := [][]float64{{math.NaN(), math.Inf(1), math.Inf(-1)}}
+	for _, policy := range []InfPolicy{"text", "blank", "1e6"} {
+		f := excelize.NewFile()
+		f.SetSheetRow("Sheet1", "A1", &[]interface{}{"a", "b", "c"})
+		for c, v := range data[0] {
+			f.SetCellValue("Sheet1", fmt.Sprintf("%s2", GetColumn(c+1)), policy.CellValue(v))
+		}
+		if diffs := VerifySheet(f, "Sheet1", data, 0, policy); len(diffs) != 0 {
+			t.Errorf("VerifySheet with --inf=%s = %v; want no differences", policy, diffs)
+		}
+	}
+
+	// a NaN is only matched by an empty cell and an infinite value only by its replacement
+	f := excelize.NewFile()
+	f.SetSheetRow("Sheet1", "A2", &[]interface{}{"NaN", "", "-1e6"})
+	want := []CellDiff{
+		{Sheet: "Sheet1", Cell: "A2", Old: "NaN", New: "NaN"},
+		{Sheet: "Sheet1", Cell: "B2", Old: "+Inf", New: ""},
+		{Sheet: "Sheet1", Cell: "C2", Old: "-Inf", New: "-1e6"},
+	}
+	if got := VerifySheet(f, "Sheet1", data, 0, "text"); !reflect.DeepEqual(got, want) {
+		t.Errorf("VerifySheet =\n%v\nwant\n%v", got, want)
+	}
+}
@@ -6,8 +6,24 @@
 package excelutil
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/xml"
 	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
 	"log"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/360EntSecGroup-Skylar/excelize"
@@ -27,6 +43,30 @@ type ExcelWorkbook struct {
 	SheetNames []string
 	NumSheets  int
 	Dims       [2]int
+	Empty      EmptyPolicy   // how DataMatrix treats empty cells (defaults to EmptyError)
+	SearchRows int           // number of rows that StartRowAny searches for a start label (0 means all rows)
+	Retries    int           // number of times that OpenAs retries to open an .xlsx file after a transient error
+	RetryDelay time.Duration // time between two attempts to open a file
+}
+
+// EmptyPolicy defines how empty cells in the data region are treated
+type EmptyPolicy string
+
+// empty cells either abort parsing, are read as 0 or NaN, or cause their whole row to be skipped
+const (
+	EmptyError EmptyPolicy = "error"
+	EmptyZero  EmptyPolicy = "zero"
+	EmptySkip  EmptyPolicy = "skip"
+	EmptyNaN   EmptyPolicy = "nan"
+)
+
+// ParseEmptyPolicy validates the name of an empty-cell policy
+func ParseEmptyPolicy(s string) (EmptyPolicy, error) {
+	switch p := EmptyPolicy(s); p {
+	case EmptyError, EmptyZero, EmptySkip, EmptyNaN:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown empty-cell policy %s (must be one of error, zero, skip, nan)", s)
 }
 
 // NumberOfSheets returns the number of sheets in an excelWorkbook
@@ -36,18 +76,238 @@ func (wb *ExcelWorkbook) NumberOfSheets() int {
 
 // StartRow returns the row index at which the actual data matrix starts as an integer
 func (wb *ExcelWorkbook) StartRow(sheet, label string) (int, error) {
-	m := wb.XLSX.GetRows(sheet)
-	for idx, val := range m {
-		if string(val[0]) == label {
-			return idx, nil
+	return wb.StartRowAny(sheet, []string{label})
+}
+
+// StartRowAny is like StartRow but accepts a list of candidate labels (e.g. for different instruments)
+// and returns the index of the first row whose label matches any of them; labels are compared after
+// NormalizeLabel, so a BOM or non-breaking spaces that some exports add do not prevent a match
+func (wb *ExcelWorkbook) StartRowAny(sheet string, labels []string) (int, error) {
+	rows := wb.MatchingRows(sheet, labels)
+	if len(rows) == 0 && wb.SearchRows > 0 {
+		return 0, fmt.Errorf("did not find a row with label %s in column 1 within the first %d rows", strings.Join(labels, " or "), wb.SearchRows)
+	}
+	if len(rows) == 0 {
+		return 0, fmt.Errorf("did not find a row with label %s in column 1", strings.Join(labels, " or "))
+	}
+	return rows[0], nil
+}
+
+// CheckStartLabel returns an error that lists all matching rows (starting at 1) if more than one row of a sheet matches
+// any of labels (e.g. because of repeated headers of concatenated exports), in which case StartRowAny may pick the wrong one
+func (wb *ExcelWorkbook) CheckStartLabel(sheet string, labels []string) error {
+	rows := wb.MatchingRows(sheet, labels)
+	if len(rows) < 2 {
+		return nil
+	}
+	indices := make([]string, len(rows))
+	for i, row := range rows {
+		indices[i] = strconv.Itoa(row + 1)
+	}
+	return fmt.Errorf("found %d rows with label %s in column 1 of sheet %s (rows %s)", len(rows), strings.Join(labels, " or "),
+		sheet, strings.Join(indices, ", "))
+}
+
+// MatchingRows returns the indices of all rows whose label in column 1 matches any of labels (see StartRowAny)
+// only the first SearchRows rows are searched if it is positive, and the rows below them are not even read (see ScanRows)
+func (wb *ExcelWorkbook) MatchingRows(sheet string, labels []string) []int {
+	rows := make([]int, 0)
+	_ = ScanRows(wb.XLSX, sheet, func(idx int, val []string) bool {
+		if wb.SearchRows > 0 && idx >= wb.SearchRows {
+			return false
+		}
+		if len(val) == 0 {
+			return true
+		}
+		cell := NormalizeLabel(val[0])
+		for _, label := range labels {
+			if cell == NormalizeLabel(label) {
+				rows = append(rows, idx)
+				break
+			}
+		}
+		return true
+	})
+	return rows
+}
+
+// xmlRow is a row of the XML part of a worksheet as ScanRows decodes it
+type xmlRow struct {
+	R int `xml:"r,attr"`
+	C []struct {
+		R  string `xml:"r,attr"`
+		T  string `xml:"t,attr"`
+		V  string `xml:"v"`
+		IS struct {
+			T string `xml:"t"`
+		} `xml:"is"`
+	} `xml:"c"`
+}
+
+// ScanRows calls fn with the (0-based) index and the cells of every row of a sheet, in order, until fn returns false
+// unlike GetRows, the rows are decoded one by one from the XML part of the sheet, so a scan that stops early (e.g. after
+// --label_search_limit rows) neither decodes the rows below nor builds a matrix of all cells of the sheet; rows without
+// cells are left out, every row ends at its last cell, and the cells hold their stored values (number formats are not
+// applied like GetRows does)
+func ScanRows(f *excelize.File, sheet string, fn func(idx int, cells []string) bool) error {
+	part := fmt.Sprintf("xl/worksheets/sheet%d.xml", f.GetSheetIndex(sheet))
+	if f.Sheet[part] != nil {
+		// the sheet was read into memory and may have changed since, Rows writes it back to its part
+		if _, err := f.Rows(sheet); err != nil {
+			return err
+		}
+	}
+	if _, ok := f.XLSX[part]; !ok {
+		return fmt.Errorf("sheet %s does not exist", sheet)
+	}
+	var shared []string
+	decoder := xml.NewDecoder(bytes.NewReader(f.XLSX[part]))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "row" {
+			continue
+		}
+		var row xmlRow
+		if err := decoder.DecodeElement(&row, &start); err != nil {
+			return err
+		}
+		cells := make([]string, 0, len(row.C))
+		for _, c := range row.C {
+			col, _, err := ParseCoordinate(c.R)
+			if err != nil {
+				return fmt.Errorf("invalid cell %q in row %d of sheet %s", c.R, row.R, sheet)
+			}
+			for len(cells) < col {
+				cells = append(cells, "")
+			}
+			switch c.T {
+			case "s":
+				if shared == nil {
+					shared = sharedStrings(f)
+				}
+				if i, err := strconv.Atoi(c.V); err == nil && i >= 0 && i < len(shared) {
+					cells[col-1] = shared[i]
+				}
+			case "inlineStr":
+				cells[col-1] = c.IS.T
+			default:
+				cells[col-1] = c.V
+			}
+		}
+		if !fn(row.R-1, cells) {
+			return nil
 		}
 	}
-	return 0, fmt.Errorf("did not find a row with label %s in column 1", label)
+}
+
+// sharedStrings returns the shared strings of a workbook, which cells of type "s" refer to by index; the runs of rich
+// text are joined like GetRows does
+func sharedStrings(f *excelize.File) []string {
+	if f.SharedStrings == nil { // excelize has not read them yet
+		var sst struct {
+			SI []struct {
+				T string   `xml:"t"`
+				R []string `xml:"r>t"`
+			} `xml:"si"`
+		}
+		_ = xml.Unmarshal(f.XLSX["xl/sharedStrings.xml"], &sst)
+		shared := make([]string, len(sst.SI))
+		for i, si := range sst.SI {
+			shared[i] = si.T
+			if len(si.R) > 0 {
+				shared[i] = strings.Join(si.R, "")
+			}
+		}
+		return shared
+	}
+	shared := make([]string, len(f.SharedStrings.SI))
+	for i, si := range f.SharedStrings.SI {
+		shared[i] = si.T
+		if len(si.R) > 0 {
+			shared[i] = ""
+			for _, r := range si.R {
+				shared[i] += r.T
+			}
+		}
+	}
+	return shared
+}
+
+// IsStartRow reports whether the first cell of the (0-based) row of sheet holds one of labels (see MatchingRows); unlike
+// StartRowAny, only that cell is read, which makes it cheap to check that a start row can be reused for another sheet
+func (wb *ExcelWorkbook) IsStartRow(sheet string, row int, labels []string) bool {
+	cell := NormalizeLabel(wb.XLSX.GetCellValue(sheet, fmt.Sprintf("A%d", row+1)))
+	for _, label := range labels {
+		if cell == NormalizeLabel(label) {
+			return true
+		}
+	}
+	return false
+}
+
+// LayoutMismatches compares the layout (number of columns and start row, see StartRowAny) of every sheet to the
+// layout of the first sheet and returns a description of every deviating sheet; nil means that all sheets agree
+func (wb *ExcelWorkbook) LayoutMismatches(labels []string) []string {
+	var mismatches []string
+	var cols, start int
+	for idx, sheet := range wb.SheetNames {
+		_, _, _, lastCol := wb.UsedRange(sheet)
+		row, err := wb.StartRowAny(sheet, labels)
+		if err != nil {
+			row = -1
+		}
+		if idx == 0 {
+			cols, start = lastCol+1, row
+			continue
+		}
+		if lastCol+1 != cols || row != start {
+			mismatches = append(mismatches, fmt.Sprintf("%s: %d columns, start row %d (expected %d columns, start row %d)",
+				sheet, lastCol+1, row+1, cols, start+1))
+		}
+	}
+	return mismatches
+}
+
+// NormalizeLabel removes the characters that some exports add to header labels and trims surrounding white space:
+// byte order marks (U+FEFF) and zero-width characters (U+200B, U+200C, U+200D, U+2060) are dropped and
+// non-breaking spaces (U+00A0, U+202F) are replaced by ordinary spaces
+func NormalizeLabel(label string) string {
+	label = strings.Map(func(r rune) rune {
+		switch r {
+		case '\uFEFF', '\u200B', '\u200C', '\u200D', '\u2060':
+			return -1
+		case '\u00A0', '\u202F':
+			return ' '
+		}
+		return r
+	}, label)
+	return strings.TrimSpace(label)
+}
+
+// ParseLabels splits a comma-separated list of labels and trims surrounding white space
+func ParseLabels(list string) []string {
+	labels := make([]string, 0)
+	for _, l := range strings.Split(list, ",") {
+		if l = strings.TrimSpace(l); l != "" {
+			labels = append(labels, l)
+		}
+	}
+	return labels
 }
 
 // Dimensions returns the dimensions of a sheet in the format (rows, cols)
+// a sheet without rows (e.g. because its part of the file is corrupt and excelize returns nil) has the dimensions (0, 0)
 func (wb *ExcelWorkbook) Dimensions(sheet string) [2]int {
 	m := wb.XLSX.GetRows(sheet)
+	if len(m) == 0 {
+		return [2]int{0, 0}
+	}
 	d := [2]int{
 		len(m),    // size of row dimension
 		len(m[0]), // size of column dimension
@@ -55,20 +315,237 @@ func (wb *ExcelWorkbook) Dimensions(sheet string) [2]int {
 	return d
 }
 
+// UsedRange returns the (0-based, inclusive) bounding box of all non-empty cells of a sheet
+// unlike Dimensions, empty rows and columns around the data are not counted; an empty sheet yields -1 for all bounds
+func (wb *ExcelWorkbook) UsedRange(sheet string) (firstRow, firstCol, lastRow, lastCol int) {
+	return usedRange(wb.XLSX.GetRows(sheet))
+}
+
+// usedRange implements UsedRange for the rows of a sheet that were read already
+func usedRange(rows [][]string) (firstRow, firstCol, lastRow, lastCol int) {
+	firstRow, firstCol, lastRow, lastCol = -1, -1, -1, -1
+	for r, row := range rows {
+		for c, cell := range row {
+			if strings.TrimSpace(cell) == "" {
+				continue
+			}
+			if firstRow < 0 {
+				firstRow = r
+			}
+			lastRow = r
+			if firstCol < 0 || c < firstCol {
+				firstCol = c
+			}
+			if c > lastCol {
+				lastCol = c
+			}
+		}
+	}
+	return firstRow, firstCol, lastRow, lastCol
+}
+
+// per-cell constants of Estimate; they are guesses, not measurements, and only meant for a rough projection: a number
+// cell like <c r="B2"><v>0.6562500000000001</v></c> takes about 40 bytes of XML, which deflate shrinks to about a
+// fifth, and the same number takes up to 17 digits plus a delimiter in a text file; the time per cell is a generous
+// guess for reading, transforming, and writing a cell with excelize
+const (
+	estimatedTimePerCell      = 100 * time.Microsecond // processing time per input cell
+	estimatedBytesPerCell     = 8                      // compressed size per output cell (.xlsx files and files written with --gzip)
+	estimatedTextBytesPerCell = 20                     // size per output cell of uncompressed .csv, .tsv, and .json files
+)
+
+// CellCount returns the number of cells within the used range (see UsedRange) of all sheets of the workbook
+func (wb *ExcelWorkbook) CellCount() int {
+	cells := 0
+	for _, sheet := range wb.SheetNames {
+		firstRow, firstCol, lastRow, lastCol := wb.UsedRange(sheet)
+		if lastRow >= 0 {
+			cells += (lastRow - firstRow + 1) * (lastCol - firstCol + 1)
+		}
+	}
+	return cells
+}
+
+// Estimate returns the rough processing time of a workbook with the given number of input cells and the projected
+// size (in bytes) of an output in format (see SaveWorkbook) that holds fraction times as many cells as the input; .csv,
+// .tsv, and .json files are only compressed if compress is set (see SaveOptions.Gzip)
+func Estimate(cells int, fraction float64, format string, compress bool) (time.Duration, int64) {
+	perCell := estimatedBytesPerCell
+	if format != "xlsx" && !compress {
+		perCell = estimatedTextBytesPerCell
+	}
+	return time.Duration(cells) * estimatedTimePerCell, int64(float64(cells) * fraction * float64(perCell))
+}
+
+// EstimatedOutput is an output file whose size --estimate projects: Name is its base name (e.g. "ratios") and Fraction
+// the number of its cells relative to the number of input cells (see Estimate)
+type EstimatedOutput struct {
+	Name     string
+	Fraction float64
+}
+
+// PrintEstimate writes the projections of --estimate to w: the number of used input cells of the workbook, the rough
+// processing time, and the size of every output in format, compressed if compress is set (see Estimate)
+func (wb *ExcelWorkbook) PrintEstimate(w io.Writer, format string, outputs []EstimatedOutput, compress bool) {
+	cells := wb.CellCount()
+	duration, _ := Estimate(cells, 0, format, compress)
+	fmt.Fprintf(w, "estimated input cells: %d in %d sheet(s)\n", cells, wb.NumSheets)
+	fmt.Fprintf(w, "estimated processing time: %s\n", duration.Round(time.Second))
+	for _, out := range outputs {
+		_, size := Estimate(cells, out.Fraction, format, compress)
+		fmt.Fprintf(w, "estimated size of %s: %.1f MB\n", OutputPath(format, out.Name, compress), float64(size)/1e6)
+	}
+}
+
 // Open opens a .xlsx file and assigns it to an ExcelWorkbook
+// OpenDocument spreadsheets and tab-separated files (detected by their .ods and .tsv extensions) are converted to an
+// in-memory .xlsx workbook
 func (wb *ExcelWorkbook) Open(name string) {
-	xlsx, err := excelize.OpenFile(name)
+	wb.OpenAs(name, "")
+}
+
+// ResolveFormat returns the format in which OpenAs reads the file at name: format itself unless it is empty, in which
+// case the format is detected by the extension ("ods" for .ods files, "tsv" for .tsv files, and "xlsx" otherwise)
+func ResolveFormat(name, format string) string {
+	if format != "" {
+		return format
+	}
+	switch lower := strings.ToLower(name); {
+	case strings.HasSuffix(lower, ".ods"):
+		return "ods"
+	case strings.HasSuffix(lower, ".tsv"):
+		return "tsv"
+	}
+	return "xlsx"
+}
+
+// OpenAs is like Open but reads the file in the given format ("xlsx", "ods", or "tsv") regardless of its extension
+// an empty format detects the format by the extension (see ResolveFormat)
+func (wb *ExcelWorkbook) OpenAs(name, format string) {
+	switch ResolveFormat(name, format) {
+	case "ods":
+		if err := retry(wb.Retries, wb.RetryDelay, func() error { return checkComplete(name) }); err != nil {
+			log.Fatalf("%s\n", err)
+		}
+		wb.openODS(name)
+		return
+	case "tsv":
+		wb.openDelimited(name, '\t')
+		return
+	}
+	xlsx, err := OpenFileRetry(name, wb.Retries, wb.RetryDelay)
 	if err != nil {
 		log.Fatalf("error while opening file: %s\n", err)
 	}
 	wb.XLSX = xlsx
 }
 
+// IncompleteError is the error of CheckComplete; Err is the error of reading the archive or its part Part (empty if
+// the archive could not be opened at all)
+type IncompleteError struct {
+	Name string
+	Part string
+	Err  error
+}
+
+func (e *IncompleteError) Error() string {
+	if e.Part == "" {
+		return fmt.Sprintf("file %s appears incomplete: %s", e.Name, e.Err)
+	}
+	return fmt.Sprintf("file %s appears incomplete: %s: %s", e.Name, e.Part, e.Err)
+}
+
+// CheckComplete returns an error if the .xlsx (or .ods) file at name is not a complete zip archive, e.g. because
+// an instrument is still writing it; a valid central directory is required and every part has to be readable
+func CheckComplete(name string) error {
+	zr, err := zip.OpenReader(name)
+	if err != nil {
+		return &IncompleteError{Name: name, Err: err}
+	}
+	defer zr.Close()
+	for _, part := range zr.File {
+		rc, err := part.Open()
+		if err == nil {
+			_, err = io.Copy(ioutil.Discard, rc)
+			rc.Close()
+		}
+		if err != nil {
+			return &IncompleteError{Name: name, Part: part.Name, Err: err}
+		}
+	}
+	return nil
+}
+
+// WaitComplete calls CheckComplete every interval until the file at name is complete or timeout has passed,
+// in which case the last error is returned
+func WaitComplete(name string, timeout, interval time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		err := CheckComplete(name)
+		if err == nil || !time.Now().Add(interval).Before(deadline) {
+			return err
+		}
+		time.Sleep(interval)
+	}
+}
+
+// OpenReader reads an .xlsx file from r (e.g. an uploaded file that is only held in memory) and returns an
+// ExcelWorkbook whose sheet names are already populated
+func OpenReader(r io.Reader) (*ExcelWorkbook, error) {
+	xlsx, err := excelize.OpenReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("error while reading workbook: %s", err)
+	}
+	wb := &ExcelWorkbook{XLSX: xlsx}
+	wb.GetSheetNames()
+	return wb, nil
+}
+
+// openDelimited reads a delimiter-separated file into a workbook with a single sheet that is named after the file
+func (wb *ExcelWorkbook) openDelimited(name string, comma rune) {
+	f, err := os.Open(name)
+	if err != nil {
+		log.Fatalf("error while opening file: %s\n", err)
+	}
+	defer f.Close()
+	rows, err := ReadDelimited(f, comma)
+	if err != nil {
+		log.Fatalf("error while reading file: %s\n", err)
+	}
+	base := strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+	wb.XLSX = ODSToXLSX([]ODSSheet{{Name: SheetName("{name}", base), Rows: rows}})
+}
+
+// openODS reads an .ods file and assigns its converted sheets to an ExcelWorkbook
+func (wb *ExcelWorkbook) openODS(name string) {
+	f, err := os.Open(name)
+	if err != nil {
+		log.Fatalf("error while opening file: %s\n", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		log.Fatalf("error while opening file: %s\n", err)
+	}
+	sheets, err := ReadODS(f, info.Size())
+	if err != nil {
+		log.Fatalf("error while opening file: %s\n", err)
+	}
+	wb.XLSX = ODSToXLSX(sheets)
+}
+
 // GetSheetNames gets all sheet names from a given workbook and stores them in the ExcelWorkbook struct
+// the names are stored in the order of the sheets in the workbook
 func (wb *ExcelWorkbook) GetSheetNames() {
+	sheetMap := wb.XLSX.GetSheetMap()
+	indices := make([]int, 0, len(sheetMap))
+	for idx := range sheetMap {
+		indices = append(indices, idx)
+	}
+	sort.Ints(indices)
 	sn := make([]string, 0)
-	for _, n := range wb.XLSX.GetSheetMap() {
-		sn = append(sn, n)
+	for _, idx := range indices {
+		sn = append(sn, sheetMap[idx])
 	}
 	wb.SheetNames = sn
 	wb.NumSheets = wb.NumberOfSheets()
@@ -83,76 +560,896 @@ func PrintDelim() {
 	fmt.Println()
 }
 
+// columnNames holds the results of GetColumn for all columns of a sheet (1 to MaxColumns, index 0 is unused); the
+// table is filled once when the package is initialized, so that lookups need no lock
+var columnNames = func() []string {
+	names := make([]string, MaxColumns+1)
+	for num := 1; num < len(names); num++ {
+		names[num] = getColumn(num)
+	}
+	return names
+}()
+
 // takes an integer and returns an Excel-style string representation of it (e.g. 1 = A, 3 = C, 27 = AA, ...)
-// the current implementation only works for a limited amount of cells, though
+// results are looked up in a table because GetColumn is called for every single cell that is written
 func GetColumn(num int) string {
-	num-- // because of go's 0 indexing
-	alphabet := [26]string{
-		"A", "B", "C", "D", "E", "F", "G", "H", "I", "J", "K", "L", "M",
-		"N", "O", "P", "Q", "R", "S", "T", "U", "V", "W", "X", "Y", "Z",
+	if num > 0 && num < len(columnNames) {
+		return columnNames[num]
 	}
-	switch {
-	// return a single letter
-	case num < (1 * len(alphabet)):
-		return fmt.Sprintf("%s", alphabet[num])
+	return getColumn(num)
+}
+
+// getColumn computes the Excel-style name of a column for GetColumn, i.e. num in base 26 with the digits A to Z
+func getColumn(num int) string {
+	if num < 1 {
+		log.Fatalf("cannot name column %d (columns start at 1)", num)
+	}
+	name := make([]byte, 0, 3)
+	for ; num > 0; num = (num - 1) / 26 {
+		name = append([]byte{byte('A' + (num-1)%26)}, name...)
+	}
+	return string(name)
+}
+
+// MaxColumns is the number of columns of an Excel sheet (the last one is "XFD")
+const MaxColumns = 16384
+
+// ColumnToIndex is the inverse of GetColumn and converts an Excel-style column (e.g. "C" or "aa") to its index
+// starting at 1 (i.e. "A" = 1, "AA" = 27); columns beyond "XFD" (see MaxColumns) are rejected
+func ColumnToIndex(col string) (int, error) {
+	if col == "" {
+		return 0, fmt.Errorf("empty column")
+	}
+	idx := 0
+	for _, r := range strings.ToUpper(col) {
+		if r < 'A' || r > 'Z' {
+			return 0, fmt.Errorf("invalid column %s", col)
+		}
+		idx = idx*26 + int(r-'A') + 1
+		if idx > MaxColumns {
+			return 0, fmt.Errorf("invalid column %s (the last column is XFD)", col)
+		}
+	}
+	return idx, nil
+}
 
-	// return a combination of letters, starting with "A..."
-	case (num >= (1 * len(alphabet))) && (num < (2 * len(alphabet))):
-		return fmt.Sprintf("%s%s", "A", alphabet[num-len(alphabet)])
+// ParseCoordinate converts an A1-style cell coordinate (e.g. "B3", absolute markers like in "$B$3" are allowed) to its
+// column and row, both starting at 1
+func ParseCoordinate(s string) (col, row int, err error) {
+	cell := strings.TrimPrefix(strings.TrimSpace(s), "$")
+	split := strings.IndexAny(cell, "0123456789")
+	if split < 1 {
+		return 0, 0, fmt.Errorf("invalid cell %s (must be a cell like 'B3')", s)
+	}
+	if col, err = ColumnToIndex(strings.TrimSuffix(cell[:split], "$")); err != nil {
+		return 0, 0, fmt.Errorf("invalid cell %s: %s", s, err)
+	}
+	if row, err = strconv.Atoi(cell[split:]); err != nil || row < 1 {
+		return 0, 0, fmt.Errorf("invalid cell %s (invalid row)", s)
+	}
+	return col, row, nil
+}
 
-	// return a combination of letters, starting with "B..."
-	case (num >= (2 * len(alphabet))) && (num < (3 * len(alphabet))):
-		return fmt.Sprintf("%s%s", "B", alphabet[num-(2*len(alphabet))])
+// ParseRange parses a range of cells like "B5:ZZ5000" into the (1-based) column and row of its top left and its bottom
+// right cell
+func ParseRange(s string) (col1, row1, col2, row2 int, err error) {
+	corners := strings.Split(s, ":")
+	if len(corners) != 2 {
+		return 0, 0, 0, 0, fmt.Errorf("invalid range %s (must be a range like 'B5:ZZ5000')", s)
+	}
+	if col1, row1, err = ParseCoordinate(corners[0]); err != nil {
+		return 0, 0, 0, 0, err
+	}
+	if col2, row2, err = ParseCoordinate(corners[1]); err != nil {
+		return 0, 0, 0, 0, err
+	}
+	if col2 < col1 || row2 < row1 {
+		return 0, 0, 0, 0, fmt.Errorf("invalid range %s (the first cell must be the top left one)", s)
+	}
+	return col1, row1, col2, row2, nil
+}
 
-	// return a combination of letter
-	case (num >= (3 * len(alphabet))) && (num < (4 * len(alphabet))):
-		return fmt.Sprintf("%s%s", "C", alphabet[num-(3*len(alphabet))])
+// FindMaxElem is a helper function for iterating over a map;
+// it finds the max value ==> gets its index ==> returns the index of the max value
+// if several indices share the max value, the smallest one is returned, and NaN values are only returned if there is
+// nothing else, such that the result does not depend on the (random) iteration order of the map
+func FindMaxElem(input map[int]float64) int {
+	return findElem(input, func(a, b float64) bool { return a > b })
+}
 
-	// return a combination of letter
-	case (num >= (4 * len(alphabet))) && (num < (5 * len(alphabet))):
-		return fmt.Sprintf("%s%s", "D", alphabet[num-(4*len(alphabet))])
+// FindMinElem is the counterpart of FindMaxElem and returns the index of the min value of a map
+// if several indices share the min value, the smallest one is returned
+func FindMinElem(input map[int]float64) int {
+	return findElem(input, func(a, b float64) bool { return a < b })
+}
 
-	// return a combination of letter
-	case (num >= (5 * len(alphabet))) && (num < (6 * len(alphabet))):
-		return fmt.Sprintf("%s%s", "E", alphabet[num-(5*len(alphabet))])
+// SortedPermutation returns the indices of peaks ranked like the sorted output, i.e. by decreasing value (FindMaxElem)
+// or, with order "asc", by increasing value (FindMinElem); element k is the original index of the k-th sorted column,
+// e.g. to sort a parallel dataset (like a second channel) in the same way
+func SortedPermutation(peaks map[int]float64, order string) []int {
+	next := FindMaxElem
+	if order == "asc" {
+		next = FindMinElem
+	}
+	remaining := make(map[int]float64, len(peaks))
+	for idx, val := range peaks {
+		remaining[idx] = val
+	}
+	perm := make([]int, 0, len(peaks))
+	for len(remaining) > 0 {
+		idx := next(remaining)
+		perm = append(perm, idx)
+		delete(remaining, idx)
+	}
+	return perm
+}
 
-	// return a combination of letter
-	case (num >= (6 * len(alphabet))) && (num < (7 * len(alphabet))):
-		return fmt.Sprintf("%s%s", "F", alphabet[num-(6*len(alphabet))])
+// findElem returns the smallest index of the value of input that no other value is better than (NaN values last);
+// 0 is returned for an empty map
+func findElem(input map[int]float64, better func(a, b float64) bool) int {
+	index, found := 0, false
+	for idx, val := range input {
+		if !found {
+			index, found = idx, true
+			continue
+		}
+		cur := input[index]
+		switch {
+		case math.IsNaN(val) && math.IsNaN(cur), !math.IsNaN(val) && !math.IsNaN(cur) && val == cur:
+			if idx < index {
+				index = idx
+			}
+		case math.IsNaN(cur) || (!math.IsNaN(val) && better(val, cur)):
+			index = idx
+		}
+	}
+	return index
+}
 
-	// return a combination of letter
-	case (num >= (7 * len(alphabet))) && (num < (8 * len(alphabet))):
-		return fmt.Sprintf("%s%s", "G", alphabet[num-(7*len(alphabet))])
+// DetectBackgroundColumns counts the trailing background columns of a header row; a column is
+// recognized as background column if its label contains "background" or starts with "bg" (case-insensitive)
+// 0 is returned if no background column was found or if background columns are not only at the end of the row
+// (which is ambiguous and should be resolved by the user)
+func DetectBackgroundColumns(header []string) int {
+	count := 0
+	for i := len(header) - 1; i >= 0; i-- {
+		if !isBackgroundLabel(header[i]) {
+			break
+		}
+		count++
+	}
+
+	// any other background label in the data region makes the detection ambiguous
+	for i := 0; i < len(header)-count; i++ {
+		if isBackgroundLabel(header[i]) {
+			return 0
+		}
+	}
+	return count
+}
 
-	// return a combination of letter
-	case (num >= (8 * len(alphabet))) && (num < (9 * len(alphabet))):
-		return fmt.Sprintf("%s%s", "H", alphabet[num-(8*len(alphabet))])
+// FitBackgroundColumns returns the largest number of trailing background columns, at most n, that leaves complete wells
+// of three columns after the time column of a sheet with cols columns, or 0 if no number does; this is used for sheets
+// whose headers do not label their background columns (see DetectBackgroundColumns)
+func FitBackgroundColumns(cols, n int) int {
+	for k := n; k > 0; k-- {
+		if data := cols - 1 - k; data > 0 && data%3 == 0 {
+			return k
+		}
+	}
+	return 0
+}
 
-	// return a combination of letter
-	case (num >= (9 * len(alphabet))) && (num < (10 * len(alphabet))):
-		return fmt.Sprintf("%s%s", "I", alphabet[num-(9*len(alphabet))])
+// isBackgroundLabel reports whether a header label denotes a background column
+func isBackgroundLabel(label string) bool {
+	l := strings.ToLower(strings.TrimSpace(label))
+	return strings.Contains(l, "background") || strings.HasPrefix(l, "bg")
+}
 
-	// return a combination of letter
-	case (num >= (10 * len(alphabet))) && (num < (11 * len(alphabet))):
-		return fmt.Sprintf("%s%s", "J", alphabet[num-(10*len(alphabet))])
+// FindColumns returns the (0-based) index of the column of header that matches each of labels; labels are compared
+// case-insensitively after NormalizeLabel, and an error is returned if a label matches no column or more than one
+func FindColumns(header, labels []string) ([]int, error) {
+	indices := make([]int, len(labels))
+	for i, label := range labels {
+		indices[i] = -1
+		for c, h := range header {
+			if !strings.EqualFold(NormalizeLabel(h), NormalizeLabel(label)) {
+				continue
+			}
+			if indices[i] >= 0 {
+				return nil, fmt.Errorf("label %s matches columns %s and %s", label, GetColumn(indices[i]+1), GetColumn(c+1))
+			}
+			indices[i] = c
+		}
+		if indices[i] < 0 {
+			return nil, fmt.Errorf("did not find a column with label %s", label)
+		}
+	}
+	return indices, nil
+}
 
-	// log a fatal error if none of these cases holds true
+// MoveToEnd returns the order of n columns in which the columns at the given indices are moved to the end (in the
+// given order) while all other columns keep their relative order; order[c] is the original index of column c
+func MoveToEnd(n int, indices []int) []int {
+	moved := make(map[int]bool)
+	for _, idx := range indices {
+		moved[idx] = true
+	}
+	order := make([]int, 0, n)
+	for c := 0; c < n; c++ {
+		if !moved[c] {
+			order = append(order, c)
+		}
+	}
+	return append(order, indices...)
+}
+
+// PairColumns pairs the channels of every well by their headers, e.g. "Well3_340" and "Well3_380" for the suffixes "340"
+// and "380": headers are normalized (see NormalizeLabel) and grouped by what precedes the suffix (ignoring trailing
+// spaces, underscores, and dashes); the (0-based) indices of the numerator and the denominator of every well are returned
+// in the order of the numerators, and columns with neither suffix are ignored
+func PairColumns(header []string, numSuffix, denomSuffix string) ([][2]int, error) {
+	prefix := func(h, suffix string) (string, bool) {
+		h = NormalizeLabel(h)
+		if !strings.HasSuffix(strings.ToLower(h), strings.ToLower(suffix)) {
+			return "", false
+		}
+		return strings.ToLower(strings.TrimRight(h[:len(h)-len(suffix)], " _-")), true
+	}
+	numerators := make([]string, 0)
+	columns := make(map[string][2]int)
+	for c, h := range header {
+		if p, ok := prefix(h, numSuffix); ok {
+			if cols, dup := columns[p]; dup && cols[0] >= 0 {
+				return nil, fmt.Errorf("columns %s and %s both hold the numerator of well %s", GetColumn(cols[0]+1), GetColumn(c+1), h)
+			}
+			if _, seen := columns[p]; !seen {
+				columns[p] = [2]int{-1, -1}
+			}
+			cols := columns[p]
+			cols[0] = c
+			columns[p] = cols
+			numerators = append(numerators, p)
+		} else if p, ok := prefix(h, denomSuffix); ok {
+			if cols, dup := columns[p]; dup && cols[1] >= 0 {
+				return nil, fmt.Errorf("columns %s and %s both hold the denominator of well %s", GetColumn(cols[1]+1), GetColumn(c+1), h)
+			}
+			if _, seen := columns[p]; !seen {
+				columns[p] = [2]int{-1, -1}
+			}
+			cols := columns[p]
+			cols[1] = c
+			columns[p] = cols
+		}
+	}
+	pairs := make([][2]int, 0, len(numerators))
+	for _, p := range numerators {
+		if columns[p][1] < 0 {
+			return nil, fmt.Errorf("no denominator for column %s", GetColumn(columns[p][0]+1))
+		}
+		pairs = append(pairs, columns[p])
+	}
+	for c, h := range header { // in the order of the header for a reproducible error
+		if _, ok := prefix(h, numSuffix); ok {
+			continue
+		}
+		if p, ok := prefix(h, denomSuffix); ok && columns[p][0] < 0 {
+			return nil, fmt.Errorf("no numerator for column %s", GetColumn(c+1))
+		}
+	}
+	if len(pairs) == 0 {
+		return nil, fmt.Errorf("no headers end with %s and %s", numSuffix, denomSuffix)
+	}
+	return pairs, nil
+}
+
+// Reorder returns the cells of row in the given order, where order[c] is the index of the cell that ends up at c;
+// indices beyond the end of row yield empty cells
+func Reorder(row []string, order []int) []string {
+	reordered := make([]string, len(order))
+	for c, src := range order {
+		if src < len(row) {
+			reordered[c] = row[src]
+		}
+	}
+	return reordered
+}
+
+// UniqueSheetName returns name if no sheet with that name exists in f yet; otherwise, a numbered suffix is appended
+// (e.g. "Sheet (2)") until the name is unique
+// Excel limits sheet names to 31 characters, so longer names are truncated
+func UniqueSheetName(f *excelize.File, name string) string {
+	const maxLen = 31
+	if len(name) > maxLen {
+		name = name[:maxLen]
+	}
+	existing := make(map[string]bool)
+	for _, n := range f.GetSheetMap() {
+		existing[n] = true
+	}
+	unique := name
+	for i := 2; existing[unique]; i++ {
+		suffix := fmt.Sprintf(" (%d)", i)
+		if len(name)+len(suffix) > maxLen {
+			unique = name[:maxLen-len(suffix)] + suffix
+		} else {
+			unique = name + suffix
+		}
+	}
+	return unique
+}
+
+// ShiftSheet moves all cells of a sheet such that its top left cell A1 ends up at the (1-based) column and row
+// of origin; cells are only moved to the bottom and to the right
+// the comments and charts of the sheet and the references of all charts to the sheet's cells are moved, too
+func ShiftSheet(f *excelize.File, sheet string, col, row int) {
+	for r := 1; r < row; r++ {
+		f.InsertRow(sheet, 0)
+	}
+	for c := 1; c < col; c++ {
+		f.InsertCol(sheet, "A")
+	}
+	if col > 1 || row > 1 {
+		shiftReferences(f, sheet, col-1, row-1)
+	}
+}
+
+var (
+	cellRefPattern      = regexp.MustCompile(`(\$?)([A-Z]+)(\$?)([0-9]+)`)
+	commentRefPattern   = regexp.MustCompile(`ref="[A-Z]+[0-9]+"`)
+	chartFormulaPattern = regexp.MustCompile(`<c:f>[^<]*</c:f>`)
+)
+
+// shiftReferences moves the parts of f that excelize's InsertRow and InsertCol leave behind by cols columns and rows
+// rows: the cells of the comments of sheet, the anchors of its comment boxes and charts, and the cell references of all
+// charts to sheet; excelize keeps these parts as raw XML in f.XLSX, so they are rewritten like in AddOverlayChart
+func shiftReferences(f *excelize.File, sheet string, cols, rows int) {
+	shiftCell := func(ref string) string {
+		m := cellRefPattern.FindStringSubmatch(ref)
+		r, _ := strconv.Atoi(m[4])
+		return fmt.Sprintf("%s%s%s%d", m[1], GetColumn(excelize.TitleToNumber(m[2])+cols+1), m[3], r+rows)
+	}
+	shiftTag := func(part, tag string, offset int) {
+		pattern := regexp.MustCompile(fmt.Sprintf(`<%s>([0-9]+)</%s>`, tag, tag))
+		f.XLSX[part] = pattern.ReplaceAllFunc(f.XLSX[part], func(m []byte) []byte {
+			n, _ := strconv.Atoi(string(pattern.FindSubmatch(m)[1]))
+			return []byte(fmt.Sprintf("<%s>%d</%s>", tag, n+offset, tag))
+		})
+	}
+
+	// the comments and drawings of a sheet are listed in its relationships
+	var rels struct {
+		Relationships []struct {
+			Type   string `xml:"Type,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	_ = xml.Unmarshal(f.XLSX[fmt.Sprintf("xl/worksheets/_rels/sheet%d.xml.rels", f.GetSheetIndex(sheet))], &rels)
+	for _, rel := range rels.Relationships {
+		part := strings.Replace(rel.Target, "..", "xl", 1)
+		if _, ok := f.XLSX[part]; !ok {
+			continue
+		}
+		switch path.Base(rel.Type) {
+		case "comments":
+			f.XLSX[part] = commentRefPattern.ReplaceAllFunc(f.XLSX[part], func(m []byte) []byte {
+				return []byte(`ref="` + shiftCell(string(m[5:len(m)-1])) + `"`)
+			})
+		case "vmlDrawing":
+			shiftTag(part, "x:Row", rows)
+			shiftTag(part, "x:Column", cols)
+		case "drawing":
+			shiftTag(part, "xdr:row", rows)
+			shiftTag(part, "xdr:col", cols)
+		}
+	}
+
+	// charts on any sheet may refer to the cells of sheet, e.g. Sheet1!$A$2:$A$470 or 'Sheet 1'!$A$1
+	names := map[string]bool{sheet: true, "'" + strings.Replace(sheet, "'", "''", -1) + "'": true}
+	for name, content := range f.XLSX {
+		if !strings.HasPrefix(name, "xl/charts/chart") {
+			continue
+		}
+		f.XLSX[name] = chartFormulaPattern.ReplaceAllFunc(content, func(m []byte) []byte {
+			formula := html.UnescapeString(string(m[len("<c:f>") : len(m)-len("</c:f>")]))
+			i := strings.LastIndex(formula, "!")
+			if i < 0 || !names[formula[:i]] {
+				return m
+			}
+			formula = formula[:i+1] + cellRefPattern.ReplaceAllStringFunc(formula[i+1:], shiftCell)
+			var b bytes.Buffer
+			_ = xml.EscapeText(&b, []byte(formula))
+			return []byte("<c:f>" + b.String() + "</c:f>")
+		})
+	}
+}
+
+// TransposeSheet swaps the rows and columns of a sheet, e.g. such that the headers in the first row end up in the first
+// column; numeric cells are written as numbers, all other cells as strings (styles, comments, and charts are not moved)
+func TransposeSheet(f *excelize.File, sheet string) {
+	_ = TransposeSheetContext(context.Background(), f, sheet)
+}
+
+// TransposeSheetContext is like TransposeSheet but stops with ctx.Err() once ctx expires (e.g. after --sheet_timeout),
+// which leaves the sheet incomplete
+func TransposeSheetContext(ctx context.Context, f *excelize.File, sheet string) error {
+	rows, err := RowsContext(ctx, f, sheet)
+	if err != nil {
+		return err
+	}
+	for range rows {
+		f.RemoveRow(sheet, 0)
+	}
+	for r, row := range rows {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		for c, val := range row {
+			if val == "" {
+				continue
+			}
+			setCopiedValue(f, sheet, fmt.Sprintf("%s%d", GetColumn(r+1), c+1), val)
+		}
+	}
+	return nil
+}
+
+// ClearSheet removes all rows of a sheet, e.g. to discard the partial output of a sheet that exceeded --sheet_timeout;
+// excelize cannot safely delete sheets (see ReuseDefaultSheet), so the empty sheet stays in f
+// sheets that do not exist in f are ignored
+func ClearSheet(f *excelize.File, sheet string) {
+	if f.GetSheetIndex(sheet) == 0 {
+		return
+	}
+	for range f.GetRows(sheet) {
+		f.RemoveRow(sheet, 0)
+	}
+}
+
+// RowsContext returns the rows of a sheet like GetRows or ctx.Err() if ctx expired; excelize cannot interrupt the
+// reading of a sheet, so a read that stalls is only noticed once it returns
+func RowsContext(ctx context.Context, f *excelize.File, sheet string) ([][]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	rows := f.GetRows(sheet)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// GetRange returns the cells of a range (e.g. "B5:ZZ5000", see ParseRange) of a sheet row by row; every row has the
+// width of the range and the rows end at the last row of the range or of the sheet, whichever comes first
+func (wb *ExcelWorkbook) GetRange(sheet, rng string) ([][]string, error) {
+	col1, row1, col2, row2, err := ParseRange(rng)
+	if err != nil {
+		return nil, err
+	}
+	rows := wb.XLSX.GetRows(sheet)
+	cells := make([][]string, 0)
+	for r := row1 - 1; r < row2 && r < len(rows); r++ {
+		row := make([]string, col2-col1+1)
+		for c := range row {
+			if col1-1+c < len(rows[r]) {
+				row[c] = rows[r][col1-1+c]
+			}
+		}
+		cells = append(cells, row)
+	}
+	if len(cells) == 0 {
+		return nil, fmt.Errorf("range %s of sheet %s is empty", rng, sheet)
+	}
+	return cells, nil
+}
+
+// CropSheet replaces the cells of a sheet by the cells of a range (see GetRange), such that the top left cell of the
+// range ends up at A1; numeric cells are written as numbers, all other cells as strings
+func (wb *ExcelWorkbook) CropSheet(sheet, rng string) error {
+	return wb.CropSheetContext(context.Background(), sheet, rng)
+}
+
+// CropSheetContext is like CropSheet but stops with ctx.Err() once ctx expires, which leaves the sheet incomplete
+func (wb *ExcelWorkbook) CropSheetContext(ctx context.Context, sheet, rng string) error {
+	cells, err := wb.GetRange(sheet, rng)
+	if err != nil {
+		return err
+	}
+	for range wb.XLSX.GetRows(sheet) {
+		wb.XLSX.RemoveRow(sheet, 0)
+	}
+	for r, row := range cells {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		for c, val := range row {
+			if val == "" {
+				continue
+			}
+			setCopiedValue(wb.XLSX, sheet, fmt.Sprintf("%s%d", GetColumn(c+1), r+1), val)
+		}
+	}
+	return nil
+}
+
+// PrependRows moves all cells of a sheet down by len(rows) rows and writes rows (e.g. the metadata rows above the data
+// of an input sheet) to the freed rows at the top; numeric cells are written as numbers, all other cells as strings
+func PrependRows(f *excelize.File, sheet string, rows [][]string) {
+	ShiftSheet(f, sheet, 1, len(rows)+1)
+	for r, row := range rows {
+		for c, val := range row {
+			if val == "" {
+				continue
+			}
+			setCopiedValue(f, sheet, fmt.Sprintf("%s%d", GetColumn(c+1), r+1), val)
+		}
+	}
+}
+
+// ColumnLength returns the number of cells below the header (the first row) of the (0-based) column c of rows, up to
+// and including its last non-empty cell; rows that are too short to hold column c count as empty
+func ColumnLength(rows [][]string, c int) int {
+	for r := len(rows) - 1; r > 0; r-- {
+		if c < len(rows[r]) && rows[r][c] != "" {
+			return r
+		}
+	}
+	return 0
+}
+
+// ColumnHeader returns the header (the first row) of the (0-based) column c of rows or "column X" if there is none
+func ColumnHeader(rows [][]string, c int) string {
+	if len(rows) == 0 || c >= len(rows[0]) || rows[0][c] == "" {
+		return "column " + GetColumn(c+1)
+	}
+	return rows[0][c]
+}
+
+// InterleaveRaw inserts the raw values of every column of a sheet with a header row (e.g. the transformed data) in front
+// of that column, such that every column is preceded by its original values; raw holds the values of every column
+// (without header), NaN values are left blank, infinite values are replaced according to inf, and the headers of both
+// columns get the suffixes " (raw)" and " (corrected)"
+func InterleaveRaw(f *excelize.File, sheet string, raw [][]float64, inf InfPolicy) {
+	for c := len(raw) - 1; c >= 0; c-- { // insert from the right, so that the columns to the left keep their position
+		col := GetColumn(c + 1)
+		header := f.GetCellValue(sheet, col+"1")
+		f.InsertCol(sheet, col)
+		f.SetCellValue(sheet, col+"1", header+" (raw)")
+		for r, v := range raw[c] {
+			if !math.IsNaN(v) {
+				f.SetCellValue(sheet, fmt.Sprintf("%s%d", col, r+2), inf.CellValue(v))
+			}
+		}
+	}
+	for c := range raw {
+		col := GetColumn(2*c + 2)
+		f.SetCellValue(sheet, col+"1", f.GetCellValue(sheet, col+"1")+" (corrected)")
+	}
+}
+
+// CopySheet copies the cell values of a sheet in src to a new sheet in dst and returns the name of the new sheet
+// (which is de-duplicated with UniqueSheetName)
+func CopySheet(dst, src *excelize.File, sheet string) string {
+	name := UniqueSheetName(dst, sheet)
+	_ = dst.NewSheet(name)
+	CopyValues(dst, name, src, sheet)
+	return name
+}
+
+// CopyValues copies the cell values of srcSheet in src to the existing dstSheet in dst
+// numeric cells are written as numbers, all other cells as strings
+func CopyValues(dst *excelize.File, dstSheet string, src *excelize.File, srcSheet string) {
+	for r, row := range src.GetRows(srcSheet) {
+		for c, val := range row {
+			if val == "" {
+				continue
+			}
+			setCopiedValue(dst, dstSheet, fmt.Sprintf("%s%d", GetColumn(c+1), r+1), val)
+		}
+	}
+}
+
+// setCopiedValue writes val, the value of a cell that was read from a sheet, to the cell cl of sheet: finite numbers are
+// written as numbers, "NaN" is left blank (like NaN values, see InfPolicy.CellValue), and all other values are written
+// as they are, including the replacements of infinite values, which were already chosen when the cell was first written
+func setCopiedValue(f *excelize.File, sheet, cl, val string) {
+	v, err := strconv.ParseFloat(val, 64)
+	switch {
+	case err == nil && math.IsNaN(v):
+	case err == nil && !math.IsInf(v, 0):
+		f.SetCellValue(sheet, cl, v)
 	default:
-		log.Fatal("algorithm cannot work with so many input columns")
-		return ""
+		f.SetCellValue(sheet, cl, val)
 	}
 }
 
-// FindMaxElem is a helper function for iterating over a map;
-// it finds the max value ==> gets its index ==> returns the index of the max value
-func FindMaxElem(input map[int]float64) int {
-	maxVal := 0.0
-	index := 0
-	for idx, val := range input {
-		if val > maxVal {
-			maxVal = val
-			index = idx
+// CopyWorkbook returns an independent copy of f, which is read back from the archive that f is written to, e.g. to change
+// the layout of a workbook that is saved before it is complete
+func CopyWorkbook(f *excelize.File) (*excelize.File, error) {
+	buf := new(bytes.Buffer)
+	if err := f.Write(buf); err != nil {
+		return nil, err
+	}
+	return excelize.OpenReader(buf)
+}
+
+// ReuseDefaultSheet renames the default sheet ("Sheet1") of a new workbook to a de-duplicated version of sheet and copies
+// the values of sheet in src to it; this is used instead of deleting the default sheet because excelize cannot safely add
+// sheets to a saved workbook once a sheet was deleted
+func ReuseDefaultSheet(dst, src *excelize.File, sheet string) string {
+	name := UniqueSheetName(dst, sheet)
+	dst.SetSheetName("Sheet1", name)
+	CopyValues(dst, name, src, sheet)
+	return name
+}
+
+// OpenOrCreate opens the .xlsx file at path or creates a new (unsaved) workbook if the file does not exist yet
+func OpenOrCreate(path string) (*excelize.File, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return excelize.NewFile(), nil
+	}
+	xlsx, err := excelize.OpenFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error while opening file %s: %s", path, err)
+	}
+	return xlsx, nil
+}
+
+// OutputFileName builds the name of an output file from an optional prefix, an optional timestamp of the
+// format YYYYMMDD_hhmmss, and a name (e.g. "ratios.xlsx"); all non-empty parts are joined with underscores
+func OutputFileName(prefix string, t time.Time, timestamp bool, name string) string {
+	return outputFileName(prefix, t.Format("20060102_150405"), timestamp, name)
+}
+
+// OutputFilePattern is like OutputFileName, but the timestamp of a run (which is not known in advance) is replaced by
+// the placeholder YYYYMMDD_hhmmss
+func OutputFilePattern(prefix string, timestamp bool, name string) string {
+	return outputFileName(prefix, "YYYYMMDD_hhmmss", timestamp, name)
+}
+
+func outputFileName(prefix, stamp string, timestamp bool, name string) string {
+	parts := make([]string, 0)
+	if prefix != "" {
+		parts = append(parts, prefix)
+	}
+	if timestamp {
+		parts = append(parts, stamp)
+	}
+	parts = append(parts, name)
+	return strings.Join(parts, "_")
+}
+
+// SheetSummary holds the top responder of a processed sheet
+type SheetSummary struct {
+	Sheet      string  // name of the sheet
+	TopColumn  string  // header of the column with the highest peak
+	Peak       float64 // peak value of that column
+	PeakRow    int     // row (starting at 1) of the peak value in the output sheets
+	TimeToPeak float64 // time of the peak value (or its index within the search range if there is no time)
+
+	ResponseRate float64   // fraction of columns whose peak exceeds the response threshold (NaN without a threshold)
+	Responders   int       // number of columns that meet the criteria of CountResponders
+	SNR          float64   // signal-to-noise ratio of the top column (NaN if the baseline is out of range)
+	Drift        float64   // baseline drift of the top column (see Drift)
+	Empty        int       // number of empty (NaN) ratios of the sheet
+	QCPass       bool      // result of QCEvaluate
+	QCReasons    []string  // failed QC criteria
+	WindowPeaks  []float64 // peaks of the top column within additional windows
+}
+
+// WriteSummary writes one row per summary to a new sheet "Summary" (or a de-duplicated version of that name)
+// with the columns sheet name, top column, peak value, peak row, response rate, time to peak, number of responders, signal-to-noise
+// ratio (blank if unknown, "Inf" for a flat baseline), baseline drift, number of empty values, QC result and reasons, and the peaks
+// within additional windows; infinite values are replaced according to inf and the name of the new sheet is returned
+func WriteSummary(f *excelize.File, summaries []SheetSummary, inf InfPolicy) string {
+	name := UniqueSheetName(f, "Summary")
+	_ = f.NewSheet(name)
+	for c, header := range []string{"sheet", "top column", "peak value", "peak row", "response rate", "time to peak", "responders", "SNR", "drift", "empty values", "QC", "QC reasons"} {
+		f.SetCellValue(name, fmt.Sprintf("%s1", GetColumn(c+1)), header)
+	}
+	for r, s := range summaries {
+		f.SetCellValue(name, fmt.Sprintf("A%d", r+2), s.Sheet)
+		f.SetCellValue(name, fmt.Sprintf("B%d", r+2), s.TopColumn)
+		f.SetCellValue(name, fmt.Sprintf("C%d", r+2), inf.CellValue(s.Peak))
+		f.SetCellValue(name, fmt.Sprintf("D%d", r+2), s.PeakRow)
+		f.SetCellValue(name, fmt.Sprintf("E%d", r+2), inf.CellValue(s.ResponseRate))
+		f.SetCellValue(name, fmt.Sprintf("F%d", r+2), inf.CellValue(s.TimeToPeak))
+		f.SetCellValue(name, fmt.Sprintf("G%d", r+2), s.Responders)
+		switch {
+		case math.IsInf(s.SNR, 0):
+			f.SetCellValue(name, fmt.Sprintf("H%d", r+2), "Inf")
+		case !math.IsNaN(s.SNR):
+			f.SetCellValue(name, fmt.Sprintf("H%d", r+2), s.SNR)
+		}
+		if !math.IsNaN(s.Drift) {
+			f.SetCellValue(name, fmt.Sprintf("I%d", r+2), s.Drift)
+		}
+		f.SetCellValue(name, fmt.Sprintf("J%d", r+2), s.Empty)
+		qc := "fail"
+		if s.QCPass {
+			qc = "pass"
+		}
+		f.SetCellValue(name, fmt.Sprintf("K%d", r+2), qc)
+		f.SetCellValue(name, fmt.Sprintf("L%d", r+2), strings.Join(s.QCReasons, "; "))
+		for w, p := range s.WindowPeaks {
+			f.SetCellValue(name, fmt.Sprintf("%s1", GetColumn(w+13)), fmt.Sprintf("peak in window %d", w+1))
+			f.SetCellValue(name, fmt.Sprintf("%s%d", GetColumn(w+13), r+2), inf.CellValue(p))
 		}
 	}
-	return index
+	return name
+}
+
+// RatioHeader returns the header of a ratio column; if an enumerator or a denominator label is given,
+// they are appended to name (e.g. "cell 3 (340/380)")
+func RatioHeader(name, enumLabel, denomLabel string) string {
+	if enumLabel == "" && denomLabel == "" {
+		return name
+	}
+	return fmt.Sprintf("%s (%s/%s)", name, enumLabel, denomLabel)
+}
+
+// PrintPreview prints the header row and the first n data rows of a sheet as aligned columns to w
+func PrintPreview(w io.Writer, rows [][]string, n int) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for r := 0; r < len(rows) && r <= n; r++ {
+		fmt.Fprintln(tw, strings.Join(rows[r], "\t"))
+	}
+	tw.Flush()
+}
+
+// DataMatrix parses all cells of a sheet from the (0-based) origin startRow, startCol to the extent of the sheet
+// into a rectangular matrix (indexed [row][column]); ragged rows are padded with NaN values and the error of a
+// cell that cannot be parsed contains its coordinate (e.g. Sheet1!B5)
+// empty cells are treated according to wb.Empty; with EmptySkip, rows that contain an empty cell are left out
+func (wb *ExcelWorkbook) DataMatrix(sheet string, startRow, startCol int) ([][]float64, error) {
+	data, _, err := wb.DataRows(sheet, startRow, startCol)
+	return data, err
+}
+
+// DataRows is like DataMatrix but also returns the (0-based) source row of every row of the matrix, which differs
+// from startRow plus the index of the row once EmptySkip left out rows
+func (wb *ExcelWorkbook) DataRows(sheet string, startRow, startCol int) ([][]float64, []int, error) {
+	return wb.DataRowsContext(context.Background(), sheet, startRow, startCol)
+}
+
+// DataRowsContext is like DataRows but stops with ctx.Err() once ctx expires (e.g. while parsing a huge ragged matrix)
+func (wb *ExcelWorkbook) DataRowsContext(ctx context.Context, sheet string, startRow, startCol int) ([][]float64, []int, error) {
+	return wb.dataRows(ctx, sheet, startRow, startCol, nil)
+}
+
+// DataColumnsContext is like DataRowsContext with startCol 0 but only parses the (0-based) columns cols, e.g. the
+// columns of a sheet that are actually used; the cells of all other columns are NaN and neither parsed nor checked
+// against wb.Empty, so that they may hold text or be empty
+func (wb *ExcelWorkbook) DataColumnsContext(ctx context.Context, sheet string, startRow int, cols []int) ([][]float64, []int, error) {
+	used := make(map[int]bool)
+	for _, c := range cols {
+		used[c] = true
+	}
+	return wb.dataRows(ctx, sheet, startRow, 0, used)
+}
+
+// dataRows implements DataRowsContext and DataColumnsContext; a nil used parses all columns
+func (wb *ExcelWorkbook) dataRows(ctx context.Context, sheet string, startRow, startCol int, used map[int]bool) ([][]float64, []int, error) {
+	m, err := RowsContext(ctx, wb.XLSX, sheet)
+	if err != nil {
+		return nil, nil, err
+	}
+	if startRow < 0 || startCol < 0 {
+		return nil, nil, fmt.Errorf("invalid origin [%d %d] of data matrix", startRow, startCol)
+	}
+
+	// empty rows and columns at the end of the sheet are not part of the data
+	_, _, lastRow, lastCol := usedRange(m)
+	m = m[:lastRow+1]
+
+	// the width of the matrix is given by the longest row
+	width := 0
+	for r := startRow; r < len(m); r++ {
+		if len(m[r])-startCol > width {
+			width = len(m[r]) - startCol
+		}
+	}
+	if width > lastCol+1-startCol {
+		width = lastCol + 1 - startCol
+	}
+	if width < 0 {
+		width = 0
+	}
+
+	data := make([][]float64, 0)
+	src := make([]int, 0)
+rows:
+	for r := startRow; r < len(m); r++ {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+		row := make([]float64, width)
+		for c := 0; c < width; c++ {
+			if startCol+c >= len(m[r]) || (used != nil && !used[startCol+c]) {
+				row[c] = math.NaN()
+				continue
+			}
+			if strings.TrimSpace(m[r][startCol+c]) == "" {
+				switch wb.Empty {
+				case EmptyZero:
+					row[c] = 0
+					continue
+				case EmptyNaN:
+					row[c] = math.NaN()
+					continue
+				case EmptySkip:
+					continue rows
+				}
+				return nil, nil, fmt.Errorf("cannot parse %s!%s%d: cell is empty", sheet, GetColumn(startCol+c+1), r+1)
+			}
+			val, err := strconv.ParseFloat(m[r][startCol+c], 64)
+			if err != nil {
+				return nil, nil, fmt.Errorf("cannot parse %s!%s%d: %q is not a number", sheet, GetColumn(startCol+c+1), r+1, m[r][startCol+c])
+			}
+			row[c] = val
+		}
+		data = append(data, row)
+		src = append(src, r)
+	}
+	return data, src, nil
+}
+
+// SheetName builds the name of an output sheet from a template in which every "{name}" placeholder is replaced by
+// the name of the source sheet; characters that Excel does not allow in sheet names (: \ / ? * [ ]) are replaced by
+// underscores and the name is truncated to 31 characters
+func SheetName(template, name string) string {
+	out := strings.Replace(template, "{name}", name, -1)
+	out = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`:\/?*[]`, r) {
+			return '_'
+		}
+		return r
+	}, out)
+	if runes := []rune(out); len(runes) > 31 {
+		out = string(runes[:31])
+	}
+	if out == "" {
+		out = name
+	}
+	return out
+}
+
+// OutputSheetNames builds the names of the output sheets of all source sheets names with SheetName; two source sheets
+// that map to the same output sheet (which Excel compares case-insensitively) are an error, since their data would be
+// merged into one output sheet
+func OutputSheetNames(template string, names []string) ([]string, error) {
+	out := make([]string, len(names))
+	seen := make(map[string]string)
+	for i, name := range names {
+		out[i] = SheetName(template, name)
+		if prev, ok := seen[strings.ToLower(out[i])]; ok {
+			return nil, fmt.Errorf("sheets %s and %s both map to the output sheet %s", prev, name, out[i])
+		}
+		seen[strings.ToLower(out[i])] = name
+	}
+	return out, nil
+}
+
+// TimeRows returns the indices of the first and the last row whose time is nearest to from and to, respectively
+// times does not have to be sampled at regular intervals but must be increasing; NaN values are ignored
+func TimeRows(times []float64, from, to float64) (int, int, error) {
+	first, last := -1, -1
+	for r, t := range times {
+		if math.IsNaN(t) {
+			continue
+		}
+		if first < 0 || math.Abs(t-from) < math.Abs(times[first]-from) {
+			first = r
+		}
+		if last < 0 || math.Abs(t-to) < math.Abs(times[last]-to) {
+			last = r
+		}
+	}
+	if first < 0 {
+		return 0, 0, fmt.Errorf("time column does not contain any values")
+	}
+	if first > last {
+		return 0, 0, fmt.Errorf("time range %v:%v does not match the time column", from, to)
+	}
+	return first, last, nil
 }
@@ -0,0 +1,986 @@
+package excelutil
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/360EntSecGroup-Skylar/excelize"
+)
+
+// slowContext is a context that expires after its Err method was called a number of times, which simulates a sheet
+// that takes too long without depending on the speed of the machine
+type slowContext struct {
+	context.Context
+	checks int
+}
+
+func (ctx *slowContext) Err() error {
+	if ctx.checks <= 0 {
+		return context.DeadlineExceeded
+	}
+	ctx.checks--
+	return nil
+}
+
+// numberSheet returns a workbook whose first sheet holds rows rows of cols numbers
+func numberSheet(rows, cols int) *ExcelWorkbook {
+	f := excelize.NewFile()
+	for r := 1; r <= rows; r++ {
+		for c := 0; c < cols; c++ {
+			f.SetCellValue("Sheet1", fmt.Sprintf("%s%d", excelize.ToAlphaString(c), r), float64(r*c))
+		}
+	}
+	return &ExcelWorkbook{XLSX: f, Empty: EmptyError}
+}
+
+func TestDataRowsContext(t *testing.T) {
+	wb := numberSheet(50, 3)
+	data, rows, err := wb.DataRowsContext(&slowContext{context.Background(), 1000}, "Sheet1", 1, 0)
+	if err != nil || len(data) != 49 || len(rows) != 49 || rows[0] != 1 {
+		t.Fatalf("DataRowsContext = %d rows, %v; want 49 rows from row 1", len(data), err)
+	}
+
+	// the deadline passes while the rows are parsed
+	if _, _, err := wb.DataRowsContext(&slowContext{context.Background(), 10}, "Sheet1", 1, 0); err != context.DeadlineExceeded {
+		t.Errorf("DataRowsContext of a slow sheet = %v; want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestTransposeSheetContext(t *testing.T) {
+	wb := numberSheet(50, 3)
+	if err := TransposeSheetContext(&slowContext{context.Background(), 10}, wb.XLSX, "Sheet1"); err != context.DeadlineExceeded {
+		t.Errorf("TransposeSheetContext of a slow sheet = %v; want %v", err, context.DeadlineExceeded)
+	}
+
+	wb = numberSheet(3, 50)
+	if err := TransposeSheetContext(context.Background(), wb.XLSX, "Sheet1"); err != nil {
+		t.Fatal(err)
+	}
+	if rows := wb.XLSX.GetRows("Sheet1"); len(rows) != 50 || rows[49][2] != "147" {
+		t.Errorf("transposed sheet has %d rows; want 50 rows that end in 147", len(rows))
+	}
+}
+
+func TestClearSheet(t *testing.T) {
+	wb := numberSheet(3, 5)
+	wb.XLSX.NewSheet("Other")
+	wb.XLSX.SetCellValue("Other", "A1", 1)
+	ClearSheet(wb.XLSX, "Sheet1")
+	ClearSheet(wb.XLSX, "Missing")
+	if rows := wb.XLSX.GetRows("Sheet1"); len(rows) != 0 {
+		t.Errorf("cleared sheet has %d rows; want 0", len(rows))
+	}
+	if rows := wb.XLSX.GetRows("Other"); len(rows) != 1 || rows[0][0] != "1" {
+		t.Errorf("other sheet has rows %v; want [[1]]", rows)
+	}
+}
+
+func TestCopyWorkbook(t *testing.T) {
+	wb := numberSheet(3, 5)
+	copied, err := CopyWorkbook(wb.XLSX)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ShiftSheet(copied, "Sheet1", 2, 2)
+	if rows := wb.XLSX.GetRows("Sheet1"); len(rows) != 3 || len(rows[0]) != 5 {
+		t.Errorf("shifting the copy changed the original to %q", rows)
+	}
+	if rows := copied.GetRows("Sheet1"); len(rows) != 4 || len(rows[1]) != 6 {
+		t.Errorf("copy has rows %q; want the shifted sheet", rows)
+	}
+
+	// a copy can be transposed without changing the original as well
+	copied, err = CopyWorkbook(wb.XLSX)
+	if err != nil {
+		t.Fatal(err)
+	}
+	TransposeSheet(copied, "Sheet1")
+	if rows := wb.XLSX.GetRows("Sheet1"); len(rows) != 3 || len(rows[0]) != 5 {
+		t.Errorf("transposing the copy changed the original to %q", rows)
+	}
+	if rows := copied.GetRows("Sheet1"); len(rows) != 5 || len(rows[0]) != 3 {
+		t.Errorf("copy has rows %q; want the transposed sheet", rows)
+	}
+}
+
+func TestDetectBackgroundColumns(t *testing.T) {
+	tests := []struct {
+		header []string
+		want   int
+	}{
+		{[]string{"Time (sec)", "Well1 340", "Well1 380", "skip", "bg340", "bg380"}, 2},
+		{[]string{"Time (sec)", "Well1 340", "Well1 380", "skip", "BG 340"}, 1},
+		{[]string{"Time (sec)", "Well1 340", "Well1 380", "skip", "Background"}, 1},
+		{[]string{"Time (sec)", "Well1 340", "Well1 380", "skip"}, 0},
+		{[]string{"Time (sec)", "bg340", "Well1 380", "skip", "bg380"}, 0}, // a background label in the data is ambiguous
+		{nil, 0},
+	}
+	for _, tt := range tests {
+		if got := DetectBackgroundColumns(tt.header); got != tt.want {
+			t.Errorf("DetectBackgroundColumns(%q) = %d; want %d", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestOutputFileName(t *testing.T) {
+	stamp := time.Date(2024, time.March, 5, 14, 7, 9, 0, time.UTC)
+	tests := []struct {
+		prefix    string
+		timestamp bool
+		want      string
+	}{
+		{"", true, "20240305_140709_ratios.xlsx"},
+		{"out/exp1", true, "out/exp1_20240305_140709_ratios.xlsx"},
+		{"out/exp1", false, "out/exp1_ratios.xlsx"},
+		{"", false, "ratios.xlsx"},
+	}
+	for _, tt := range tests {
+		if got := OutputFileName(tt.prefix, stamp, tt.timestamp, "ratios.xlsx"); got != tt.want {
+			t.Errorf("OutputFileName(%q, %v) = %q; want %q", tt.prefix, tt.timestamp, got, tt.want)
+		}
+	}
+	if got, want := OutputFilePattern("exp1", true, "ratios.xlsx"), "exp1_YYYYMMDD_hhmmss_ratios.xlsx"; got != want {
+		t.Errorf("OutputFilePattern = %q; want %q", got, want)
+	}
+}
+
+func TestWriteSummary(t *testing.T) {
+	f := excelize.NewFile()
+	f.NewSheet("Summary")
+	summaries := []SheetSummary{
+		{Sheet: "Plate1", TopColumn: "cell 3", Peak: 1.5, PeakRow: 42, ResponseRate: 0.5, TimeToPeak: 80, Responders: 2,
+			SNR: math.Inf(1), Drift: 0.1, QCPass: true, WindowPeaks: []float64{1.2}},
+		{Sheet: "Plate2", TopColumn: "cell 1", Peak: 0.9, PeakRow: 7, ResponseRate: math.NaN(), TimeToPeak: 12,
+			SNR: math.NaN(), Drift: math.NaN(), Empty: 3, QCReasons: []string{"drift", "empty"}},
+	}
+
+	// an existing summary sheet is kept and the new one gets a de-duplicated name
+	name := WriteSummary(f, summaries, "text")
+	if name != "Summary (2)" {
+		t.Fatalf("WriteSummary wrote sheet %s; want Summary (2)", name)
+	}
+	want := [][]string{
+		{"sheet", "top column", "peak value", "peak row", "response rate", "time to peak", "responders", "SNR", "drift", "empty values", "QC", "QC reasons", "peak in window 1"},
+		{"Plate1", "cell 3", "1.5", "42", "0.5", "80", "2", "Inf", "0.1", "0", "pass", "", "1.2"},
+		{"Plate2", "cell 1", "0.9", "7", "", "12", "0", "", "", "3", "fail", "drift; empty", ""},
+	}
+	if got := f.GetRows(name); !reflect.DeepEqual(got, want) {
+		t.Errorf("summary sheet =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestRatioHeader(t *testing.T) {
+	tests := []struct {
+		enum, denom, want string
+	}{
+		{"", "", "cell 3"},
+		{"340", "380", "cell 3 (340/380)"},
+		{"Fura", "", "cell 3 (Fura/)"},
+	}
+	for _, tt := range tests {
+		if got := RatioHeader("cell 3", tt.enum, tt.denom); got != tt.want {
+			t.Errorf("RatioHeader(%q, %q) = %q; want %q", tt.enum, tt.denom, got, tt.want)
+		}
+	}
+}
+
+func TestFitBackgroundColumns(t *testing.T) {
+	tests := []struct {
+		cols, n, want int
+	}{
+		{15, 2, 2}, // time, 4 wells, and 2 background columns
+		{14, 2, 1}, // the same sheet with a single background column
+		{14, 1, 1},
+		{13, 2, 0}, // no number of background columns leaves complete wells
+		{3, 2, 0},
+	}
+	for _, tt := range tests {
+		if got := FitBackgroundColumns(tt.cols, tt.n); got != tt.want {
+			t.Errorf("FitBackgroundColumns(%d, %d) = %d; want %d", tt.cols, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestGetColumn(t *testing.T) {
+	for num, want := range map[int]string{1: "A", 26: "Z", 27: "AA", 53: "BA", 286: "JZ", 287: "KA", 702: "ZZ", 703: "AAA",
+		MaxColumns: "XFD", MaxColumns + 1: "XFE"} {
+		if got := GetColumn(num); got != want {
+			t.Errorf("GetColumn(%d) = %q; want %q", num, got, want)
+		}
+	}
+	for num := 1; num <= MaxColumns; num++ {
+		if got, want := GetColumn(num), excelize.ToAlphaString(num-1); got != want {
+			t.Fatalf("GetColumn(%d) = %q; want %q like excelize", num, got, want)
+		}
+	}
+}
+
+func BenchmarkGetColumn(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		GetColumn(i%1000 + 1)
+	}
+}
+
+func BenchmarkGetColumnParallel(b *testing.B) {
+	b.RunParallel(func(pb *testing.PB) {
+		for i := 0; pb.Next(); i++ {
+			GetColumn(i%1000 + 1)
+		}
+	})
+}
+
+func TestPrintPreview(t *testing.T) {
+	rows := [][]string{
+		{"Time (sec)", "cell 1", "cell 2"},
+		{"2", "0.5", "0.75"},
+		{"4", "0.625", "1"},
+		{"6", "0.5", "0.5"},
+	}
+	var buf bytes.Buffer
+	PrintPreview(&buf, rows, 2)
+	want := "Time (sec)  cell 1  cell 2\n" +
+		"2           0.5     0.75\n" +
+		"4           0.625   1\n"
+	if buf.String() != want {
+		t.Errorf("PrintPreview =\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	// a preview of more rows than the sheet has prints all of them
+	buf.Reset()
+	PrintPreview(&buf, rows[:2], 10)
+	if n := strings.Count(buf.String(), "\n"); n != 2 {
+		t.Errorf("PrintPreview of 2 rows printed %d lines; want 2", n)
+	}
+}
+
+func TestStartRowAny(t *testing.T) {
+	if got := ParseLabels(" Time (sec), ,Elapsed Time,"); !reflect.DeepEqual(got, []string{"Time (sec)", "Elapsed Time"}) {
+		t.Errorf("ParseLabels = %q; want two labels", got)
+	}
+
+	f := excelize.NewFile()
+	f.SetCellValue("Sheet1", "A1", "Elapsed Time") // a title that matches only the second label
+	f.SetCellValue("Sheet1", "A3", "Time (sec)")
+	f.SetCellValue("Sheet1", "A5", "\ufeffElapsed Time\u00a0") // a BOM and a non-breaking space of another export
+	wb := &ExcelWorkbook{XLSX: f}
+
+	tests := []struct {
+		labels []string
+		want   int
+	}{
+		{[]string{"Time (sec)"}, 2},
+		{[]string{"Time (sec)", "Elapsed Time"}, 0}, // the first matching row wins, not the first label
+		{[]string{"Time (s)", "Time (sec)"}, 2},
+	}
+	for _, tt := range tests {
+		if got, err := wb.StartRowAny("Sheet1", tt.labels); err != nil || got != tt.want {
+			t.Errorf("StartRowAny(%q) = %d, %v; want %d", tt.labels, got, err, tt.want)
+		}
+	}
+	if got := wb.MatchingRows("Sheet1", []string{"Elapsed Time"}); !reflect.DeepEqual(got, []int{0, 4}) {
+		t.Errorf("MatchingRows = %v; want [0 4]", got)
+	}
+	if _, err := wb.StartRowAny("Sheet1", []string{"Time (s)", "Zeit"}); err == nil || !strings.Contains(err.Error(), "Time (s) or Zeit") {
+		t.Errorf("StartRowAny without a matching label = %v; want an error that lists both labels", err)
+	}
+}
+
+func TestDataMatrix(t *testing.T) {
+	f := excelize.NewFile()
+	f.SetSheetRow("Sheet1", "A1", &[]interface{}{"Time (sec)", "cell 1", "cell 2"})
+	f.SetSheetRow("Sheet1", "A2", &[]interface{}{2.0, 0.5, 0.25})
+	f.SetSheetRow("Sheet1", "A3", &[]interface{}{4.0, 0.75}) // a ragged row
+	wb := &ExcelWorkbook{XLSX: f}
+
+	// the missing cell of the ragged row is empty, which is an error by default
+	if _, err := wb.DataMatrix("Sheet1", 1, 1); err == nil || !strings.Contains(err.Error(), "Sheet1!C3: cell is empty") {
+		t.Errorf("DataMatrix of a ragged row = %v; want an error for Sheet1!C3", err)
+	}
+	wb.Empty = EmptyNaN
+	data, err := wb.DataMatrix("Sheet1", 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]float64{{0.5, 0.25}, {0.75, math.NaN()}}
+	if len(data) != len(want) || !equalFloats(data[0], want[0], 0) || !equalFloats(data[1], want[1], 0) {
+		t.Errorf("DataMatrix = %v; want %v", data, want)
+	}
+
+	// the errors name the cell that cannot be parsed
+	if _, err := wb.DataMatrix("Sheet1", 0, 1); err == nil || !strings.Contains(err.Error(), `Sheet1!B1: "cell 1" is not a number`) {
+		t.Errorf("DataMatrix of the header = %v; want an error for Sheet1!B1", err)
+	}
+	if _, err := wb.DataMatrix("Sheet1", -1, 0); err == nil {
+		t.Error("DataMatrix with a negative origin = nil error; want an error")
+	}
+	if data, err := (&ExcelWorkbook{XLSX: excelize.NewFile()}).DataMatrix("Sheet1", 0, 0); err != nil || len(data) != 0 {
+		t.Errorf("DataMatrix of an empty sheet = %v, %v; want no rows", data, err)
+	}
+}
+
+func TestDataColumnsContext(t *testing.T) {
+	f := excelize.NewFile()
+	f.SetSheetRow("Sheet1", "A1", &[]interface{}{"Time (sec)", "cell 1", "skip", "bg"})
+	f.SetSheetRow("Sheet1", "A2", &[]interface{}{2.0, 0.5, "ok", 0.1})
+	f.SetSheetRow("Sheet1", "A3", &[]interface{}{4.0, 0.75, "", 0.2})
+	wb := &ExcelWorkbook{XLSX: f}
+
+	// the unused column holds text and an empty cell, which are neither parsed nor an error
+	data, rows, err := wb.DataColumnsContext(context.Background(), "Sheet1", 1, []int{0, 1, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]float64{{2, 0.5, math.NaN(), 0.1}, {4, 0.75, math.NaN(), 0.2}}
+	if len(data) != len(want) || !equalFloats(data[0], want[0], 0) || !equalFloats(data[1], want[1], 0) || !reflect.DeepEqual(rows, []int{1, 2}) {
+		t.Errorf("DataColumnsContext = %v, %v; want %v from rows 1 and 2", data, rows, want)
+	}
+	if _, _, err := wb.DataColumnsContext(context.Background(), "Sheet1", 1, []int{0, 2}); err == nil || !strings.Contains(err.Error(), `Sheet1!C2: "ok" is not a number`) {
+		t.Errorf("DataColumnsContext of a text column = %v; want an error for Sheet1!C2", err)
+	}
+}
+
+func TestSheetName(t *testing.T) {
+	tests := []struct {
+		template, name, want string
+	}{
+		{"{name}", "Plate1", "Plate1"},
+		{"ratios_{name}", "Plate1", "ratios_Plate1"},
+		{"{name}/{name}", "a:b", "a_b_a_b"},
+		{"ratios of {name}", "a very long name of a plate", "ratios of a very long name of a"}, // 31 characters
+		{"", "Plate1", "Plate1"},
+	}
+	for _, tt := range tests {
+		if got := SheetName(tt.template, tt.name); got != tt.want {
+			t.Errorf("SheetName(%q, %q) = %q; want %q", tt.template, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestOutputSheetNames(t *testing.T) {
+	got, err := OutputSheetNames("ratios {name}", []string{"Plate1", "Plate2"})
+	if want := []string{"ratios Plate1", "ratios Plate2"}; err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("OutputSheetNames = %q, %v; want %q", got, err, want)
+	}
+	for _, names := range [][]string{
+		{"a:b", "a/b"},       // both replace the character by an underscore
+		{"Plate1", "plate1"}, // Excel compares sheet names case-insensitively
+		{"a very long name of plate 1", "a very long name of plate 2"}, // both are truncated
+	} {
+		if _, err := OutputSheetNames("ratios {name}", names); err == nil {
+			t.Errorf("OutputSheetNames(%q) = nil error; want an error for the collision", names)
+		}
+	}
+}
+
+func TestTimeRows(t *testing.T) {
+	times := []float64{0, 2, 5, 11, 30, 33, math.NaN(), 200, 355, 370, 500} // irregular sampling
+	tests := []struct {
+		from, to    float64
+		first, last int
+	}{
+		{30, 360, 4, 8},
+		{0, 500, 0, 10},
+		{-10, 1000, 0, 10},
+		{4, 12, 2, 3},
+		{150, 150, 7, 7}, // nearer to 200 than to 33
+	}
+	for _, tt := range tests {
+		if first, last, err := TimeRows(times, tt.from, tt.to); err != nil || first != tt.first || last != tt.last {
+			t.Errorf("TimeRows(%v:%v) = %d, %d, %v; want %d, %d", tt.from, tt.to, first, last, err, tt.first, tt.last)
+		}
+	}
+	if _, _, err := TimeRows([]float64{math.NaN()}, 0, 1); err == nil {
+		t.Error("TimeRows without times = nil error; want an error")
+	}
+}
+
+func TestUsedRange(t *testing.T) {
+	f := excelize.NewFile()
+	// an empty leading row and column, and trailing cells that only hold whitespace
+	for axis, v := range map[string]interface{}{"B2": "Time (sec)", "C2": "Well1", "B3": 2.0, "D4": 5.0, "F7": "  ", "A8": ""} {
+		f.SetCellValue("Sheet1", axis, v)
+	}
+	wb := &ExcelWorkbook{XLSX: f}
+	if firstRow, firstCol, lastRow, lastCol := wb.UsedRange("Sheet1"); firstRow != 1 || firstCol != 1 || lastRow != 3 || lastCol != 3 {
+		t.Errorf("UsedRange = %d, %d, %d, %d; want 1, 1, 3, 3", firstRow, firstCol, lastRow, lastCol)
+	}
+	if d := wb.Dimensions("Sheet1"); d[0] <= 4 || d[1] <= 4 {
+		t.Errorf("Dimensions = %v; want the padded extent", d)
+	}
+
+	empty := &ExcelWorkbook{XLSX: excelize.NewFile()}
+	if firstRow, firstCol, lastRow, lastCol := empty.UsedRange("Sheet1"); firstRow != -1 || firstCol != -1 || lastRow != -1 || lastCol != -1 {
+		t.Errorf("UsedRange of an empty sheet = %d, %d, %d, %d; want -1 for all bounds", firstRow, firstCol, lastRow, lastCol)
+	}
+}
+
+func TestColumnToIndex(t *testing.T) {
+	for col, want := range map[string]int{"A": 1, "c": 3, "Z": 26, "AA": 27, "ZZ": 702, "AAA": 703, "xfd": 16384} {
+		if got, err := ColumnToIndex(col); err != nil || got != want {
+			t.Errorf("ColumnToIndex(%q) = %d, %v; want %d", col, got, err, want)
+		}
+		if GetColumn(want) != strings.ToUpper(col) {
+			t.Errorf("GetColumn(%d) = %q; want %q (see ColumnToIndex)", want, GetColumn(want), strings.ToUpper(col))
+		}
+	}
+	// columns beyond XFD, including those whose index would overflow an int
+	for _, col := range []string{"XFE", "ZZZ", "AAAA", "AAAAAAAAAAAAAAA"} {
+		if got, err := ColumnToIndex(col); err == nil {
+			t.Errorf("ColumnToIndex(%q) = %d; want an error", col, got)
+		}
+	}
+}
+
+func TestLayoutMismatches(t *testing.T) {
+	f := excelize.NewFile()
+	f.SetSheetName("Sheet1", "Plate1")
+	sheets := []string{"Plate1", "Plate2", "Plate3", "Plate4"}
+	for _, sheet := range sheets[1:] {
+		f.NewSheet(sheet)
+	}
+	for _, sheet := range sheets {
+		f.SetSheetRow(sheet, "A1", &[]interface{}{"Instrument X"})
+		f.SetSheetRow(sheet, "A2", &[]interface{}{"Time (sec)", "Well1 340", "Well1 380"})
+		f.SetSheetRow(sheet, "A3", &[]interface{}{2.0, 200.0, 300.0})
+	}
+	f.SetCellValue("Plate3", "D2", "Well2 340") // an additional column
+	f.InsertRow("Plate4", 0)                    // the start label is one row further down
+
+	wb := &ExcelWorkbook{XLSX: f, SheetNames: sheets}
+	want := []string{
+		"Plate3: 4 columns, start row 2 (expected 3 columns, start row 2)",
+		"Plate4: 3 columns, start row 3 (expected 3 columns, start row 2)",
+	}
+	if got := wb.LayoutMismatches([]string{"Time (sec)"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("LayoutMismatches = %q; want %q", got, want)
+	}
+	wb.SheetNames = sheets[:2]
+	if got := wb.LayoutMismatches([]string{"Time (sec)"}); got != nil {
+		t.Errorf("LayoutMismatches of equal sheets = %q; want nil", got)
+	}
+}
+
+func TestFindMinElem(t *testing.T) {
+	tests := []struct {
+		input map[int]float64
+		want  int
+	}{
+		{map[int]float64{3: 1, 5: 4, 7: 4, 9: 1}, 3}, // ties go to the smallest index
+		{map[int]float64{4: -2, 6: -1}, 4},
+		{map[int]float64{1: math.NaN(), 2: 0.5, 3: math.NaN()}, 2}, // NaN values rank last
+		{map[int]float64{}, 0},
+	}
+	for _, tt := range tests {
+		// the iteration order of maps is random, so every map is searched several times
+		for i := 0; i < 20; i++ {
+			if got := FindMinElem(tt.input); got != tt.want {
+				t.Errorf("FindMinElem(%v) = %d; want %d", tt.input, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestFindMaxElem(t *testing.T) {
+	tests := []struct {
+		input map[int]float64
+		want  int
+	}{
+		{map[int]float64{3: 1, 5: 4, 7: 4, 9: 1}, 5}, // ties go to the smallest index
+		{map[int]float64{4: -2, 6: -1}, 6},           // peaks do not have to be positive
+		{map[int]float64{1: math.NaN(), 2: -0.5, 3: math.NaN()}, 2},
+		{map[int]float64{8: math.NaN(), 5: math.NaN()}, 5},
+		{map[int]float64{}, 0},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			if got := FindMaxElem(tt.input); got != tt.want {
+				t.Errorf("FindMaxElem(%v) = %d; want %d", tt.input, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestSortedPermutation(t *testing.T) {
+	peaks := map[int]float64{0: 0.5, 1: 2, 2: math.NaN(), 3: 1, 4: 2}
+	// equal peaks keep their original order and NaN peaks come last in both directions
+	for order, want := range map[string][]int{
+		"desc": {1, 4, 3, 0, 2},
+		"asc":  {0, 3, 1, 4, 2},
+	} {
+		if got := SortedPermutation(peaks, order); !reflect.DeepEqual(got, want) {
+			t.Errorf("SortedPermutation(%s) = %v; want %v", order, got, want)
+		}
+	}
+	if got := SortedPermutation(map[int]float64{}, "asc"); len(got) != 0 {
+		t.Errorf("SortedPermutation of no peaks = %v; want none", got)
+	}
+}
+
+func TestNormalizeLabel(t *testing.T) {
+	tests := []struct{ label, want string }{
+		{"\ufeffTime (sec)", "Time (sec)"},
+		{"Time\u00a0(sec)", "Time (sec)"},
+		{"Time (sec)\u202f", "Time (sec)"},
+		{"\u200bTime\u200c (sec)\u200d\u2060", "Time (sec)"},
+		{"\ufeff\u00a0\t", ""},
+		{"Time (sec)", "Time (sec)"},
+	}
+	for _, tt := range tests {
+		if got := NormalizeLabel(tt.label); got != tt.want {
+			t.Errorf("NormalizeLabel(%q) = %q; want %q", tt.label, got, tt.want)
+		}
+	}
+
+	f := excelize.NewFile()
+	f.SetCellValue("Sheet1", "A2", "\ufeffTime (sec)")
+	if got, err := (&ExcelWorkbook{XLSX: f}).StartRow("Sheet1", "Time (sec)"); err != nil || got != 1 {
+		t.Errorf("StartRow of a label with a BOM = %d, %v; want 1", got, err)
+	}
+}
+
+func TestResolveFormat(t *testing.T) {
+	tests := []struct {
+		name, format, want string
+	}{
+		{"plate.xlsx", "", "xlsx"},
+		{"plate.ODS", "", "ods"},
+		{"plate.tsv", "", "tsv"},
+		{"plate.txt", "", "xlsx"},
+		{"plate.txt", "tsv", "tsv"},
+		{"plate.tsv", "xlsx", "xlsx"},
+	}
+	for _, tt := range tests {
+		if got := ResolveFormat(tt.name, tt.format); got != tt.want {
+			t.Errorf("ResolveFormat(%q, %q) = %q; want %q", tt.name, tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestCheckComplete(t *testing.T) {
+	dir, err := ioutil.TempDir("", "excelutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var buf bytes.Buffer
+	if err := SaveTo(metadataSheet().XLSX, &buf, DefaultSaveOptions()); err != nil {
+		t.Fatal(err)
+	}
+	complete, truncated := filepath.Join(dir, "complete.xlsx"), filepath.Join(dir, "truncated.xlsx")
+	if err := ioutil.WriteFile(complete, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// an instrument that is still writing the file
+	if err := ioutil.WriteFile(truncated, buf.Bytes()[:buf.Len()/2], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CheckComplete(complete); err != nil {
+		t.Errorf("CheckComplete of a complete file = %v; want nil", err)
+	}
+	if err := CheckComplete(truncated); err == nil || !strings.Contains(err.Error(), "appears incomplete") {
+		t.Errorf("CheckComplete of a truncated file = %v; want an error", err)
+	}
+	if err := WaitComplete(truncated, 30*time.Millisecond, 10*time.Millisecond); err == nil {
+		t.Error("WaitComplete of a file that stays truncated = nil; want an error")
+	}
+
+	// the file is completed while WaitComplete waits for it
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		tmp := filepath.Join(dir, "tmp.xlsx")
+		ioutil.WriteFile(tmp, buf.Bytes(), 0644)
+		os.Rename(tmp, truncated)
+	}()
+	if err := WaitComplete(truncated, 5*time.Second, 10*time.Millisecond); err != nil {
+		t.Errorf("WaitComplete of a file that is completed = %v; want nil", err)
+	}
+}
+
+func TestEstimate(t *testing.T) {
+	f := excelize.NewFile()
+	f.NewSheet("Plate2")
+	f.SetCellValue("Sheet1", "B2", 1.0)
+	f.SetCellValue("Sheet1", "D11", 1.0) // 10 rows and 3 columns
+	f.SetCellValue("Plate2", "A1", 1.0)
+	f.NewSheet("Empty")
+	wb := &ExcelWorkbook{XLSX: f}
+	wb.GetSheetNames()
+	if got := wb.CellCount(); got != 31 {
+		t.Errorf("CellCount = %d; want 31", got)
+	}
+
+	// both the time and the size grow linearly with the number of cells
+	d1, s1 := Estimate(1000, 0.5, "xlsx", false)
+	d2, s2 := Estimate(2000, 0.5, "xlsx", false)
+	if d1 != 1000*estimatedTimePerCell || s1 != 500*estimatedBytesPerCell || d2 != 2*d1 || s2 != 2*s1 {
+		t.Errorf("Estimate = %v, %d and %v, %d; want linear projections", d1, s1, d2, s2)
+	}
+	if _, size := Estimate(1000, 0, "xlsx", false); size != 0 {
+		t.Errorf("Estimate without output = %d bytes; want 0", size)
+	}
+
+	// text files are not compressed
+	if _, size := Estimate(1000, 0.5, "csv", false); size != 500*estimatedTextBytesPerCell {
+		t.Errorf("Estimate of a .csv file = %d bytes; want %d", size, 500*estimatedTextBytesPerCell)
+	}
+
+	// unless they are written with gzip
+	if _, size := Estimate(1000, 0.5, "json", true); size != s1 {
+		t.Errorf("Estimate of a gzipped .json file = %d bytes; want %d like a .xlsx file", size, s1)
+	}
+}
+
+func TestPrintEstimate(t *testing.T) {
+	f := excelize.NewFile()
+	f.SetCellValue("Sheet1", "A1", 1.0)
+	f.SetCellValue("Sheet1", "J1000", 1.0) // 1000 rows and 10 columns
+	wb := &ExcelWorkbook{XLSX: f}
+	wb.GetSheetNames()
+
+	var buf bytes.Buffer
+	wb.PrintEstimate(&buf, "csv", []EstimatedOutput{{Name: "ratios", Fraction: 1}, {Name: "stats", Fraction: 0.5}}, false)
+	want := "estimated input cells: 10000 in 1 sheet(s)\n" +
+		"estimated processing time: 1s\n" +
+		"estimated size of ratios_<sheet>.csv: 0.2 MB\n" +
+		"estimated size of stats_<sheet>.csv: 0.1 MB\n"
+	if buf.String() != want {
+		t.Errorf("PrintEstimate printed\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	// without outputs, only the input and the processing time are printed
+	buf.Reset()
+	wb.PrintEstimate(&buf, "xlsx", nil, false)
+	if got := strings.Count(buf.String(), "\n"); got != 2 {
+		t.Errorf("PrintEstimate without outputs printed %d lines; want 2", got)
+	}
+}
+
+func TestPrependRows(t *testing.T) {
+	f := excelize.NewFile()
+	f.SetSheetRow("Sheet1", "A1", &[]interface{}{"cell 1", "cell 2"})
+	f.SetSheetRow("Sheet1", "A2", &[]interface{}{0.5, 1.0})
+	PrependRows(f, "Sheet1", [][]string{{"Instrument X", "", "v1.2"}, {"Date", "2020-01-02"}, {"Dilution", "0.25"}})
+
+	want := [][]string{
+		{"Instrument X", "", "v1.2"},
+		{"Date", "2020-01-02", ""},
+		{"Dilution", "0.25", ""},
+		{"cell 1", "cell 2", ""},
+		{"0.5", "1", ""},
+	}
+	if got := f.GetRows("Sheet1"); !reflect.DeepEqual(got, want) {
+		t.Errorf("rows after PrependRows = %q; want %q", got, want)
+	}
+	// numbers are written as numbers and everything else as text
+	if got := f.GetCellValue("Sheet1", "B3"); got != "0.25" {
+		t.Errorf("B3 = %q; want the number 0.25", got)
+	}
+}
+
+func TestShiftSheet(t *testing.T) {
+	f := excelize.NewFile()
+	f.SetSheetRow("Sheet1", "A1", &[]interface{}{"cell 1", "cell 2"})
+	f.SetSheetRow("Sheet1", "A2", &[]interface{}{0.5, 1.0})
+	f.SetSheetRow("Sheet1", "A3", &[]interface{}{0.75, 2.0})
+	if err := AnnotateCell(f, "Sheet1", "B2", "a note"); err != nil {
+		t.Fatal(err)
+	}
+	settings := `{"type":"line","series":[{"name":"Sheet1!$B$1","values":"Sheet1!$B$2:$B$3"}]}`
+	if err := f.AddChart("Sheet1", "A5", settings); err != nil {
+		t.Fatal(err)
+	}
+	ShiftSheet(f, "Sheet1", 3, 2)
+
+	if got := f.GetCellValue("Sheet1", "C3"); got != "0.5" {
+		t.Errorf("C3 after ShiftSheet = %q; want the former A2", got)
+	}
+	if comments := string(f.XLSX["xl/comments1.xml"]); !strings.Contains(comments, `ref="D3"`) {
+		t.Errorf("comment of B2 is not at D3 after ShiftSheet: %s", comments)
+	}
+	// the comment box is anchored at 0-based row and column
+	vml := string(f.XLSX["xl/drawings/vmlDrawing1.vml"])
+	if !strings.Contains(vml, "<x:Row>2</x:Row><x:Column>3</x:Column>") {
+		t.Errorf("comment box after ShiftSheet is not anchored at D3: %s", vml)
+	}
+	chart := string(f.XLSX["xl/charts/chart1.xml"])
+	for _, ref := range []string{"<c:f>Sheet1!$D$2</c:f>", "<c:f>Sheet1!$D$3:$D$4</c:f>"} {
+		if !strings.Contains(chart, ref) {
+			t.Errorf("chart after ShiftSheet does not contain %s", ref)
+		}
+	}
+	// the chart was anchored at A5 (0-based column 0 and row 4)
+	drawing := string(f.XLSX["xl/drawings/drawing1.xml"])
+	if !strings.Contains(drawing, "<xdr:from><xdr:col>2</xdr:col><xdr:colOff>0</xdr:colOff><xdr:row>5</xdr:row>") {
+		t.Errorf("chart after ShiftSheet is not anchored at C6: %s", drawing)
+	}
+}
+
+func TestCheckStartLabel(t *testing.T) {
+	f := excelize.NewFile()
+	f.SetCellValue("Sheet1", "A1", "Time (sec)")
+	f.SetCellValue("Sheet1", "A2", 2.0)
+	f.SetCellValue("Sheet1", "A4", "Time (sec)") // the repeated header of a concatenated export
+	f.SetCellValue("Sheet1", "A6", "Elapsed Time")
+	wb := &ExcelWorkbook{XLSX: f}
+
+	if err := wb.CheckStartLabel("Sheet1", []string{"Elapsed Time"}); err != nil {
+		t.Errorf("CheckStartLabel of a single match = %v; want nil", err)
+	}
+	if err := wb.CheckStartLabel("Sheet1", []string{"Zeit"}); err != nil {
+		t.Errorf("CheckStartLabel without a match = %v; want nil (see StartRowAny)", err)
+	}
+	want := "found 3 rows with label Time (sec) or Elapsed Time in column 1 of sheet Sheet1 (rows 1, 4, 6)"
+	if err := wb.CheckStartLabel("Sheet1", []string{"Time (sec)", "Elapsed Time"}); err == nil || err.Error() != want {
+		t.Errorf("CheckStartLabel of repeated labels = %v; want %q", err, want)
+	}
+	// only the rows that StartRowAny searches count
+	wb.SearchRows = 3
+	if err := wb.CheckStartLabel("Sheet1", []string{"Time (sec)"}); err != nil {
+		t.Errorf("CheckStartLabel within the first 3 rows = %v; want nil", err)
+	}
+}
+
+func TestBackgroundColumnsByLabel(t *testing.T) {
+	header := []string{"Time (sec)", "BG340", "Well1 340", "Well1 380", " bg380 ", "skip"}
+	cols, err := FindColumns(header, []string{"bg340", "BG380"})
+	if err != nil || !reflect.DeepEqual(cols, []int{1, 4}) {
+		t.Fatalf("FindColumns = %v, %v; want [1 4]", cols, err)
+	}
+	order := MoveToEnd(len(header), cols)
+	if want := []int{0, 2, 3, 5, 1, 4}; !reflect.DeepEqual(order, want) {
+		t.Errorf("MoveToEnd = %v; want %v", order, want)
+	}
+	if got, want := Reorder(header, order), []string{"Time (sec)", "Well1 340", "Well1 380", "skip", "BG340", " bg380 "}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Reorder = %q; want %q", got, want)
+	}
+	// short rows are padded with empty cells, and without indices nothing is moved
+	if got, want := Reorder([]string{"1", "2"}, order), []string{"1", "", "", "", "2", ""}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Reorder of a short row = %q; want %q", got, want)
+	}
+	if got := MoveToEnd(3, nil); !reflect.DeepEqual(got, []int{0, 1, 2}) {
+		t.Errorf("MoveToEnd without indices = %v; want [0 1 2]", got)
+	}
+
+	for _, labels := range [][]string{{"BG340", "BG405"}, {"Well1 340"}} {
+		if _, err := FindColumns(append(header, "Well1 340"), labels); err == nil {
+			t.Errorf("FindColumns(%q) = nil error; want an error", labels)
+		}
+	}
+}
+
+func TestParseCoordinate(t *testing.T) {
+	tests := []struct {
+		cell     string
+		col, row int
+	}{
+		{"B3", 2, 3},
+		{"$B$3", 2, 3},
+		{"$aa10", 27, 10},
+		{" ZZ5000 ", 702, 5000},
+	}
+	for _, tt := range tests {
+		if col, row, err := ParseCoordinate(tt.cell); err != nil || col != tt.col || row != tt.row {
+			t.Errorf("ParseCoordinate(%q) = %d, %d, %v; want %d, %d", tt.cell, col, row, err, tt.col, tt.row)
+		}
+	}
+	for _, cell := range []string{"", "3B", "B", "B0", "B-1", "B3$", "$$B3", "\u00c41", "B3C"} {
+		if col, row, err := ParseCoordinate(cell); err == nil {
+			t.Errorf("ParseCoordinate(%q) = %d, %d; want an error", cell, col, row)
+		}
+	}
+
+	if col1, row1, col2, row2, err := ParseRange("B5:ZZ5000"); err != nil || col1 != 2 || row1 != 5 || col2 != 702 || row2 != 5000 {
+		t.Errorf("ParseRange = %d, %d, %d, %d, %v; want 2, 5, 702, 5000", col1, row1, col2, row2, err)
+	}
+	for _, rng := range []string{"B5", "B5:A6", "B5:C4", "B5:C6:D7", "B5:x"} {
+		if _, _, _, _, err := ParseRange(rng); err == nil {
+			t.Errorf("ParseRange(%q) = nil error; want an error", rng)
+		}
+	}
+}
+
+func TestLabelSearchLimit(t *testing.T) {
+	f := excelize.NewFile()
+	f.SetCellValue("Sheet1", "A1", "Instrument X")
+	f.SetCellValue("Sheet1", "A60", "Time (sec)")
+	wb := &ExcelWorkbook{XLSX: f}
+
+	if got, err := wb.StartRow("Sheet1", "Time (sec)"); err != nil || got != 59 {
+		t.Errorf("StartRow without limit = %d, %v; want 59", got, err)
+	}
+	wb.SearchRows = 60
+	if got, err := wb.StartRow("Sheet1", "Time (sec)"); err != nil || got != 59 {
+		t.Errorf("StartRow within the first 60 rows = %d, %v; want 59", got, err)
+	}
+	wb.SearchRows = 50
+	if _, err := wb.StartRow("Sheet1", "Time (sec)"); err == nil || !strings.Contains(err.Error(), "within the first 50 rows") {
+		t.Errorf("StartRow within the first 50 rows = %v; want an error that names the limit", err)
+	}
+}
+
+func TestScanRows(t *testing.T) {
+	f := excelize.NewFile()
+	f.SetCellValue("Sheet1", "B2", 1.5)
+	f.SetCellValue("Sheet1", "D2", "Well1 340")
+	f.SetCellValue("Sheet1", "A4", "Time (sec)")
+
+	// rows end at their last cell and hold the values of GetRows
+	got := make(map[int][]string)
+	if err := ScanRows(f, "Sheet1", func(idx int, cells []string) bool {
+		got[idx] = cells
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got[1], []string{"", "1.5", "", "Well1 340"}) || !reflect.DeepEqual(got[3], []string{"Time (sec)"}) {
+		t.Errorf("ScanRows = %v; want the cells of rows 2 and 4", got)
+	}
+	rows := f.GetRows("Sheet1")
+	for idx, cells := range got {
+		if !reflect.DeepEqual(cells, rows[idx][:len(cells)]) {
+			t.Errorf("row %d = %q; want %q like GetRows", idx, cells, rows[idx])
+		}
+	}
+
+	// the scan stops as soon as fn returns false
+	scanned := 0
+	if err := ScanRows(f, "Sheet1", func(int, []string) bool {
+		scanned++
+		return false
+	}); err != nil || scanned != 1 {
+		t.Errorf("ScanRows passed %d rows, %v; want 1 row", scanned, err)
+	}
+
+	// shared strings (which excelize itself does not write) are resolved, including rich text
+	f = excelize.NewFile()
+	delete(f.Sheet, "xl/worksheets/sheet1.xml")
+	f.XLSX["xl/sharedStrings.xml"] = []byte(`<sst><si><t>Time (sec)</t></si><si><r><t>Well1</t></r><r><t> 340</t></r></si></sst>`)
+	f.XLSX["xl/worksheets/sheet1.xml"] = []byte(`<worksheet><sheetData><row r="3"><c r="A3" t="s"><v>0</v></c>` +
+		`<c r="B3" t="s"><v>1</v></c><c r="C3" t="inlineStr"><is><t>bg340</t></is></c></row></sheetData></worksheet>`)
+	got = make(map[int][]string)
+	if err := ScanRows(f, "Sheet1", func(idx int, cells []string) bool {
+		got[idx] = cells
+		return true
+	}); err != nil || !reflect.DeepEqual(got, map[int][]string{2: {"Time (sec)", "Well1 340", "bg340"}}) {
+		t.Errorf("ScanRows = %v, %v; want the shared and inline strings of row 3", got, err)
+	}
+
+	if err := ScanRows(f, "Missing", func(int, []string) bool { return true }); err == nil {
+		t.Error("ScanRows of a missing sheet = nil error; want an error")
+	}
+}
+
+func TestPairColumns(t *testing.T) {
+	header := []string{"Time (sec)", "Well3_380", "Well3_340", "well1 340", "skip", "Well1-380", "bg340 ", "BG 380"}
+	want := [][2]int{{2, 1}, {3, 5}, {6, 7}} // in the order of the numerators
+	if got, err := PairColumns(header, "340", "380"); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("PairColumns = %v, %v; want %v", got, err, want)
+	}
+
+	for _, tt := range []struct {
+		header []string
+		err    string
+	}{
+		{[]string{"Well1_340", "Well1_380", "Well1 340"}, "columns A and C both hold the numerator of well Well1 340"},
+		{[]string{"Well1_340", "Well1_380", "well1-380"}, "columns B and C both hold the denominator of well well1-380"},
+		{[]string{"Well1_340", "Well2_380", "Well2_340"}, "no denominator for column A"},
+		{[]string{"Well1_340", "Well1_380", "Well2_380"}, "no numerator for column C"},
+		{[]string{"Time (sec)", "Well1"}, "no headers end with 340 and 380"},
+	} {
+		if _, err := PairColumns(tt.header, "340", "380"); err == nil || err.Error() != tt.err {
+			t.Errorf("PairColumns(%q) = %v; want %q", tt.header, err, tt.err)
+		}
+	}
+}
+
+func TestIsStartRow(t *testing.T) {
+	wb := metadataSheet()
+	labels := []string{"Elapsed Time", "Time (sec)"}
+	tests := []struct {
+		row  int
+		want bool
+	}{
+		{2, true},
+		{0, false},
+		{3, false},
+		{10, false}, // rows beyond the sheet are empty
+	}
+	for _, tt := range tests {
+		if got := wb.IsStartRow("Sheet1", tt.row, labels); got != tt.want {
+			t.Errorf("IsStartRow(%d) = %v; want %v", tt.row, got, tt.want)
+		}
+	}
+	wb.XLSX.SetCellValue("Sheet1", "A3", "\ufeffTime (sec)\u00a0") // labels are normalized
+	if !wb.IsStartRow("Sheet1", 2, labels) {
+		t.Error("IsStartRow does not normalize the label")
+	}
+}
+
+func TestInterleaveRaw(t *testing.T) {
+	f := excelize.NewFile()
+	f.SetSheetRow("Sheet1", "A1", &[]interface{}{"Well1", "Well2"})
+	f.SetSheetRow("Sheet1", "A2", &[]interface{}{150.0, 250.0})
+	f.SetSheetRow("Sheet1", "A3", &[]interface{}{151.0, 251.0})
+	InterleaveRaw(f, "Sheet1", [][]float64{{200, math.NaN()}, {300, 301}}, "text")
+	want := [][]string{
+		{"Well1 (raw)", "Well1 (corrected)", "Well2 (raw)", "Well2 (corrected)"},
+		{"200", "150", "300", "250"},
+		{"", "151", "301", "251"}, // NaN values are left blank
+	}
+	if got := f.GetRows("Sheet1"); !reflect.DeepEqual(got, want) {
+		t.Errorf("InterleaveRaw = %q; want %q", got, want)
+	}
+}
+
+func TestGetRange(t *testing.T) {
+	wb := metadataSheet()
+	tests := []struct {
+		rng  string
+		want [][]string
+	}{
+		{"A5:B6", [][]string{{"2", "200"}, {"4", "201"}}},
+		{"B3:D4", [][]string{{"Well1", "bg", ""}, {"well names", "", ""}}}, // rows are padded to the width of the range
+		{"C5:C99", [][]string{{"50"}, {"50"}}},                             // and end at the last row of the sheet
+	}
+	for _, tt := range tests {
+		if got, err := wb.GetRange("Sheet1", tt.rng); err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("GetRange(%s) = %q, %v; want %q", tt.rng, got, err, tt.want)
+		}
+	}
+	for _, rng := range []string{"A7:B9", "B6:A5", "A5"} {
+		if _, err := wb.GetRange("Sheet1", rng); err == nil {
+			t.Errorf("GetRange(%s) = nil error; want an error", rng)
+		}
+	}
+}
+
+func TestCropSheet(t *testing.T) {
+	wb := metadataSheet()
+	if err := wb.CropSheet("Sheet1", "A3:B6"); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{"Time (sec)", "Well1"}, {"", "well names"}, {"2", "200"}, {"4", "201"}}
+	if got := wb.XLSX.GetRows("Sheet1"); !reflect.DeepEqual(got, want) {
+		t.Errorf("cropped sheet = %q; want %q", got, want)
+	}
+
+	wb = metadataSheet()
+	if err := wb.CropSheet("Sheet1", "A10:B12"); err == nil {
+		t.Error("CropSheet of an empty range = nil error; want an error")
+	}
+	if got := len(wb.XLSX.GetRows("Sheet1")); got != 6 {
+		t.Errorf("failed CropSheet left %d rows; want the 6 rows of the sheet", got)
+	}
+}
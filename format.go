@@ -0,0 +1,82 @@
+package excelutil
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"strings"
+
+	"github.com/360EntSecGroup-Skylar/excelize"
+)
+
+// SetNumberFormat applies a custom Excel number format (e.g. "0.000") to the data region of a sheet, i.e. to
+// every cell below the header row; only the displayed values change, the stored values keep their full precision
+func SetNumberFormat(f *excelize.File, sheet, format string) error {
+	m := f.GetRows(sheet)
+	if len(m) < 2 || len(m[0]) == 0 {
+		return nil // nothing to format
+	}
+
+	// the format code is json-encoded to correctly escape quotes and backslashes
+	code, err := json.Marshal(format)
+	if err != nil {
+		return err
+	}
+	style, err := f.NewStyle(fmt.Sprintf("{\"custom_number_format\":%s}", code))
+	if err != nil {
+		return fmt.Errorf("cannot create number format %s: %s", format, err)
+	}
+	f.SetCellStyle(sheet, "A2", fmt.Sprintf("%s%d", GetColumn(len(m[0])), len(m)), style)
+	return nil
+}
+
+// defaultColWidth is the width that excelize returns for columns without a <col> element; it is taken from a new
+// workbook because excelize returns it in pixels, whereas explicit widths are given in characters
+var defaultColWidth = excelize.NewFile().GetColWidth("Sheet1", "A")
+
+// CopyStyles replaces the style sheet of dst with the style sheet of src so that style IDs of src can be used in dst
+// this has to be done before any style is created in dst because all existing styles of dst are lost
+func CopyStyles(dst, src *excelize.File) error {
+	styles := src.XLSX["xl/styles.xml"]
+	if src.Styles != nil {
+		var err error
+		if styles, err = xml.Marshal(src.Styles); err != nil {
+			return fmt.Errorf("cannot copy styles: %s", err)
+		}
+	}
+	if len(styles) == 0 {
+		return fmt.Errorf("cannot copy styles: source workbook has no style sheet")
+	}
+	dst.XLSX["xl/styles.xml"] = styles
+	dst.Styles = nil // forces excelize to read the new style sheet
+	return nil
+}
+
+// CopyCellFormat copies the style and the column width of a cell in src to a cell in dst (best-effort)
+// the styles of src must have been copied to dst with CopyStyles; column widths are only copied if they were set explicitly
+func CopyCellFormat(dst *excelize.File, dstSheet, dstCell string, src *excelize.File, srcSheet, srcCell string) {
+	if style := src.GetCellStyle(srcSheet, srcCell); style != 0 {
+		dst.SetCellStyle(dstSheet, dstCell, dstCell, style)
+	}
+	srcCol, dstCol := strings.TrimRight(srcCell, "0123456789"), strings.TrimRight(dstCell, "0123456789")
+	if width := src.GetColWidth(srcSheet, srcCol); width != defaultColWidth {
+		dst.SetColWidth(dstSheet, dstCol, dstCol, width)
+	}
+}
+
+// AnnotateCell attaches a comment with the given text to a cell (e.g. to document where its value comes from)
+func AnnotateCell(f *excelize.File, sheet, cell, text string) error {
+	format, err := json.Marshal(struct {
+		Author string `json:"author"`
+		Text   string `json:"text"`
+	}{"excelutil: ", text})
+	if err != nil {
+		return err
+	}
+	return f.AddComment(sheet, cell, string(format))
+}
+
+// CellRef returns a reference to the cell at the (1-based) column and row of sheet for use in formulas (e.g. 'Plate 1'!B3)
+func CellRef(sheet string, col, row int) string {
+	return fmt.Sprintf("'%s'!%s%d", strings.Replace(sheet, "'", "''", -1), GetColumn(col), row)
+}
@@ -0,0 +1,106 @@
+package excelutil
+
+import (
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/360EntSecGroup-Skylar/excelize"
+)
+
+func TestSetNumberFormat(t *testing.T) {
+	f := excelize.NewFile()
+	f.SetSheetRow("Sheet1", "A1", &[]interface{}{"Time (sec)", "Well1"})
+	f.SetSheetRow("Sheet1", "A2", &[]interface{}{2.0, 1.23456})
+	f.SetSheetRow("Sheet1", "A3", &[]interface{}{4.0, 1.5})
+	if err := SetNumberFormat(f, "Sheet1", `0.000" mM"`); err != nil {
+		t.Fatal(err)
+	}
+
+	// the data cells share the new style, the header keeps the default style
+	style := f.GetCellStyle("Sheet1", "A2")
+	if style == 0 || f.GetCellStyle("Sheet1", "B3") != style {
+		t.Errorf("data cells have styles %d and %d; want the same custom style", style, f.GetCellStyle("Sheet1", "B3"))
+	}
+	if got := f.GetCellStyle("Sheet1", "B1"); got != 0 {
+		t.Errorf("header cell has style %d; want 0", got)
+	}
+	if got := f.GetCellValue("Sheet1", "B2"); got != "1.23456" {
+		t.Errorf("value of B2 = %s; want the full precision", got)
+	}
+
+	// a sheet without data is left alone
+	if err := SetNumberFormat(excelize.NewFile(), "Sheet1", "0.0"); err != nil {
+		t.Errorf("SetNumberFormat of an empty sheet = %v; want nil", err)
+	}
+}
+
+func TestCopyCellFormatWidth(t *testing.T) {
+	src := excelize.NewFile()
+	src.SetColWidth("Sheet1", "B", "B", 30)
+	src.SetColWidth("Sheet1", "C", "C", 8)
+	dst := excelize.NewFile()
+
+	CopyCellFormat(dst, "Sheet1", "D1", src, "Sheet1", "B2") // explicit width
+	CopyCellFormat(dst, "Sheet1", "E1", src, "Sheet1", "C2") // explicit width below the default in pixels
+	CopyCellFormat(dst, "Sheet1", "F1", src, "Sheet1", "A2") // no <col> element
+	for col, want := range map[string]float64{"D": 30, "E": 8, "F": defaultColWidth} {
+		if got := dst.GetColWidth("Sheet1", col); got != want {
+			t.Errorf("width of column %s = %v; want %v", col, got, want)
+		}
+	}
+
+	// column F keeps the default width instead of an explicit width of 64 characters
+	if cols := dst.Sheet["xl/worksheets/sheet1.xml"].Cols; cols == nil || len(cols.Col) != 2 {
+		t.Errorf("destination has column widths %+v; want the widths of D and E only", cols)
+	}
+}
+
+func TestAnnotateCell(t *testing.T) {
+	f := excelize.NewFile()
+	for cell, text := range map[string]string{"A2": "source=Plate1!B3, bg=Plate1!H3, op=subtract", "B2": `a "quoted" <text>`} {
+		if err := AnnotateCell(f, "Sheet1", cell, text); err != nil {
+			t.Fatalf("AnnotateCell(%s) = %v", cell, err)
+		}
+	}
+
+	// excelize cannot read comments, so the part of the workbook that holds them is parsed instead
+	var comments struct {
+		Comment []struct {
+			Ref string   `xml:"ref,attr"`
+			T   []string `xml:"text>r>t"`
+		} `xml:"commentList>comment"`
+	}
+	if err := xml.Unmarshal(f.XLSX["xl/comments1.xml"], &comments); err != nil {
+		t.Fatalf("cannot parse the comments: %s", err)
+	}
+	got := make(map[string]string)
+	for _, c := range comments.Comment {
+		got[c.Ref] = strings.Join(c.T, "")
+	}
+	want := map[string]string{
+		"A2": "excelutil: source=Plate1!B3, bg=Plate1!H3, op=subtract",
+		"B2": `excelutil: a "quoted" <text>`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("comments = %q; want %q", got, want)
+	}
+}
+
+func TestCellRef(t *testing.T) {
+	tests := []struct {
+		sheet    string
+		col, row int
+		want     string
+	}{
+		{"Plate1", 2, 3, "'Plate1'!B3"},
+		{"raw Plate 1", 27, 10, "'raw Plate 1'!AA10"},
+		{"Bob's plate", 1, 1, "'Bob''s plate'!A1"}, // quotes are doubled
+	}
+	for _, tt := range tests {
+		if got := CellRef(tt.sheet, tt.col, tt.row); got != tt.want {
+			t.Errorf("CellRef(%q, %d, %d) = %q; want %q", tt.sheet, tt.col, tt.row, got, tt.want)
+		}
+	}
+}
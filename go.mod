@@ -4,5 +4,6 @@ go 1.12
 
 require (
 	github.com/360EntSecGroup-Skylar/excelize v0.0.0-20180620075330-3a91b28ddbca
+	github.com/mattn/go-sqlite3 v1.14.6
 	github.com/mohae/deepcopy v0.0.0-20170929034955-c48cc78d4826
 )
@@ -0,0 +1,104 @@
+package excelutil
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/360EntSecGroup-Skylar/excelize"
+)
+
+// LoadLabelMap reads a two-column mapping (e.g. well "A1" -> "Drug X 10uM") from a .csv file (or a .tsv file,
+// depending on the extension); keys and labels are trimmed, rows with fewer than two fields or an empty key are
+// ignored, and later rows overwrite earlier ones with the same key
+func LoadLabelMap(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error while opening label mapping %s: %s", path, err)
+	}
+	defer file.Close()
+	comma := ','
+	if strings.ToLower(filepath.Ext(path)) == ".tsv" {
+		comma = '\t'
+	}
+	records, err := ReadDelimited(file, comma)
+	if err != nil {
+		return nil, fmt.Errorf("error while reading label mapping %s: %s", path, err)
+	}
+	labels := make(map[string]string)
+	for _, record := range records {
+		if len(record) < 2 {
+			continue
+		}
+		key := NormalizeLabel(record[0])
+		if key == "" {
+			continue
+		}
+		labels[key] = strings.TrimSpace(record[1])
+	}
+	return labels, nil
+}
+
+// MapLabel returns the label of the first key that is part of the mapping and fallback if none of them is
+func MapLabel(labels map[string]string, fallback string, keys ...string) string {
+	for _, key := range keys {
+		if label, ok := labels[NormalizeLabel(key)]; ok {
+			return label
+		}
+	}
+	return fallback
+}
+
+// Ungrouped is the group of the columns that have none (see WriteGroups)
+const Ungrouped = "Ungrouped"
+
+// GroupedColumn is a column of an output sheet that belongs to a group (e.g. the condition of a well)
+type GroupedColumn struct {
+	Group  string // name of the group, empty if the column has none
+	Header string // header of the column in its group sheet
+	Values []float64
+}
+
+// WriteGroups writes every group of columns to a sheet of f (a new workbook) that is named after the group (see SheetName and
+// UniqueSheetName) and returns the names of these sheets; groups are written in the order of their first column and the
+// columns without a group are written last, to a sheet named Ungrouped; NaN values are left blank and infinite values
+// are replaced according to inf
+func WriteGroups(f *excelize.File, columns []GroupedColumn, inf InfPolicy) []string {
+	order := make([]string, 0)
+	groups := make(map[string][]GroupedColumn)
+	for _, col := range columns {
+		group := col.Group
+		if group == "" {
+			group = Ungrouped
+		}
+		if _, ok := groups[group]; !ok && group != Ungrouped {
+			order = append(order, group)
+		}
+		groups[group] = append(groups[group], col)
+	}
+	if _, ok := groups[Ungrouped]; ok {
+		order = append(order, Ungrouped)
+	}
+	sheets := make([]string, 0, len(order))
+	for idx, group := range order {
+		sheet := UniqueSheetName(f, SheetName("{name}", group))
+		if idx == 0 {
+			f.SetSheetName("Sheet1", sheet) // the default sheet of the new workbook is reused (see ReuseDefaultSheet)
+		} else {
+			_ = f.NewSheet(sheet)
+		}
+		for c, col := range groups[group] {
+			name := GetColumn(c + 1)
+			f.SetCellValue(sheet, name+"1", col.Header)
+			for r, v := range col.Values {
+				if !math.IsNaN(v) {
+					f.SetCellValue(sheet, fmt.Sprintf("%s%d", name, r+2), inf.CellValue(v))
+				}
+			}
+		}
+		sheets = append(sheets, sheet)
+	}
+	return sheets
+}
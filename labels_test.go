@@ -0,0 +1,96 @@
+package excelutil
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/360EntSecGroup-Skylar/excelize"
+)
+
+func TestLoadLabelMap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "excelutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// short rows and rows without key are ignored, and the last label of a key wins
+	csvPath := filepath.Join(dir, "map.csv")
+	content := "A1, Drug X 10uM\n\"A2\",\"Drug Y, 5uM\"\nA3\n,orphan\nA1,Drug Z\n"
+	if err := ioutil.WriteFile(csvPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	labels, err := LoadLabelMap(csvPath)
+	if want := map[string]string{"A1": "Drug Z", "A2": "Drug Y, 5uM"}; err != nil || !reflect.DeepEqual(labels, want) {
+		t.Errorf("LoadLabelMap(map.csv) = %q, %v; want %q", labels, err, want)
+	}
+
+	tsvPath := filepath.Join(dir, "map.tsv")
+	if err := ioutil.WriteFile(tsvPath, []byte("cell 2\tcontrol, untreated\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	labels, err = LoadLabelMap(tsvPath)
+	if want := map[string]string{"cell 2": "control, untreated"}; err != nil || !reflect.DeepEqual(labels, want) {
+		t.Errorf("LoadLabelMap(map.tsv) = %q, %v; want %q", labels, err, want)
+	}
+
+	if _, err := LoadLabelMap(filepath.Join(dir, "missing.csv")); err == nil {
+		t.Error("LoadLabelMap of a missing file = nil error; want an error")
+	}
+}
+
+func TestMapLabel(t *testing.T) {
+	labels := map[string]string{"A1": "Drug X", "cell 2": "control"}
+	tests := []struct {
+		keys []string
+		want string
+	}{
+		{[]string{"1", "A1"}, "Drug X"},            // the position is not mapped, the source header is
+		{[]string{"2", "cell 2", "A1"}, "control"}, // the first key that is mapped wins
+		{[]string{" A1\u00a0"}, "Drug X"},          // keys are normalized
+		{[]string{"3", "cell 3"}, "cell 3"},        // unmapped columns keep their name
+		{nil, "cell 3"},
+	}
+	for _, tt := range tests {
+		if got := MapLabel(labels, "cell 3", tt.keys...); got != tt.want {
+			t.Errorf("MapLabel(%q) = %q; want %q", tt.keys, got, tt.want)
+		}
+	}
+}
+
+func TestWriteGroups(t *testing.T) {
+	nan := math.NaN()
+	columns := []GroupedColumn{
+		{Group: "", Header: "Plate1 cell 1", Values: []float64{1, 2}},
+		{Group: "Drug X 1/2", Header: "Plate1 cell 2", Values: []float64{3, nan}},
+		{Group: "control", Header: "Plate1 cell 3", Values: []float64{5, 6}},
+		{Group: "Drug X 1/2", Header: "Plate2 cell 4", Values: []float64{7, 8}},
+		{Group: "Drug X 1_2", Header: "Plate2 cell 5", Values: []float64{9}}, // collides with the name of the first group
+	}
+	f := excelize.NewFile()
+	sheets := WriteGroups(f, columns, "text")
+
+	// groups are written in the order of their first column, the columns without group last
+	want := []string{"Drug X 1_2", "control", "Drug X 1_2 (2)", Ungrouped}
+	if !reflect.DeepEqual(sheets, want) {
+		t.Fatalf("WriteGroups = %q; want %q", sheets, want)
+	}
+	if got := f.GetSheetMap(); len(got) != len(want) {
+		t.Errorf("workbook has sheets %v; want %q (the default sheet is reused)", got, want)
+	}
+	contents := map[string][][]string{
+		"Drug X 1_2":     {{"Plate1 cell 2", "Plate2 cell 4"}, {"3", "7"}, {"", "8"}}, // NaN values are left blank
+		"control":        {{"Plate1 cell 3"}, {"5"}, {"6"}},
+		"Drug X 1_2 (2)": {{"Plate2 cell 5"}, {"9"}},
+		Ungrouped:        {{"Plate1 cell 1"}, {"1"}, {"2"}},
+	}
+	for sheet, want := range contents {
+		if got := f.GetRows(sheet); !reflect.DeepEqual(got, want) {
+			t.Errorf("sheet %s = %q; want %q", sheet, got, want)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package excelutil
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/360EntSecGroup-Skylar/excelize"
+)
+
+// ODSSheet holds the name and the cell values of a sheet of an OpenDocument (.ods) spreadsheet
+type ODSSheet struct {
+	Name string
+	Rows [][]string
+}
+
+// namespaces of the OpenDocument format
+const (
+	odsTableNS  = "urn:oasis:names:tc:opendocument:xmlns:table:1.0"
+	odsOfficeNS = "urn:oasis:names:tc:opendocument:xmlns:office:1.0"
+	odsTextNS   = "urn:oasis:names:tc:opendocument:xmlns:text:1.0"
+)
+
+// ReadODS reads all sheets of an OpenDocument spreadsheet (.ods) in the order in which they appear in the document
+// numeric cells are returned with full precision (the 'office:value' attribute), all other cells with their text content;
+// repeated empty rows and columns at the end of a sheet are dropped
+func ReadODS(r io.ReaderAt, size int64) ([]ODSSheet, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read .ods archive: %s", err)
+	}
+	var content *zip.File
+	for _, f := range zr.File {
+		if f.Name == "content.xml" {
+			content = f
+		}
+	}
+	if content == nil {
+		return nil, fmt.Errorf("invalid .ods file: content.xml is missing")
+	}
+	rc, err := content.Open()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read content.xml: %s", err)
+	}
+	defer rc.Close()
+	return parseODSContent(xml.NewDecoder(rc))
+}
+
+// odsRepeat returns the value of a repetition attribute (e.g. 'table:number-rows-repeated') or 1 if it is missing
+func odsRepeat(attrs []xml.Attr, name string) int {
+	for _, a := range attrs {
+		if a.Name.Space == odsTableNS && a.Name.Local == name {
+			if n, err := strconv.Atoi(a.Value); err == nil && n > 0 {
+				return n
+			}
+		}
+	}
+	return 1
+}
+
+// odsAttr returns the value of an attribute in the given namespace or an empty string
+func odsAttr(attrs []xml.Attr, space, name string) string {
+	for _, a := range attrs {
+		if a.Name.Space == space && a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// parseODSContent parses the content.xml of an .ods file
+func parseODSContent(d *xml.Decoder) ([]ODSSheet, error) {
+	sheets := make([]ODSSheet, 0)
+	var (
+		sheet        *ODSSheet
+		row          []string
+		pendingCols  int // empty cells that are only added if a non-empty cell follows
+		pendingRows  int // empty rows that are only added if a non-empty row follows
+		rowRepeat    int
+		cellRepeat   int
+		cellValue    string
+		cellHasValue bool
+		text         strings.Builder
+		inCell       bool
+		paragraphs   int
+	)
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse content.xml: %s", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch {
+			case t.Name.Space == odsTableNS && t.Name.Local == "table":
+				sheets = append(sheets, ODSSheet{Name: odsAttr(t.Attr, odsTableNS, "name")})
+				sheet = &sheets[len(sheets)-1]
+				pendingRows = 0
+			case t.Name.Space == odsTableNS && t.Name.Local == "table-row":
+				row = make([]string, 0)
+				pendingCols = 0
+				rowRepeat = odsRepeat(t.Attr, "number-rows-repeated")
+			case t.Name.Space == odsTableNS && (t.Name.Local == "table-cell" || t.Name.Local == "covered-table-cell"):
+				inCell = true
+				paragraphs = 0
+				text.Reset()
+				cellRepeat = odsRepeat(t.Attr, "number-columns-repeated")
+				cellValue, cellHasValue = "", false
+				switch odsAttr(t.Attr, odsOfficeNS, "value-type") {
+				case "float", "percentage", "currency":
+					cellValue, cellHasValue = odsAttr(t.Attr, odsOfficeNS, "value"), true
+				case "date":
+					cellValue, cellHasValue = odsAttr(t.Attr, odsOfficeNS, "date-value"), true
+				case "time":
+					cellValue, cellHasValue = odsAttr(t.Attr, odsOfficeNS, "time-value"), true
+				case "boolean":
+					cellValue, cellHasValue = odsAttr(t.Attr, odsOfficeNS, "boolean-value"), true
+				}
+			case inCell && t.Name.Space == odsTextNS && t.Name.Local == "p":
+				if paragraphs > 0 {
+					text.WriteString("\n")
+				}
+				paragraphs++
+			case inCell && t.Name.Space == odsTextNS && t.Name.Local == "s":
+				n, err := strconv.Atoi(odsAttr(t.Attr, odsTextNS, "c"))
+				if err != nil || n < 1 {
+					n = 1
+				}
+				text.WriteString(strings.Repeat(" ", n))
+			case inCell && t.Name.Space == odsTextNS && t.Name.Local == "tab":
+				text.WriteString("\t")
+			}
+		case xml.CharData:
+			if inCell {
+				text.Write(t)
+			}
+		case xml.EndElement:
+			switch {
+			case t.Name.Space == odsTableNS && (t.Name.Local == "table-cell" || t.Name.Local == "covered-table-cell"):
+				inCell = false
+				if !cellHasValue {
+					cellValue = text.String()
+				}
+				if cellValue == "" {
+					pendingCols += cellRepeat
+					continue
+				}
+				for ; pendingCols > 0; pendingCols-- {
+					row = append(row, "")
+				}
+				for k := 0; k < cellRepeat; k++ {
+					row = append(row, cellValue)
+				}
+			case t.Name.Space == odsTableNS && t.Name.Local == "table-row":
+				if sheet == nil {
+					continue
+				}
+				if len(row) == 0 {
+					pendingRows += rowRepeat
+					continue
+				}
+				for ; pendingRows > 0; pendingRows-- {
+					sheet.Rows = append(sheet.Rows, []string{})
+				}
+				for k := 0; k < rowRepeat; k++ {
+					sheet.Rows = append(sheet.Rows, append([]string{}, row...))
+				}
+			case t.Name.Space == odsTableNS && t.Name.Local == "table":
+				sheet = nil
+			}
+		}
+	}
+	return sheets, nil
+}
+
+// ODSToXLSX converts the sheets of an .ods file to an in-memory excelize workbook so that they can be
+// processed like any .xlsx file; numeric cells are written as numbers, all other cells as strings
+func ODSToXLSX(sheets []ODSSheet) *excelize.File {
+	xlsx := excelize.NewFile()
+	for idx, sheet := range sheets {
+		if idx == 0 {
+			xlsx.SetSheetName("Sheet1", sheet.Name)
+		} else {
+			_ = xlsx.NewSheet(sheet.Name)
+		}
+		for r, row := range sheet.Rows {
+			for c, val := range row {
+				if val == "" {
+					continue
+				}
+				cl := fmt.Sprintf("%s%d", GetColumn(c+1), r+1)
+				if v, err := strconv.ParseFloat(val, 64); err == nil {
+					xlsx.SetCellValue(sheet.Name, cl, v)
+				} else {
+					xlsx.SetCellValue(sheet.Name, cl, val)
+				}
+			}
+		}
+	}
+	return xlsx
+}
@@ -0,0 +1,84 @@
+package excelutil
+
+import (
+	"archive/zip"
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// odsContent is the content.xml of a spreadsheet with two sheets, repeated cells and rows, and trailing empty cells
+const odsContent = `<?xml version="1.0" encoding="UTF-8"?>
+<office:document-content xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0"
+ xmlns:table="urn:oasis:names:tc:opendocument:xmlns:table:1.0" xmlns:text="urn:oasis:names:tc:opendocument:xmlns:text:1.0">
+<office:body><office:spreadsheet>
+<table:table table:name="Plate1">
+ <table:table-row>
+  <table:table-cell office:value-type="string"><text:p>Time<text:s text:c="2"/>(sec)</text:p></table:table-cell>
+  <table:table-cell table:number-columns-repeated="2"/>
+  <table:table-cell office:value-type="string"><text:p>bg</text:p></table:table-cell>
+  <table:table-cell table:number-columns-repeated="1020"/>
+ </table:table-row>
+ <table:table-row table:number-rows-repeated="2">
+  <table:table-cell office:value-type="float" office:value="0.123456789"><text:p>0.12</text:p></table:table-cell>
+  <table:table-cell office:value-type="float" office:value="2" table:number-columns-repeated="2"><text:p>2</text:p></table:table-cell>
+ </table:table-row>
+ <table:table-row table:number-rows-repeated="1048000"><table:table-cell table:number-columns-repeated="1024"/></table:table-row>
+</table:table>
+<table:table table:name="Plate2">
+ <table:table-row table:number-rows-repeated="2"><table:table-cell/></table:table-row>
+ <table:table-row><table:table-cell office:value-type="string"><text:p>a</text:p><text:p>b</text:p></table:table-cell></table:table-row>
+</table:table>
+</office:spreadsheet></office:body></office:document-content>`
+
+// odsFile returns an .ods archive that holds content as the file name (i.e. content.xml for a valid archive)
+func odsFile(t *testing.T, name, content string) *bytes.Reader {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte(content))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return bytes.NewReader(buf.Bytes())
+}
+
+func TestReadODS(t *testing.T) {
+	r := odsFile(t, "content.xml", odsContent)
+	sheets, err := ReadODS(r, r.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ODSSheet{
+		{"Plate1", [][]string{
+			{"Time  (sec)", "", "", "bg"},
+			{"0.123456789", "2", "2"},
+			{"0.123456789", "2", "2"},
+		}},
+		{"Plate2", [][]string{{}, {}, {"a\nb"}}},
+	}
+	if !reflect.DeepEqual(sheets, want) {
+		t.Errorf("ReadODS =\n%q\nwant\n%q", sheets, want)
+	}
+
+	// the sheets are converted to a workbook with numeric cells
+	f := ODSToXLSX(sheets)
+	if got := f.GetSheetMap(); !reflect.DeepEqual(got, map[int]string{1: "Plate1", 2: "Plate2"}) {
+		t.Errorf("converted workbook has sheets %v; want Plate1 and Plate2", got)
+	}
+	if got := f.GetCellValue("Plate1", "A3"); got != "0.123456789" {
+		t.Errorf("A3 of the converted workbook = %q; want the full precision", got)
+	}
+
+	// files that are no archives and archives without content.xml are rejected
+	zr := odsFile(t, "mimetype", "application/vnd.oasis.opendocument.spreadsheet")
+	if _, err := ReadODS(bytes.NewReader(nil), 0); err == nil {
+		t.Error("ReadODS of an empty file = nil; want an error")
+	}
+	if _, err := ReadODS(zr, zr.Size()); err == nil {
+		t.Error("ReadODS of an archive without content.xml = nil; want an error")
+	}
+}
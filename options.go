@@ -0,0 +1,169 @@
+package excelutil
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+)
+
+// Options holds the values of the flags of the 'process' subcommand that procexcel and procexcelratios share
+// every field is named after its flag (e.g. FilePath is --file_path); the flags that only one of the programs has
+// (or that mean something different in both) are defined by the programs themselves
+type Options struct {
+	FilePath           string
+	ThresholdReport    bool
+	TrimmedOutput      int
+	AddChart           bool
+	Verbose            bool
+	Start              int
+	Stop               int
+	PrintOrder         bool
+	OutputPrefix       string
+	Timestamp          bool
+	StartLabels        string
+	FallbackStartRow   int
+	PreserveFormatting bool
+	Preview            int
+	DryRun             bool
+	InputFormat        string
+	OutputFormat       string
+	OutputOrigin       string
+	ConsistentLayout   bool
+	LimitSheets        int
+	SheetNameTemplate  string
+	TimeRange          string
+	SortOrder          string
+	Annotate           bool
+	Incremental        bool
+	Compression        int
+	Wait               time.Duration
+	Estimate           bool
+	CarryMetadata      bool
+	PrintPrecision     int
+	StrictStartLabel   bool
+	Inf                string
+	Orientation        string
+	LabelSearchLimit   int
+	Downsample         int
+	CPUProfile         string
+	MemProfile         string
+	TemplateSheet      string
+	EmitRawPairs       bool
+	ListOutputs        bool
+	DataRange          string
+	Retry              int
+	RetryDelay         time.Duration
+	HeaderOffset       int
+	ExportOrder        bool
+	Gzip               bool
+	QualityReport      bool
+	Seed               int64
+}
+
+// NewOptions defines the shared flags on fs and returns the Options that hold their values once fs is parsed
+func NewOptions(fs *flag.FlagSet) *Options {
+	o := &Options{}
+	fs.StringVar(&o.FilePath, "file_path", "", "specify the path to the Excel (.xlsx) file that you want to process")
+	fs.BoolVar(&o.ThresholdReport, "threshold_report", false, "--threshold_report=true writes the number of columns of every sheet that survive --threshold to a 'threshold_report.json' file\n(e.g. as a quantitative quality check of a run, defaults to false)")
+	fs.IntVar(&o.TrimmedOutput, "trimmed_output", 450, "specify after how many measurements the output should be trimmed\nthis option applies only to the '_ratios.xlsx' output file")
+	fs.BoolVar(&o.AddChart, "add_chart", false, "--add_chart=true adds two line plots visualizing the first 12 columns of every sheet (defaults to false)\nonly the first up to 470 measurements are plotted and the plots are drawn at columns A470 and R470\nmake sure to change this hard-coded format if your experimental setup/sampling-interval changes")
+	fs.BoolVar(&o.Verbose, "verbose", false, "--verbose=true results in an (extremely) verbose output (defaults to false)")
+	fs.IntVar(&o.Start, "start", 30, "specify at which measurement you want to start looking for a peak that is then used to sort columns")
+	fs.IntVar(&o.Stop, "stop", 360, "specify at which measurement you want to stop looking for a peak that is then used to sort columns")
+	fs.BoolVar(&o.PrintOrder, "print_order", true, "--print_order=false does not print the ordered max values for all cells in all sheets to stdout")
+	fs.StringVar(&o.OutputPrefix, "output_prefix", "", "specify a prefix for the names of all output files (e.g. a path to an output directory and/or an experiment name)")
+	fs.BoolVar(&o.Timestamp, "timestamp", true, "--timestamp=false omits the timestamp (YYYYMMDD_hhmmss) from the names of all output files\nbe aware that existing output files will be overwritten unless a unique --output_prefix is used")
+	fs.StringVar(&o.StartLabels, "start_labels", "Time (sec)", "specify a comma-separated list of labels in column 1 that mark the start of the data matrix (e.g. 'Time (sec),Time (s),Elapsed Time')\nthe first row that matches any of the labels holds the column headers")
+	fs.IntVar(&o.FallbackStartRow, "fallback_start_row", 0, "specify the row (starting at 1) that holds the column headers of sheets without a start label (see --start_labels)\nthe data is expected to start in the following row; by default, sheets without label are skipped")
+	fs.BoolVar(&o.PreserveFormatting, "preserve_formatting", false, "--preserve_formatting=true copies the styles of the header cells and the column widths of the input file to the transformed data (best-effort, defaults to false)")
+	fs.IntVar(&o.Preview, "preview", 0, "specify a number of rows N to print the header and the first N rows of the transformed data of every sheet to stdout")
+	fs.BoolVar(&o.DryRun, "dry_run", false, "--dry_run=true processes all sheets without writing any output file (e.g. to check the results with --preview, defaults to false)")
+	fs.StringVar(&o.InputFormat, "input_format", "", "specify the format of the input file: 'xlsx', 'ods', or 'tsv' (a tab-separated file is read as a single sheet)\nby default, the format is detected by the file extension")
+	fs.StringVar(&o.OutputFormat, "output_format", "xlsx", "specify the format of the main output files: 'xlsx', 'csv' or 'tsv' (one file per sheet), or 'json'\nadditional outputs (e.g. histograms) are always written as .xlsx files")
+	fs.StringVar(&o.OutputOrigin, "output_origin", "A1", "specify the cell (e.g. 'B3') at which the headers and data of all output sheets start\nthe rows and columns before it stay empty (e.g. for metadata) and charts and comments move along; only supported with --output_format=xlsx (defaults to A1)")
+	fs.BoolVar(&o.ConsistentLayout, "consistent_layout", false, "--consistent_layout=true checks that all sheets have the same number of columns and the same start row\nbefore anything is processed and aborts with a list of deviating sheets otherwise (defaults to false)")
+	fs.IntVar(&o.LimitSheets, "limit_sheets", 0, "specify how many sheets are processed at most (in the order of the workbook, e.g. for a quick look with --preview)\nthe default of 0 processes all sheets")
+	fs.StringVar(&o.SheetNameTemplate, "sheet_name_template", "{name}", "specify a template for the names of the output sheets in which '{name}' is replaced by the name of the input sheet (e.g. 'ratios_{name}')\nnames are truncated to 31 characters and characters that Excel does not allow are replaced by underscores; input sheets that map to the same name are rejected")
+	fs.StringVar(&o.TimeRange, "time_range", "", "specify a range of times from:to (e.g. '30:360', in the unit of the time column) to restrict processing to the rows\nwhose times are nearest to these bounds; this is independent of the sampling interval\n--start and --stop then count measurements from the start of this range (defaults to all rows)")
+	fs.StringVar(&o.SortOrder, "sort_order", "desc", "specify whether the sorted output starts with the highest ('desc') or the lowest ('asc') peak (defaults to 'desc')")
+	fs.BoolVar(&o.Annotate, "annotate", false, "--annotate=true adds a comment to every transformed cell that names its source cell, its background cell, and the operation\n(writing comments becomes very slow for large sheets, so consider --time_range or --limit_sheets; comments are only kept in .xlsx files, defaults to false)")
+	fs.BoolVar(&o.Incremental, "incremental", false, "--incremental=true saves the main output files after every sheet so that the results of finished sheets survive a crash\nthe files are overwritten after every sheet and completed at the end of the run (defaults to false)")
+	fs.IntVar(&o.Compression, "compression", -1, "--compression=N sets the compression level (0-9) of all .xlsx output files; -1 uses the default level of excelize (defaults to -1)\nhigher levels produce smaller files but take longer to save, 0 stores the files uncompressed (fastest, but several times larger)\ncharts are only embedded with --add_chart, so leaving it off keeps files small as well")
+	fs.DurationVar(&o.Wait, "wait", 0, "--wait=2m waits up to the given duration for an input file that is still being written (e.g. by an instrument) to be complete\nthe file is checked every second; without --wait, an incomplete file is rejected right away (defaults to 0, i.e. no waiting)")
+	fs.BoolVar(&o.Estimate, "estimate", false, "--estimate=true only scans the dimensions of all sheets and prints the number of input cells, a rough processing time, and the projected\nsizes of the main output files, e.g. to decide whether a batch should run overnight; the projection is based on fixed per-cell constants that are guesses rather than measurements (defaults to false)")
+	fs.BoolVar(&o.CarryMetadata, "carry_metadata", false, "--carry_metadata=true copies the rows above the start label (e.g. instrument, date, and protocol) to the top of every transformed output sheet\nthe transformed data starts below them; only supported with --output_format=xlsx (defaults to false)")
+	fs.IntVar(&o.PrintPrecision, "print_precision", 3, "specify the number of decimals of the peak values that --print_order prints to stdout (the output files keep full precision)\na negative value prints the values with full precision (defaults to 3)")
+	fs.BoolVar(&o.StrictStartLabel, "strict_start_label", false, "--strict_start_label=true aborts if more than one row of a sheet matches --start_labels (e.g. repeated headers of concatenated exports)\nby default, the first matching row is used (defaults to false)")
+	fs.StringVar(&o.Inf, "inf", "text", "specify how infinite values (e.g. ratios with a zero denominator) are written to the output cells: 'text' writes 'Inf' and '-Inf',\n'blank' leaves the cells empty (later steps like the peak search treat them as missing values), and a number (e.g. 1e9) replaces them by that number and -Inf by its negation (defaults to 'text')")
+	fs.StringVar(&o.Orientation, "orientation", "rows", "specify whether the time of every sheet increases down the rows ('rows') or across the columns ('columns') of the input\nsheets with time in columns are transposed before they are processed, so the time row must be the first row of such sheets\n'auto' detects the orientation of every sheet and falls back to 'rows' with a warning if it is ambiguous (defaults to 'rows')")
+	fs.IntVar(&o.LabelSearchLimit, "label_search_limit", 0, "specify how many rows at the top of every sheet are searched for --start_labels (e.g. 50 on huge sheets)\nthe default of 0 searches all rows")
+	fs.IntVar(&o.Downsample, "downsample", 1, "specify N to only process every N-th measurement (starting with the first one), e.g. for a quick preview of a very long recording\nall outputs and the peak search use the kept measurements, so --start and --stop count them instead of the original rows (defaults to 1, i.e. all measurements)")
+	fs.StringVar(&o.CPUProfile, "cpuprofile", "", "--cpuprofile=path writes a CPU profile of the run to path, which can be inspected with 'go tool pprof' (defaults to '', i.e. no profile)")
+	fs.StringVar(&o.MemProfile, "memprofile", "", "--memprofile=path writes a heap profile at the end of the run to path, which can be inspected with 'go tool pprof' (defaults to '', i.e. no profile)")
+	fs.StringVar(&o.TemplateSheet, "template_sheet", "", "--template_sheet=name searches the start label (see --start_labels) only on sheet 'name' and reuses its start row for all sheets\nwhose first column holds a start label in that row; other sheets are searched as usual (defaults to '', i.e. every sheet is searched)")
+	fs.BoolVar(&o.EmitRawPairs, "emit_raw_pairs", false, "--emit_raw_pairs=true writes two columns per data column to the transformed data, the original values ('<header> (raw)')\nfollowed by the corrected values ('<header> (corrected)'), e.g. to check the background correction; cannot be combined with --annotate (defaults to false)")
+	fs.BoolVar(&o.ListOutputs, "list_outputs", false, "--list_outputs=true prints the paths of all files that a run with the other options would write and exits without processing\n(the timestamp of the run is shown as YYYYMMDD_hhmmss); files that exist already or would overwrite each other are marked (defaults to false)")
+	fs.StringVar(&o.DataRange, "data_range", "", "--data_range=B5:ZZ5000 reads only that range of every sheet instead of searching the start label (see --start_labels)\nthe first row of the range is the header row and its first column holds the time (defaults to '', i.e. the start label is searched)")
+	fs.IntVar(&o.Retry, "retry", 0, "--retry=N tries up to N more times to open the input file if opening fails with a transient I/O error (e.g. on a network drive)\nmissing files and files that are no valid workbooks fail immediately (defaults to 0, i.e. no retries)")
+	fs.DurationVar(&o.RetryDelay, "retry_delay", time.Second, "--retry_delay=DURATION sets the time to wait before every retry of --retry, e.g. '500ms' or '2s' (defaults to 1s)")
+	fs.IntVar(&o.HeaderOffset, "header_offset", 0, "--header_offset=N takes the column headers (e.g. the well names) from the row N rows below the start label instead of the\nstart label row itself; the data starts below that row (defaults to 0, i.e. the start label row is the header)")
+	fs.BoolVar(&o.ExportOrder, "export_order", false, "--export_order=true writes the sorted order of the columns of every sheet to an 'order.csv' file (sheet, rank, original column, header)\ne.g. to sort a related dataset (like a second channel) in the same way (defaults to false)")
+	fs.BoolVar(&o.Gzip, "gzip", false, "--gzip=true compresses all .csv, .tsv, and .json output files with gzip and appends '.gz' to their names (defaults to false)\n.xlsx files are zip archives already and are not affected")
+	fs.BoolVar(&o.QualityReport, "quality_report", false, "--quality_report=true counts the empty, non-numeric (e.g. 'n/a'), and non-finite (e.g. 'Inf') cells below the header of every column\nand sheet and writes them to a 'quality_report.csv' file, e.g. to decide whether a file is worth analyzing (defaults to false)")
+	fs.Int64Var(&o.Seed, "seed", 0, "specify a seed for all operations that involve randomness to get reproducible results\nthe default of 0 means that a time-based seed is used")
+	return o
+}
+
+// SaveOptions returns the settings of the output files that --compression and --gzip select
+func (o *Options) SaveOptions() SaveOptions {
+	return SaveOptions{CompressionLevel: o.Compression, Gzip: o.Gzip}
+}
+
+// Validate checks the values of the shared flags that do not depend on each other or on the input file; the flags that
+// are parsed into other values (e.g. --output_origin or --time_range) are checked by the programs when they parse them
+func (o *Options) Validate() error {
+	if o.FilePath == "" {
+		return errors.New("provide a correct file path (see process --help)")
+	}
+	if o.InputFormat != "" && o.InputFormat != "xlsx" && o.InputFormat != "ods" && o.InputFormat != "tsv" {
+		return fmt.Errorf("unknown input format: %s (see process --help)", o.InputFormat)
+	}
+	if o.OutputFormat != "xlsx" && o.OutputFormat != "csv" && o.OutputFormat != "tsv" && o.OutputFormat != "json" {
+		return fmt.Errorf("unknown output format: %s (see process --help)", o.OutputFormat)
+	}
+	if o.CarryMetadata && o.OutputFormat != "xlsx" {
+		return errors.New("--carry_metadata is only supported with --output_format=xlsx")
+	}
+	if o.SortOrder != "desc" && o.SortOrder != "asc" {
+		return fmt.Errorf("unknown sort order: %s (must be 'desc' or 'asc')", o.SortOrder)
+	}
+	if o.EmitRawPairs && o.Annotate {
+		return errors.New("--emit_raw_pairs cannot be combined with --annotate")
+	}
+	if o.Start < 1 {
+		return fmt.Errorf("cannot use --start=%d (measurements are counted from 1)", o.Start)
+	}
+	if o.Downsample < 1 {
+		return fmt.Errorf("cannot use --downsample=%d (must be at least 1)", o.Downsample)
+	}
+	if o.Orientation != "rows" && o.Orientation != "columns" && o.Orientation != "auto" {
+		return fmt.Errorf("unknown orientation: %s (must be 'rows', 'columns', or 'auto')", o.Orientation)
+	}
+	if o.Compression < -1 || o.Compression > 9 {
+		return fmt.Errorf("invalid compression level: %d (must be between -1 and 9)", o.Compression)
+	}
+	if o.HeaderOffset < 0 {
+		return fmt.Errorf("cannot use --header_offset=%d (must not be negative)", o.HeaderOffset)
+	}
+	if o.LabelSearchLimit < 0 {
+		return fmt.Errorf("cannot use --label_search_limit=%d (must not be negative)", o.LabelSearchLimit)
+	}
+	if o.LimitSheets < 0 {
+		return fmt.Errorf("cannot use --limit_sheets=%d (must not be negative)", o.LimitSheets)
+	}
+	if o.Retry < 0 {
+		return fmt.Errorf("cannot use --retry=%d (must not be negative)", o.Retry)
+	}
+	return nil
+}
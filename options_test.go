@@ -0,0 +1,74 @@
+package excelutil
+
+import (
+	"flag"
+	"testing"
+	"time"
+)
+
+// parseOptions parses args into the Options of a new flag set
+func parseOptions(t *testing.T, args ...string) *Options {
+	fs := flag.NewFlagSet("process", flag.ContinueOnError)
+	o := NewOptions(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatalf("cannot parse %v: %s", args, err)
+	}
+	return o
+}
+
+func TestNewOptions(t *testing.T) {
+	o := parseOptions(t)
+	if o.TrimmedOutput != 450 || o.Start != 30 || o.Stop != 360 || !o.PrintOrder || !o.Timestamp ||
+		o.StartLabels != "Time (sec)" || o.OutputFormat != "xlsx" || o.Compression != -1 || o.RetryDelay != time.Second || o.Seed != 0 {
+		t.Errorf("unexpected defaults: %+v", o)
+	}
+
+	o = parseOptions(t, "--file_path=in.xlsx", "--start=5", "--seed=42")
+	if o.FilePath != "in.xlsx" || o.Start != 5 || o.Seed != 42 {
+		t.Errorf("flags were not parsed: %+v", o)
+	}
+
+	// the flags that differ between the programs are not shared
+	fs := flag.NewFlagSet("process", flag.ContinueOnError)
+	NewOptions(fs)
+	for _, name := range []string{"threshold", "norm_value", "background_count"} {
+		if fs.Lookup(name) != nil {
+			t.Errorf("--%s is defined by NewOptions", name)
+		}
+	}
+}
+
+func TestSaveOptions(t *testing.T) {
+	if got := parseOptions(t).SaveOptions(); got != DefaultSaveOptions() {
+		t.Errorf("SaveOptions of the defaults = %+v; want %+v", got, DefaultSaveOptions())
+	}
+	if got := parseOptions(t, "--compression=9").SaveOptions(); got.CompressionLevel != 9 {
+		t.Errorf("SaveOptions with --compression=9 = %+v", got)
+	}
+}
+
+func TestOptionsValidate(t *testing.T) {
+	if err := parseOptions(t, "--file_path=in.xlsx").Validate(); err != nil {
+		t.Errorf("Validate of the defaults = %v; want nil", err)
+	}
+	for _, args := range [][]string{
+		{},
+		{"--file_path=in.xlsx", "--input_format=xls"},
+		{"--file_path=in.xlsx", "--output_format=pdf"},
+		{"--file_path=in.xlsx", "--output_format=csv", "--carry_metadata"},
+		{"--file_path=in.xlsx", "--sort_order=up"},
+		{"--file_path=in.xlsx", "--emit_raw_pairs", "--annotate"},
+		{"--file_path=in.xlsx", "--start=0"},
+		{"--file_path=in.xlsx", "--downsample=0"},
+		{"--file_path=in.xlsx", "--orientation=diagonal"},
+		{"--file_path=in.xlsx", "--compression=10"},
+		{"--file_path=in.xlsx", "--header_offset=-1"},
+		{"--file_path=in.xlsx", "--label_search_limit=-1"},
+		{"--file_path=in.xlsx", "--limit_sheets=-1"},
+		{"--file_path=in.xlsx", "--retry=-1"},
+	} {
+		if err := parseOptions(t, args...).Validate(); err == nil {
+			t.Errorf("Validate of %v = nil; want an error", args)
+		}
+	}
+}
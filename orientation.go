@@ -0,0 +1,63 @@
+package excelutil
+
+import "strconv"
+
+// Orientation describes along which axis the measurements of a sheet are arranged
+type Orientation string
+
+// the time either increases down the first column (the default layout) or across a row
+const (
+	OrientationUnknown Orientation = ""
+	OrientationRows    Orientation = "rows"
+	OrientationColumns Orientation = "columns"
+)
+
+// DetectOrientation guesses the orientation of a sheet by looking for its time axis, i.e. for at least three numeric
+// values that strictly increase down the first column or across a row (starting at its second cell)
+// OrientationUnknown is returned if neither or both are found
+func DetectOrientation(rows [][]string) Orientation {
+	column := make([]string, 0, len(rows))
+	for _, row := range rows {
+		if len(row) > 0 {
+			column = append(column, row[0])
+		}
+	}
+	inRows := increasing(column)
+	inColumns := false
+	for _, row := range rows {
+		if len(row) > 1 && increasing(row[1:]) {
+			inColumns = true
+			break
+		}
+	}
+	switch {
+	case inRows && !inColumns:
+		return OrientationRows
+	case inColumns && !inRows:
+		return OrientationColumns
+	}
+	return OrientationUnknown
+}
+
+// increasing reports whether the numeric cells of a row or column are at least three values that strictly increase
+// empty cells are skipped and any other non-numeric cell (e.g. a label) starts the sequence over
+func increasing(cells []string) bool {
+	n := 0
+	var last float64
+	for _, cell := range cells {
+		if cell == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(cell, 64)
+		if err != nil {
+			n = 0
+			continue
+		}
+		if n > 0 && v <= last {
+			return false
+		}
+		last = v
+		n++
+	}
+	return n >= 3
+}
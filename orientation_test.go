@@ -0,0 +1,44 @@
+package excelutil
+
+import "testing"
+
+func TestDetectOrientation(t *testing.T) {
+	tests := []struct {
+		name string
+		rows [][]string
+		want Orientation
+	}{
+		{"time in rows", [][]string{
+			{"Instrument X"},
+			{"Time (sec)", "Well1", "bg"},
+			{"0", "200", "50"},
+			{"2", "190", "50"},
+			{"", "", ""}, // empty cells are skipped
+			{"4", "210", "50"},
+		}, OrientationRows},
+		{"time in columns", [][]string{
+			{"Time (sec)", "0", "2", "4", "6"},
+			{"Well1", "200", "190", "210", "205"},
+			{"bg", "50", "50", "50", "50"},
+		}, OrientationColumns},
+		{"both", [][]string{
+			{"Time (sec)", "1", "2", "3"},
+			{"2", "5", "6", "7"},
+			{"4"},
+			{"6"},
+		}, OrientationUnknown},
+		{"neither", [][]string{
+			{"Time (sec)", "Well1"},
+			{"4", "200"},
+			{"2", "190"},
+			{"0", "210"},
+		}, OrientationUnknown},
+		{"too short", [][]string{{"0", "5"}, {"2", "6"}}, OrientationUnknown},
+		{"empty", nil, OrientationUnknown},
+	}
+	for _, tt := range tests {
+		if got := DetectOrientation(tt.rows); got != tt.want {
+			t.Errorf("%s: DetectOrientation = %q; want %q", tt.name, got, tt.want)
+		}
+	}
+}
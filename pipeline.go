@@ -0,0 +1,111 @@
+package excelutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrSkipSheet is returned by ReadSheet for sheets that cannot be processed (e.g. empty sheets or sheets without start
+// label); the reason was printed already and the sheet should be skipped
+var ErrSkipSheet = errors.New("skipping sheet")
+
+// ReadSheet reads a sheet the way the 'process' subcommand of both programs does: sheets with their time axis in a
+// row are transposed (see --orientation), only --data_range is kept, and the header row is searched with startLabels
+// (templateRow is the start row of --template_sheet or -1), --fallback_start_row, and --header_offset
+// it sets wb.Dims, writes its progress to w, and returns all rows of the sheet and the index of the header row
+// errors of ctx are returned as they are, so that the callers can tell sheets that exceeded --sheet_timeout apart
+func (wb *ExcelWorkbook) ReadSheet(ctx context.Context, w io.Writer, sheet string, o *Options, startLabels []string, templateRow int) ([][]string, int, error) {
+	// sheets that are listed in the workbook but have no rows (e.g. the corrupt files of a crashed instrument) are skipped
+	rows, err := RowsContext(ctx, wb.XLSX, sheet)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(rows) == 0 {
+		fmt.Fprintf(w, "warning: skipping sheet %s (no rows, the sheet might be empty or corrupt)\n", sheet)
+		return nil, 0, ErrSkipSheet
+	}
+
+	// sheets with their time axis in a row are transposed to the default layout (see --orientation)
+	transpose := o.Orientation == "columns"
+	if o.Orientation == "auto" {
+		switch DetectOrientation(rows) {
+		case OrientationColumns:
+			transpose = true
+		case OrientationUnknown:
+			fmt.Fprintf(w, "warning: could not detect the orientation of sheet %s, assuming time in rows\n", sheet)
+		}
+	}
+	if transpose {
+		fmt.Fprintf(w, "transposing sheet %s (time in columns)\n", sheet)
+		if err := TransposeSheetContext(ctx, wb.XLSX, sheet); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	// with --data_range, only that range is read and its first row is the header
+	if o.DataRange != "" {
+		if err := wb.CropSheetContext(ctx, sheet, o.DataRange); err == context.DeadlineExceeded || err == context.Canceled {
+			return nil, 0, err
+		} else if err != nil {
+			return nil, 0, fmt.Errorf("cannot use --data_range=%s for sheet %s: %s", o.DataRange, sheet, err)
+		}
+	}
+
+	// the rows are only read again if the sheet was changed above
+	if transpose || o.DataRange != "" {
+		if rows, err = RowsContext(ctx, wb.XLSX, sheet); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	// populate dimension field of excelWorkbook for the current sheet
+	wb.Dims = [2]int{0, 0}
+	if len(rows) > 0 {
+		wb.Dims = [2]int{len(rows), len(rows[0])}
+	}
+	if _, _, lastRow, lastCol := usedRange(rows); lastRow >= 0 {
+		wb.Dims = [2]int{lastRow + 1, lastCol + 1} // ignore empty padding at the end of the sheet
+	}
+
+	// find the starting index of the actual data matrix
+	if o.StrictStartLabel && o.DataRange == "" {
+		if err := wb.CheckStartLabel(sheet, startLabels); err != nil {
+			return nil, 0, fmt.Errorf("%s (see --strict_start_label)", err)
+		}
+	}
+	id, err := templateRow, error(nil)
+	if o.DataRange != "" {
+		id = 0 // the header is the first row of --data_range
+	} else if templateRow < 0 || !wb.IsStartRow(sheet, templateRow, startLabels) {
+		if templateRow >= 0 {
+			fmt.Fprintf(w, "sheet %s does not share the layout of --template_sheet=%s, searching its start row\n", sheet, o.TemplateSheet)
+		}
+		id, err = wb.StartRowAny(sheet, startLabels)
+	}
+	if err != nil {
+		fmt.Fprintf(w, "error while trying to find data: %s\n", err)
+		if o.FallbackStartRow < 1 {
+			fmt.Fprintf(w, "skipping sheet %s (use --fallback_start_row to specify where the data starts)\n", sheet)
+			return nil, 0, ErrSkipSheet
+		}
+		if o.FallbackStartRow > wb.Dims[0] {
+			return nil, 0, fmt.Errorf("--fallback_start_row=%d exceeds the number of rows (%d) of sheet %s", o.FallbackStartRow, wb.Dims[0], sheet)
+		}
+		id = o.FallbackStartRow - 1
+		fmt.Fprintf(w, "using fallback start row %d instead\n", o.FallbackStartRow)
+	} else {
+		fmt.Fprintf(w, "found ID: %d --> will start here\n", id)
+	}
+
+	// with --header_offset, the header is taken from a row below the start label (the rows in between are skipped)
+	if o.HeaderOffset > 0 {
+		if id+o.HeaderOffset >= wb.Dims[0] {
+			return nil, 0, fmt.Errorf("--header_offset=%d exceeds the number of rows (%d) of sheet %s", o.HeaderOffset, wb.Dims[0], sheet)
+		}
+		id += o.HeaderOffset
+		fmt.Fprintf(w, "using row %d as header (--header_offset=%d)\n", id+1, o.HeaderOffset)
+	}
+	return rows, id, nil
+}
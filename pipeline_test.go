@@ -0,0 +1,158 @@
+package excelutil
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/360EntSecGroup-Skylar/excelize"
+)
+
+// metadataSheet returns a workbook whose 'Sheet1' has two rows of metadata above the start label 'Time (sec)' and two
+// rows of data
+func metadataSheet() *ExcelWorkbook {
+	f := excelize.NewFile()
+	for r, row := range [][]interface{}{
+		{"Instrument X"},
+		{"Protocol Y"},
+		{"Time (sec)", "Well1", "bg"},
+		{"", "well names", ""},
+		{2.0, 200.0, 50.0},
+		{4.0, 201.0, 50.0},
+	} {
+		for c, v := range row {
+			f.SetCellValue("Sheet1", fmt.Sprintf("%s%d", GetColumn(c+1), r+1), v)
+		}
+	}
+	return &ExcelWorkbook{XLSX: f}
+}
+
+func TestReadSheet(t *testing.T) {
+	labels := []string{"Time (sec)"}
+	tests := []struct {
+		name   string
+		args   []string
+		want   int // the index of the header row
+		dims   [2]int
+		header string
+	}{
+		{"start label", nil, 2, [2]int{6, 3}, "Time (sec)"},
+		{"header offset", []string{"--header_offset=1"}, 3, [2]int{6, 3}, ""},
+		{"data range", []string{"--data_range=A3:B6"}, 0, [2]int{4, 2}, "Time (sec)"},
+		{"orientation", []string{"--orientation=columns", "--fallback_start_row=1"}, 0, [2]int{3, 6}, "Instrument X"},
+	}
+	for _, tt := range tests {
+		wb := metadataSheet()
+		rows, id, err := wb.ReadSheet(context.Background(), ioutil.Discard, "Sheet1", parseOptions(t, tt.args...), labels, -1)
+		if err != nil {
+			t.Errorf("%s: ReadSheet returned %v", tt.name, err)
+			continue
+		}
+		if id != tt.want || wb.Dims != tt.dims || rows[id][0] != tt.header {
+			t.Errorf("%s: ReadSheet = header %d (%q) of %v; want header %d (%q) of %v", tt.name, id, rows[id][0], wb.Dims, tt.want, tt.header, tt.dims)
+		}
+	}
+}
+
+func TestReadSheetWithoutStartLabel(t *testing.T) {
+	labels := []string{"Elapsed Time"}
+	wb := metadataSheet()
+	if _, _, err := wb.ReadSheet(context.Background(), ioutil.Discard, "Sheet1", parseOptions(t), labels, -1); err != ErrSkipSheet {
+		t.Errorf("ReadSheet without start label = %v; want %v", err, ErrSkipSheet)
+	}
+	_, id, err := wb.ReadSheet(context.Background(), ioutil.Discard, "Sheet1", parseOptions(t, "--fallback_start_row=3"), labels, -1)
+	if err != nil || id != 2 {
+		t.Errorf("ReadSheet with --fallback_start_row=3 = %d, %v; want 2", id, err)
+	}
+	if _, _, err := wb.ReadSheet(context.Background(), ioutil.Discard, "Sheet1", parseOptions(t, "--fallback_start_row=7"), labels, -1); err == nil || err == ErrSkipSheet {
+		t.Errorf("ReadSheet with --fallback_start_row beyond the sheet = %v; want an error", err)
+	}
+
+	if _, _, err := metadataSheet().ReadSheet(context.Background(), ioutil.Discard, "Sheet1", parseOptions(t, "--header_offset=4"), []string{"Time (sec)"}, -1); err == nil || err == ErrSkipSheet {
+		t.Errorf("ReadSheet with --header_offset beyond the sheet = %v; want an error", err)
+	}
+
+	// the deadline of --sheet_timeout is returned as it is
+	if _, _, err := wb.ReadSheet(&slowContext{context.Background(), 0}, ioutil.Discard, "Sheet1", parseOptions(t), labels, -1); err != context.DeadlineExceeded {
+		t.Errorf("ReadSheet of a slow sheet = %v; want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestOpenReader(t *testing.T) {
+	buf := new(bytes.Buffer)
+	if err := metadataSheet().XLSX.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	wb, err := OpenReader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wb.NumSheets != 1 || len(wb.SheetNames) != 1 || wb.SheetNames[0] != "Sheet1" {
+		t.Fatalf("OpenReader = %d sheets %v; want Sheet1", wb.NumSheets, wb.SheetNames)
+	}
+
+	// the workbook is read like one that was opened from a file
+	rows, id, err := wb.ReadSheet(context.Background(), ioutil.Discard, "Sheet1", parseOptions(t), []string{"Time (sec)"}, -1)
+	if err != nil || id != 2 || len(rows) != 6 || rows[5][1] != "201" {
+		t.Errorf("ReadSheet of a workbook from a reader = header %d of %q, %v; want header 2 of 6 rows", id, rows, err)
+	}
+
+	if _, err := OpenReader(bytes.NewBufferString("not a workbook")); err == nil {
+		t.Error("OpenReader of invalid data = nil error; want an error")
+	}
+}
+
+func TestReadSheetWithoutRows(t *testing.T) {
+	// the part of Plate2 is corrupt, so excelize returns no rows although the sheet is listed in the workbook
+	wb := metadataSheet()
+	wb.XLSX.NewSheet("Plate2")
+	wb.XLSX.SetCellValue("Plate2", "A1", "Time (sec)")
+	delete(wb.XLSX.Sheet, "xl/worksheets/sheet2.xml")
+	wb.XLSX.XLSX["xl/worksheets/sheet2.xml"] = []byte("<worksheet><sheetData><row")
+	wb.GetSheetNames()
+	if wb.NumSheets != 2 {
+		t.Fatalf("workbook has sheets %v; want Sheet1 and Plate2", wb.SheetNames)
+	}
+
+	if d := wb.Dimensions("Plate2"); d != [2]int{0, 0} {
+		t.Errorf("Dimensions of a sheet without rows = %v; want [0 0]", d)
+	}
+	if firstRow, _, lastRow, _ := wb.UsedRange("Plate2"); firstRow != -1 || lastRow != -1 {
+		t.Errorf("UsedRange of a sheet without rows = %d, %d; want -1", firstRow, lastRow)
+	}
+	var out bytes.Buffer
+	if _, _, err := wb.ReadSheet(context.Background(), &out, "Plate2", parseOptions(t, "--fallback_start_row=1"), []string{"Time (sec)"}, -1); err != ErrSkipSheet {
+		t.Errorf("ReadSheet of a sheet without rows = %v; want %v", err, ErrSkipSheet)
+	}
+	if want := "warning: skipping sheet Plate2 (no rows, the sheet might be empty or corrupt)\n"; out.String() != want {
+		t.Errorf("ReadSheet printed %q; want %q", out.String(), want)
+	}
+
+	// the other sheets are read as usual
+	if _, id, err := wb.ReadSheet(context.Background(), ioutil.Discard, "Sheet1", parseOptions(t), []string{"Time (sec)"}, -1); err != nil || id != 2 {
+		t.Errorf("ReadSheet of Sheet1 = %d, %v; want 2", id, err)
+	}
+}
+
+func TestReadSheetTemplateRow(t *testing.T) {
+	labels := []string{"Time (sec)"}
+	o := parseOptions(t, "--template_sheet=Plate1")
+
+	// a template row with a start label is used as it is
+	var log bytes.Buffer
+	if _, id, err := metadataSheet().ReadSheet(context.Background(), &log, "Sheet1", o, labels, 2); err != nil || id != 2 || strings.Contains(log.String(), "does not share") {
+		t.Errorf("ReadSheet with a matching template row = %d, %v (%q); want 2 without a search", id, err, log.String())
+	}
+
+	// other sheets are searched as usual
+	log.Reset()
+	if _, id, err := metadataSheet().ReadSheet(context.Background(), &log, "Sheet1", o, labels, 0); err != nil || id != 2 {
+		t.Errorf("ReadSheet with a deviating template row = %d, %v; want 2", id, err)
+	}
+	if want := "sheet Sheet1 does not share the layout of --template_sheet=Plate1, searching its start row\n"; !strings.HasPrefix(log.String(), want) {
+		t.Errorf("ReadSheet printed %q; want it to start with %q", log.String(), want)
+	}
+}
@@ -0,0 +1,308 @@
+package excelutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/360EntSecGroup-Skylar/excelize"
+)
+
+// chartColors are used for the series of a chart in turn
+var chartColors = []color.RGBA{
+	{31, 119, 180, 255},
+	{255, 127, 14, 255},
+	{44, 160, 44, 255},
+	{214, 39, 40, 255},
+	{148, 103, 189, 255},
+	{140, 86, 75, 255},
+	{227, 119, 194, 255},
+	{127, 127, 127, 255},
+	{188, 189, 34, 255},
+	{23, 190, 207, 255},
+}
+
+// the space (in pixels) between the border of a chart and its axes; the left and bottom margins hold the tick labels
+const (
+	chartMarginLeft   = 60
+	chartMarginRight  = 20
+	chartMarginTop    = 20
+	chartMarginBottom = 30
+)
+
+// chartTicks is the number of intervals between the ticks of both axes
+const chartTicks = 4
+
+// WriteLineChartPNG renders every series as a line (x is the number of a measurement, y its value) into a PNG image
+// with ticks and tick labels on both axes and a legend that names every series by its label (series without a label
+// are numbered); the text is drawn with a small built-in font, since the standard library cannot render text, and
+// NaN values interrupt a line
+func WriteLineChartPNG(w io.Writer, series [][]float64, labels []string, width, height int) error {
+	if width <= chartMarginLeft+chartMarginRight || height <= chartMarginTop+chartMarginBottom {
+		return fmt.Errorf("chart size %dx%d is too small", width, height)
+	}
+
+	// find the range of both axes
+	lo, hi, n := math.Inf(1), math.Inf(-1), 0
+	for _, s := range series {
+		if len(s) > n {
+			n = len(s)
+		}
+		for _, v := range s {
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				continue
+			}
+			lo = math.Min(lo, v)
+			hi = math.Max(hi, v)
+		}
+	}
+	if math.IsInf(lo, 1) {
+		return fmt.Errorf("no values to plot")
+	}
+	if hi == lo {
+		lo, hi = lo-1, hi+1
+	}
+	if n < 2 {
+		n = 2
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.Set(x, y, color.White)
+		}
+	}
+
+	// map a value to pixel coordinates (the y axis of an image points down)
+	left, right, top, bottom := chartMarginLeft, width-chartMarginRight, chartMarginTop, height-chartMarginBottom
+	px := func(i int) int {
+		return left + i*(right-left)/(n-1)
+	}
+	py := func(v float64) int {
+		return bottom - int((v-lo)/(hi-lo)*float64(bottom-top))
+	}
+
+	// draw axes with ticks and their labels (the measurements are numbered from 1 like the rows of the ratios)
+	drawLine(img, left, bottom, right, bottom, color.Black)
+	drawLine(img, left, top, left, bottom, color.Black)
+	for k := 0; k <= chartTicks; k++ {
+		v := lo + float64(k)*(hi-lo)/chartTicks
+		label := strconv.FormatFloat(v, 'g', 3, 64)
+		drawLine(img, left-4, py(v), left, py(v), color.Black)
+		drawText(img, left-6-textWidth(label), py(v)-glyphHeight/2, label, color.Black)
+
+		i := k * (n - 1) / chartTicks
+		label = strconv.Itoa(i + 1)
+		drawLine(img, px(i), bottom, px(i), bottom+4, color.Black)
+		drawText(img, px(i)-textWidth(label)/2, bottom+8, label, color.Black)
+	}
+
+	// draw series
+	for k, s := range series {
+		c := chartColors[k%len(chartColors)]
+		for i := 1; i < len(s); i++ {
+			if math.IsNaN(s[i-1]) || math.IsNaN(s[i]) || math.IsInf(s[i-1], 0) || math.IsInf(s[i], 0) {
+				continue
+			}
+			drawLine(img, px(i-1), py(s[i-1]), px(i), py(s[i]), c)
+		}
+	}
+
+	// draw the legend into the upper right corner of the chart, with a line in the color of every series and its label
+	names := make([]string, len(series))
+	boxWidth := 0
+	for k := range series {
+		names[k] = strconv.Itoa(k + 1)
+		if k < len(labels) && labels[k] != "" {
+			names[k] = labels[k]
+		}
+		if w := textWidth(names[k]); w > boxWidth {
+			boxWidth = w
+		}
+	}
+	if len(series) > 0 {
+		const swatch, lineHeight = 16, glyphHeight + 4
+		x0, y0 := right-boxWidth-swatch-16, top+4
+		x1, y1 := right-4, y0+len(series)*lineHeight+4
+		for x := x0; x <= x1; x++ {
+			for y := y0; y <= y1; y++ {
+				img.Set(x, y, color.White)
+			}
+		}
+		drawLine(img, x0, y0, x1, y0, color.Black)
+		drawLine(img, x0, y1, x1, y1, color.Black)
+		drawLine(img, x0, y0, x0, y1, color.Black)
+		drawLine(img, x1, y0, x1, y1, color.Black)
+		for k := range series {
+			y := y0 + 4 + k*lineHeight
+			c := chartColors[k%len(chartColors)]
+			for dy := -1; dy <= 1; dy++ {
+				drawLine(img, x0+4, y+glyphHeight/2+dy, x0+4+swatch, y+glyphHeight/2+dy, c)
+			}
+			drawText(img, x0+8+swatch, y, names[k], color.Black)
+		}
+	}
+	return png.Encode(w, img)
+}
+
+// glyphs is a font of 3x5 pixels for the text of PNG charts: every row of a glyph is a bit mask whose bit 4 is its left
+// pixel; lower-case letters are drawn as upper-case ones and characters without a glyph as blanks
+var glyphs = map[rune][5]uint8{
+	'0': {7, 5, 5, 5, 7}, '1': {2, 6, 2, 2, 7}, '2': {7, 1, 7, 4, 7}, '3': {7, 1, 7, 1, 7}, '4': {5, 5, 7, 1, 1},
+	'5': {7, 4, 7, 1, 7}, '6': {7, 4, 7, 5, 7}, '7': {7, 1, 1, 1, 1}, '8': {7, 5, 7, 5, 7}, '9': {7, 5, 7, 1, 7},
+	'A': {2, 5, 7, 5, 5}, 'B': {6, 5, 6, 5, 6}, 'C': {3, 4, 4, 4, 3}, 'D': {6, 5, 5, 5, 6}, 'E': {7, 4, 6, 4, 7},
+	'F': {7, 4, 6, 4, 4}, 'G': {3, 4, 5, 5, 3}, 'H': {5, 5, 7, 5, 5}, 'I': {7, 2, 2, 2, 7}, 'J': {1, 1, 1, 5, 2},
+	'K': {5, 5, 6, 5, 5}, 'L': {4, 4, 4, 4, 7}, 'M': {5, 7, 7, 5, 5}, 'N': {6, 5, 5, 5, 5}, 'O': {2, 5, 5, 5, 2},
+	'P': {6, 5, 6, 4, 4}, 'Q': {2, 5, 5, 6, 3}, 'R': {6, 5, 6, 5, 5}, 'S': {3, 4, 2, 1, 6}, 'T': {7, 2, 2, 2, 2},
+	'U': {5, 5, 5, 5, 7}, 'V': {5, 5, 5, 5, 2}, 'W': {5, 5, 7, 7, 5}, 'X': {5, 5, 2, 5, 5}, 'Y': {5, 5, 2, 2, 2},
+	'Z': {7, 1, 2, 4, 7}, '.': {0, 0, 0, 0, 2}, '-': {0, 0, 7, 0, 0}, '+': {0, 2, 7, 2, 0}, '(': {1, 2, 2, 2, 1},
+	')': {4, 2, 2, 2, 4}, '/': {1, 1, 2, 4, 4}, ':': {0, 2, 0, 2, 0}, '_': {0, 0, 0, 0, 7},
+}
+
+// the glyphs are drawn with 2x2 pixels per font pixel and one blank font pixel between two glyphs
+const (
+	glyphScale   = 2
+	glyphAdvance = 4 * glyphScale
+	glyphHeight  = 5 * glyphScale
+)
+
+// textWidth returns the width (in pixels) of s drawn by drawText
+func textWidth(s string) int {
+	return len([]rune(s)) * glyphAdvance
+}
+
+// drawText draws s with the built-in font such that its upper left corner is at (x, y)
+func drawText(img *image.RGBA, x, y int, s string, c color.Color) {
+	for _, r := range strings.ToUpper(s) {
+		for row, mask := range glyphs[r] {
+			for col := 0; col < 3; col++ {
+				if mask&(4>>uint(col)) == 0 {
+					continue
+				}
+				for dx := 0; dx < glyphScale; dx++ {
+					for dy := 0; dy < glyphScale; dy++ {
+						img.Set(x+col*glyphScale+dx, y+row*glyphScale+dy, c)
+					}
+				}
+			}
+		}
+		x += glyphAdvance
+	}
+}
+
+// drawLine draws a line from (x0, y0) to (x1, y1) using Bresenham's algorithm
+func drawLine(img *image.RGBA, x0, y0, x1, y1 int, c color.Color) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	e := dx + dy
+	for {
+		img.Set(x0, y0, c)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		e2 := 2 * e
+		if e2 >= dy {
+			e += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			e += dx
+			y0 += sy
+		}
+	}
+}
+
+// abs returns the absolute value of an integer
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// GradientColor returns the color (as hex string, e.g. "1F77B4") of the i-th of n series of an overlay chart; the colors
+// run from blue (first series) to red (last series)
+func GradientColor(i, n int) string {
+	from, to := chartColors[0], chartColors[3]
+	t := 0.0
+	if n > 1 {
+		t = float64(i) / float64(n-1)
+	}
+	mix := func(a, b uint8) uint8 {
+		return uint8(math.Round(float64(a) + t*(float64(b)-float64(a))))
+	}
+	return fmt.Sprintf("%02X%02X%02X", mix(from.R, to.R), mix(from.G, to.G), mix(from.B, to.B))
+}
+
+// OverlayChart returns the settings (see excelize's AddChart) of a line chart with one series per column of a block of
+// data on sheet: the block has a header row and rows measurements below it, and its first column and row (1-based)
+// are col and row; only the first maxSeries columns are plotted, which keeps large plates from producing charts that
+// Excel refuses to open
+func OverlayChart(sheet string, col, row, columns, rows, maxSeries int) string {
+	type series struct {
+		Name   string `json:"name"`
+		Values string `json:"values"`
+	}
+	if columns > maxSeries {
+		columns = maxSeries
+	}
+	quoted := "'" + strings.Replace(sheet, "'", "''", -1) + "'"
+	settings := struct {
+		Type      string         `json:"type"`
+		Dimension map[string]int `json:"dimension"`
+		Series    []series       `json:"series"`
+		Legend    struct {
+			Position string `json:"position"`
+		} `json:"legend"`
+		Title struct {
+			Name string `json:"name"`
+		} `json:"title"`
+	}{Type: "line", Dimension: map[string]int{"width": 1040, "height": 640}}
+	for c := 0; c < columns; c++ {
+		name := GetColumn(col + c)
+		settings.Series = append(settings.Series, series{
+			Name:   fmt.Sprintf("%s!$%s$%d", quoted, name, row),
+			Values: fmt.Sprintf("%s!$%s$%d:$%s$%d", quoted, name, row+1, name, row+rows),
+		})
+	}
+	settings.Legend.Position = "right"
+	settings.Title.Name = fmt.Sprintf("Response Profiles (%s)", sheet)
+	b, _ := json.Marshal(settings) // cannot fail for these types
+	return string(b)
+}
+
+// AddOverlayChart adds a chart with the given settings (see OverlayChart) to cell of sheet and colors its series with
+// GradientColor; excelize ignores the colors of series and only knows the 6 accent colors of the default theme, so the
+// colors are replaced in the XML of the chart
+func AddOverlayChart(f *excelize.File, sheet, cell, settings string) error {
+	if err := f.AddChart(sheet, cell, settings); err != nil {
+		return err
+	}
+	charts := 0
+	for name := range f.XLSX {
+		if strings.HasPrefix(name, "xl/charts/chart") {
+			charts++
+		}
+	}
+	name := fmt.Sprintf("xl/charts/chart%d.xml", charts) // excelize numbers the charts in the order they are added
+	chart := string(f.XLSX[name])
+	n := strings.Count(chart, "<c:ser>")
+	for i := 0; i < n; i++ {
+		chart = strings.Replace(chart, fmt.Sprintf(`<a:schemeClr val="accent%d"></a:schemeClr>`, i+1),
+			fmt.Sprintf(`<a:srgbClr val="%s"></a:srgbClr>`, GradientColor(i, n)), 1)
+	}
+	f.XLSX[name] = []byte(chart)
+	return nil
+}
@@ -0,0 +1,155 @@
+package excelutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/360EntSecGroup-Skylar/excelize"
+)
+
+func TestWriteLineChartPNG(t *testing.T) {
+	series := [][]float64{{1, 2, 3, 2, 1}, {0.5, math.NaN(), 1.5, 2.5, 3}}
+	var buf bytes.Buffer
+	if err := WriteLineChartPNG(&buf, series, []string{"cell 1"}, 200, 100); err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatalf("chart is not a PNG image: %s", err)
+	}
+	if size := img.Bounds().Size(); size.X != 200 || size.Y != 100 {
+		t.Errorf("chart is %dx%d; want 200x100", size.X, size.Y)
+	}
+
+	// both series are drawn in their colors
+	found := make(map[color.RGBA]bool)
+	for x := 0; x < 200; x++ {
+		for y := 0; y < 100; y++ {
+			r, g, b, a := img.At(x, y).RGBA()
+			found[color.RGBA{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8), uint8(a >> 8)}] = true
+		}
+	}
+	for k := range series {
+		if !found[chartColors[k]] {
+			t.Errorf("chart does not show series %d", k)
+		}
+	}
+
+	// the tick labels are drawn left of the y axis and below the x axis
+	black := func(x0, y0, x1, y1 int) bool {
+		for x := x0; x < x1; x++ {
+			for y := y0; y < y1; y++ {
+				if r, g, b, _ := img.At(x, y).RGBA(); r == 0 && g == 0 && b == 0 {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	if !black(0, 0, chartMarginLeft-5, 100) {
+		t.Error("chart has no labels on the y axis")
+	}
+	if !black(0, 100-chartMarginBottom+5, 200, 100) {
+		t.Error("chart has no labels on the x axis")
+	}
+
+	// the legend in the upper right corner names the first series by its label and numbers the second one
+	x0 := 200 - chartMarginRight - textWidth("cell 1") - 32
+	for k, name := range []string{"cell 1", "2"} {
+		y := chartMarginTop + 8 + k*(glyphHeight+4)
+		text := image.NewRGBA(image.Rect(0, 0, textWidth(name), glyphHeight))
+		drawText(text, 0, 0, name, color.Black)
+		for x := 0; x < textWidth(name); x++ {
+			for dy := 0; dy < glyphHeight; dy++ {
+				if _, _, _, a := text.At(x, dy).RGBA(); a == 0 {
+					continue
+				}
+				if r, g, b, _ := img.At(x0+24+x, y+dy).RGBA(); r != 0 || g != 0 || b != 0 {
+					t.Fatalf("legend does not show %q at [%d %d]", name, x0+24+x, y+dy)
+				}
+			}
+		}
+		if got := img.At(x0+8, y+glyphHeight/2); got != chartColors[k] {
+			t.Errorf("legend shows series %d in %v; want %v", k, got, chartColors[k])
+		}
+	}
+
+	if err := WriteLineChartPNG(&buf, series, nil, 50, 50); err == nil {
+		t.Errorf("chart of 50x50 pixels was written; want an error because of the margins")
+	}
+}
+
+func TestGradientColor(t *testing.T) {
+	tests := []struct {
+		i, n int
+		want string
+	}{
+		{0, 3, "1F77B4"}, // blue
+		{1, 3, "7B4F6E"},
+		{2, 3, "D62728"}, // red
+		{0, 1, "1F77B4"},
+	}
+	for _, tt := range tests {
+		if got := GradientColor(tt.i, tt.n); got != tt.want {
+			t.Errorf("GradientColor(%d, %d) = %s; want %s", tt.i, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestOverlayChart(t *testing.T) {
+	var settings struct {
+		Type   string
+		Series []struct{ Name, Values string }
+		Title  struct{ Name string }
+	}
+	// a block of 3 columns with 20 measurements at B3, of which only 2 columns are plotted
+	if err := json.Unmarshal([]byte(OverlayChart("Bob's plate", 2, 3, 3, 20, 2)), &settings); err != nil {
+		t.Fatal(err)
+	}
+	if settings.Type != "line" || len(settings.Series) != 2 || settings.Title.Name != "Response Profiles (Bob's plate)" {
+		t.Fatalf("OverlayChart = %+v; want a line chart with 2 series", settings)
+	}
+	if s := settings.Series[1]; s.Name != "'Bob''s plate'!$C$3" || s.Values != "'Bob''s plate'!$C$4:$C$23" {
+		t.Errorf("second series = %+v; want the header and the values of column C", s)
+	}
+	if err := json.Unmarshal([]byte(OverlayChart("Plate1", 1, 1, 3, 20, 50)), &settings); err != nil || len(settings.Series) != 3 {
+		t.Errorf("OverlayChart with a large maximum has %d series (%v); want 3", len(settings.Series), err)
+	}
+}
+
+func TestAddOverlayChart(t *testing.T) {
+	f := excelize.NewFile()
+	f.NewSheet("Plate2")
+	if err := AddOverlayChart(f, "Sheet1", "E2", OverlayChart("Sheet1", 1, 1, 3, 5, 10)); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddOverlayChart(f, "Plate2", "E2", OverlayChart("Plate2", 1, 1, 2, 5, 10)); err != nil {
+		t.Fatal(err)
+	}
+
+	// every series of a chart gets its color of the gradient, and a later chart does not change an earlier one
+	seriesColor := regexp.MustCompile(`<c:ser>.*?<a:srgbClr val="([0-9A-F]{6})">`)
+	for name, want := range map[string][]string{
+		"xl/charts/chart1.xml": {"1F77B4", "7B4F6E", "D62728"},
+		"xl/charts/chart2.xml": {"1F77B4", "D62728"},
+	} {
+		chart := string(f.XLSX[name])
+		got := make([]string, 0)
+		for _, m := range seriesColor.FindAllStringSubmatch(chart, -1) {
+			got = append(got, m[1])
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("series colors of %s = %v; want %v", name, got, want)
+		}
+		if regexp.MustCompile(`<c:ser>.*?schemeClr val="accent`).MatchString(chart) {
+			t.Errorf("%s still colors a series with a theme color", name)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package excelutil
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+// StartProfiles starts a CPU profile that is written to cpuPath (see runtime/pprof); the returned function stops it and
+// writes a heap profile to memPath, so it should be deferred until the end of the run; empty paths disable the profiles
+func StartProfiles(cpuPath, memPath string) (func() error, error) {
+	var cpu *os.File
+	if cpuPath != "" {
+		var err error
+		if cpu, err = os.Create(cpuPath); err != nil {
+			return nil, fmt.Errorf("cannot create cpu profile: %s", err)
+		}
+		if err := pprof.StartCPUProfile(cpu); err != nil {
+			cpu.Close()
+			return nil, fmt.Errorf("cannot start cpu profile: %s", err)
+		}
+	}
+	stop := func() error {
+		if cpu != nil {
+			pprof.StopCPUProfile()
+			if err := cpu.Close(); err != nil {
+				return fmt.Errorf("cannot write cpu profile: %s", err)
+			}
+		}
+		if memPath == "" {
+			return nil
+		}
+		mem, err := os.Create(memPath)
+		if err != nil {
+			return fmt.Errorf("cannot create memory profile: %s", err)
+		}
+		defer mem.Close()
+		runtime.GC() // get up-to-date statistics of the live heap
+		if err := pprof.WriteHeapProfile(mem); err != nil {
+			return fmt.Errorf("cannot write memory profile: %s", err)
+		}
+		return nil
+	}
+	return stop, nil
+}
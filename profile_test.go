@@ -0,0 +1,45 @@
+package excelutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStartProfiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "excelutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cpuPath, memPath := filepath.Join(dir, "cpu.prof"), filepath.Join(dir, "mem.prof")
+	stop, err := StartProfiles(cpuPath, memPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stop(); err != nil {
+		t.Fatalf("stop = %v; want nil", err)
+	}
+	for _, path := range []string{cpuPath, memPath} {
+		if info, err := os.Stat(path); err != nil || info.Size() == 0 {
+			t.Errorf("profile %s was not written (%v)", filepath.Base(path), err)
+		}
+	}
+
+	// without paths nothing is profiled
+	stop, err = StartProfiles("", "")
+	if err != nil || stop() != nil {
+		t.Errorf("StartProfiles without paths failed: %v", err)
+	}
+
+	missing := filepath.Join(dir, "missing", "cpu.prof")
+	if _, err := StartProfiles(missing, ""); err == nil {
+		t.Error("StartProfiles with a cpu profile in a missing directory = nil error; want an error")
+	}
+	stop, err = StartProfiles("", filepath.Join(dir, "missing", "mem.prof"))
+	if err != nil || stop() == nil {
+		t.Errorf("stop with a memory profile in a missing directory = nil error; want an error")
+	}
+}
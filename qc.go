@@ -0,0 +1,108 @@
+package excelutil
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// QCCriteria are the thresholds of QCEvaluate; a negative threshold disables its criterion
+type QCCriteria struct {
+	MinSNR   float64 // minimum signal-to-noise ratio of the top column
+	MaxDrift float64 // maximum absolute baseline drift of the top column
+	MaxEmpty int     // maximum number of empty (NaN) ratios of the sheet
+}
+
+// Enabled reports whether any criterion is enabled
+func (c QCCriteria) Enabled() bool {
+	return c.MinSNR >= 0 || c.MaxDrift >= 0 || c.MaxEmpty >= 0
+}
+
+// QCEvaluate checks the metrics of a processed sheet against criteria and returns whether the sheet passes
+// and the reasons of every failed criterion; unknown (NaN) metrics fail an enabled criterion
+func QCEvaluate(result SheetSummary, criteria QCCriteria) (bool, []string) {
+	reasons := make([]string, 0)
+	if criteria.MinSNR >= 0 && (math.IsNaN(result.SNR) || result.SNR < criteria.MinSNR) {
+		reasons = append(reasons, fmt.Sprintf("SNR %.3g is below %g", result.SNR, criteria.MinSNR))
+	}
+	if criteria.MaxDrift >= 0 && (math.IsNaN(result.Drift) || math.Abs(result.Drift) > criteria.MaxDrift) {
+		reasons = append(reasons, fmt.Sprintf("baseline drift %.3g exceeds %g", result.Drift, criteria.MaxDrift))
+	}
+	if criteria.MaxEmpty >= 0 && result.Empty > criteria.MaxEmpty {
+		reasons = append(reasons, fmt.Sprintf("%d empty values exceed %d", result.Empty, criteria.MaxEmpty))
+	}
+	return len(reasons) == 0, reasons
+}
+
+// ColumnQuality counts the cells of a column below its header that cannot be used for the analysis
+type ColumnQuality struct {
+	Header     string
+	Cells      int // number of cells below the header (missing cells of ragged rows included)
+	Empty      int // empty (or whitespace-only) cells, including missing cells
+	NonNumeric int // cells that cannot be parsed as a number (e.g. "n/a" or "#DIV/0!")
+	NonFinite  int // numbers that are NaN or infinite (e.g. "NaN", "Inf", or "1e999")
+}
+
+// QualityReport is the result of DataQuality for a sheet; Total holds the counts of all columns together
+type QualityReport struct {
+	Columns []ColumnQuality
+	Total   ColumnQuality
+}
+
+// DataQuality counts the empty, non-numeric, and non-finite cells of every column of rows, whose first row is the header
+// (like SheetData); the header row itself is not counted
+func DataQuality(rows [][]string) QualityReport {
+	report := QualityReport{Columns: []ColumnQuality{}}
+	if len(rows) == 0 {
+		return report
+	}
+	for c, header := range rows[0] {
+		col := ColumnQuality{Header: header}
+		for r := 1; r < len(rows); r++ {
+			col.Cells++
+			cell := ""
+			if c < len(rows[r]) {
+				cell = strings.TrimSpace(rows[r][c])
+			}
+			if cell == "" {
+				col.Empty++
+				continue
+			}
+			v, err := strconv.ParseFloat(cell, 64)
+			if err != nil {
+				// out-of-range numbers are parsed as +-Inf (or as 0 if they are too small, which is fine)
+				if ne, ok := err.(*strconv.NumError); !ok || ne.Err != strconv.ErrRange {
+					col.NonNumeric++
+					continue
+				}
+			}
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				col.NonFinite++
+			}
+		}
+		report.Columns = append(report.Columns, col)
+		report.Total.Cells += col.Cells
+		report.Total.Empty += col.Empty
+		report.Total.NonNumeric += col.NonNumeric
+		report.Total.NonFinite += col.NonFinite
+	}
+	return report
+}
+
+// QualityHeader is the header of the records of QualityReport.Records
+var QualityHeader = []string{"sheet", "column", "header", "cells", "empty", "non_numeric", "non_finite"}
+
+// Records returns one record per column (with its 1-based index) and a last record with the totals of the sheet
+// (with the column "all"), e.g. to write them to a .csv file with WriteRecords
+func (q QualityReport) Records(sheet string) [][]string {
+	record := func(column string, col ColumnQuality) []string {
+		return []string{sheet, column, col.Header, strconv.Itoa(col.Cells), strconv.Itoa(col.Empty),
+			strconv.Itoa(col.NonNumeric), strconv.Itoa(col.NonFinite)}
+	}
+	records := make([][]string, 0, len(q.Columns)+1)
+	for c, col := range q.Columns {
+		records = append(records, record(strconv.Itoa(c+1), col))
+	}
+	return append(records, record("all", q.Total))
+}
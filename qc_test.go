@@ -0,0 +1,81 @@
+package excelutil
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestQCEvaluate(t *testing.T) {
+	good := SheetSummary{Sheet: "Plate1", SNR: 12, Drift: -0.05, Empty: 1}
+	all := QCCriteria{MinSNR: 5, MaxDrift: 0.1, MaxEmpty: 2}
+	if pass, reasons := QCEvaluate(good, all); !pass || len(reasons) != 0 {
+		t.Errorf("QCEvaluate of a good sheet = %v, %q; want a pass", pass, reasons)
+	}
+
+	bad := SheetSummary{Sheet: "Plate2", SNR: 2, Drift: -0.25, Empty: 3}
+	tests := []struct {
+		name     string
+		criteria QCCriteria
+		want     []string
+	}{
+		{"all", all, []string{"SNR 2 is below 5", "baseline drift -0.25 exceeds 0.1", "3 empty values exceed 2"}},
+		{"SNR", QCCriteria{MinSNR: 5, MaxDrift: -1, MaxEmpty: -1}, []string{"SNR 2 is below 5"}},
+		{"drift", QCCriteria{MinSNR: -1, MaxDrift: 0.3, MaxEmpty: 2}, []string{"3 empty values exceed 2"}},
+		{"disabled", QCCriteria{MinSNR: -1, MaxDrift: -1, MaxEmpty: -1}, []string{}},
+	}
+	for _, tt := range tests {
+		pass, reasons := QCEvaluate(bad, tt.criteria)
+		if pass != (len(tt.want) == 0) || !reflect.DeepEqual(reasons, tt.want) {
+			t.Errorf("%s: QCEvaluate = %v, %q; want %q", tt.name, pass, reasons, tt.want)
+		}
+	}
+
+	// unknown metrics fail an enabled criterion
+	unknown := SheetSummary{Sheet: "Plate3", SNR: math.NaN(), Drift: math.NaN()}
+	if pass, reasons := QCEvaluate(unknown, all); pass || len(reasons) != 2 {
+		t.Errorf("QCEvaluate of unknown metrics = %v, %q; want two failed criteria", pass, reasons)
+	}
+	if (QCCriteria{MinSNR: -1, MaxDrift: -1, MaxEmpty: -1}).Enabled() || !(QCCriteria{MinSNR: -1, MaxDrift: -1, MaxEmpty: 0}).Enabled() {
+		t.Error("Enabled does not report the criteria that are enabled")
+	}
+}
+
+func TestDataQuality(t *testing.T) {
+	rows := [][]string{
+		{"Time (sec)", "Well1 340", "Well1 380"},
+		{"2", "200", " "},
+		{"4", "n/a", "Inf"},
+		{"6", "1e999"}, // out of range and short
+	}
+	report := DataQuality(rows)
+	want := QualityReport{
+		Columns: []ColumnQuality{
+			{Header: "Time (sec)", Cells: 3},
+			{Header: "Well1 340", Cells: 3, NonNumeric: 1, NonFinite: 1},
+			{Header: "Well1 380", Cells: 3, Empty: 2, NonFinite: 1},
+		},
+		Total: ColumnQuality{Cells: 9, Empty: 2, NonNumeric: 1, NonFinite: 2},
+	}
+	if !reflect.DeepEqual(report, want) {
+		t.Errorf("DataQuality = %+v; want %+v", report, want)
+	}
+
+	records := report.Records("Plate1")
+	wantRecords := [][]string{
+		{"Plate1", "1", "Time (sec)", "3", "0", "0", "0"},
+		{"Plate1", "2", "Well1 340", "3", "0", "1", "1"},
+		{"Plate1", "3", "Well1 380", "3", "2", "0", "1"},
+		{"Plate1", "all", "", "9", "2", "1", "2"},
+	}
+	if !reflect.DeepEqual(records, wantRecords) {
+		t.Errorf("Records = %q; want %q", records, wantRecords)
+	}
+	if len(QualityHeader) != len(records[0]) {
+		t.Errorf("QualityHeader has %d columns; the records have %d", len(QualityHeader), len(records[0]))
+	}
+
+	if got := DataQuality(nil); len(got.Columns) != 0 || got.Total != (ColumnQuality{}) {
+		t.Errorf("DataQuality(nil) = %+v; want an empty report", got)
+	}
+}
@@ -0,0 +1,18 @@
+package excelutil
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Rand is the source of randomness that every stochastic operation of this package has to use
+// (instead of the global functions of math/rand) so that results are reproducible; it is time-seeded by default
+var Rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+// Seed re-seeds Rand; a seed of 0 means that the current time is used as seed (which is the default)
+func Seed(seed int64) {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	Rand = rand.New(rand.NewSource(seed))
+}
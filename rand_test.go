@@ -0,0 +1,28 @@
+package excelutil
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSeed(t *testing.T) {
+	draw := func() []int64 {
+		values := make([]int64, 5)
+		for i := range values {
+			values[i] = Rand.Int63()
+		}
+		return values
+	}
+
+	// the same seed yields the same values, a different one different values
+	Seed(42)
+	first := draw()
+	Seed(42)
+	if second := draw(); !reflect.DeepEqual(first, second) {
+		t.Errorf("values after Seed(42) = %v and %v; want the same values", first, second)
+	}
+	Seed(43)
+	if other := draw(); reflect.DeepEqual(first, other) {
+		t.Errorf("values after Seed(43) = %v; want other values than after Seed(42)", other)
+	}
+}
@@ -0,0 +1,65 @@
+package excelutil
+
+import (
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/360EntSecGroup-Skylar/excelize"
+)
+
+// openFile opens an .xlsx file and checkComplete is CheckComplete; they are variables so that OpenFileRetry can be
+// exercised with failing opens and checks
+var (
+	openFile      = excelize.OpenFile
+	checkComplete = CheckComplete
+)
+
+// IsTransient reports whether err is an I/O error that might not occur again (e.g. a hiccup of a network drive);
+// missing files, missing permissions, and files that are no valid workbooks are never transient
+func IsTransient(err error) bool {
+	switch e := err.(type) {
+	case *os.PathError:
+		if os.IsNotExist(e) || os.IsPermission(e) {
+			return false
+		}
+		return IsTransient(e.Err)
+	case *os.SyscallError:
+		return IsTransient(e.Err)
+	case *IncompleteError:
+		return IsTransient(e.Err)
+	case syscall.Errno:
+		switch e {
+		case syscall.EIO, syscall.EAGAIN, syscall.EINTR, syscall.EBUSY, syscall.ETIMEDOUT, syscall.ESTALE, syscall.ECONNRESET:
+			return true
+		}
+	}
+	return false
+}
+
+// retry calls fn and calls it again up to retries times (waiting delay before every attempt) as long as it fails with
+// a transient error (see IsTransient); the error of the last attempt is returned
+func retry(retries int, delay time.Duration, fn func() error) error {
+	err := fn()
+	for attempt := 0; err != nil && attempt < retries && IsTransient(err); attempt++ {
+		time.Sleep(delay)
+		err = fn()
+	}
+	return err
+}
+
+// OpenFileRetry checks that an .xlsx file is complete (see CheckComplete) and opens it; both steps are tried again up
+// to retries times (waiting delay before every attempt) as long as one of them fails with a transient error (see
+// IsTransient); the error of the last attempt is returned
+func OpenFileRetry(name string, retries int, delay time.Duration) (*excelize.File, error) {
+	var xlsx *excelize.File
+	err := retry(retries, delay, func() error {
+		if err := checkComplete(name); err != nil {
+			return err
+		}
+		var err error
+		xlsx, err = openFile(name)
+		return err
+	})
+	return xlsx, err
+}
@@ -0,0 +1,93 @@
+package excelutil
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/360EntSecGroup-Skylar/excelize"
+)
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&os.PathError{Op: "open", Path: "in.xlsx", Err: syscall.EIO}, true},
+		{&os.PathError{Op: "read", Path: "in.xlsx", Err: &os.SyscallError{Syscall: "read", Err: syscall.ESTALE}}, true},
+		{syscall.EAGAIN, true},
+		{&os.PathError{Op: "open", Path: "in.xlsx", Err: syscall.ENOENT}, false},
+		{&os.PathError{Op: "open", Path: "in.xlsx", Err: syscall.EACCES}, false},
+		{&IncompleteError{Name: "in.xlsx", Err: &os.PathError{Op: "read", Path: "in.xlsx", Err: syscall.EIO}}, true},
+		{&IncompleteError{Name: "in.xlsx", Err: errors.New("zip: not a valid zip file")}, false},
+		{errors.New("zip: not a valid zip file"), false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := IsTransient(tt.err); got != tt.want {
+			t.Errorf("IsTransient(%v) = %v; want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestOpenFileRetry(t *testing.T) {
+	defer func(old func(string) (*excelize.File, error)) { openFile = old }(openFile)
+	defer func(old func(string) error) { checkComplete = old }(checkComplete)
+	checkComplete = func(string) error { return nil }
+
+	// opens fail with the given errors before they succeed
+	var attempts int
+	failWith := func(errs ...error) {
+		attempts = 0
+		openFile = func(name string) (*excelize.File, error) {
+			attempts++
+			if attempts <= len(errs) {
+				return nil, errs[attempts-1]
+			}
+			return excelize.NewFile(), nil
+		}
+	}
+	eio := &os.PathError{Op: "open", Path: "in.xlsx", Err: syscall.EIO}
+	missing := &os.PathError{Op: "open", Path: "in.xlsx", Err: syscall.ENOENT}
+
+	failWith(eio, eio)
+	if xlsx, err := OpenFileRetry("in.xlsx", 2, 0); err != nil || xlsx == nil || attempts != 3 {
+		t.Errorf("OpenFileRetry after two transient errors = %v after %d attempts; want success after 3", err, attempts)
+	}
+	failWith(eio, eio, eio)
+	if _, err := OpenFileRetry("in.xlsx", 2, 0); err != eio || attempts != 3 {
+		t.Errorf("OpenFileRetry with too few retries = %v after %d attempts; want the last error after 3", err, attempts)
+	}
+	failWith(eio, missing)
+	if _, err := OpenFileRetry("in.xlsx", 5, 0); err != missing || attempts != 2 {
+		t.Errorf("OpenFileRetry after a permanent error = %v after %d attempts; want it after 2", err, attempts)
+	}
+	failWith(eio)
+	if _, err := OpenFileRetry("in.xlsx", 0, 0); err != eio || attempts != 1 {
+		t.Errorf("OpenFileRetry without retries = %v after %d attempts; want a single attempt", err, attempts)
+	}
+
+	// the check of the file is retried like the open itself (e.g. if a network drive fails while the archive is read)
+	var checks int
+	checkComplete = func(name string) error {
+		checks++
+		if checks <= 2 {
+			return &IncompleteError{Name: name, Part: "xl/workbook.xml", Err: eio}
+		}
+		return nil
+	}
+	failWith()
+	if xlsx, err := OpenFileRetry("in.xlsx", 2, 0); err != nil || xlsx == nil || checks != 3 || attempts != 1 {
+		t.Errorf("OpenFileRetry after two transient check errors = %v after %d checks and %d opens; want success after 3 and 1", err, checks, attempts)
+	}
+	checks = 0
+	failWith()
+	checkComplete = func(name string) error {
+		checks++
+		return &IncompleteError{Name: name, Err: errors.New("zip: not a valid zip file")}
+	}
+	if _, err := OpenFileRetry("in.xlsx", 5, 0); err == nil || checks != 1 || attempts != 0 {
+		t.Errorf("OpenFileRetry of a truncated file = %v after %d checks and %d opens; want an error after 1 and 0", err, checks, attempts)
+	}
+}
@@ -0,0 +1,220 @@
+package excelutil
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ParseRangeSpec parses a selection of 1-based indices like "1,3,5-8" or "30:360" (a range can be given with
+// either '-' or ':' as separator) and returns the expanded, de-duplicated, and sorted indices
+// every index has to be within [1, max]; reversed ranges (e.g. "8-5") are rejected
+func ParseRangeSpec(s string, max int) ([]int, error) {
+	seen := make(map[int]bool)
+	indices := make([]int, 0)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		from, to, err := parseRange(part)
+		if err != nil {
+			return nil, err
+		}
+		if from < 1 || to > max {
+			return nil, fmt.Errorf("selection %s is out of range [1, %d]", part, max)
+		}
+		for i := from; i <= to; i++ {
+			if !seen[i] {
+				seen[i] = true
+				indices = append(indices, i)
+			}
+		}
+	}
+	if len(indices) == 0 {
+		return nil, fmt.Errorf("selection %q does not select anything", s)
+	}
+	sort.Ints(indices)
+	return indices, nil
+}
+
+// parseRange parses a single index ("3") or a range of indices ("5-8" or "5:8")
+func parseRange(part string) (int, int, error) {
+	from, to, err := parseBounds(part, "-:", "selection", true, parseInt)
+	return int(from), int(to), err
+}
+
+// parseBounds parses a range like "30:360" into its start and end, which are separated by the first of the characters
+// in seps (except at the very beginning, so that a negative start is not split) and parsed with parse; without single,
+// the separator is required, otherwise a range without separator is a single value that is its start and end
+// errors name the range with what (e.g. "window"), and the start must not be larger than the end
+func parseBounds(s, seps, what string, single bool, parse func(string) (float64, error)) (float64, float64, error) {
+	lo, hi := s, s
+	if idx := strings.IndexAny(s, seps); idx > 0 {
+		lo, hi = s[:idx], s[idx+1:]
+	} else if !single {
+		return 0, 0, fmt.Errorf("invalid %s %s: expected format from%cto", what, s, seps[0])
+	}
+	from, err := parse(strings.TrimSpace(lo))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid %s %s: %s", what, s, err)
+	}
+	to, err := parse(strings.TrimSpace(hi))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid %s %s: %s", what, s, err)
+	}
+	if from > to {
+		return 0, 0, fmt.Errorf("invalid %s %s: start is larger than end", what, s)
+	}
+	return from, to, nil
+}
+
+// parseInt and parseFloat are the parsers of parseBounds for indices and for times
+func parseInt(s string) (float64, error) {
+	v, err := strconv.Atoi(s)
+	return float64(v), err
+}
+
+func parseFloat(s string) (float64, error) {
+	return strconv.ParseFloat(s, 64)
+}
+
+// ParsePairSpec parses a list of index pairs like "1/2,4/5" (e.g. enumerator/denominator columns) into a slice of
+// 1-based index pairs; every index has to be within [1, max] and the two indices of a pair must differ
+func ParsePairSpec(s string, max int) ([][2]int, error) {
+	pairs := make([][2]int, 0)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		fields := strings.Split(part, "/")
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid pair %s: expected format a/b", part)
+		}
+		var pair [2]int
+		for i, f := range fields {
+			v, err := strconv.Atoi(strings.TrimSpace(f))
+			if err != nil {
+				return nil, fmt.Errorf("invalid pair %s: %s", part, err)
+			}
+			if v < 1 || v > max {
+				return nil, fmt.Errorf("pair %s is out of range [1, %d]", part, max)
+			}
+			pair[i] = v
+		}
+		if pair[0] == pair[1] {
+			return nil, fmt.Errorf("invalid pair %s: indices must differ", part)
+		}
+		pairs = append(pairs, pair)
+	}
+	if len(pairs) == 0 {
+		return nil, fmt.Errorf("pair selection %q does not select anything", s)
+	}
+	return pairs, nil
+}
+
+// ParseColumnSelection parses a column selection like "1,3,5-8" (see ParseRangeSpec) into a set of 1-based column indices
+// every index has to be within [1, max]
+func ParseColumnSelection(spec string, max int) (map[int]bool, error) {
+	indices, err := ParseRangeSpec(spec, max)
+	if err != nil {
+		return nil, err
+	}
+	selected := make(map[int]bool)
+	for _, idx := range indices {
+		selected[idx] = true
+	}
+	return selected, nil
+}
+
+// ParseWindow parses a window like "30:360" into its start and end; the start must not be larger than the end
+func ParseWindow(s string) (int, int, error) {
+	from, to, err := parseBounds(s, ":", "window", false, parseInt)
+	return int(from), int(to), err
+}
+
+// ParseTimeRange parses a time range like "30:360" (in the unit of the time column, e.g. seconds)
+func ParseTimeRange(s string) (float64, float64, error) {
+	return parseBounds(s, ":", "time range", false, parseFloat)
+}
+
+// ParseWindows parses a comma-separated list of windows like "30:120,200:300" (see ParseWindow)
+func ParseWindows(s string) ([][2]int, error) {
+	windows := make([][2]int, 0)
+	for _, field := range strings.Split(s, ",") {
+		from, to, err := ParseWindow(field)
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, [2]int{from, to})
+	}
+	return windows, nil
+}
+
+// ParsePercentiles parses a pair of percentiles like "1:99" with 0 <= low < high <= 100
+func ParsePercentiles(s string) (float64, float64, error) {
+	low, high, err := ParseTimeRange(s)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid percentiles %s: expected format low:high", s)
+	}
+	if low < 0 || high > 100 || low >= high {
+		return 0, 0, fmt.Errorf("invalid percentiles %s: expected 0 <= low < high <= 100", s)
+	}
+	return low, high, nil
+}
+
+// ParseSheetValues parses a global value and/or per-sheet values like "2,Plate2=1" into a map from sheet name to value
+// in which the global value (if any) has the empty key; names and values are trimmed and must not be empty
+func ParseSheetValues(s string) (map[string]string, error) {
+	values := make(map[string]string)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value := "", part
+		if idx := strings.LastIndex(part, "="); idx >= 0 {
+			name, value = strings.TrimSpace(part[:idx]), strings.TrimSpace(part[idx+1:])
+			if name == "" {
+				return nil, fmt.Errorf("invalid entry %s: expected format sheet=value", part)
+			}
+		}
+		if value == "" {
+			return nil, fmt.Errorf("invalid entry %s: empty value", part)
+		}
+		if _, ok := values[name]; ok {
+			return nil, fmt.Errorf("invalid entry %s: duplicate value", part)
+		}
+		values[name] = value
+	}
+	return values, nil
+}
+
+// ParseStages parses a comma-separated list of pipeline stages like "transform,ratio" into a set; all holds the stages of
+// the pipeline in the order in which they run, and since every stage works on the output of the stage before it, a stage
+// can only be enabled together with all stages before it
+func ParseStages(s string, all []string) (map[string]bool, error) {
+	stages := make(map[string]bool)
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		known := false
+		for _, stage := range all {
+			known = known || stage == field
+		}
+		if !known {
+			return nil, fmt.Errorf("invalid stage %q: expected one of %s", field, strings.Join(all, ", "))
+		}
+		if stages[field] {
+			return nil, fmt.Errorf("invalid stage %s: listed more than once", field)
+		}
+		stages[field] = true
+	}
+	for k := 1; k < len(all); k++ {
+		if stages[all[k]] && !stages[all[k-1]] {
+			return nil, fmt.Errorf("invalid stage %s: requires stage %s", all[k], all[k-1])
+		}
+	}
+	return stages, nil
+}
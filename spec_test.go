@@ -0,0 +1,121 @@
+package excelutil
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseColumnSelection(t *testing.T) {
+	got, err := ParseColumnSelection("1,3,5-6", 6)
+	if want := map[int]bool{1: true, 3: true, 5: true, 6: true}; err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseColumnSelection = %v, %v; want %v", got, err, want)
+	}
+	for _, spec := range []string{"0", "7", "2-8", "a", ""} {
+		if _, err := ParseColumnSelection(spec, 6); err == nil {
+			t.Errorf("ParseColumnSelection(%q, 6) = nil error; want an error", spec)
+		}
+	}
+}
+
+func TestParseRangeSpec(t *testing.T) {
+	tests := []struct {
+		spec string
+		want []int
+	}{
+		{"3", []int{3}},
+		{"1,3,5-8", []int{1, 3, 5, 6, 7, 8}},
+		{"30:32", []int{30, 31, 32}},
+		{" 5-6 , 1 ,5,", []int{1, 5, 6}}, // spaces, duplicates, and empty parts
+	}
+	for _, tt := range tests {
+		if got, err := ParseRangeSpec(tt.spec, 40); err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseRangeSpec(%q) = %v, %v; want %v", tt.spec, got, err, tt.want)
+		}
+	}
+	for _, spec := range []string{"8-5", "1-x", "-3", "41", ","} {
+		if got, err := ParseRangeSpec(spec, 40); err == nil {
+			t.Errorf("ParseRangeSpec(%q) = %v; want an error", spec, got)
+		}
+	}
+}
+
+func TestParseTimeRange(t *testing.T) {
+	if from, to, err := ParseTimeRange(" 30 : 360.5 "); err != nil || from != 30 || to != 360.5 {
+		t.Errorf("ParseTimeRange = %v, %v, %v; want 30, 360.5", from, to, err)
+	}
+	if from, to, err := ParseTimeRange("-10:-2.5"); err != nil || from != -10 || to != -2.5 {
+		t.Errorf("ParseTimeRange of negative times = %v, %v, %v; want -10, -2.5", from, to, err)
+	}
+	for _, s := range []string{"30", "30:x", "x:30", "360:30", "1:2:3"} {
+		if _, _, err := ParseTimeRange(s); err == nil {
+			t.Errorf("ParseTimeRange(%q) = nil error; want an error", s)
+		}
+	}
+}
+
+func TestParseWindow(t *testing.T) {
+	if from, to, err := ParseWindow(" 1 : 3 "); err != nil || from != 1 || to != 3 {
+		t.Errorf("ParseWindow = %d, %d, %v; want 1, 3", from, to, err)
+	}
+	for _, s := range []string{"1", "1:x", "1.5:3", "3:1", "1:2:3"} {
+		if _, _, err := ParseWindow(s); err == nil {
+			t.Errorf("ParseWindow(%q) = nil error; want an error", s)
+		}
+	}
+}
+
+func TestParseWindows(t *testing.T) {
+	if got, err := ParseWindows("30:120, 200:300"); err != nil || !reflect.DeepEqual(got, [][2]int{{30, 120}, {200, 300}}) {
+		t.Errorf("ParseWindows = %v, %v; want both windows", got, err)
+	}
+	for _, s := range []string{"", "30:120,", "30:120,300:200"} {
+		if _, err := ParseWindows(s); err == nil {
+			t.Errorf("ParseWindows(%q) = nil error; want an error", s)
+		}
+	}
+}
+
+func TestParsePercentiles(t *testing.T) {
+	if low, high, err := ParsePercentiles("1:99"); err != nil || low != 1 || high != 99 {
+		t.Errorf("ParsePercentiles = %v, %v, %v; want 1, 99", low, high, err)
+	}
+	for _, s := range []string{"99", "-1:99", "1:101", "50:50", "x:99"} {
+		if _, _, err := ParsePercentiles(s); err == nil {
+			t.Errorf("ParsePercentiles(%q) = nil error; want an error", s)
+		}
+	}
+}
+
+func TestParseSheetValues(t *testing.T) {
+	got, err := ParseSheetValues(" 2, Plate2 = 1 ,a=b=auto,")
+	if want := map[string]string{"": "2", "Plate2": "1", "a=b": "auto"}; err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseSheetValues = %q, %v; want %q", got, err, want)
+	}
+	for _, s := range []string{"=1", "Plate1=", "1,2", "Plate1=1,Plate1=2"} {
+		if got, err := ParseSheetValues(s); err == nil {
+			t.Errorf("ParseSheetValues(%q) = %q; want an error", s, got)
+		}
+	}
+}
+
+func TestParseStages(t *testing.T) {
+	all := []string{"transform", "ratio", "sort"}
+	tests := []struct {
+		s    string
+		want map[string]bool
+	}{
+		{"transform", map[string]bool{"transform": true}},
+		{" ratio , transform", map[string]bool{"transform": true, "ratio": true}},
+		{"transform,ratio,sort", map[string]bool{"transform": true, "ratio": true, "sort": true}},
+	}
+	for _, tt := range tests {
+		if got, err := ParseStages(tt.s, all); err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseStages(%q) = %v, %v; want %v", tt.s, got, err, tt.want)
+		}
+	}
+	for _, s := range []string{"", "ratio", "transform,sort", "transform,transform", "transform,plot"} {
+		if _, err := ParseStages(s, all); err == nil {
+			t.Errorf("ParseStages(%q) = nil error; want an error", s)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package excelutil
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+)
+
+// SQLWriter writes sheets to a SQL database (e.g. SQLite) within a single transaction that is committed on Close unless
+// a write failed; the database driver is not part of this package and has to be registered by the program that opens db
+// measurements are written to the table 'measurements' (sheet, column_label, row, value) and peaks to the
+// table 'peaks' (sheet, column_label, peak_value, peak_row); both tables are created if they don't exist
+type SQLWriter struct {
+	tx  *sql.Tx
+	err error // first error of WriteSheet or WritePeaks
+}
+
+// NewSQLWriter creates the tables if necessary and starts a transaction
+func NewSQLWriter(db *sql.DB) (*SQLWriter, error) {
+	tables := []string{
+		"CREATE TABLE IF NOT EXISTS measurements (sheet TEXT, column_label TEXT, row INTEGER, value REAL)",
+		"CREATE TABLE IF NOT EXISTS peaks (sheet TEXT, column_label TEXT, peak_value REAL, peak_row INTEGER)",
+	}
+	for _, stmt := range tables {
+		if _, err := db.Exec(stmt); err != nil {
+			return nil, fmt.Errorf("cannot create table: %s", err)
+		}
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("cannot start transaction: %s", err)
+	}
+	return &SQLWriter{tx: tx}, nil
+}
+
+// WriteSheet inserts one row per value into the measurements table; rows are counted from 1 and NaN values are skipped
+func (w *SQLWriter) WriteSheet(name string, headers []string, data [][]float64) error {
+	return w.remember(w.writeSheet(name, headers, data))
+}
+
+func (w *SQLWriter) writeSheet(name string, headers []string, data [][]float64) error {
+	stmt, err := w.tx.Prepare("INSERT INTO measurements (sheet, column_label, row, value) VALUES (?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for r, row := range data {
+		for c, v := range row {
+			if math.IsNaN(v) || c >= len(headers) {
+				continue
+			}
+			if _, err := stmt.Exec(name, headers[c], r+1, v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// WritePeaks inserts one row per column into the peaks table; the value and row of a NaN peak (a column without
+// values within the search range) are NULL
+func (w *SQLWriter) WritePeaks(name string, labels []string, peaks []float64, peakRows []int) error {
+	return w.remember(w.writePeaks(name, labels, peaks, peakRows))
+}
+
+func (w *SQLWriter) writePeaks(name string, labels []string, peaks []float64, peakRows []int) error {
+	stmt, err := w.tx.Prepare("INSERT INTO peaks (sheet, column_label, peak_value, peak_row) VALUES (?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for c := range peaks {
+		if c >= len(labels) || c >= len(peakRows) {
+			break
+		}
+		var value, row interface{}
+		if !math.IsNaN(peaks[c]) {
+			value, row = peaks[c], peakRows[c]
+		}
+		if _, err := stmt.Exec(name, labels[c], value, row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// remember keeps the first error of a write for Close and returns err
+func (w *SQLWriter) remember(err error) error {
+	if w.err == nil {
+		w.err = err
+	}
+	return err
+}
+
+// Close commits the transaction; if a write failed, the transaction is rolled back instead and the error of that write
+// is returned
+func (w *SQLWriter) Close() error {
+	if w.err != nil {
+		w.tx.Rollback()
+		return fmt.Errorf("nothing was written because of an earlier error: %s", w.err)
+	}
+	return w.tx.Commit()
+}
+
+// Rollback discards everything that was written
+func (w *SQLWriter) Rollback() error {
+	return w.tx.Rollback()
+}
@@ -0,0 +1,128 @@
+package excelutil
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// recordingDriver is a database/sql driver that records the statements that are executed instead of running them, so
+// that SQLWriter can be tested without a database
+type recordingDriver struct {
+	execs      []string // the executed statements with their arguments
+	committed  bool
+	rolledBack bool
+	fail       string // statements that start with fail return an error
+}
+
+func (d *recordingDriver) Open(name string) (driver.Conn, error) { return recordingConn{d}, nil }
+
+type recordingConn struct{ d *recordingDriver }
+
+func (c recordingConn) Prepare(query string) (driver.Stmt, error) {
+	return recordingStmt{c.d, query}, nil
+}
+func (c recordingConn) Close() error              { return nil }
+func (c recordingConn) Begin() (driver.Tx, error) { return c, nil }
+func (c recordingConn) Commit() error             { c.d.committed = true; return nil }
+func (c recordingConn) Rollback() error           { c.d.rolledBack = true; return nil }
+
+type recordingStmt struct {
+	d     *recordingDriver
+	query string
+}
+
+func (s recordingStmt) Close() error  { return nil }
+func (s recordingStmt) NumInput() int { return strings.Count(s.query, "?") }
+func (s recordingStmt) Exec(args []driver.Value) (driver.Result, error) {
+	stmt := strings.Fields(s.query)[0]
+	if stmt == "INSERT" {
+		stmt += " " + strings.Fields(s.query)[2]
+	}
+	if s.d.fail != "" && strings.HasPrefix(stmt, s.d.fail) {
+		return nil, errors.New("disk I/O error")
+	}
+	s.d.execs = append(s.d.execs, fmt.Sprintf("%s %v", stmt, args))
+	return driver.RowsAffected(1), nil
+}
+func (s recordingStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return nil, errors.New("queries are not supported")
+}
+
+var testDriver = &recordingDriver{}
+
+func init() {
+	sql.Register("excelutil_recording", testDriver)
+}
+
+func TestSQLWriter(t *testing.T) {
+	db, err := sql.Open("excelutil_recording", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	w, err := NewSQLWriter(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nan := math.NaN()
+	if err := w.WriteSheet("Plate1", []string{"cell 1", "cell 2"}, [][]float64{{0.5, nan}, {0.75, 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WritePeaks("Plate1", []string{"cell 1", "cell 2", "cell 3"}, []float64{0.75, 1, nan}, []int{3, 3, -1}); err != nil {
+		t.Fatal(err)
+	}
+	if testDriver.committed {
+		t.Error("the transaction was committed before Close")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// NaN values are skipped, NaN peaks are NULL, and rows are counted from 1
+	want := []string{
+		"CREATE []", "CREATE []",
+		"INSERT measurements [Plate1 cell 1 1 0.5]",
+		"INSERT measurements [Plate1 cell 1 2 0.75]",
+		"INSERT measurements [Plate1 cell 2 2 1]",
+		"INSERT peaks [Plate1 cell 1 0.75 3]",
+		"INSERT peaks [Plate1 cell 2 1 3]",
+		"INSERT peaks [Plate1 cell 3 <nil> <nil>]",
+	}
+	if !reflect.DeepEqual(testDriver.execs, want) || !testDriver.committed {
+		t.Errorf("executed statements =\n%q\nwant\n%q (committed: %v)", testDriver.execs, want, testDriver.committed)
+	}
+}
+
+func TestSQLWriterRollsBackAfterFailedWrite(t *testing.T) {
+	*testDriver = recordingDriver{fail: "INSERT peaks"}
+	defer func() { *testDriver = recordingDriver{} }()
+	db, err := sql.Open("excelutil_recording", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	w, err := NewSQLWriter(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteSheet("Plate1", []string{"cell 1"}, [][]float64{{0.5}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WritePeaks("Plate1", []string{"cell 1"}, []float64{0.5}, []int{1}); err == nil {
+		t.Fatal("WritePeaks with a failing insert = nil; want an error")
+	}
+
+	// the measurements of the sheet are not committed without its peaks
+	if err := w.Close(); err == nil || !strings.Contains(err.Error(), "disk I/O error") {
+		t.Errorf("Close after a failed write = %v; want the error of that write", err)
+	}
+	if testDriver.committed || !testDriver.rolledBack {
+		t.Errorf("Close after a failed write committed: %v, rolled back: %v; want a rollback", testDriver.committed, testDriver.rolledBack)
+	}
+}
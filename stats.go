@@ -0,0 +1,578 @@
+package excelutil
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// CorrelationMatrix computes the pairwise Pearson correlation coefficients between the columns in data
+// (every inner slice holds the values of one column); NaN values are handled by only using the
+// observations that are present in both columns (pairwise-complete observations)
+// a coefficient is NaN if fewer than two complete observations exist or if a column has zero variance
+func CorrelationMatrix(data [][]float64) [][]float64 {
+	corr := make([][]float64, len(data))
+	for i := range data {
+		corr[i] = make([]float64, len(data))
+	}
+	for i := 0; i < len(data); i++ {
+		for j := i; j < len(data); j++ {
+			r := pearson(data[i], data[j])
+			corr[i][j] = r
+			corr[j][i] = r
+		}
+	}
+	return corr
+}
+
+// pearson returns the Pearson correlation coefficient of x and y using pairwise-complete observations
+func pearson(x, y []float64) float64 {
+	n := len(x)
+	if len(y) < n {
+		n = len(y)
+	}
+
+	// compute the means of all complete observations
+	var sumX, sumY float64
+	count := 0
+	for i := 0; i < n; i++ {
+		if math.IsNaN(x[i]) || math.IsNaN(y[i]) {
+			continue
+		}
+		sumX += x[i]
+		sumY += y[i]
+		count++
+	}
+	if count < 2 {
+		return math.NaN()
+	}
+	meanX, meanY := sumX/float64(count), sumY/float64(count)
+
+	// compute covariance and variances
+	var cov, varX, varY float64
+	for i := 0; i < n; i++ {
+		if math.IsNaN(x[i]) || math.IsNaN(y[i]) {
+			continue
+		}
+		dx, dy := x[i]-meanX, y[i]-meanY
+		cov += dx * dy
+		varX += dx * dx
+		varY += dy * dy
+	}
+	if varX == 0 || varY == 0 {
+		return math.NaN()
+	}
+	return cov / math.Sqrt(varX*varY)
+}
+
+// Histogram sorts values into bins of equal width between the minimum and the maximum value and returns the
+// counts per bin and the bin edges (len(edges) == len(counts)+1); NaN and infinite values are ignored
+// if all values are equal, a single bin is returned; if there are no values, both slices are empty
+func Histogram(values []float64, bins int) ([]int, []float64) {
+	if bins < 1 {
+		bins = 1
+	}
+	min, max := math.Inf(1), math.Inf(-1)
+	n := 0
+	for _, v := range values {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			continue
+		}
+		min = math.Min(min, v)
+		max = math.Max(max, v)
+		n++
+	}
+	if n == 0 {
+		return []int{}, []float64{}
+	}
+	if min == max {
+		return []int{n}, []float64{min, max}
+	}
+
+	// compute bin edges and count values per bin (the last bin includes the maximum)
+	width := (max - min) / float64(bins)
+	edges := make([]float64, bins+1)
+	for i := range edges {
+		edges[i] = min + float64(i)*width
+	}
+	edges[bins] = max
+	counts := make([]int, bins)
+	for _, v := range values {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			continue
+		}
+		idx := int((v - min) / width)
+		if idx >= bins {
+			idx = bins - 1
+		}
+		counts[idx]++
+	}
+	return counts, edges
+}
+
+// EWMA smoothes values with an exponentially weighted moving average, i.e. s[0] = v[0] and s[i] = alpha*v[i] + (1-alpha)*s[i-1]
+// alpha has to be in (0, 1] with 1 meaning no smoothing at all and small values meaning heavy smoothing;
+// NaN values do not update the average and are kept as NaN in the output
+func EWMA(values []float64, alpha float64) []float64 {
+	smoothed := make([]float64, len(values))
+	if alpha <= 0 || alpha > 1 {
+		copy(smoothed, values)
+		return smoothed
+	}
+	avg := math.NaN()
+	for i, v := range values {
+		switch {
+		case math.IsNaN(v):
+			smoothed[i] = v
+			continue
+		case math.IsNaN(avg):
+			avg = v
+		default:
+			avg = alpha*v + (1-alpha)*avg
+		}
+		smoothed[i] = avg
+	}
+	return smoothed
+}
+
+// RollingMean smoothes values with a centered moving average over window values, i.e. every value is replaced by the mean
+// of the values from i-(window-1)/2 to i+window/2; the window is truncated at both ends, NaN values are ignored (and kept
+// as NaN in the output), and a window of 1 or less returns a copy of values
+func RollingMean(values []float64, window int) []float64 {
+	smoothed := make([]float64, len(values))
+	copy(smoothed, values)
+	if window <= 1 {
+		return smoothed
+	}
+	for i, v := range values {
+		if math.IsNaN(v) {
+			continue
+		}
+		from, to := i-(window-1)/2, i+window/2+1
+		if from < 0 {
+			from = 0
+		}
+		if to > len(values) {
+			to = len(values)
+		}
+		smoothed[i] = meanOf(values[from:to])
+	}
+	return smoothed
+}
+
+// FindDuplicateColumns returns the index pairs of all columns in data (every inner slice holds the values of one column)
+// whose values are equal within an absolute tolerance tol; columns of different length are never equal
+// and NaN values are only considered equal to other NaN values
+func FindDuplicateColumns(data [][]float64, tol float64) [][2]int {
+	duplicates := make([][2]int, 0)
+	for i := 0; i < len(data); i++ {
+		for j := i + 1; j < len(data); j++ {
+			if equalColumns(data[i], data[j], tol) {
+				duplicates = append(duplicates, [2]int{i, j})
+			}
+		}
+	}
+	return duplicates
+}
+
+// equalColumns reports whether two columns are equal within an absolute tolerance
+func equalColumns(a, b []float64, tol float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !AlmostEqual(a[i], b[i], tol) {
+			return false
+		}
+	}
+	return true
+}
+
+// ResponseRate returns the fraction of peaks that are larger than threshold (i.e. the fraction of responding cells)
+// NaN peaks count as non-responding; 0 is returned if there are no peaks
+func ResponseRate(peaks []float64, threshold float64) float64 {
+	if len(peaks) == 0 {
+		return 0
+	}
+	responding := 0
+	for _, p := range peaks {
+		if p > threshold {
+			responding++
+		}
+	}
+	return float64(responding) / float64(len(peaks))
+}
+
+// CountResponders returns the number of cells whose peak is larger than peakMin and whose latency (time to peak)
+// is smaller than latencyMax; a negative peakMin or latencyMax disables the respective criterion and NaN values
+// never satisfy an enabled criterion
+func CountResponders(peaks, latencies []float64, peakMin, latencyMax float64) int {
+	n := 0
+	for i, p := range peaks {
+		if peakMin >= 0 && !(p > peakMin) {
+			continue
+		}
+		if latencyMax >= 0 && (i >= len(latencies) || !(latencies[i] < latencyMax)) {
+			continue
+		}
+		n++
+	}
+	return n
+}
+
+// ThresholdCount is the number of columns of a sheet that survive a response threshold (see FilterColumnsByThreshold)
+type ThresholdCount struct {
+	Sheet string `json:"sheet"`
+	Kept  int    `json:"kept"`
+	Total int    `json:"total"`
+}
+
+// String formats a count for the summary of a run, e.g. "Plate1: kept 3 of 4 columns"
+func (c ThresholdCount) String() string {
+	return fmt.Sprintf("%s: kept %d of %d columns", c.Sheet, c.Kept, c.Total)
+}
+
+// FilterColumnsByThreshold returns the headers and the data (given row-wise) of all columns that have at least one
+// value larger than threshold; the order of the kept columns does not change
+func FilterColumnsByThreshold(headers []string, data [][]float64, threshold float64) ([]string, [][]float64) {
+	keep := make([]int, 0)
+	for c := range headers {
+		for r := range data {
+			if c < len(data[r]) && data[r][c] > threshold {
+				keep = append(keep, c)
+				break
+			}
+		}
+	}
+	kept := make([]string, len(keep))
+	for k, c := range keep {
+		kept[k] = headers[c]
+	}
+	filtered := make([][]float64, len(data))
+	for r := range data {
+		filtered[r] = make([]float64, len(keep))
+		for k, c := range keep {
+			filtered[r][k] = math.NaN()
+			if c < len(data[r]) {
+				filtered[r][k] = data[r][c]
+			}
+		}
+	}
+	return kept, filtered
+}
+
+// Detrend removes a linear trend from values by fitting a least-squares line (with the index as x value) and
+// subtracting it; NaN values are ignored during the fit and kept as NaN in the output
+func Detrend(values []float64) []float64 {
+	var sumX, sumY float64
+	n := 0
+	for i, v := range values {
+		if math.IsNaN(v) {
+			continue
+		}
+		sumX += float64(i)
+		sumY += v
+		n++
+	}
+	detrended := make([]float64, len(values))
+	copy(detrended, values)
+	if n < 2 {
+		return detrended
+	}
+
+	// compute slope and intercept of the least-squares line
+	meanX, meanY := sumX/float64(n), sumY/float64(n)
+	var sxy, sxx float64
+	for i, v := range values {
+		if math.IsNaN(v) {
+			continue
+		}
+		dx := float64(i) - meanX
+		sxy += dx * (v - meanY)
+		sxx += dx * dx
+	}
+	slope := sxy / sxx
+	intercept := meanY - slope*meanX
+	for i, v := range values {
+		if !math.IsNaN(v) {
+			detrended[i] = v - (slope*float64(i) + intercept)
+		}
+	}
+	return detrended
+}
+
+// DeltaF returns the response amplitude of values, i.e. the maximum within [windowFrom, windowTo) minus the
+// mean of the baseline within [baselineFrom, baselineTo); NaN values are ignored
+// NaN is returned if a range is empty, reversed, or out of bounds
+func DeltaF(values []float64, baselineFrom, baselineTo, windowFrom, windowTo int) float64 {
+	if !validRange(len(values), baselineFrom, baselineTo) || !validRange(len(values), windowFrom, windowTo) {
+		return math.NaN()
+	}
+	return maxOf(values[windowFrom:windowTo]) - meanOf(values[baselineFrom:baselineTo])
+}
+
+// SNR returns the signal-to-noise ratio of values, i.e. the response amplitude (see DeltaF) divided by the
+// (population) standard deviation of the baseline within [baselineFrom, baselineTo); NaN values are ignored
+// a baseline without variance always yields +Inf, and NaN is returned if a range is empty, reversed, or out of bounds
+func SNR(values []float64, baselineFrom, baselineTo, windowFrom, windowTo int) float64 {
+	amplitude := DeltaF(values, baselineFrom, baselineTo, windowFrom, windowTo)
+	if math.IsNaN(amplitude) {
+		return math.NaN()
+	}
+	baseline := values[baselineFrom:baselineTo]
+	mean := meanOf(baseline)
+	sum, n := 0.0, 0
+	for _, v := range baseline {
+		if !math.IsNaN(v) {
+			sum += (v - mean) * (v - mean)
+			n++
+		}
+	}
+	if sum == 0 {
+		return math.Inf(1)
+	}
+	return amplitude / math.Sqrt(sum/float64(n))
+}
+
+// Drift returns how far values moved away from their baseline within [baselineFrom, baselineTo), i.e. the mean of
+// the same number of values at the end of values minus the mean of the baseline; NaN values are ignored
+// NaN is returned if the range is empty, reversed, or out of bounds
+func Drift(values []float64, baselineFrom, baselineTo int) float64 {
+	if !validRange(len(values), baselineFrom, baselineTo) {
+		return math.NaN()
+	}
+	return meanOf(values[len(values)-(baselineTo-baselineFrom):]) - meanOf(values[baselineFrom:baselineTo])
+}
+
+// CountNaN returns the number of NaN values in all columns of data
+func CountNaN(data [][]float64) int {
+	n := 0
+	for _, col := range data {
+		for _, v := range col {
+			if math.IsNaN(v) {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// validRange reports whether [from, to) is a non-empty range within a slice of length n
+func validRange(n, from, to int) bool {
+	return from >= 0 && from < to && to <= n
+}
+
+// maxOf returns the maximum of all non-NaN values or NaN if there are none
+func maxOf(values []float64) float64 {
+	max := math.NaN()
+	for _, v := range values {
+		if !math.IsNaN(v) && (math.IsNaN(max) || v > max) {
+			max = v
+		}
+	}
+	return max
+}
+
+// meanOf returns the mean of all non-NaN values or NaN if there are none
+func meanOf(values []float64) float64 {
+	sum, n := 0.0, 0
+	for _, v := range values {
+		if !math.IsNaN(v) {
+			sum += v
+			n++
+		}
+	}
+	if n == 0 {
+		return math.NaN()
+	}
+	return sum / float64(n)
+}
+
+// ZScore standardizes values to zero mean and unit (population) standard deviation; NaN values are excluded
+// from the mean and the standard deviation and stay NaN, and a constant column yields all zeros
+func ZScore(values []float64) []float64 {
+	mean := meanOf(values)
+	sum, n := 0.0, 0
+	for _, v := range values {
+		if !math.IsNaN(v) {
+			sum += (v - mean) * (v - mean)
+			n++
+		}
+	}
+	sd := 0.0
+	if n > 0 {
+		sd = math.Sqrt(sum / float64(n))
+	}
+	z := make([]float64, len(values))
+	for i, v := range values {
+		switch {
+		case math.IsNaN(v):
+			z[i] = math.NaN()
+		case sd == 0:
+			z[i] = 0
+		default:
+			z[i] = (v - mean) / sd
+		}
+	}
+	return z
+}
+
+// ClipOutliers winsorizes values: values below the lowPct-th percentile (0-100) are set to that percentile and values
+// above the highPct-th percentile to that one; percentiles are interpolated linearly between the sorted non-NaN
+// values, NaN values stay NaN, and the input is not modified
+func ClipOutliers(values []float64, lowPct, highPct float64) []float64 {
+	sorted := make([]float64, 0, len(values))
+	for _, v := range values {
+		if !math.IsNaN(v) {
+			sorted = append(sorted, v)
+		}
+	}
+	clipped := make([]float64, len(values))
+	copy(clipped, values)
+	if len(sorted) == 0 {
+		return clipped
+	}
+	sort.Float64s(sorted)
+	low, high := percentile(sorted, lowPct), percentile(sorted, highPct)
+	for i, v := range clipped {
+		switch {
+		case v < low:
+			clipped[i] = low
+		case v > high:
+			clipped[i] = high
+		}
+	}
+	return clipped
+}
+
+// percentile returns the p-th percentile (0-100) of sorted, which must not be empty
+func percentile(sorted []float64, p float64) float64 {
+	pos := p / 100 * float64(len(sorted)-1)
+	lo := int(math.Floor(pos))
+	if lo >= len(sorted)-1 {
+		return sorted[len(sorted)-1]
+	}
+	if lo < 0 {
+		return sorted[0]
+	}
+	return sorted[lo] + (pos-float64(lo))*(sorted[lo+1]-sorted[lo])
+}
+
+// Ranks returns the rank (starting at 1) of every value, i.e. its position after sorting in descending (or, with
+// desc == false, ascending) order; ties are ranked in the order of their indices and NaN values are ranked last
+func Ranks(values []float64, desc bool) []int {
+	order := make([]int, len(values))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		x, y := values[order[a]], values[order[b]]
+		switch {
+		case math.IsNaN(x) || math.IsNaN(y):
+			return !math.IsNaN(x) && math.IsNaN(y)
+		case desc:
+			return x > y
+		default:
+			return x < y
+		}
+	})
+	ranks := make([]int, len(values))
+	for r, i := range order {
+		ranks[i] = r + 1
+	}
+	return ranks
+}
+
+// Downsample keeps every factor-th value of values starting with the first one, i.e. ceil(len(values)/factor) values
+// a factor below 2 returns a copy of values
+func Downsample(values []float64, factor int) []float64 {
+	if factor < 1 {
+		factor = 1
+	}
+	kept := make([]float64, 0, (len(values)+factor-1)/factor)
+	for i := 0; i < len(values); i += factor {
+		kept = append(kept, values[i])
+	}
+	return kept
+}
+
+// AlmostEqual reports whether a and b differ by at most tol
+// two NaNs are considered equal, and infinities are only equal to an infinity of the same sign
+func AlmostEqual(a, b, tol float64) bool {
+	switch {
+	case math.IsNaN(a) || math.IsNaN(b):
+		return math.IsNaN(a) && math.IsNaN(b)
+	case math.IsInf(a, 0) || math.IsInf(b, 0):
+		return a == b
+	}
+	return math.Abs(a-b) <= tol
+}
+
+// TimeToPeak returns the time at which values reach their maximum, i.e. times[i] for the index i of the maximum
+// if times is missing or does not hold a time for that index, i itself is returned; NaN values are ignored and NaN is
+// returned if there is no value at all
+func TimeToPeak(values []float64, times []float64) float64 {
+	peak := -1
+	for i, v := range values {
+		if !math.IsNaN(v) && (peak < 0 || v > values[peak]) {
+			peak = i
+		}
+	}
+	switch {
+	case peak < 0:
+		return math.NaN()
+	case peak >= len(times) || math.IsNaN(times[peak]):
+		return float64(peak)
+	}
+	return times[peak]
+}
+
+// WindowMean returns the mean of all non-NaN values within [from, to) or NaN if the range is empty or out of bounds
+func WindowMean(values []float64, from, to int) float64 {
+	if !validRange(len(values), from, to) {
+		return math.NaN()
+	}
+	return meanOf(values[from:to])
+}
+
+// WindowPeaks returns the maximum of values within every window [from, to); windows are clipped to the length of
+// values and the peak of a window without values is NaN
+func WindowPeaks(values []float64, windows [][2]int) []float64 {
+	peaks := make([]float64, len(windows))
+	for w, window := range windows {
+		from, to := window[0], window[1]
+		if from < 0 {
+			from = 0
+		}
+		if to > len(values) {
+			to = len(values)
+		}
+		peaks[w] = math.NaN()
+		if from < to {
+			peaks[w] = maxOf(values[from:to])
+		}
+	}
+	return peaks
+}
+
+// RatioThenCorrect returns the ratio of the raw channels num and denom minus the ratio of their backgrounds bgNum and
+// bgDenom, i.e. num/denom - bgNum/bgDenom; correcting first yields (num-bgNum)/(denom-bgDenom) instead, which is a
+// different quantity (it is 0 if the backgrounds share the ratio of the raw channels), e.g. for num=200, denom=300,
+// bgNum=50, and bgDenom=60, correcting first yields 0.625 while this yields -0.167
+func RatioThenCorrect(num, denom, bgNum, bgDenom float64) float64 {
+	return num/denom - bgNum/bgDenom
+}
+
+// ComputeRatios divides every value of num by the value of denom with the same index; if both differ in length, only
+// the values of the shorter one are used and equal is false
+func ComputeRatios(num, denom []float64) (ratios []float64, equal bool) {
+	n := len(num)
+	if len(denom) < n {
+		n = len(denom)
+	}
+	ratios = make([]float64, n)
+	for r := range ratios {
+		ratios[r] = num[r] / denom[r]
+	}
+	return ratios, len(num) == len(denom)
+}
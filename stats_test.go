@@ -0,0 +1,438 @@
+package excelutil
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+// equalFloats reports whether a and b have the same length and equal values (see AlmostEqual)
+func equalFloats(a, b []float64, tol float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !AlmostEqual(a[i], b[i], tol) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestComputeRatiosMismatchedLength(t *testing.T) {
+	tests := []struct {
+		name      string
+		num       []float64
+		denom     []float64
+		want      []float64
+		wantEqual bool
+	}{
+		{"equal", []float64{2, 4, 6}, []float64{1, 2, 3}, []float64{2, 2, 2}, true},
+		{"short numerator", []float64{2, 4}, []float64{1, 2, 3}, []float64{2, 2}, false},
+		{"short denominator", []float64{2, 4, 6}, []float64{1}, []float64{2}, false},
+		{"empty denominator", []float64{2, 4}, []float64{}, []float64{}, false},
+		{"zero denominator", []float64{1, 0}, []float64{0, 0}, []float64{math.Inf(1), math.NaN()}, true},
+	}
+	for _, tt := range tests {
+		got, equal := ComputeRatios(tt.num, tt.denom)
+		if !equalFloats(got, tt.want, 0) || equal != tt.wantEqual {
+			t.Errorf("%s: ComputeRatios(%v, %v) = %v, %v; want %v, %v", tt.name, tt.num, tt.denom, got, equal, tt.want, tt.wantEqual)
+		}
+	}
+}
+
+func TestCorrelationMatrix(t *testing.T) {
+	nan := math.NaN()
+	data := [][]float64{
+		{1, 2, 3, 4},
+		{2, 4, 6, 8},     // correlated
+		{4, 3, 2, 1},     // anti-correlated
+		{5, 5, 5, 5},     // zero variance
+		{1, nan, 3, nan}, // pairwise-complete observations of the first column
+	}
+	want := [][]float64{
+		{1, 1, -1, nan, 1},
+		{1, 1, -1, nan, 1},
+		{-1, -1, 1, nan, -1},
+		{nan, nan, nan, nan, nan},
+		{1, 1, -1, nan, 1},
+	}
+	got := CorrelationMatrix(data)
+	if len(got) != len(want) {
+		t.Fatalf("CorrelationMatrix has %d rows; want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !equalFloats(got[i], want[i], 1e-12) {
+			t.Errorf("row %d of CorrelationMatrix = %v; want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	tests := []struct {
+		values []float64
+		bins   int
+		counts []int
+		edges  []float64
+	}{
+		{[]float64{1, 2, 2, 3, 4, 5, math.NaN()}, 2, []int{3, 3}, []float64{1, 3, 5}}, // the maximum is in the last bin
+		{[]float64{0, 0.5, 1}, 4, []int{1, 0, 1, 1}, []float64{0, 0.25, 0.5, 0.75, 1}},
+		{[]float64{2, 2}, 3, []int{2}, []float64{2, 2}},
+		{[]float64{math.NaN()}, 3, []int{}, []float64{}},
+		{[]float64{1, 2}, 0, []int{2}, []float64{1, 2}},
+		{[]float64{math.Inf(1), 1, 2, 3, math.Inf(-1)}, 2, []int{1, 2}, []float64{1, 2, 3}}, // e.g. peaks of a zero denominator
+		{[]float64{math.Inf(1)}, 2, []int{}, []float64{}},
+	}
+	for _, tt := range tests {
+		counts, edges := Histogram(tt.values, tt.bins)
+		if !reflect.DeepEqual(counts, tt.counts) || !equalFloats(edges, tt.edges, 1e-12) {
+			t.Errorf("Histogram(%v, %d) = %v, %v; want %v, %v", tt.values, tt.bins, counts, edges, tt.counts, tt.edges)
+		}
+	}
+}
+
+func TestEWMA(t *testing.T) {
+	nan := math.NaN()
+	tests := []struct {
+		values []float64
+		alpha  float64
+		want   []float64
+	}{
+		{[]float64{1, 2, 3}, 1, []float64{1, 2, 3}},
+		{[]float64{1, 3, 3}, 0.5, []float64{1, 2, 2.5}},
+		{[]float64{nan, 2, nan, 4}, 0.5, []float64{nan, 2, nan, 3}}, // NaN values do not update the average
+		{[]float64{1, 2}, 0, []float64{1, 2}},                       // an invalid alpha does not smooth
+	}
+	for _, tt := range tests {
+		if got := EWMA(tt.values, tt.alpha); !equalFloats(got, tt.want, 1e-12) {
+			t.Errorf("EWMA(%v, %v) = %v; want %v", tt.values, tt.alpha, got, tt.want)
+		}
+	}
+}
+
+func TestFindDuplicateColumns(t *testing.T) {
+	nan := math.NaN()
+	data := [][]float64{
+		{1, 2, nan},
+		{1, 2.0000001, nan},
+		{1, 2},
+		{5, 5, 5},
+		{1, 2, nan},
+	}
+	want := [][2]int{{0, 1}, {0, 4}, {1, 4}}
+	if got := FindDuplicateColumns(data, 1e-6); !reflect.DeepEqual(got, want) {
+		t.Errorf("FindDuplicateColumns = %v; want %v", got, want)
+	}
+	if got := FindDuplicateColumns(data, 0); !reflect.DeepEqual(got, [][2]int{{0, 4}}) {
+		t.Errorf("FindDuplicateColumns without tolerance = %v; want [[0 4]]", got)
+	}
+}
+
+func TestResponseRate(t *testing.T) {
+	tests := []struct {
+		peaks     []float64
+		threshold float64
+		want      float64
+	}{
+		{[]float64{0.5, 1.5, 2, 1}, 1, 0.5}, // a peak equal to the threshold does not respond
+		{[]float64{2, math.NaN()}, 1, 0.5},
+		{[]float64{-1, -2}, -3, 1},
+		{nil, 1, 0},
+	}
+	for _, tt := range tests {
+		if got := ResponseRate(tt.peaks, tt.threshold); got != tt.want {
+			t.Errorf("ResponseRate(%v, %v) = %v; want %v", tt.peaks, tt.threshold, got, tt.want)
+		}
+	}
+}
+
+func TestDetrend(t *testing.T) {
+	nan := math.NaN()
+	tests := []struct {
+		values []float64
+		want   []float64
+	}{
+		{[]float64{1, 3, 5, 7}, []float64{0, 0, 0, 0}},
+		{[]float64{0, 2, 0, 2}, []float64{-0.4, 1.2, -1.2, 0.4}}, // the line 0.4x + 0.4 is subtracted
+		{[]float64{1, nan, 5, 7}, []float64{0, nan, 0, 0}},
+		{[]float64{nan, 4}, []float64{nan, 4}}, // a single value cannot be fitted
+	}
+	for _, tt := range tests {
+		if got := Detrend(tt.values); !equalFloats(got, tt.want, 1e-12) {
+			t.Errorf("Detrend(%v) = %v; want %v", tt.values, got, tt.want)
+		}
+	}
+}
+
+func TestDeltaF(t *testing.T) {
+	values := []float64{1, 3, math.NaN(), 2, 8, 5}
+	tests := []struct {
+		baselineFrom, baselineTo, windowFrom, windowTo int
+		want                                           float64
+	}{
+		{0, 2, 3, 6, 6}, // peak 8 minus baseline mean 2
+		{0, 3, 3, 6, 6}, // the NaN value is ignored
+		{0, 2, 3, 4, 0}, // the window ends before the peak
+		{2, 2, 3, 6, math.NaN()},
+		{0, 2, 5, 7, math.NaN()},
+	}
+	for _, tt := range tests {
+		if got := DeltaF(values, tt.baselineFrom, tt.baselineTo, tt.windowFrom, tt.windowTo); !AlmostEqual(got, tt.want, 1e-12) {
+			t.Errorf("DeltaF(%d:%d, %d:%d) = %v; want %v", tt.baselineFrom, tt.baselineTo, tt.windowFrom, tt.windowTo, got, tt.want)
+		}
+	}
+}
+
+func TestAlmostEqual(t *testing.T) {
+	nan, inf := math.NaN(), math.Inf(1)
+	tests := []struct {
+		a, b, tol float64
+		want      bool
+	}{
+		{1, 1, 0, true},
+		{1, 1.5, 0.5, true}, // the tolerance is inclusive
+		{1, 1.5000001, 0.5, false},
+		{-1, 1, 1.5, false},
+		{nan, nan, 0, true},
+		{nan, 1, 100, false},
+		{1, nan, 100, false},
+		{inf, inf, 0, true},
+		{inf, -inf, 100, false},
+		{inf, math.MaxFloat64, inf, false},
+		{nan, inf, inf, false},
+	}
+	for _, tt := range tests {
+		if got := AlmostEqual(tt.a, tt.b, tt.tol); got != tt.want {
+			t.Errorf("AlmostEqual(%v, %v, %v) = %v; want %v", tt.a, tt.b, tt.tol, got, tt.want)
+		}
+	}
+}
+
+func TestTimeToPeak(t *testing.T) {
+	nan := math.NaN()
+	tests := []struct {
+		name          string
+		values, times []float64
+		want          float64
+	}{
+		{"peak time", []float64{1, 5, 3, 5}, []float64{0, 2.5, 7, 12}, 2.5}, // the first of equal maxima
+		{"NaN values", []float64{nan, 1, nan, 4}, []float64{0, 2, 4, 6}, 6},
+		{"without times", []float64{1, 5, 3}, nil, 1},
+		{"short times", []float64{1, 3, 5}, []float64{0, 2}, 2},
+		{"NaN time", []float64{1, 5, 3}, []float64{0, nan, 4}, 1},
+		{"no values", []float64{nan, nan}, []float64{0, 2}, nan},
+	}
+	for _, tt := range tests {
+		if got := TimeToPeak(tt.values, tt.times); !AlmostEqual(got, tt.want, 0) {
+			t.Errorf("%s: TimeToPeak(%v, %v) = %v; want %v", tt.name, tt.values, tt.times, got, tt.want)
+		}
+	}
+}
+
+func TestCountResponders(t *testing.T) {
+	nan := math.NaN()
+	peaks := []float64{0.5, 1.5, 2, nan, 3}
+	latencies := []float64{10, 40, 20, 5, nan}
+	tests := []struct {
+		name               string
+		peakMin, latencies float64
+		want               int
+	}{
+		{"no criteria", -1, -1, 5},
+		{"peak", 1, -1, 3},             // 1.5, 2, and 3; NaN never responds
+		{"latency", -1, 30, 3},         // 10, 20, and 5
+		{"peak and latency", 1, 30, 1}, // only the third cell
+		{"strict bounds", 2, 20, 0},
+	}
+	for _, tt := range tests {
+		if got := CountResponders(peaks, latencies, tt.peakMin, tt.latencies); got != tt.want {
+			t.Errorf("%s: CountResponders(%v, %v) = %d; want %d", tt.name, tt.peakMin, tt.latencies, got, tt.want)
+		}
+	}
+	// cells without latency only respond if the latency is ignored
+	if got := CountResponders([]float64{2, 2}, []float64{1}, 1, 10); got != 1 {
+		t.Errorf("CountResponders with missing latencies = %d; want 1", got)
+	}
+}
+
+func TestWindowPeaks(t *testing.T) {
+	// a trace with two stimulations that peak at 5 and 3
+	values := []float64{1, 2, 5, 2, 1, 1, 3, math.NaN(), 1}
+	windows, err := ParseWindows("0:4,4:9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := WindowPeaks(values, windows), []float64{5, 3}; !equalFloats(got, want, 0) {
+		t.Errorf("WindowPeaks(%v) = %v; want %v", windows, got, want)
+	}
+	// windows are clipped to the values and empty windows have no peak
+	clipped := [][2]int{{-2, 1}, {8, 20}, {20, 30}, {3, 3}}
+	if got, want := WindowPeaks(values, clipped), []float64{1, 1, math.NaN(), math.NaN()}; !equalFloats(got, want, 0) {
+		t.Errorf("WindowPeaks(%v) = %v; want %v", clipped, got, want)
+	}
+}
+
+func TestZScore(t *testing.T) {
+	nan := math.NaN()
+	tests := []struct {
+		name         string
+		values, want []float64
+	}{
+		{"known", []float64{2, 4, 4, 4, 5, 5, 7, 9}, []float64{-1.5, -0.5, -0.5, -0.5, 0, 0, 1, 2}}, // mean 5, sd 2
+		{"NaN", []float64{1, nan, 3}, []float64{-1, nan, 1}},
+		{"constant", []float64{3, 3, nan, 3}, []float64{0, 0, nan, 0}},
+		{"empty", []float64{}, []float64{}},
+	}
+	for _, tt := range tests {
+		if got := ZScore(tt.values); !equalFloats(got, tt.want, 1e-12) {
+			t.Errorf("%s: ZScore(%v) = %v; want %v", tt.name, tt.values, got, tt.want)
+		}
+	}
+}
+
+func TestClipOutliers(t *testing.T) {
+	nan := math.NaN()
+	// 0 to 9 with a spike and a NaN; the 10th and 90th percentiles are 1 and 9
+	values := []float64{100, 0, 1, 2, nan, 3, 4, 5, 6, 7, 8, 9}
+	want := []float64{9, 1, 1, 2, nan, 3, 4, 5, 6, 7, 8, 9}
+	if got := ClipOutliers(values, 10, 90); !equalFloats(got, want, 1e-12) {
+		t.Errorf("ClipOutliers(10, 90) = %v; want %v", got, want)
+	}
+	if values[0] != 100 {
+		t.Error("ClipOutliers changed its input")
+	}
+	// percentiles between two values are interpolated, and 0:100 keeps everything
+	if got, want := ClipOutliers([]float64{0, 10}, 25, 75), []float64{2.5, 7.5}; !equalFloats(got, want, 1e-12) {
+		t.Errorf("ClipOutliers(25, 75) = %v; want %v", got, want)
+	}
+	if got := ClipOutliers(values, 0, 100); !equalFloats(got, values, 0) {
+		t.Errorf("ClipOutliers(0, 100) = %v; want the unchanged values", got)
+	}
+	if got := ClipOutliers([]float64{nan}, 1, 99); !equalFloats(got, []float64{nan}, 0) {
+		t.Errorf("ClipOutliers of NaN values = %v; want NaN", got)
+	}
+}
+
+func TestSNR(t *testing.T) {
+	nan := math.NaN()
+	// a baseline with mean 2 and standard deviation 1, followed by a peak of 12
+	values := []float64{1, 3, 1, 3, 5, 12, 7}
+	tests := []struct {
+		name                                           string
+		values                                         []float64
+		baselineFrom, baselineTo, windowFrom, windowTo int
+		want                                           float64
+	}{
+		{"known", values, 0, 4, 4, 7, 10},
+		{"NaN in baseline", []float64{1, nan, 3, 12}, 0, 3, 3, 4, 10},
+		{"constant baseline", []float64{2, 2, 2, 5}, 0, 3, 3, 4, math.Inf(1)},
+		{"empty baseline", values, 2, 2, 4, 7, nan},
+		{"window out of bounds", values, 0, 4, 4, 8, nan},
+	}
+	for _, tt := range tests {
+		if got := SNR(tt.values, tt.baselineFrom, tt.baselineTo, tt.windowFrom, tt.windowTo); !AlmostEqual(got, tt.want, 1e-12) {
+			t.Errorf("%s: SNR = %v; want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRanks(t *testing.T) {
+	nan := math.NaN()
+	tests := []struct {
+		values []float64
+		desc   bool
+		want   []int
+	}{
+		// ties keep the order of their indices and NaN values are ranked last in both directions
+		{[]float64{0.5, nan, 2, 0.5, -1}, true, []int{2, 5, 1, 3, 4}},
+		{[]float64{0.5, nan, 2, 0.5, -1}, false, []int{2, 5, 4, 3, 1}},
+		{[]float64{nan, 1, nan}, true, []int{2, 1, 3}},
+		{[]float64{nan, 1, nan}, false, []int{2, 1, 3}},
+		{[]float64{math.Inf(-1), 3, math.Inf(1)}, true, []int{3, 2, 1}},
+		{nil, true, []int{}},
+	}
+	for _, tt := range tests {
+		if got := Ranks(tt.values, tt.desc); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Ranks(%v, %v) = %v; want %v", tt.values, tt.desc, got, tt.want)
+		}
+	}
+}
+
+func TestDownsample(t *testing.T) {
+	values := []float64{0, 1, 2, 3, 4, 5, 6}
+	tests := []struct {
+		factor int
+		want   []float64
+	}{
+		{1, values},
+		{0, values},
+		{2, []float64{0, 2, 4, 6}},
+		{3, []float64{0, 3, 6}},
+		{10, []float64{0}},
+	}
+	for _, tt := range tests {
+		got := Downsample(values, tt.factor)
+		if !equalFloats(got, tt.want, 0) {
+			t.Errorf("Downsample(%d) = %v; want %v", tt.factor, got, tt.want)
+		}
+		if len(got) > 0 {
+			got[0] = -1
+		}
+		if values[0] != 0 {
+			t.Fatalf("changing the result of Downsample(%d) changed its input", tt.factor)
+		}
+	}
+	if got := Downsample(nil, 2); len(got) != 0 {
+		t.Errorf("Downsample(nil) = %v; want no values", got)
+	}
+}
+
+func TestRatioThenCorrect(t *testing.T) {
+	// the example of the documentation, whose backgrounds do not share the ratio of the channels
+	if got := RatioThenCorrect(200, 300, 50, 60); !AlmostEqual(got, -1.0/6, 1e-12) {
+		t.Errorf("RatioThenCorrect(200, 300, 50, 60) = %v; want -0.167", got)
+	}
+	// backgrounds that share the ratio of the channels cancel it out
+	if got := RatioThenCorrect(200, 400, 50, 100); got != 0 {
+		t.Errorf("RatioThenCorrect(200, 400, 50, 100) = %v; want 0", got)
+	}
+	if got := RatioThenCorrect(200, 0, 50, 60); !math.IsInf(got, 1) {
+		t.Errorf("RatioThenCorrect with a zero denominator = %v; want +Inf", got)
+	}
+}
+
+func TestRollingMean(t *testing.T) {
+	nan := math.NaN()
+	tests := []struct {
+		values []float64
+		window int
+		want   []float64
+	}{
+		{[]float64{1, 2, 3, 4, 5}, 3, []float64{1.5, 2, 3, 4, 4.5}},     // truncated at both ends
+		{[]float64{1, 2, 3, 4, 5}, 2, []float64{1.5, 2.5, 3.5, 4.5, 5}}, // even windows reach further ahead
+		{[]float64{1, nan, 3, 5}, 3, []float64{1, nan, 4, 4}},           // NaN values are ignored and kept
+		{[]float64{1, 2, 3}, 1, []float64{1, 2, 3}},
+		{[]float64{1, 2, 3}, 10, []float64{2, 2, 2}},
+		{nil, 3, []float64{}},
+	}
+	for _, tt := range tests {
+		got := RollingMean(tt.values, tt.window)
+		if len(got) != len(tt.want) {
+			t.Errorf("RollingMean(%v, %d) = %v; want %v", tt.values, tt.window, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if !AlmostEqual(got[i], tt.want[i], 1e-12) {
+				t.Errorf("RollingMean(%v, %d) = %v; want %v", tt.values, tt.window, got, tt.want)
+				break
+			}
+		}
+	}
+
+	// the input is not modified
+	values := []float64{1, 2, 3}
+	RollingMean(values, 3)
+	if values[0] != 1 || values[2] != 3 {
+		t.Errorf("RollingMean modified its input to %v", values)
+	}
+}
@@ -0,0 +1,577 @@
+package excelutil
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/360EntSecGroup-Skylar/excelize"
+)
+
+// SheetWriter writes sheets of numeric data with column headers to an output format
+// the data is given row-wise, i.e. data[r][c] belongs to the column with header headers[c]
+type SheetWriter interface {
+	WriteSheet(name string, headers []string, data [][]float64) error
+	Close() error
+}
+
+// NewSheetWriter returns a SheetWriter for the given format ("xlsx", "csv", or "json") that writes with the settings o
+// base is the path of the output file(s) without extension
+func NewSheetWriter(format, base string, o SaveOptions) (SheetWriter, error) {
+	switch format {
+	case "xlsx":
+		return NewXLSXWriter(base+".xlsx", o), nil
+	case "csv":
+		return &CSVWriter{Base: base, Gzip: o.Gzip}, nil
+	case "tsv":
+		return &CSVWriter{Base: base, Comma: '\t', Ext: "tsv", Gzip: o.Gzip}, nil
+	case "json":
+		return &JSONWriter{Path: base + ".json", Gzip: o.Gzip}, nil
+	default:
+		return nil, fmt.Errorf("unknown output format %s", format)
+	}
+}
+
+// XLSXWriter writes every sheet to a sheet of an Excel workbook that is saved to Path with Options on Close
+type XLSXWriter struct {
+	Path    string
+	XLSX    *excelize.File
+	Options SaveOptions
+	count   int
+}
+
+// NewXLSXWriter returns an XLSXWriter that saves to path with the settings o
+func NewXLSXWriter(path string, o SaveOptions) *XLSXWriter {
+	return &XLSXWriter{Path: path, XLSX: excelize.NewFile(), Options: o}
+}
+
+// WriteSheet writes headers and data to a new sheet; NaN values are left blank
+func (w *XLSXWriter) WriteSheet(name string, headers []string, data [][]float64) error {
+	if w.count == 0 {
+		name = ReuseDefaultSheet(w.XLSX, excelize.NewFile(), name)
+	} else {
+		name = UniqueSheetName(w.XLSX, name)
+		_ = w.XLSX.NewSheet(name)
+	}
+	w.count++
+	WriteSheetData(w.XLSX, name, headers, data, w.Options.Inf)
+	return nil
+}
+
+// WriteSheetData writes headers to the first row of an existing sheet and data (given row-wise) below them
+// NaN values are left blank and infinite values are replaced according to inf
+func WriteSheetData(f *excelize.File, sheet string, headers []string, data [][]float64, inf InfPolicy) {
+	for c, h := range headers {
+		f.SetCellValue(sheet, fmt.Sprintf("%s1", GetColumn(c+1)), h)
+	}
+	for r, row := range data {
+		for c, v := range row {
+			if math.IsNaN(v) {
+				continue
+			}
+			f.SetCellValue(sheet, fmt.Sprintf("%s%d", GetColumn(c+1), r+2), inf.CellValue(v))
+		}
+	}
+}
+
+// WriteMatrixNaNAware writes data (given row-wise) to an existing sheet such that data[0][0] ends up at the cell origin
+// (e.g. "B2"); finite values are written as numbers, NaN values are left blank, and infinite values are replaced
+// according to inf like in WriteSheetData
+func WriteMatrixNaNAware(f *excelize.File, sheet string, data [][]float64, origin string, inf InfPolicy) error {
+	col, row, err := ParseCoordinate(origin)
+	if err != nil {
+		return err
+	}
+	for r, values := range data {
+		for c, v := range values {
+			if value := inf.CellValue(v); value != nil {
+				f.SetCellValue(sheet, fmt.Sprintf("%s%d", GetColumn(col+c), row+r), value)
+			}
+		}
+	}
+	return nil
+}
+
+// Close saves the workbook
+func (w *XLSXWriter) Close() error {
+	return SaveXLSX(w.XLSX, w.Path, w.Options)
+}
+
+// CSVWriter writes every sheet to a separate .csv file named <Base>_<sheet name>.csv
+// with Comma set to '\t' and Ext set to "tsv", it writes tab-separated files instead
+type CSVWriter struct {
+	Base  string
+	Comma rune   // field delimiter, defaults to ','
+	Ext   string // file extension without the dot, defaults to "csv"
+	Gzip  bool   // compress the files and append ".gz" to their names (see GzipPath)
+}
+
+// WriteSheet writes headers and data to a new .csv file; NaN values are written as empty fields
+func (w *CSVWriter) WriteSheet(name string, headers []string, data [][]float64) error {
+	ext := w.Ext
+	if ext == "" {
+		ext = "csv"
+	}
+	f, err := createOutput(fmt.Sprintf("%s_%s.%s", w.Base, name, ext), w.Gzip)
+	if err != nil {
+		return err
+	}
+	if err := writeDelimited(f, w.Comma, headers, data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeDelimited writes headers and data as delimited records to out (with ',' as delimiter if comma is 0); NaN values
+// are written as empty fields
+func writeDelimited(out io.Writer, comma rune, headers []string, data [][]float64) error {
+	cw := csv.NewWriter(out)
+	if comma != 0 {
+		cw.Comma = comma
+	}
+	if err := cw.Write(headers); err != nil {
+		return err
+	}
+	for _, row := range data {
+		record := make([]string, len(row))
+		for c, v := range row {
+			if !math.IsNaN(v) {
+				record[c] = strconv.FormatFloat(v, 'g', -1, 64)
+			}
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Close is a no-op because every sheet is written to its own file
+func (w *CSVWriter) Close() error {
+	return nil
+}
+
+// WriteRecords writes records (e.g. a header followed by the rows of a long-format table) to a .csv file at path, which
+// is compressed if compress is set (see GzipPath)
+func WriteRecords(path string, records [][]string, compress bool) error {
+	f, err := createOutput(path, compress)
+	if err != nil {
+		return err
+	}
+	cw := csv.NewWriter(f)
+	if err := cw.WriteAll(records); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadDelimited reads all records of a delimiter-separated file (e.g. comma = '\t' for .tsv files) with the quoting
+// rules of encoding/csv; records may have different numbers of fields
+func ReadDelimited(r io.Reader, comma rune) ([][]string, error) {
+	cr := csv.NewReader(r)
+	cr.Comma = comma
+	cr.FieldsPerRecord = -1
+	return cr.ReadAll()
+}
+
+// WriteThresholdReport writes a response threshold and the number of columns of every sheet that survive it to a
+// .json file at path, which is compressed if compress is set (see GzipPath)
+func WriteThresholdReport(path string, threshold float64, counts []ThresholdCount, compress bool) error {
+	f, err := createOutput(path, compress)
+	if err != nil {
+		return err
+	}
+	report := struct {
+		Threshold float64          `json:"threshold"`
+		Sheets    []ThresholdCount `json:"sheets"`
+	}{threshold, counts}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// JSONWriter collects all sheets and writes them to a single .json file on Close; with Gzip set, the file is
+// compressed and ".gz" is appended to its name (see GzipPath)
+type JSONWriter struct {
+	Path   string
+	Gzip   bool
+	sheets []jsonSheet
+}
+
+// jsonSheet is the JSON representation of a sheet; NaN values are encoded as null
+type jsonSheet struct {
+	Name    string       `json:"name"`
+	Headers []string     `json:"headers"`
+	Data    [][]*float64 `json:"data"`
+}
+
+// WriteSheet adds a sheet to the JSON document
+func (w *JSONWriter) WriteSheet(name string, headers []string, data [][]float64) error {
+	sheet := jsonSheet{Name: name, Headers: headers, Data: make([][]*float64, len(data))}
+	for r, row := range data {
+		sheet.Data[r] = make([]*float64, len(row))
+		for c := range row {
+			if !math.IsNaN(row[c]) && !math.IsInf(row[c], 0) {
+				v := row[c]
+				sheet.Data[r][c] = &v
+			}
+		}
+	}
+	w.sheets = append(w.sheets, sheet)
+	return nil
+}
+
+// Close writes all sheets to the .json file
+func (w *JSONWriter) Close() error {
+	f, err := createOutput(w.Path, w.Gzip)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(map[string][]jsonSheet{"sheets": w.sheets}); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// SheetData splits the rows of a sheet into the header row and the numeric data below it
+// cells that cannot be parsed and missing cells of ragged rows are returned as NaN
+func SheetData(rows [][]string) ([]string, [][]float64) {
+	if len(rows) == 0 {
+		return []string{}, [][]float64{}
+	}
+	headers := rows[0]
+	data := make([][]float64, len(rows)-1)
+	for r := 1; r < len(rows); r++ {
+		data[r-1] = make([]float64, len(headers))
+		for c := range headers {
+			data[r-1][c] = math.NaN()
+			if c < len(rows[r]) {
+				if v, err := strconv.ParseFloat(rows[r][c], 64); err == nil {
+					data[r-1][c] = v
+				}
+			}
+		}
+	}
+	return headers, data
+}
+
+// WriteWorkbook writes the given sheets of a workbook to a SheetWriter and closes it
+func WriteWorkbook(w SheetWriter, f *excelize.File, sheets []string) error {
+	for _, sheet := range sheets {
+		headers, data := SheetData(f.GetRows(sheet))
+		if err := w.WriteSheet(sheet, headers, data); err != nil {
+			return fmt.Errorf("error while writing sheet %s: %s", sheet, err)
+		}
+	}
+	return w.Close()
+}
+
+// OutputPath returns a description of the path(s) that SaveWorkbook writes for a format and a base path (with ".gz"
+// appended to text files if compress is set, see SaveOptions.Gzip)
+func OutputPath(format, base string, compress bool) string {
+	if format == "csv" || format == "tsv" {
+		return GzipPath(base+"_<sheet>."+format, compress)
+	}
+	if format == "json" {
+		return GzipPath(base+".json", compress)
+	}
+	return base + "." + format
+}
+
+// OutputPaths returns the paths that SaveWorkbook writes for a format, a base path, and the sheets to write (one file
+// per sheet for .csv and .tsv files, see OutputPath for compress)
+func OutputPaths(format, base string, sheets []string, compress bool) []string {
+	if format != "csv" && format != "tsv" {
+		return []string{OutputPath(format, base, compress)}
+	}
+	paths := make([]string, 0, len(sheets))
+	for _, sheet := range sheets {
+		paths = append(paths, GzipPath(fmt.Sprintf("%s_%s.%s", base, sheet, format), compress))
+	}
+	return paths
+}
+
+// ListOutputs writes every path to w (one per line) and marks the paths that already exist (and would be overwritten)
+// and the paths that are listed more than once (and would overwrite each other)
+func ListOutputs(w io.Writer, paths []string) {
+	seen := make(map[string]int)
+	for _, path := range paths {
+		seen[path]++
+	}
+	for _, path := range paths {
+		notes := make([]string, 0)
+		if _, err := os.Stat(path); err == nil {
+			notes = append(notes, "exists, will be overwritten")
+		}
+		if seen[path] > 1 {
+			notes = append(notes, "collides with another output")
+		}
+		if len(notes) > 0 {
+			fmt.Fprintf(w, "%s (%s)\n", path, strings.Join(notes, ", "))
+		} else {
+			fmt.Fprintln(w, path)
+		}
+	}
+}
+
+// SaveOptions are the settings with which SaveTo, SaveXLSX, SaveWorkbook, and the SheetWriters write files (see
+// Options.SaveOptions for the settings of the flags and DefaultSaveOptions for the settings of excelize)
+type SaveOptions struct {
+	// CompressionLevel is the deflate level (see compress/flate) of .xlsx files: higher levels produce smaller files but
+	// take longer to save, flate.NoCompression (the zero value) stores all parts uncompressed (fastest, but files are
+	// several times larger), and flate.DefaultCompression keeps the behavior of excelize
+	CompressionLevel int
+	// Inf is how the .xlsx outputs write infinite values (see InfPolicy)
+	Inf InfPolicy
+	// Gzip compresses the .csv, .tsv, and .json files of the SheetWriters (but not the .xlsx files, which are zip
+	// archives already) and appends ".gz" to their names (see GzipPath)
+	Gzip bool
+}
+
+// DefaultSaveOptions returns the settings with which excelize itself would write files
+func DefaultSaveOptions() SaveOptions {
+	return SaveOptions{CompressionLevel: flate.DefaultCompression}
+}
+
+// GzipPath returns the name under which a file is written, i.e. path with ".gz" appended if compress is set and path is
+// a .csv, .tsv, or .json file
+func GzipPath(path string, compress bool) string {
+	switch filepath.Ext(path) {
+	case ".csv", ".tsv", ".json":
+		if compress {
+			return path + ".gz"
+		}
+	}
+	return path
+}
+
+// gzipFile is a gzip.Writer whose Close also closes the underlying file
+type gzipFile struct {
+	*gzip.Writer
+	f *os.File
+}
+
+func (g *gzipFile) Close() error {
+	if err := g.Writer.Close(); err != nil {
+		g.f.Close()
+		return err
+	}
+	return g.f.Close()
+}
+
+// createOutput creates a .csv, .tsv, or .json file at GzipPath(path, compress) and wraps it in a gzip.Writer if
+// compress is set
+func createOutput(path string, compress bool) (io.WriteCloser, error) {
+	f, err := os.Create(GzipPath(path, compress))
+	if err != nil {
+		return nil, err
+	}
+	if !compress {
+		return f, nil
+	}
+	return &gzipFile{Writer: gzip.NewWriter(f), f: f}, nil
+}
+
+// SaveTo writes a workbook as .xlsx with the settings o to w (e.g. to stream it back as HTTP response) instead of
+// saving it to a file; the process subcommands of both programs only save their outputs to files, so callers have to
+// build the workbook themselves (e.g. with ReadSheet and WriteSheetData)
+// the parts of the archive are written in the order of their names, so that identical workbooks yield identical files
+func SaveTo(f *excelize.File, w io.Writer, o SaveOptions) error {
+	// excelize has no save options and writes the parts in the (random) order of a map, so the archive it writes is
+	// re-compressed with o.CompressionLevel and sorted
+	buf := new(bytes.Buffer)
+	if err := f.Write(buf); err != nil {
+		return err
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		return err
+	}
+	parts := append([]*zip.File{}, zr.File...)
+	sort.Slice(parts, func(i, j int) bool { return parts[i].Name < parts[j].Name })
+	zw := zip.NewWriter(w)
+	zw.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+		return flate.NewWriter(out, o.CompressionLevel)
+	})
+	for _, part := range parts {
+		header := &zip.FileHeader{Name: part.Name, Method: zip.Deflate}
+		if o.CompressionLevel == flate.NoCompression {
+			header.Method = zip.Store
+		}
+		dst, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		src, err := part.Open()
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(dst, src)
+		src.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// SaveXLSX saves a workbook to the .xlsx file at path with the settings o
+func SaveXLSX(f *excelize.File, path string, o SaveOptions) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := SaveTo(f, out, o); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// SaveWorkbook saves the given sheets of a workbook in the given format with the settings o to base plus the format's
+// extension; .xlsx files are saved directly (which preserves charts and styles), all other formats are written with a
+// SheetWriter
+func SaveWorkbook(f *excelize.File, sheets []string, format, base string, o SaveOptions) error {
+	if format == "xlsx" {
+		return SaveXLSX(f, base+".xlsx", o)
+	}
+	w, err := NewSheetWriter(format, base, o)
+	if err != nil {
+		return err
+	}
+	return WriteWorkbook(w, f, sheets)
+}
+
+// InfPolicy is how CellValue replaces infinite values (which excelize writes as "+Inf" and "-Inf", i.e. in a way that Excel
+// cannot display): "text" (or the zero value) writes the strings "Inf" and "-Inf", "blank" leaves the cells empty, and a
+// number replaces them by that number (and by its negation for -Inf); see ParseInfPolicy
+type InfPolicy string
+
+// ParseInfPolicy validates a policy ("text", "blank", or a number)
+func ParseInfPolicy(policy string) (InfPolicy, error) {
+	if policy == "text" || policy == "blank" {
+		return InfPolicy(policy), nil
+	}
+	if v, err := strconv.ParseFloat(policy, 64); err != nil || math.IsInf(v, 0) || math.IsNaN(v) {
+		return "", fmt.Errorf("unknown policy %s (must be 'text', 'blank', or a finite number)", policy)
+	}
+	return InfPolicy(policy), nil
+}
+
+// CellValue returns the value that is written to a cell for v, i.e. v itself or, if v is infinite, its replacement
+// according to p (which is why every computed number is written through CellValue); NaN values (e.g. the empty
+// cells of --empty=nan) are written as empty cells
+func (p InfPolicy) CellValue(v float64) interface{} {
+	if math.IsNaN(v) {
+		return nil
+	}
+	if !math.IsInf(v, 0) {
+		return v
+	}
+	switch p {
+	case "", "text":
+		if v < 0 {
+			return "-Inf"
+		}
+		return "Inf"
+	case "blank":
+		return nil
+	}
+	r, _ := strconv.ParseFloat(string(p), 64)
+	if v < 0 {
+		r = -r
+	}
+	return r
+}
+
+// SplitByColumn writes every data column of a sheet to its own .xlsx file in outDir, next to the time column
+// files are named <sheet>_<header>.xlsx (with characters that are not allowed in file names replaced by underscores)
+// and times[r] belongs to data[r]; the files are saved with the settings o
+func SplitByColumn(sheet string, headers []string, data [][]float64, times []float64, outDir string, o SaveOptions) error {
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return err
+	}
+	for c, h := range headers {
+		column := make([][]float64, len(data))
+		for r := range data {
+			t := math.NaN()
+			if r < len(times) {
+				t = times[r]
+			}
+			column[r] = []float64{t, data[r][c]}
+		}
+		w := NewXLSXWriter(SplitColumnPath(outDir, sheet, h), o)
+		if err := w.WriteSheet(sheet, []string{"Time", h}, column); err != nil {
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return fmt.Errorf("error while writing column %s: %s", h, err)
+		}
+	}
+	return nil
+}
+
+// SplitColumnPath returns the path of the file that SplitByColumn writes for the column with header h of sheet to outDir
+func SplitColumnPath(outDir, sheet, h string) string {
+	return filepath.Join(outDir, safeFileName(fmt.Sprintf("%s_%s.xlsx", sheet, h)))
+}
+
+// SplitColumnPattern returns a description of the paths of the files that SplitByColumn writes for sheet to outDir
+// (with "<column>" in place of the header of every column, which are only known once the sheet is processed)
+func SplitColumnPattern(outDir, sheet string) string {
+	return filepath.Join(outDir, safeFileName(sheet)+"_<column>.xlsx")
+}
+
+// safeFileName replaces the characters of name that are not allowed in file names by underscores
+func safeFileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`:\/?*[]<>|"`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// DebugDumpPath returns the path of the file that DebugDump writes for the data of a sheet after a stage to dir
+func DebugDumpPath(dir, sheet, stage string) string {
+	return filepath.Join(dir, fmt.Sprintf("%s_%s.csv", safeFileName(sheet), safeFileName(stage)))
+}
+
+// DebugDump writes the intermediate data of a sheet after a stage of the pipeline (e.g. "transform") to the file
+// <sheet>_<stage>.csv in dir (see DebugDumpPath), e.g. to check the matrix that the ratios were computed from; NaN
+// values are written as empty fields and the file is never compressed (see SaveOptions.Gzip)
+func DebugDump(dir, sheet, stage string, headers []string, data [][]float64) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(DebugDumpPath(dir, sheet, stage))
+	if err != nil {
+		return err
+	}
+	if err := writeDelimited(f, 0, headers, data); err != nil {
+		f.Close()
+		return fmt.Errorf("error while dumping stage %s of sheet %s: %s", stage, sheet, err)
+	}
+	return f.Close()
+}
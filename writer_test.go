@@ -0,0 +1,433 @@
+package excelutil
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/360EntSecGroup-Skylar/excelize"
+)
+
+func TestCellValue(t *testing.T) {
+	tests := []struct {
+		policy InfPolicy
+		v      float64
+		want   interface{}
+	}{
+		{"text", 1.5, 1.5},
+		{"text", math.Inf(1), "Inf"},
+		{"text", math.Inf(-1), "-Inf"},
+		{"blank", math.Inf(1), nil},
+		{"blank", 2, 2.0},
+		{"1e9", math.Inf(1), 1e9},
+		{"1e9", math.Inf(-1), -1e9},
+		{"text", math.NaN(), nil},
+		{"", math.Inf(1), "Inf"}, // the zero value writes text
+	}
+	for _, tt := range tests {
+		if got := tt.policy.CellValue(tt.v); got != tt.want {
+			t.Errorf("CellValue(%v) with policy %s = %#v; want %#v", tt.v, tt.policy, got, tt.want)
+		}
+	}
+}
+
+func TestTransposeSheetWideInf(t *testing.T) {
+	f := excelize.NewFile()
+
+	// 300 rows become 300 columns, which is beyond the columns that GetColumn can name
+	for r := 1; r <= 300; r++ {
+		f.SetCellValue("Sheet1", fmt.Sprintf("A%d", r), InfPolicy("text").CellValue(math.Inf(1)))
+		f.SetCellValue("Sheet1", fmt.Sprintf("B%d", r), float64(r))
+	}
+	TransposeSheet(f, "Sheet1")
+	rows := f.GetRows("Sheet1")
+	if len(rows) != 2 || len(rows[0]) != 300 {
+		t.Fatalf("transposed sheet has %d rows; want 2 rows of 300 cells", len(rows))
+	}
+	if rows[0][299] != "Inf" || rows[1][299] != "300" {
+		t.Errorf("last column = %q, %q; want \"Inf\", \"300\"", rows[0][299], rows[1][299])
+	}
+}
+
+func TestSaveToKeepsWorkbook(t *testing.T) {
+	f := excelize.NewFile()
+	f.SetCellValue("Sheet1", "A1", math.Inf(1))
+	if err := SaveTo(f, new(bytes.Buffer), DefaultSaveOptions()); err != nil {
+		t.Fatal(err)
+	}
+	if got := f.GetCellValue("Sheet1", "A1"); got != "+Inf" {
+		t.Errorf("A1 = %q after SaveTo; want the unchanged value \"+Inf\"", got)
+	}
+}
+
+func TestSheetWriters(t *testing.T) {
+	dir, err := ioutil.TempDir("", "excelutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	f := excelize.NewFile()
+	f.SetSheetName("Sheet1", "Plate1")
+	f.NewSheet("Plate2")
+	for _, sheet := range []string{"Plate1", "Plate2"} {
+		f.SetSheetRow(sheet, "A1", &[]interface{}{"Time (sec)", "cell 1"})
+		f.SetSheetRow(sheet, "A2", &[]interface{}{2.0, 0.5})
+		f.SetSheetRow(sheet, "A3", &[]interface{}{4.0}) // the missing cell is written as NaN
+	}
+	base := filepath.Join(dir, "ratios")
+	for _, format := range []string{"xlsx", "csv", "tsv", "json"} {
+		w, err := NewSheetWriter(format, base, DefaultSaveOptions())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := WriteWorkbook(w, f, []string{"Plate1", "Plate2"}); err != nil {
+			t.Fatalf("cannot write %s: %s", format, err)
+		}
+	}
+	if _, err := NewSheetWriter("pdf", base, DefaultSaveOptions()); err == nil {
+		t.Error("NewSheetWriter(\"pdf\") = nil error; want an error")
+	}
+
+	xlsx, err := excelize.OpenFile(base + ".xlsx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := xlsx.GetRows("Plate2"); !reflect.DeepEqual(got, [][]string{{"Time (sec)", "cell 1"}, {"2", "0.5"}, {"4", ""}}) {
+		t.Errorf("sheet Plate2 of the .xlsx file = %q", got)
+	}
+	for path, want := range map[string]string{
+		base + "_Plate1.csv": "Time (sec),cell 1\n2,0.5\n4,\n",
+		base + "_Plate2.tsv": "Time (sec)\tcell 1\n2\t0.5\n4\t\n",
+	} {
+		if b, err := ioutil.ReadFile(path); err != nil || string(b) != want {
+			t.Errorf("%s = %q, %v; want %q", filepath.Base(path), b, err, want)
+		}
+	}
+	b, err := ioutil.ReadFile(base + ".json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Sheets []struct {
+			Name    string
+			Headers []string
+			Data    [][]*float64
+		}
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatalf("cannot parse .json file: %s\n%s", err, b)
+	}
+	if len(doc.Sheets) != 2 || doc.Sheets[1].Name != "Plate2" || doc.Sheets[1].Data[1][1] != nil || *doc.Sheets[1].Data[0][1] != 0.5 {
+		t.Errorf(".json file = %s; want both sheets with null for the missing cell", b)
+	}
+}
+
+func TestSplitByColumn(t *testing.T) {
+	dir, err := ioutil.TempDir("", "excelutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	headers := []string{"cell 1", "cell 2", "a/b"}
+	data := [][]float64{{1, 2, 3}, {4, 5, 6}}
+	out := filepath.Join(dir, "split")
+	if err := SplitByColumn("Plate1", headers, data, []float64{2}, out, DefaultSaveOptions()); err != nil {
+		t.Fatal(err)
+	}
+	files, err := ioutil.ReadDir(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != len(headers) {
+		t.Fatalf("SplitByColumn wrote %d files; want one per column (%d)", len(files), len(headers))
+	}
+
+	for _, h := range headers {
+		if _, err := os.Stat(SplitColumnPath(out, "Plate1", h)); err != nil {
+			t.Errorf("file of column %s is not at SplitColumnPath: %s", h, err)
+		}
+	}
+	if got, want := SplitColumnPattern(out, "a/b"), filepath.Join(out, "a_b_<column>.xlsx"); got != want {
+		t.Errorf("SplitColumnPattern = %q; want %q", got, want)
+	}
+
+	// the time of the second row is missing and left empty
+	f, err := excelize.OpenFile(filepath.Join(out, "Plate1_a_b.xlsx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := f.GetRows("Plate1"); !reflect.DeepEqual(got, [][]string{{"Time", "a/b"}, {"2", "3"}, {"", "6"}}) {
+		t.Errorf("file of column a/b = %q", got)
+	}
+}
+
+func TestWriteThresholdReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "excelutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "threshold_report.json")
+	counts := []ThresholdCount{{"Plate1", 3, 4}, {"Plate2", 0, 4}}
+	if err := WriteThresholdReport(path, 1.2, counts, false); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report struct {
+		Threshold float64
+		Sheets    []ThresholdCount
+	}
+	if err := json.Unmarshal(b, &report); err != nil {
+		t.Fatalf("cannot parse report: %s\n%s", err, b)
+	}
+	if report.Threshold != 1.2 || !reflect.DeepEqual(report.Sheets, counts) {
+		t.Errorf("report = %+v; want threshold 1.2 and %+v", report, counts)
+	}
+	if got := counts[0].String(); got != "Plate1: kept 3 of 4 columns" {
+		t.Errorf("String() = %q", got)
+	}
+}
+
+func TestTSVRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "excelutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// fields with tabs and quotes are quoted like encoding/csv does
+	w := &CSVWriter{Base: filepath.Join(dir, "ratios"), Comma: '\t', Ext: "tsv"}
+	if err := w.WriteSheet("Plate1", []string{"Time (sec)", "cell\t1", `"cell 2"`}, [][]float64{{2, 0.5, math.NaN()}}); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "ratios_Plate1.tsv")
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Time (sec)\t\"cell\t1\"\t\"\"\"cell 2\"\"\"\n2\t0.5\t\n"; string(b) != want {
+		t.Errorf("ratios_Plate1.tsv = %q; want %q", b, want)
+	}
+
+	var wb ExcelWorkbook
+	wb.Open(path)
+	want := [][]string{{"Time (sec)", "cell\t1", `"cell 2"`}, {"2", "0.5", ""}}
+	if got := wb.XLSX.GetRows("ratios_Plate1"); !reflect.DeepEqual(got, want) {
+		t.Errorf("rows of the .tsv file = %q; want %q", got, want)
+	}
+	if _, err := ReadDelimited(bytes.NewBufferString("a\t\"b\n"), '\t'); err == nil {
+		t.Error("ReadDelimited of an unterminated quote = nil error; want an error")
+	}
+}
+
+func TestSaveTo(t *testing.T) {
+	f := excelize.NewFile()
+	f.NewSheet("Plate1")
+	f.SetSheetRow("Plate1", "A1", &[]interface{}{"Time (sec)", "cell 1"})
+	f.SetSheetRow("Plate1", "A2", &[]interface{}{2.0, 0.5})
+
+	// the bytes are a complete workbook, and saving the same workbook twice yields the same bytes
+	var first, second bytes.Buffer
+	if err := SaveTo(f, &first, DefaultSaveOptions()); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveTo(f, &second, DefaultSaveOptions()); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first.Bytes(), second.Bytes()) {
+		t.Error("SaveTo wrote different bytes for the same workbook")
+	}
+	wb, err := OpenReader(&first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := wb.XLSX.GetRows("Plate1"); !reflect.DeepEqual(got, [][]string{{"Time (sec)", "cell 1"}, {"2", "0.5"}}) {
+		t.Errorf("reopened sheet Plate1 = %q", got)
+	}
+}
+
+func TestCompressionLevel(t *testing.T) {
+	f := excelize.NewFile()
+	for r := 1; r <= 200; r++ {
+		f.SetSheetRow("Sheet1", fmt.Sprintf("A%d", r), &[]interface{}{float64(r), float64(r) / 3, float64(r) * 1.5})
+	}
+
+	// higher levels write smaller files, and all of them can be read again
+	sizes := make(map[int]int)
+	for _, level := range []int{flate.NoCompression, flate.BestSpeed, flate.BestCompression} {
+		var buf bytes.Buffer
+		if err := SaveTo(f, &buf, SaveOptions{CompressionLevel: level}); err != nil {
+			t.Fatal(err)
+		}
+		sizes[level] = buf.Len()
+		wb, err := OpenReader(&buf)
+		if err != nil {
+			t.Fatalf("cannot read the file of level %d: %s", level, err)
+		}
+		if got := wb.XLSX.GetCellValue("Sheet1", "C200"); got != "300" {
+			t.Errorf("C200 of level %d = %q; want 300", level, got)
+		}
+	}
+	if !(sizes[flate.NoCompression] > sizes[flate.BestSpeed] && sizes[flate.BestSpeed] >= sizes[flate.BestCompression]) {
+		t.Errorf("file sizes by level = %v; want decreasing sizes", sizes)
+	}
+}
+
+func TestWriteMatrixNaNAware(t *testing.T) {
+	data := [][]float64{
+		{1, math.NaN(), 0.5},
+		{math.Inf(1), -2, math.Inf(-1)},
+	}
+
+	// infinite values are written according to the policy like in WriteSheetData
+	for policy, inf := range map[InfPolicy][]string{"text": {"Inf", "-Inf"}, "blank": {"", ""}, "1e6": {"1000000", "-1000000"}} {
+		f := excelize.NewFile()
+		if err := WriteMatrixNaNAware(f, "Sheet1", data, "B2", policy); err != nil {
+			t.Fatal(err)
+		}
+		want := [][]string{
+			{"", "", "", ""},
+			{"", "1", "", "0.5"},
+			{"", inf[0], "-2", inf[1]},
+		}
+		if got := f.GetRows("Sheet1"); !reflect.DeepEqual(got, want) {
+			t.Errorf("WriteMatrixNaNAware with policy %s wrote %q; want %q", policy, got, want)
+		}
+	}
+	if err := WriteMatrixNaNAware(excelize.NewFile(), "Sheet1", data, "2B", "text"); err == nil {
+		t.Error("WriteMatrixNaNAware with an invalid origin = nil error; want an error")
+	}
+}
+
+func TestOutputPaths(t *testing.T) {
+	sheets := []string{"Plate1", "Plate2"}
+	tests := []struct {
+		format string
+		gzip   bool
+		want   []string
+	}{
+		{"xlsx", false, []string{"out/ratios.xlsx"}},
+		{"json", false, []string{"out/ratios.json"}},
+		{"csv", false, []string{"out/ratios_Plate1.csv", "out/ratios_Plate2.csv"}},
+		{"tsv", false, []string{"out/ratios_Plate1.tsv", "out/ratios_Plate2.tsv"}},
+		{"xlsx", true, []string{"out/ratios.xlsx"}},
+		{"json", true, []string{"out/ratios.json.gz"}},
+		{"tsv", true, []string{"out/ratios_Plate1.tsv.gz", "out/ratios_Plate2.tsv.gz"}},
+	}
+	for _, tt := range tests {
+		if got := OutputPaths(tt.format, "out/ratios", sheets, tt.gzip); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("OutputPaths(%s, gzip %v) = %q; want %q", tt.format, tt.gzip, got, tt.want)
+		}
+	}
+}
+
+func TestListOutputs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "excelutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	existing := filepath.Join(dir, "ratios.xlsx")
+	if err := ioutil.WriteFile(existing, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	planned, twice := filepath.Join(dir, "sorted_ratios.xlsx"), filepath.Join(dir, "peaks.csv")
+
+	var buf bytes.Buffer
+	ListOutputs(&buf, []string{existing, planned, twice, twice})
+	want := existing + " (exists, will be overwritten)\n" + planned + "\n" +
+		twice + " (collides with another output)\n" + twice + " (collides with another output)\n"
+	if buf.String() != want {
+		t.Errorf("ListOutputs wrote %q; want %q", buf.String(), want)
+	}
+}
+
+func TestGzip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "excelutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		path string
+		gzip bool
+		want string
+	}{
+		{"order.csv", true, "order.csv.gz"},
+		{"ratios_Plate1.tsv", true, "ratios_Plate1.tsv.gz"},
+		{"report.json", true, "report.json.gz"},
+		{"ratios.xlsx", true, "ratios.xlsx"}, // .xlsx files are zip archives already
+		{"order.csv", false, "order.csv"},
+	}
+	for _, tt := range tests {
+		if got := GzipPath(tt.path, tt.gzip); got != tt.want {
+			t.Errorf("GzipPath(%s) with gzip %v = %s; want %s", tt.path, tt.gzip, got, tt.want)
+		}
+	}
+
+	// the written file is compressed and the plain file is not written
+	path := filepath.Join(dir, "order.csv")
+	records := [][]string{{"sheet", "rank"}, {"Plate1", "1"}}
+	if err := WriteRecords(path, records, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("WriteRecords with gzip wrote the plain file %s", path)
+	}
+	f, err := os.Open(path + ".gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("%s.gz is no gzip file: %s", path, err)
+	}
+	b, err := ioutil.ReadAll(zr)
+	if want := "sheet,rank\nPlate1,1\n"; err != nil || string(b) != want {
+		t.Errorf("decompressed %s.gz = %q, %v; want %q", path, b, err, want)
+	}
+}
+
+func TestDebugDump(t *testing.T) {
+	dir, err := ioutil.TempDir("", "excelutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the directory is created and the sheet name is made safe for a file name
+	dump := filepath.Join(dir, "dump", "run1")
+	if err := DebugDump(dump, "Plate 1/2", "ratio", []string{"cell 1", "cell 2"}, [][]float64{{0.5, math.NaN()}, {0.75, 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := DebugDumpPath(dump, "Plate 1/2", "ratio"), filepath.Join(dump, "Plate 1_2_ratio.csv"); got != want {
+		t.Errorf("DebugDumpPath = %q; want %q", got, want)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dump, "Plate 1_2_ratio.csv"))
+	if want := "cell 1,cell 2\n0.5,\n0.75,1\n"; err != nil || string(b) != want {
+		t.Errorf("dump = %q, %v; want %q", b, err, want)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "file"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := DebugDump(filepath.Join(dir, "file"), "Plate1", "ratio", nil, nil); err == nil {
+		t.Error("DebugDump to a file instead of a directory = nil error; want an error")
+	}
+}